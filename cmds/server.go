@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	log "github.com/duglin/dlog"
 	"github.com/duglin/xreg-github/registry"
@@ -17,6 +19,18 @@ var Verbose = 2
 var doDelete *bool
 var doRecreate *bool
 var doVerify *bool
+var dbDriver *string
+var inMemory *bool
+var webhooks = []string{}
+var authFile *string
+var readOnly *bool
+var mirrorURL *string
+var mirrorInterval *time.Duration
+var blobStoreSpec *string
+var importCatalog *string
+var importCache *string
+var importCacheTTL *time.Duration
+var offline *bool
 var firstTimeDB = true
 
 func InitDB() {
@@ -86,11 +100,60 @@ func main() {
 	doDelete = flag.Bool("delete", false, "Delete DB and exit")
 	doRecreate = flag.Bool("recreate", false, "Recreate DB, then run")
 	doVerify = flag.Bool("verify", false, "Exit after loading - for testing")
+	dbDriver = flag.String("db", registry.DBDRIVER,
+		"DB driver to use: "+strings.Join(registry.SortedKeys(registry.DBDrivers), ","))
+	inMemory = flag.Bool("inmemory", false,
+		"Use an in-memory DB, nothing is persisted (same as --db=memory)")
+	flag.Func("webhook", "URL to send change events to (can be repeated)",
+		func(url string) error {
+			webhooks = append(webhooks, url)
+			return nil
+		})
+	authFile = flag.String("auth", "",
+		"Authentication/authorization config file, if not set then anyone "+
+			"can do anything")
+	readOnly = flag.Bool("readonly", false, "Reject all writes via HTTP")
+	mirrorURL = flag.String("mirror", "",
+		"URL of an xRegistry to mirror, its model replaces the local one")
+	mirrorInterval = flag.Duration("mirror-interval", 5*time.Minute,
+		"How often to sync from the --mirror xRegistry")
+	blobStoreSpec = flag.String("blobstore", "",
+		"Where to store Resource documents (a dir, file://DIR or "+
+			"s3://BUCKET/PREFIX?endpoint=URL), if not set then the DB")
+	importCatalog = flag.String("import-catalog", "",
+		"Dir or archive w/local copies of the URLs that models $import")
+	importCache = flag.String("import-cache", "",
+		"Dir to cache the URLs that models $import in")
+	importCacheTTL = flag.Duration("import-cache-ttl",
+		registry.GetImportCacheTTL(),
+		"How long cached $import URLs are used before they're fetched "+
+			"again (0 = forever)")
+	offline = flag.Bool("offline", false,
+		"Don't fetch $import URLs that aren't in the catalog or cache")
 	flag.IntVar(&Verbose, "v", Verbose, "Verbose level")
 	flag.Parse()
 
 	log.SetVerbose(Verbose)
 
+	if *inMemory {
+		*dbDriver = "memory"
+	}
+	if err := registry.SetDBDriver(*dbDriver); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if err := registry.SetBlobStoreSpec(*blobStoreSpec); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	err := registry.ConfigureImports(*importCatalog, *importCache, *offline)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	registry.SetImportCacheTTL(*importCacheTTL)
+
 	if tmp := os.Getenv("PORT"); tmp != "" {
 		tmpInt, _ := strconv.Atoi(tmp)
 		if tmpInt != 0 {
@@ -102,5 +165,35 @@ func main() {
 	// registry.DB_InitFunc = InitDB
 	InitDB()
 
-	registry.NewServer(Port).Serve()
+	// Add these after loading the samples so they don't get flooded
+	for _, url := range webhooks {
+		registry.AddWebhook(url)
+	}
+
+	if *mirrorURL != "" {
+		tx, err := registry.NewTx()
+		if err == nil {
+			reg := registry.GetDefaultReg(tx)
+			if err = reg.SetMirror(*mirrorURL); err == nil {
+				err = tx.Commit()
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		registry.StartMirror(registry.DefaultRegDbSID, *mirrorInterval)
+	}
+
+	server := registry.NewServer(Port)
+	if *authFile != "" {
+		auth, err := registry.LoadAuthFile(*authFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(1)
+		}
+		server.Auth = auth
+	}
+	server.ReadOnly = *readOnly
+	server.Serve()
 }
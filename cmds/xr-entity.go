@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	// log "github.com/duglin/dlog"
+	"github.com/duglin/xreg-github/registry"
+	"github.com/spf13/cobra"
+)
+
+// The Group, Resource and Version commands all work the same way, the only
+// difference is how many segments the PATH argument must have
+var entityLevels = []struct {
+	Name  string
+	Title string
+	Path  string
+	Parts int
+}{
+	{"group", "Group", "GROUPS/gID", 2},
+	{"resource", "Resource", "GROUPS/gID/RESOURCES/rID", 4},
+	{"version", "Version", "GROUPS/gID/RESOURCES/rID/versions/vID", 6},
+}
+
+func addGroupCmd(parent *cobra.Command) {
+	addEntityCmd(parent, 0)
+}
+
+func addResourceCmd(parent *cobra.Command) {
+	addEntityCmd(parent, 1)
+}
+
+func addVersionCmd(parent *cobra.Command) {
+	addEntityCmd(parent, 2)
+}
+
+func addEntityCmd(parent *cobra.Command, level int) {
+	name := entityLevels[level].Name
+	path := entityLevels[level].Path
+	title := entityLevels[level].Title
+
+	entityCmd := &cobra.Command{
+		Use:     name,
+		Short:   name + " commands",
+		Aliases: []string{name + "s"},
+	}
+
+	getCmd := &cobra.Command{
+		Use:   "get " + path,
+		Short: "Retrieve a " + title,
+		Run:   func(cmd *cobra.Command, args []string) { entityGet(cmd, args, level) },
+	}
+	if level > 0 {
+		getCmd.Flags().BoolP("content", "c", false,
+			"Show the document instead of the metadata")
+	}
+	entityCmd.AddCommand(getCmd)
+
+	for _, verb := range []struct {
+		Name    string
+		Short   string
+		Aliases []string
+	}{
+		{"create", "Create a new " + title + ", it must not already exist",
+			[]string{"add"}},
+		{"update", "Replace an existing " + title, nil},
+		{"patch", "Update just the specified attributes of a " + title, nil},
+	} {
+		verb := verb
+		verbCmd := &cobra.Command{
+			Use:     verb.Name + " " + path + " [ NAME=VALUE | NAME:=JSON | NAME- ...]",
+			Short:   verb.Short,
+			Aliases: verb.Aliases,
+			Run: func(cmd *cobra.Command, args []string) {
+				entityWrite(cmd, args, level, verb.Name)
+			},
+		}
+		verbCmd.Flags().StringP("data", "d", "",
+			"JSON body: the JSON itself, @FILE or - for stdin")
+		if level > 0 && verb.Name != "patch" {
+			verbCmd.Flags().StringP("file", "f", "",
+				"Document content: FILE or - for stdin")
+		}
+		entityCmd.AddCommand(verbCmd)
+	}
+
+	deleteCmd := &cobra.Command{
+		Use:   "delete " + path,
+		Short: "Delete a " + title,
+		Run:   func(cmd *cobra.Command, args []string) { entityDelete(cmd, args, level) },
+	}
+	entityCmd.AddCommand(deleteCmd)
+
+	parent.AddCommand(entityCmd)
+}
+
+// Verify the PATH arg and return its cleaned up version along with whether
+// the Resource type has a document
+func entityPath(args []string, level int) (string, bool) {
+	if len(args) == 0 {
+		Error("Missing the %s PATH (%s)", entityLevels[level].Name,
+			entityLevels[level].Path)
+	}
+
+	path := strings.Trim(args[0], "/")
+	path = strings.TrimSuffix(path, "$meta")
+	parts := strings.Split(path, "/")
+	if len(parts) != entityLevels[level].Parts || strings.Contains(path, "//") {
+		Error("Invalid %s PATH %q, must be of the form: %s",
+			entityLevels[level].Name, args[0], entityLevels[level].Path)
+	}
+	if level == 2 && parts[4] != "versions" {
+		Error("Invalid version PATH %q, must be of the form: %s", args[0],
+			entityLevels[level].Path)
+	}
+
+	if level == 0 {
+		return path, false
+	}
+
+	model, _ := getModel()
+	gm := model.Groups[parts[0]]
+	if gm == nil {
+		ExitError(EXIT_NOT_FOUND, "Unknown Group type: %s", parts[0])
+	}
+	rm := gm.Resources[parts[2]]
+	if rm == nil {
+		ExitError(EXIT_NOT_FOUND, "Unknown Resource type: %s", parts[2])
+	}
+	return path, rm.GetHasDocument()
+}
+
+func entityGet(cmd *cobra.Command, args []string, level int) {
+	if len(args) > 1 {
+		Error("Too many arguments - just the PATH is allowed")
+	}
+	path, hasDoc := entityPath(args, level)
+
+	content := false
+	if level > 0 {
+		content, _ = cmd.Flags().GetBool("content")
+	}
+	if content && !hasDoc {
+		Error("Resource type %q doesn't have documents",
+			strings.Split(path, "/")[2])
+	}
+	if hasDoc && !content {
+		path += "$meta"
+	}
+
+	buf, _ := HTTPDo("GET", path, OutputHeaders(nil), nil)
+	os.Stdout.Write(buf)
+}
+
+func entityWrite(cmd *cobra.Command, args []string, level int, verb string) {
+	path, hasDoc := entityPath(args, level)
+
+	obj, err := readData(cmd)
+	if err != nil {
+		Error(err.Error())
+	}
+	if err = ParseAttributes(obj, args[1:]); err != nil {
+		Error(err.Error())
+	}
+
+	file := ""
+	if level > 0 && verb != "patch" {
+		file, _ = cmd.Flags().GetString("file")
+	}
+	if file != "" && !hasDoc {
+		Error("Resource type %q doesn't have documents",
+			strings.Split(path, "/")[2])
+	}
+
+	url := path
+	headers := OutputHeaders(nil)
+	body := []byte(nil)
+
+	if file != "" {
+		// Document goes in the body, metadata goes in the headers
+		if body, err = readFile(file); err != nil {
+			Error(err.Error())
+		}
+		if err = ObjectToHeaders(obj, "xRegistry-", headers); err != nil {
+			Error(err.Error())
+		}
+	} else {
+		if hasDoc {
+			url += "$meta"
+		}
+		body, err = json.Marshal(obj)
+		ErrStop(err)
+	}
+
+	method := "PUT"
+	switch verb {
+	case "create":
+		headers["If-None-Match"] = "*"
+	case "update":
+		headers["If-Match"] = "*"
+	case "patch":
+		method = "PATCH"
+	}
+
+	buf, res := HTTPSend(method, url, headers, body)
+
+	// Make the "already exists" and "not found" errors more user-friendly
+	// than the server's precondition failure ones
+	if res.StatusCode == http.StatusPreconditionFailed {
+		if verb == "create" {
+			ExitError(EXIT_SERVER, "%s %q already exists",
+				entityLevels[level].Title, path)
+		}
+		if verb == "update" {
+			ExitError(EXIT_NOT_FOUND, "%s %q not found",
+				entityLevels[level].Title, path)
+		}
+	}
+	CheckResponse(res, buf)
+
+	os.Stdout.Write(buf)
+}
+
+func entityDelete(cmd *cobra.Command, args []string, level int) {
+	if len(args) > 1 {
+		Error("Too many arguments - just the PATH is allowed")
+	}
+	path, _ := entityPath(args, level)
+
+	HTTPDo("DELETE", path, nil, nil)
+}
+
+func readData(cmd *cobra.Command) (map[string]any, error) {
+	obj := map[string]any{}
+
+	data, _ := cmd.Flags().GetString("data")
+	if data == "" {
+		return obj, nil
+	}
+
+	buf := []byte(data)
+	if data == "-" || data[0] == '@' {
+		var err error
+		if buf, err = readFile(strings.TrimPrefix(data, "@")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := registry.Unmarshal(buf, &obj); err != nil {
+		return nil, fmt.Errorf("Error parsing the JSON data: %s", err)
+	}
+	return obj, nil
+}
+
+func readFile(file string) ([]byte, error) {
+	var buf []byte
+	var err error
+
+	if file == "-" {
+		if buf, err = io.ReadAll(os.Stdin); err != nil {
+			return nil, fmt.Errorf("Error reading from stdin: %s", err)
+		}
+	} else if buf, err = os.ReadFile(file); err != nil {
+		return nil, fmt.Errorf("Error reading file %q: %s", file, err)
+	}
+	return buf, nil
+}
+
+// Add the "NAME=VALUE" (string), "NAME:=JSON" and "NAME-" (delete) args to
+// "obj". Nested attributes use "." as the separator, e.g. labels.env=prod
+func ParseAttributes(obj map[string]any, args []string) error {
+	for _, arg := range args {
+		// Note: foo= and foo are equivalent
+		// Note: foo- means delete it
+		path, value, found := strings.Cut(arg, "=")
+		val := any(value)
+
+		if tmp, isJSON := strings.CutSuffix(path, ":"); isJSON && found {
+			path = tmp
+			if err := json.Unmarshal([]byte(value), &val); err != nil {
+				return fmt.Errorf("Invalid JSON value on %q: %s", arg, err)
+			}
+		}
+
+		del := false
+		if path, del = strings.CutSuffix(path, "-"); del {
+			if found {
+				return fmt.Errorf("Using both \"-\" and \"=\" on %q isn't "+
+					"allowed", arg)
+			}
+			val = nil
+		}
+
+		if len(path) == 0 {
+			return fmt.Errorf("Missing an attribute path on %q", arg)
+		}
+
+		names := strings.Split(path, ".")
+		m := obj
+		for _, name := range names[:len(names)-1] {
+			next, ok := m[name].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				m[name] = next
+			}
+			m = next
+		}
+		m[names[len(names)-1]] = val
+	}
+	return nil
+}
+
+// Convert the attributes into xRegistry HTTP headers. Maps are flattened
+// (e.g. labels.env -> xRegistry-labels-env), and deleted attributes have a
+// value of "null"
+func ObjectToHeaders(obj map[string]any, prefix string,
+	headers map[string]string) error {
+
+	keys := []string{}
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		switch val := obj[k].(type) {
+		case nil:
+			headers[prefix+k] = "null"
+		case string:
+			headers[prefix+k] = val
+		case map[string]any:
+			if err := ObjectToHeaders(val, prefix+k+"-", headers); err != nil {
+				return err
+			}
+		case []any:
+			return fmt.Errorf("Attribute %q can't be sent as an HTTP header, "+
+				"use \"--data\" without \"--file\" instead", k)
+		default:
+			buf, _ := json.Marshal(val)
+			headers[prefix+k] = string(buf)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	// log "github.com/duglin/dlog"
+	"github.com/duglin/xreg-github/registry"
+	"github.com/spf13/cobra"
+)
+
+// A portable copy of an entire Registry. Things are listed in the order in
+// which they need to be created, in particular Versions are oldest first so
+// that the "newest" Version is the same once they're imported.
+type ExportBundle struct {
+	Model    json.RawMessage `json:"model"`
+	Registry map[string]any  `json:"registry,omitempty"`
+	Groups   []*ExportGroup  `json:"groups,omitempty"`
+}
+
+type ExportGroup struct {
+	Path       string            `json:"path"`
+	Attributes map[string]any    `json:"attributes,omitempty"`
+	Resources  []*ExportResource `json:"resources,omitempty"`
+}
+
+type ExportResource struct {
+	Path string `json:"path"`
+
+	// Only set when the default Version is sticky
+	DefaultVersionID string           `json:"defaultversionid,omitempty"`
+	Versions         []*ExportVersion `json:"versions"`
+}
+
+type ExportVersion struct {
+	Path       string         `json:"path"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Document   []byte         `json:"document,omitempty"` // base64 in JSON
+}
+
+func addRegistryExportCmds(registryCmd *cobra.Command) {
+	exportCmd := &cobra.Command{
+		Use: "export [ FILE ]",
+		Short: "Save the entire Registry (model, entities and documents) " +
+			"as a JSON bundle",
+		Run: registryExportFunc,
+	}
+	registryCmd.AddCommand(exportCmd)
+
+	importCmd := &cobra.Command{
+		Use:   "import [ - | FILE ]",
+		Short: "Load a bundle created by \"export\" into the Registry",
+		Run:   registryImportFunc,
+	}
+	registryCmd.AddCommand(importCmd)
+}
+
+// Returns the server's model, parsed and as raw JSON
+func getModel() (*registry.Model, []byte) {
+	buf, _ := HTTPDo("GET", "/model", nil, nil)
+	model := &registry.Model{}
+	if err := json.Unmarshal(buf, model); err != nil {
+		Error("Error parsing the server's model: %s", err)
+	}
+	return model, buf
+}
+
+func getJSON(path string) map[string]any {
+	buf, _ := HTTPDo("GET", path, nil, nil)
+
+	// Use Numbers so we don't lose precision on large ints
+	obj := map[string]any{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&obj); err != nil {
+		Error("Error parsing the response from %q: %s", path, err)
+	}
+	return obj
+}
+
+// Returns a copy of "obj" w/o the attributes that the server generates
+func exportAttrs(obj map[string]any, skip ...string) map[string]any {
+	res := map[string]any{}
+	for k, v := range obj {
+		res[k] = v
+	}
+	for _, k := range append(skip, "epoch", "self") {
+		delete(res, k)
+	}
+	return res
+}
+
+func collAttrs(plural string) []string {
+	return []string{plural, plural + "count", plural + "url"}
+}
+
+func registryExportFunc(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		Error("Too many arguments - just the FILE is allowed")
+	}
+
+	bundle := &ExportBundle{}
+	model, buf := getModel()
+	bundle.Model = buf
+
+	// Ask for all of the Versions to be inlined, but not their documents
+	// since we'll grab those as raw bytes to avoid any conversions
+	path := "?"
+	for _, gm := range model.Groups {
+		for _, rm := range gm.Resources {
+			path += "inline=" + gm.Plural + "." + rm.Plural + ".versions&"
+		}
+	}
+	regObj := getJSON(path)
+
+	skip := []string{"specversion", "id"}
+	for _, gm := range model.Groups {
+		skip = append(skip, collAttrs(gm.Plural)...)
+	}
+	bundle.Registry = exportAttrs(regObj, skip...)
+
+	for _, gm := range model.Groups {
+		groups, _ := regObj[gm.Plural].(map[string]any)
+
+		skip = []string{}
+		for _, rm := range gm.Resources {
+			skip = append(skip, collAttrs(rm.Plural)...)
+		}
+
+		for _, gID := range registry.SortedKeys(groups) {
+			gObj, _ := groups[gID].(map[string]any)
+			group := &ExportGroup{
+				Path:       gm.Plural + "/" + gID,
+				Attributes: exportAttrs(gObj, skip...),
+			}
+			bundle.Groups = append(bundle.Groups, group)
+
+			for _, rm := range gm.Resources {
+				resources, _ := gObj[rm.Plural].(map[string]any)
+				for _, rID := range registry.SortedKeys(resources) {
+					rObj, _ := resources[rID].(map[string]any)
+					group.Resources = append(group.Resources,
+						exportResource(rm, group.Path+"/"+rm.Plural+"/"+rID,
+							rObj))
+				}
+			}
+		}
+	}
+
+	buf, err := json.MarshalIndent(bundle, "", "  ")
+	ErrStop(err)
+	buf = append(buf, '\n')
+
+	if len(args) == 0 || args[0] == "-" {
+		os.Stdout.Write(buf)
+	} else if err = os.WriteFile(args[0], buf, 0644); err != nil {
+		Error("Error writing to %q: %s", args[0], err)
+	}
+}
+
+func exportResource(rm *registry.ResourceModel, path string,
+	rObj map[string]any) *ExportResource {
+
+	resource := &ExportResource{Path: path}
+	if rObj["stickydefaultversion"] == true {
+		resource.DefaultVersionID, _ = rObj["defaultversionid"].(string)
+	}
+
+	versions, _ := rObj["versions"].(map[string]any)
+	for _, vID := range registry.SortedKeys(versions) {
+		vObj, _ := versions[vID].(map[string]any)
+		version := &ExportVersion{
+			Path: path + "/versions/" + vID,
+			Attributes: exportAttrs(vObj, "isdefault", rm.Singular,
+				rm.Singular+"base64"),
+		}
+
+		// Only grab the document if it's stored in the registry
+		_, isURL := vObj[rm.Singular+"url"]
+		_, isProxy := vObj[rm.Singular+"proxyurl"]
+		if rm.GetHasDocument() && !isURL && !isProxy {
+			version.Document, _ = HTTPDo("GET", version.Path, nil, nil)
+		}
+		resource.Versions = append(resource.Versions, version)
+	}
+
+	// The server doesn't expose the order in which the Versions were
+	// created, so use "createdat" and then the IDs (numerically if possible)
+	createdAt := func(v *ExportVersion) time.Time {
+		str, _ := v.Attributes["createdat"].(string)
+		t, _ := time.Parse(time.RFC3339Nano, str)
+		return t
+	}
+	id := func(v *ExportVersion) string {
+		return v.Path[len(path+"/versions/"):]
+	}
+	sort.SliceStable(resource.Versions, func(i, j int) bool {
+		vi, vj := resource.Versions[i], resource.Versions[j]
+		if ti, tj := createdAt(vi), createdAt(vj); !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		ni, erri := strconv.Atoi(id(vi))
+		nj, errj := strconv.Atoi(id(vj))
+		if erri == nil && errj == nil {
+			return ni < nj
+		}
+		return id(vi) < id(vj)
+	})
+
+	return resource
+}
+
+func registryImportFunc(cmd *cobra.Command, args []string) {
+	if len(args) > 1 {
+		Error("Too many arguments - just the FILE is allowed")
+	}
+
+	file := "-"
+	if len(args) == 1 {
+		file = args[0]
+	}
+	buf, err := readFile(file)
+	if err != nil {
+		Error(err.Error())
+	}
+
+	bundle := &ExportBundle{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err = dec.Decode(bundle); err != nil {
+		Error("Error parsing the bundle: %s", err)
+	}
+
+	// Model first so the entities can be created
+	if len(bundle.Model) > 0 {
+		HTTPDo("PUT", "/model", nil, bundle.Model)
+	}
+	model, _ := getModel()
+
+	putJSON := func(method string, path string, obj map[string]any) {
+		buf, err := json.Marshal(obj)
+		ErrStop(err)
+		HTTPDo(method, path, nil, buf)
+	}
+
+	if bundle.Registry != nil {
+		putJSON("PUT", "/", bundle.Registry)
+	}
+
+	for _, group := range bundle.Groups {
+		putJSON("PUT", group.Path, group.Attributes)
+		gm := model.Groups[strings.Split(group.Path, "/")[0]]
+		if gm == nil {
+			Error("Unknown Group type for %q", group.Path)
+		}
+
+		for _, resource := range group.Resources {
+			rm := gm.Resources[strings.Split(resource.Path, "/")[2]]
+			if rm == nil {
+				Error("Unknown Resource type for %q", resource.Path)
+			}
+
+			meta := ""
+			if rm.GetHasDocument() {
+				meta = "$meta"
+			}
+
+			// Oldest first so that the newest Version is the same as before
+			for _, version := range resource.Versions {
+				obj := version.Attributes
+				if obj == nil {
+					obj = map[string]any{}
+				}
+				if version.Document != nil {
+					obj[rm.Singular+"base64"] =
+						base64.StdEncoding.EncodeToString(version.Document)
+				}
+				putJSON("PUT", version.Path+meta, obj)
+			}
+
+			if resource.DefaultVersionID != "" {
+				HTTPDo("POST", resource.Path+meta+"?setdefaultversionid="+
+					resource.DefaultVersionID, nil, nil)
+			}
+		}
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"strings"
 
@@ -48,9 +47,9 @@ func modelNormalizeFunc(cmd *cobra.Command, args []string) {
 	}
 
 	for _, fileName = range args {
-		buf, err = os.ReadFile(fileName)
+		buf, err = readModelFile(fileName)
 		if err != nil {
-			Error("Error reading file %q: %s", fileName, err)
+			Error("Error reading %q: %s", fileName, err)
 		}
 	}
 
@@ -64,7 +63,14 @@ func modelNormalizeFunc(cmd *cobra.Command, args []string) {
 	if err != nil {
 		Error(err.Error())
 	}
-	fmt.Printf("%s\n", registry.ToJSON(tmp))
+	buf = []byte(registry.ToJSON(tmp))
+	if Output == "yaml" {
+		buf, err = registry.JSONToYAML(buf)
+		ErrStop(err)
+		fmt.Printf("%s", buf)
+		return
+	}
+	fmt.Printf("%s\n", buf)
 }
 
 func modelVerifyFunc(cmd *cobra.Command, args []string) {
@@ -83,20 +89,7 @@ func modelVerifyFunc(cmd *cobra.Command, args []string) {
 		if Verbose {
 			fmt.Printf("%s:\n", fileName)
 		}
-		if strings.HasPrefix(fileName, "http") {
-			res, err := http.Get(fileName)
-			if err == nil {
-				buf, err = io.ReadAll(res.Body)
-				res.Body.Close()
-
-				if res.StatusCode/100 != 2 {
-					err = fmt.Errorf("Error getting model: %s\n%s",
-						res.Status, string(buf))
-				}
-			}
-		} else {
-			buf, err = os.ReadFile(fileName)
-		}
+		buf, err = readModelFile(fileName)
 		if err != nil {
 			Error("Error reading %q: %s", fileName, err)
 		}
@@ -105,27 +98,35 @@ func modelVerifyFunc(cmd *cobra.Command, args []string) {
 
 }
 
+// URLs come from the import catalog or cache if they're there
+func readModelFile(fileName string) ([]byte, error) {
+	if strings.HasPrefix(fileName, "http") {
+		return registry.FetchURL(fileName)
+	}
+	return os.ReadFile(fileName)
+}
+
 func VerifyModel(fileName string, buf []byte) {
 	var err error
 
+	// Keep "fileName" as is so relative $imports are resolved against it
+	prefix := ""
 	if len(os.Args) > 2 && fileName != "" {
-		fileName += ": "
-	} else {
-		fileName = ""
+		prefix = fileName + ": "
 	}
 
 	buf, err = registry.ProcessImports(fileName, buf, true)
 	if err != nil {
-		Error("%s%s", fileName, err)
+		Error("%s%s", prefix, err)
 	}
 
 	model := &registry.Model{}
 
 	if err := registry.Unmarshal(buf, model); err != nil {
-		Error("%s%s", fileName, err)
+		Error("%s%s", prefix, err)
 	}
 
 	if err := model.Verify(); err != nil {
-		Error("%s%s", fileName, err)
+		Error("%s%s", prefix, err)
 	}
 }
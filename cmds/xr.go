@@ -1,17 +1,34 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 
 	// log "github.com/duglin/dlog"
+	"github.com/duglin/xreg-github/registry"
 	"github.com/spf13/cobra"
 )
 
+// Exit codes
+const (
+	EXIT_ERROR     = 1 // Bad usage or a local error
+	EXIT_SERVER    = 2 // The server rejected the request
+	EXIT_NOT_FOUND = 3 // The entity doesn't exist
+)
+
 var worked = true
 var Verbose = EnvBool("XR_VERBOSE", false)
 var Server = EnvString("XR_SERVER", "")
+var Output = EnvString("XR_OUTPUT", "json")
+var ImportCatalog = EnvString("XR_IMPORT_CATALOG", "")
+var ImportCache = EnvString("XR_IMPORT_CACHE", "")
+var Offline = EnvBool("XR_OFFLINE", false)
+var ImportCacheTTL = registry.GetImportCacheTTL()
+var ClearImportCache = false
 
 func EnvBool(name string, def bool) bool {
 	val := os.Getenv(name)
@@ -42,10 +59,78 @@ func ErrStop(err error, prefix ...any) {
 }
 
 func Error(str string, args ...any) {
+	ExitError(EXIT_ERROR, str, args...)
+}
+
+func ExitError(code int, str string, args ...any) {
 	str = strings.TrimSpace(str) + "\n"
 	fmt.Fprintf(os.Stderr, str, args...)
 	worked = false
-	os.Exit(1)
+	os.Exit(code)
+}
+
+// Send a request to the server and return the response body. Any non-2xx
+// response is shown to the user and we exit with the appropriate code.
+func HTTPDo(method string, path string, headers map[string]string,
+	body []byte) ([]byte, *http.Response) {
+
+	buf, res := HTTPSend(method, path, headers, body)
+	CheckResponse(res, buf)
+	return buf, res
+}
+
+// Like HTTPDo but the caller needs to check the response
+func HTTPSend(method string, path string, headers map[string]string,
+	body []byte) ([]byte, *http.Response) {
+
+	if Server == "" {
+		Error("No Server address provided. Try either -s or XR_SERVER env var")
+	}
+
+	url := strings.TrimRight(Server, "/") + "/" + strings.TrimLeft(path, "/")
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	ErrStop(err, "Error creating request (%s): %s", url, err)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if Verbose {
+		fmt.Fprintf(os.Stderr, "%s %s\n", method, url)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	ErrStop(err, "Error talking to server (%s): %s", Server, err)
+
+	buf, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	ErrStop(err, "Error reading server response: %s", err)
+
+	return buf, res
+}
+
+// Asks the server to return the metadata in the "--output" format
+func OutputHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		headers = map[string]string{}
+	}
+	if Output == "yaml" {
+		headers["Accept"] = "application/yaml"
+	}
+	return headers
+}
+
+func CheckResponse(res *http.Response, buf []byte) {
+	if res.StatusCode/100 != 2 {
+		code := EXIT_SERVER
+		if res.StatusCode == http.StatusNotFound {
+			code = EXIT_NOT_FOUND
+		}
+		msg := strings.TrimSpace(string(buf))
+		if msg == "" {
+			msg = res.Status
+		}
+		ExitError(code, "%s", msg)
+	}
 }
 
 func main() {
@@ -58,10 +143,37 @@ func main() {
 		"Chatty?")
 	xrCmd.PersistentFlags().StringVarP(&Server, "server", "s", Server,
 		"URL to server")
+	xrCmd.PersistentFlags().StringVarP(&Output, "output", "o", Output,
+		"Output format: json or yaml")
+	xrCmd.PersistentFlags().StringVar(&ImportCatalog, "import-catalog",
+		ImportCatalog, "Dir or archive w/local copies of imported model URLs")
+	xrCmd.PersistentFlags().StringVar(&ImportCache, "import-cache",
+		ImportCache, "Dir to cache imported model URLs in")
+	xrCmd.PersistentFlags().DurationVar(&ImportCacheTTL, "import-cache-ttl",
+		ImportCacheTTL,
+		"How long cached model URLs are used before they're fetched again "+
+			"(0 = forever)")
+	xrCmd.PersistentFlags().BoolVar(&ClearImportCache, "clear-import-cache",
+		ClearImportCache, "Empty the --import-cache dir first")
+	xrCmd.PersistentFlags().BoolVar(&Offline, "offline", Offline,
+		"Don't fetch imported model URLs that aren't in the catalog/cache")
+	xrCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if Output != "json" && Output != "yaml" {
+			Error("Invalid --output value %q, must be json or yaml", Output)
+		}
+		err := registry.ConfigureImports(ImportCatalog, ImportCache, Offline)
+		ErrStop(err)
+		registry.SetImportCacheTTL(ImportCacheTTL)
+		if ClearImportCache {
+			ErrStop(registry.ClearImportCache())
+		}
+	}
 
 	addModelCmd(xrCmd)
 	addRegistryCmd(xrCmd)
 	addGroupCmd(xrCmd)
+	addResourceCmd(xrCmd)
+	addVersionCmd(xrCmd)
 
 	if err := xrCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", err)
@@ -0,0 +1,504 @@
+package registry
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// An Authenticator checks the credentials in the Authorization header.
+// It returns the name of the user if they're valid, "" (and no error) if
+// they're not the kind of credentials it deals with, or an error if they're
+// the right kind but aren't valid.
+type Authenticator interface {
+	Scheme() string // "Bearer", "Basic"
+	Authenticate(scheme string, creds string) (string, error)
+}
+
+const (
+	ACCESS_READ  = "read"
+	ACCESS_WRITE = "write" // implies read
+)
+
+// Special values for AuthRule.Users
+const (
+	AUTH_ANYONE    = "*"         // Any authenticated user
+	AUTH_ANONYMOUS = "anonymous" // Requests without any credentials
+)
+
+// An AuthRule grants "access" to the "users" for everything at, or under,
+// "path" in "registry". An empty "registry" means all registries and an
+// empty "path" means the entire registry. So, to grant access to a Group
+// type just use its plural as the path, e.g. "/schemagroups".
+type AuthRule struct {
+	Users    []string `json:"users"`
+	Access   string   `json:"access"`
+	Registry string   `json:"registry,omitempty"`
+	Path     string   `json:"path,omitempty"`
+}
+
+type Auth struct {
+	Authenticators []Authenticator
+	Rules          []*AuthRule
+}
+
+// The format of the file passed to LoadAuthFile(). Relative file names are
+// relative to the config file's directory.
+type AuthConfig struct {
+	Tokens      map[string]string `json:"tokens,omitempty"` // token->user
+	BasicFile   string            `json:"basicfile,omitempty"`
+	JWKSFile    string            `json:"jwksfile,omitempty"`
+	JWTIssuer   string            `json:"jwtissuer,omitempty"`
+	JWTAudience string            `json:"jwtaudience,omitempty"`
+	Rules       []*AuthRule       `json:"rules,omitempty"`
+}
+
+func LoadAuthFile(file string) (*Auth, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := AuthConfig{}
+	if err := Unmarshal(buf, &cfg); err != nil {
+		return nil, fmt.Errorf("Error parsing %q: %s", file, err)
+	}
+
+	relTo := func(name string) string {
+		if filepath.IsAbs(name) {
+			return name
+		}
+		return filepath.Join(filepath.Dir(file), name)
+	}
+
+	auth := &Auth{Rules: cfg.Rules}
+	if len(cfg.Tokens) > 0 {
+		auth.Authenticators = append(auth.Authenticators,
+			&TokenAuthenticator{Tokens: cfg.Tokens})
+	}
+	if cfg.BasicFile != "" {
+		ba, err := LoadBasicAuthFile(relTo(cfg.BasicFile))
+		if err != nil {
+			return nil, err
+		}
+		auth.Authenticators = append(auth.Authenticators, ba)
+	}
+	if cfg.JWKSFile != "" {
+		ja, err := LoadJWTAuthFile(relTo(cfg.JWKSFile))
+		if err != nil {
+			return nil, err
+		}
+		ja.Issuer = cfg.JWTIssuer
+		ja.Audience = cfg.JWTAudience
+		auth.Authenticators = append(auth.Authenticators, ja)
+	}
+
+	if err := auth.Verify(); err != nil {
+		return nil, fmt.Errorf("Error in %q: %s", file, err)
+	}
+	return auth, nil
+}
+
+func (auth *Auth) Verify() error {
+	for i, rule := range auth.Rules {
+		if rule.Access != ACCESS_READ && rule.Access != ACCESS_WRITE {
+			return fmt.Errorf("Rule %d has an invalid \"access\" value (%s), "+
+				"must be one of: %s, %s", i, rule.Access, ACCESS_READ,
+				ACCESS_WRITE)
+		}
+		if len(rule.Users) == 0 {
+			return fmt.Errorf("Rule %d must have at least one user", i)
+		}
+		rule.Path = strings.Trim(rule.Path, "/")
+	}
+	return nil
+}
+
+// Returns the user making the request, "" for anonymous requests.
+func (auth *Auth) Authenticate(r *http.Request) (string, error) {
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if header == "" {
+		return "", nil
+	}
+
+	scheme, creds, _ := strings.Cut(header, " ")
+	creds = strings.TrimSpace(creds)
+	for _, a := range auth.Authenticators {
+		if !strings.EqualFold(a.Scheme(), scheme) {
+			continue
+		}
+		user, err := a.Authenticate(scheme, creds)
+		if err != nil {
+			return "", err
+		}
+		if user != "" {
+			return user, nil
+		}
+	}
+	return "", fmt.Errorf("Invalid credentials")
+}
+
+// Returns true if "user" has "access" to "path" in the registry
+func (auth *Auth) Allowed(user string, access string, regID string,
+	path string) bool {
+
+	path = strings.Trim(path, "/")
+	for _, rule := range auth.Rules {
+		if access == ACCESS_WRITE && rule.Access != ACCESS_WRITE {
+			continue
+		}
+		if rule.Registry != "" && !strings.EqualFold(rule.Registry, regID) {
+			continue
+		}
+		if rule.Path != "" && path != rule.Path &&
+			!strings.HasPrefix(path, rule.Path+"/") {
+			continue
+		}
+		if user == "" {
+			if slices.Contains(rule.Users, AUTH_ANONYMOUS) {
+				return true
+			}
+		} else if slices.Contains(rule.Users, AUTH_ANYONE) ||
+			slices.Contains(rule.Users, user) {
+			return true
+		}
+	}
+	return false
+}
+
+// Challenge asks the client for credentials, in any of our schemes
+func (auth *Auth) Challenge(header http.Header) {
+	schemes := []string{}
+	for _, a := range auth.Authenticators {
+		scheme := a.Scheme() + ` realm="xRegistry"`
+		if !slices.Contains(schemes, scheme) {
+			schemes = append(schemes, scheme)
+		}
+	}
+	if len(schemes) > 0 {
+		header.Set("WWW-Authenticate", strings.Join(schemes, ", "))
+	}
+}
+
+// Check makes sure the user (info.User, from Authenticate) is allowed to do
+// the request. GETs need "read" access, everything else needs "write"
+// access.
+func (auth *Auth) Check(info *RequestInfo) error {
+	access := ACCESS_WRITE
+	method := strings.ToUpper(info.OriginalRequest.Method)
+	if method == "GET" || method == "HEAD" {
+		access = ACCESS_READ
+	}
+
+	path := "/" + strings.Join(info.Parts, "/")
+	if auth.Allowed(info.User, access, info.Registry.UID, path) {
+		return nil
+	}
+
+	if info.User == "" {
+		auth.Challenge(info.OriginalResponse.Header())
+		info.StatusCode = http.StatusUnauthorized
+		return fmt.Errorf("Authentication is required")
+	}
+	info.StatusCode = http.StatusForbidden
+	return fmt.Errorf("User %q isn't allowed to %s %q", info.User, access,
+		path)
+}
+
+// Static bearer tokens
+type TokenAuthenticator struct {
+	Tokens map[string]string // token->user
+}
+
+func (ta *TokenAuthenticator) Scheme() string {
+	return "Bearer"
+}
+
+func (ta *TokenAuthenticator) Authenticate(scheme, creds string) (string, error) {
+	for token, user := range ta.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(creds)) == 1 {
+			return user, nil
+		}
+	}
+	return "", nil // Might be a JWT
+}
+
+// HTTP basic auth. Passwords are either in plain text or, if they start
+// with "{SHA256}", the hex encoded sha256 of the password.
+type BasicAuthenticator struct {
+	Users map[string]string // user->password
+}
+
+// Each line of the file is "user:password". Blank lines and lines starting
+// with "#" are ignored.
+func LoadBasicAuthFile(file string) (*BasicAuthenticator, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ba := &BasicAuthenticator{Users: map[string]string{}}
+	for i, line := range strings.Split(string(buf), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		user, pwd, found := strings.Cut(line, ":")
+		if !found || user == "" {
+			return nil, fmt.Errorf("Error in %q, line %d isn't of the form "+
+				"\"user:password\"", file, i+1)
+		}
+		ba.Users[user] = pwd
+	}
+	return ba, nil
+}
+
+func (ba *BasicAuthenticator) Scheme() string {
+	return "Basic"
+}
+
+func (ba *BasicAuthenticator) Authenticate(scheme, creds string) (string, error) {
+	buf, err := base64.StdEncoding.DecodeString(creds)
+	if err != nil {
+		return "", fmt.Errorf("Invalid basic auth credentials")
+	}
+	user, pwd, _ := strings.Cut(string(buf), ":")
+
+	// Do the same work whether or not the user exists, and compare hashes
+	// so the time taken doesn't leak the users or the passwords' lengths
+	exp, known := ba.Users[user]
+	expSum := []byte(nil)
+	if hash, ok := strings.CutPrefix(exp, "{SHA256}"); ok {
+		expSum, _ = hex.DecodeString(hash)
+	} else {
+		sum := sha256.Sum256([]byte(exp))
+		expSum = sum[:]
+	}
+	sum := sha256.Sum256([]byte(pwd))
+	if subtle.ConstantTimeCompare(expSum, sum[:]) != 1 || !known {
+		return "", fmt.Errorf("Invalid user name or password")
+	}
+	return user, nil
+}
+
+// JWTs, signed with one of the keys in a JWKS file. The user is the "sub"
+// claim. If Issuer or Audience are set then the "iss" and "aud" claims must
+// match them.
+type JWTAuthenticator struct {
+	Keys     []*JWK
+	Issuer   string
+	Audience string
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`   // RSA
+	E   string `json:"e,omitempty"`   // RSA
+	Crv string `json:"crv,omitempty"` // EC
+	X   string `json:"x,omitempty"`   // EC
+	Y   string `json:"y,omitempty"`   // EC
+
+	key crypto.PublicKey
+}
+
+type JWKS struct {
+	Keys []*JWK `json:"keys"`
+}
+
+func LoadJWTAuthFile(file string) (*JWTAuthenticator, error) {
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(buf)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing %q: %s", file, err)
+	}
+	return &JWTAuthenticator{Keys: keys}, nil
+}
+
+func ParseJWKS(buf []byte) ([]*JWK, error) {
+	jwks := JWKS{}
+	if err := json.Unmarshal(buf, &jwks); err != nil {
+		return nil, err
+	}
+
+	b64Int := func(str string) (*big.Int, error) {
+		buf, err := base64.RawURLEncoding.DecodeString(str)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(buf), nil
+	}
+
+	keys := []*JWK{}
+	for i, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			n, err := b64Int(key.N)
+			if err != nil {
+				return nil, fmt.Errorf("Key %d has an invalid \"n\": %s", i, err)
+			}
+			e, err := b64Int(key.E)
+			if err != nil || !e.IsInt64() {
+				return nil, fmt.Errorf("Key %d has an invalid \"e\"", i)
+			}
+			key.key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve := elliptic.Curve(nil)
+			switch key.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				return nil, fmt.Errorf("Key %d has an unsupported \"crv\": %s",
+					i, key.Crv)
+			}
+			x, err1 := b64Int(key.X)
+			y, err2 := b64Int(key.Y)
+			if err1 != nil || err2 != nil {
+				return nil, fmt.Errorf("Key %d has an invalid \"x\" or \"y\"", i)
+			}
+			key.key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		default:
+			log.VPrintf(2, "Skipping JWK %d, unsupported \"kty\": %s", i, key.Kty)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (ja *JWTAuthenticator) Scheme() string {
+	return "Bearer"
+}
+
+func (ja *JWTAuthenticator) Authenticate(scheme, creds string) (string, error) {
+	parts := strings.Split(creds, ".")
+	if len(parts) != 3 {
+		return "", nil // Not a JWT
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	buf, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err == nil {
+		err = json.Unmarshal(buf, &header)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Invalid JWT header")
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("Invalid JWT signature")
+	}
+
+	hashes := map[string]crypto.Hash{
+		"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+		"ES256": crypto.SHA256, "ES384": crypto.SHA384,
+	}
+	hash, ok := hashes[header.Alg]
+	if !ok {
+		return "", fmt.Errorf("Unsupported JWT \"alg\": %s", header.Alg)
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	digest := h.Sum(nil)
+
+	verified := false
+	for _, key := range ja.Keys {
+		if (header.Kid != "" && key.Kid != header.Kid) ||
+			(key.Alg != "" && key.Alg != header.Alg) {
+			continue
+		}
+		switch pub := key.key.(type) {
+		case *rsa.PublicKey:
+			if header.Alg[0] == 'R' {
+				verified = rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil
+			}
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			if header.Alg[0] == 'E' && len(sig) == 2*size {
+				r := new(big.Int).SetBytes(sig[:size])
+				s := new(big.Int).SetBytes(sig[size:])
+				verified = ecdsa.Verify(pub, digest, r, s)
+			}
+		}
+		if verified {
+			break
+		}
+	}
+	if !verified {
+		return "", fmt.Errorf("Invalid JWT signature")
+	}
+
+	claims := struct {
+		Sub string `json:"sub"`
+		Iss string `json:"iss"`
+		Aud any    `json:"aud"` // string or []string
+		Exp *int64 `json:"exp"`
+		Nbf *int64 `json:"nbf"`
+	}{}
+	buf, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err == nil {
+		err = json.Unmarshal(buf, &claims)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Invalid JWT claims")
+	}
+
+	now := time.Now().Unix()
+	if claims.Exp != nil && now >= *claims.Exp {
+		return "", fmt.Errorf("JWT has expired")
+	}
+	if claims.Nbf != nil && now < *claims.Nbf {
+		return "", fmt.Errorf("JWT isn't valid yet")
+	}
+	if ja.Issuer != "" && claims.Iss != ja.Issuer {
+		return "", fmt.Errorf("JWT has the wrong issuer: %s", claims.Iss)
+	}
+	if ja.Audience != "" {
+		match := false
+		switch aud := claims.Aud.(type) {
+		case string:
+			match = aud == ja.Audience
+		case []any:
+			for _, a := range aud {
+				match = match || a == ja.Audience
+			}
+		}
+		if !match {
+			return "", fmt.Errorf("JWT has the wrong audience")
+		}
+	}
+	if claims.Sub == "" {
+		return "", fmt.Errorf("JWT is missing a \"sub\" claim")
+	}
+	return claims.Sub, nil
+}
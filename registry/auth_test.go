@@ -0,0 +1,211 @@
+package registry
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func b64(buf []byte) string {
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func makeJWT(t *testing.T, key crypto.Signer, alg string, kid string,
+	claims map[string]any) string {
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	body, _ := json.Marshal(claims)
+	data := b64(header) + "." + b64(body)
+	digest := sha256.Sum256([]byte(data))
+
+	sig := []byte(nil)
+	var err error
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err2 := ecdsa.Sign(rand.Reader, k, digest[:])
+		err = err2
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatalf("Signing: %s", err)
+	}
+	return data + "." + b64(sig)
+}
+
+func TestAuthJWT(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	jwks, _ := json.Marshal(map[string]any{"keys": []any{
+		map[string]any{"kty": "RSA", "kid": "r1", "alg": "RS256",
+			"n": b64(rsaKey.N.Bytes()),
+			"e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		map[string]any{"kty": "EC", "kid": "e1", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		map[string]any{"kty": "oct", "k": "c2VjcmV0"},
+	}})
+	keys, err := ParseJWKS(jwks)
+	if err != nil {
+		t.Fatalf("ParseJWKS: %s", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected 2 keys, got: %d", len(keys))
+	}
+
+	ja := &JWTAuthenticator{Keys: keys, Issuer: "me", Audience: "xreg"}
+	now := time.Now().Unix()
+	good := map[string]any{"sub": "john", "iss": "me", "aud": "xreg",
+		"exp": now + 60}
+
+	tests := []struct {
+		name  string
+		token string
+		user  string
+		err   string
+	}{
+		{"rsa", makeJWT(t, rsaKey, "RS256", "r1", good), "john", ""},
+		{"ec", makeJWT(t, ecKey, "ES256", "e1", good), "john", ""},
+		{"aud list", makeJWT(t, rsaKey, "RS256", "", map[string]any{
+			"sub": "jane", "iss": "me", "aud": []string{"x", "xreg"}}),
+			"jane", ""},
+		{"not a jwt", "abc", "", ""},
+		{"wrong key", makeJWT(t, otherKey, "RS256", "r1", good),
+			"", "Invalid JWT signature"},
+		{"wrong kid", makeJWT(t, rsaKey, "RS256", "e1", good),
+			"", "Invalid JWT signature"},
+		{"alg none", b64([]byte(`{"alg":"none"}`)) + "." +
+			b64([]byte(`{"sub":"john"}`)) + ".",
+			"", "Unsupported JWT \"alg\": none"},
+		{"expired", makeJWT(t, rsaKey, "RS256", "r1", map[string]any{
+			"sub": "john", "iss": "me", "aud": "xreg", "exp": now - 1}),
+			"", "JWT has expired"},
+		{"not yet", makeJWT(t, rsaKey, "RS256", "r1", map[string]any{
+			"sub": "john", "iss": "me", "aud": "xreg", "nbf": now + 60}),
+			"", "JWT isn't valid yet"},
+		{"issuer", makeJWT(t, rsaKey, "RS256", "r1", map[string]any{
+			"sub": "john", "iss": "you", "aud": "xreg"}),
+			"", "JWT has the wrong issuer: you"},
+		{"audience", makeJWT(t, rsaKey, "RS256", "r1", map[string]any{
+			"sub": "john", "iss": "me", "aud": "foo"}),
+			"", "JWT has the wrong audience"},
+		{"no sub", makeJWT(t, rsaKey, "RS256", "r1", map[string]any{
+			"iss": "me", "aud": "xreg"}),
+			"", "JWT is missing a \"sub\" claim"},
+	}
+
+	for _, test := range tests {
+		user, err := ja.Authenticate("Bearer", test.token)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if user != test.user || errStr != test.err {
+			t.Fatalf("%s: expected %q/%q, got %q/%q", test.name,
+				test.user, test.err, user, errStr)
+		}
+	}
+}
+
+func TestAuthConfig(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "users.txt"), []byte(`
+# comment
+john:pwd
+# sha256 of "secret"
+jane:{SHA256}2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "auth.json"), []byte(`{
+  "tokens": { "tok1": "bot" },
+  "basicfile": "users.txt",
+  "rules": [
+    { "users": [ "anonymous", "*" ], "access": "read", "registry": "reg1" },
+    { "users": [ "bot" ], "access": "write", "path": "/dirs/" },
+    { "users": [ "jane" ], "access": "write", "registry": "reg2" }
+  ]
+}`), 0644)
+
+	auth, err := LoadAuthFile(filepath.Join(dir, "auth.json"))
+	if err != nil {
+		t.Fatalf("LoadAuthFile: %s", err)
+	}
+
+	basic := func(user, pwd string) string {
+		return base64.StdEncoding.EncodeToString([]byte(user + ":" + pwd))
+	}
+
+	for _, test := range []struct {
+		scheme, creds string
+		user, err     string
+	}{
+		{"Bearer", "tok1", "bot", ""},
+		{"bearer", "tok1", "bot", ""},
+		{"Bearer", "tok2", "", "Invalid credentials"},
+		{"Basic", basic("john", "pwd"), "john", ""},
+		{"Basic", basic("jane", "secret"), "jane", ""},
+		{"Basic", basic("jane", "pwd"), "", "Invalid user name or password"},
+		{"Basic", basic("bob", "pwd"), "", "Invalid user name or password"},
+		{"Basic", basic("bob", ""), "", "Invalid user name or password"},
+		{"Digest", "foo", "", "Invalid credentials"},
+	} {
+		req := &http.Request{Header: http.Header{}}
+		req.Header.Set("Authorization", test.scheme+" "+test.creds)
+		user, err := auth.Authenticate(req)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if user != test.user || errStr != test.err {
+			t.Fatalf("%s %s: expected %q/%q, got %q/%q", test.scheme,
+				test.creds, test.user, test.err, user, errStr)
+		}
+	}
+
+	for _, test := range []struct {
+		user, access, reg, path string
+		allowed                 bool
+	}{
+		{"", ACCESS_READ, "reg1", "/", true},
+		{"", ACCESS_WRITE, "reg1", "/", false},
+		{"", ACCESS_READ, "reg2", "/", false},
+		{"john", ACCESS_READ, "REG1", "/dirs/d1", true},
+		{"john", ACCESS_WRITE, "reg1", "/dirs/d1", false},
+		{"bot", ACCESS_WRITE, "reg1", "/dirs", true},
+		{"bot", ACCESS_WRITE, "reg2", "/dirs/d1/files", true},
+		{"bot", ACCESS_WRITE, "reg1", "/dirsx", false},
+		{"bot", ACCESS_WRITE, "reg1", "/", false},
+		{"bot", ACCESS_READ, "reg2", "/dirs", true},
+		{"jane", ACCESS_WRITE, "reg2", "/model", true},
+		{"jane", ACCESS_WRITE, "reg1", "/dirs", false},
+	} {
+		if auth.Allowed(test.user, test.access, test.reg, test.path) !=
+			test.allowed {
+			t.Fatalf("%q %s %s %s: expected %v", test.user, test.access,
+				test.reg, test.path, test.allowed)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{
+  "rules": [ { "users": [ "*" ], "access": "all" } ]
+}`), 0644)
+	_, err = LoadAuthFile(filepath.Join(dir, "bad.json"))
+	if err == nil || err.Error() != `Error in "`+filepath.Join(dir, "bad.json")+
+		`": Rule 0 has an invalid "access" value (all), must be one of: `+
+		`read, write` {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,421 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/duglin/dlog"
+)
+
+// A BlobStore holds Resource documents outside of the DB. Blobs are keyed by
+// their digest (the hex SHA-256 of the contents) so they're immutable, and
+// the DB's ContentBlobs table just has a row w/o any Content for each one.
+// While a blob is being uploaded, and its digest isn't known yet, it's saved
+// under a temporary key and then renamed (see StageBlob).
+type BlobStore interface {
+	Name() string
+
+	// Saves the "size" bytes from "r", "size" is -1 if it's not known.
+	// Storing a digest that's already there is a no-op.
+	Put(digest string, size int64, r io.Reader) error
+
+	// Returns an os.ErrNotExist error if the blob isn't there
+	Get(digest string) (io.ReadCloser, error)
+
+	// Deleting a blob that isn't there isn't an error
+	Delete(digest string) error
+
+	// Moves the blob at "from" to "to". If "to" is already there then
+	// "from" is just deleted, they're the same blob.
+	Rename(from string, to string) error
+}
+
+// Creates a BlobStore from the "spec" passed to SetBlobStoreSpec, e.g.
+// "file:///var/xreg/blobs" or "s3://bucket/prefix?endpoint=..."
+type BlobStoreFactory func(spec *url.URL) (BlobStore, error)
+
+var BlobStoreFactories = map[string]BlobStoreFactory{}
+var blobStore BlobStore // nil means documents are stored in the DB
+
+func init() {
+	RegisterBlobStoreFactory("file", NewFSBlobStoreFromURL)
+}
+
+func RegisterBlobStoreFactory(scheme string, factory BlobStoreFactory) {
+	BlobStoreFactories[scheme] = factory
+}
+
+// Documents saved from now on go into "store", nil means the DB. Existing
+// documents stay where they are.
+func SetBlobStore(store BlobStore) {
+	blobStore = store
+}
+
+func GetBlobStore() BlobStore {
+	return blobStore
+}
+
+// "spec" is a URL whose scheme picks the BlobStoreFactory to use, a plain
+// directory name is the same as "file://DIR". An empty "spec" means the DB.
+func SetBlobStoreSpec(spec string) error {
+	if spec == "" {
+		SetBlobStore(nil)
+		return nil
+	}
+
+	u, err := url.Parse(spec)
+	if err != nil || u.Scheme == "" {
+		u = &url.URL{Scheme: "file", Path: spec}
+	}
+
+	factory := BlobStoreFactories[u.Scheme]
+	if factory == nil {
+		return fmt.Errorf("Unknown blob store %q, must be one of: %s",
+			u.Scheme, strings.Join(SortedKeys(BlobStoreFactories), ","))
+	}
+
+	store, err := factory(u)
+	if err != nil {
+		return err
+	}
+	SetBlobStore(store)
+	return nil
+}
+
+// Opens the document stored for the Version (or the default Version of the
+// Resource) w/o loading all of it into memory. Returns nil if there isn't one.
+func (e *Entity) OpenDocument() (io.ReadCloser, error) {
+	results, err := Query(e.tx, `
+        SELECT b.Digest, b.Content
+        FROM ResourceContents AS rc
+        JOIN ContentBlobs AS b ON (b.Digest=rc.Digest)
+        WHERE rc.VersionSID=? OR
+              rc.VersionSID=(SELECT eSID FROM FullTree WHERE ParentSID=? AND
+              PropName=? and PropValue='true')
+        `, e.DbSID, e.DbSID, NewPPP("isdefault").DB())
+	defer results.Close()
+	if err != nil {
+		return nil, fmt.Errorf("Error finding contents %q: %s", e.DbSID, err)
+	}
+
+	row := results.NextRow()
+	if row == nil {
+		return nil, nil
+	}
+	return openBlob(NotNilString(row[0]), row[1])
+}
+
+// "content" is the ContentBlobs.Content column, it's NULL when the blob is
+// in the BlobStore
+func openBlob(digest string, content *any) (io.ReadCloser, error) {
+	if content != nil && *content != nil {
+		buf, _ := (*content).([]byte)
+		return io.NopCloser(bytes.NewReader(buf)), nil
+	}
+
+	if blobStore == nil {
+		return nil, fmt.Errorf("Document %q is in a blob store but none "+
+			"is configured", digest)
+	}
+	return blobStore.Get(digest)
+}
+
+// Remember the blobs used by "e" (and its children) so that if they're no
+// longer needed once the Tx is committed they can be removed from the
+// BlobStore. The DB's own rows are taken care of by the triggers.
+func (tx *Tx) checkBlobs(e *Entity) error {
+	return tx.checkBlobsWhere(
+		`v.SID=? OR v.ResourceSID=? OR r.GroupSID=? OR g.RegistrySID=?`,
+		e.DbSID, e.DbSID, e.DbSID, e.DbSID)
+}
+
+// Same as checkBlobs but for all of the entities of a Group or Resource
+// model type that's being removed
+func (tx *Tx) checkModelBlobs(modelSID string) error {
+	return tx.checkBlobsWhere(`r.ModelSID=? OR g.ModelSID=?`,
+		modelSID, modelSID)
+}
+
+func (tx *Tx) checkBlobsWhere(where string, args ...any) error {
+	if blobStore == nil {
+		return nil
+	}
+
+	results, err := Query(tx, `
+        SELECT DISTINCT rc.Digest
+        FROM ResourceContents AS rc
+        JOIN Versions AS v ON (v.SID=rc.VersionSID)
+        JOIN Resources AS r ON (r.SID=v.ResourceSID)
+        JOIN "Groups" AS g ON (g.SID=r.GroupSID)
+        WHERE `+where, args...)
+	defer results.Close()
+	if err != nil {
+		return err
+	}
+
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		tx.blobs = append(tx.blobs, NotNilString(row[0]))
+	}
+	return nil
+}
+
+// Blobs are shared by all Versions (and Txs) w/the same digest, so a blob
+// that one Tx no longer needs can be one that another Tx just saved but
+// hasn't committed yet. To avoid deleting it out from under that Tx, each Tx
+// "pins" the digests it saves until it's done, and CollectBlobs skips pinned
+// blobs and checks the DB while holding blobLock. The Tx that pinned the
+// blob then collects it itself if it's no longer needed. Note that this only
+// covers the Txs in this process.
+var blobLock sync.Mutex
+var blobPins = map[string]int{} // digest -> # of Txs using it
+
+// A document that's already been saved in the BlobStore by StageBlob. It can
+// be used as a Resource's (or Version's) document instead of its bytes.
+type StagedBlob struct {
+	Digest string // hex SHA-256
+	Size   int64
+}
+
+// Reads all of it back in, for the few things (like validators) that need
+// the entire document
+func (sb *StagedBlob) Bytes() ([]byte, error) {
+	if blobStore == nil {
+		return nil, fmt.Errorf("Document %q is in a blob store but none "+
+			"is configured", sb.Digest)
+	}
+	r, err := blobStore.Get(sb.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+type byteCounter int64
+
+func (bc *byteCounter) Write(buf []byte) (int, error) {
+	*bc += byteCounter(len(buf))
+	return len(buf), nil
+}
+
+// Streams "r" into the BlobStore w/o holding all of it in memory. It's saved
+// under a temporary key while it's being hashed, and then renamed to its
+// digest. The blob is pinned until the Tx is done. "size" is -1 if it's not
+// known.
+func (tx *Tx) StageBlob(r io.Reader, size int64) (*StagedBlob, error) {
+	if blobStore == nil {
+		return nil, fmt.Errorf("No blob store is configured")
+	}
+
+	hash := sha256.New()
+	count := byteCounter(0)
+	tmpKey := "tmp-" + NewUUID()
+
+	err := blobStore.Put(tmpKey, size,
+		io.TeeReader(r, io.MultiWriter(hash, &count)))
+	if err == nil {
+		digest := hex.EncodeToString(hash.Sum(nil))
+
+		// Pin it before it shows up under its digest so it can't be
+		// collected before this Tx is done
+		tx.pinBlob(digest)
+		if err = blobStore.Rename(tmpKey, digest); err == nil {
+			return &StagedBlob{Digest: digest, Size: int64(count)}, nil
+		}
+	}
+
+	blobStore.Delete(tmpKey)
+	return nil, fmt.Errorf("Error saving document: %s", err)
+}
+
+// Saves the blob in the BlobStore, and pins it until the Tx is done
+func (tx *Tx) putBlob(digest string, size int64, r io.Reader) error {
+	tx.pinBlob(digest)
+	return blobStore.Put(digest, size, r)
+}
+
+func (tx *Tx) pinBlob(digest string) {
+	blobLock.Lock()
+	defer blobLock.Unlock()
+
+	blobPins[digest]++
+	tx.pins = append(tx.pins, digest)
+}
+
+// Called when the Tx is done (committed or rolled back). Returns the pinned
+// digests so they can be collected if nothing references them, e.g. because
+// the Tx was rolled back.
+func (tx *Tx) unpinBlobs() []string {
+	if len(tx.pins) == 0 {
+		// Don't need the lock, CollectBlobs's own Txs end up here
+		return nil
+	}
+
+	blobLock.Lock()
+	defer blobLock.Unlock()
+
+	for _, digest := range tx.pins {
+		if blobPins[digest]--; blobPins[digest] <= 0 {
+			delete(blobPins, digest)
+		}
+	}
+	pins := tx.pins
+	tx.pins = nil
+	return pins
+}
+
+// Removes the blobs (from a finished Tx) that the DB no longer references
+func CollectBlobs(digests []string) {
+	if blobStore == nil || len(digests) == 0 {
+		return
+	}
+
+	blobLock.Lock()
+	defer blobLock.Unlock()
+
+	seen := map[string]bool{}
+	for _, digest := range digests {
+		if seen[digest] || blobPins[digest] > 0 {
+			continue
+		}
+		seen[digest] = true
+
+		// Use a new Tx for each one so we see everything that was committed
+		// before we got the lock
+		found, err := hasCommittedContentBlob(digest)
+		if err != nil {
+			log.Printf("Error collecting blob %q: %s", digest, err)
+			continue
+		}
+		if found {
+			continue
+		}
+		if err = blobStore.Delete(digest); err != nil {
+			log.Printf("Error deleting blob %q: %s", digest, err)
+		}
+	}
+}
+
+func hasCommittedContentBlob(digest string) (bool, error) {
+	tx, err := NewTx()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	return hasContentBlob(tx, digest)
+}
+
+// FSBlobStore saves each blob as a file in Dir, spread out across
+// sub-directories named after the first 2 chars of the digest
+type FSBlobStore struct {
+	Dir string
+}
+
+func NewFSBlobStore(dir string) (*FSBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Error creating blob store dir: %s", err)
+	}
+	return &FSBlobStore{Dir: dir}, nil
+}
+
+func NewFSBlobStoreFromURL(u *url.URL) (BlobStore, error) {
+	dir := u.Path
+	if u.Host != "" { // file://relative/dir
+		dir = u.Host + dir
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("Missing the directory in %q", u.String())
+	}
+	return NewFSBlobStore(dir)
+}
+
+func (fs *FSBlobStore) Name() string {
+	return "file"
+}
+
+func (fs *FSBlobStore) fileName(digest string) (string, error) {
+	if len(digest) < 3 || strings.ContainsAny(digest, `/\.`) {
+		return "", fmt.Errorf("Invalid blob digest %q", digest)
+	}
+	return filepath.Join(fs.Dir, digest[:2], digest), nil
+}
+
+func (fs *FSBlobStore) Put(digest string, size int64, r io.Reader) error {
+	name, err := fs.fileName(digest)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(name); err == nil {
+		return nil
+	}
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temp file first so no one sees a partial blob
+	tmp, err := os.CreateTemp(filepath.Dir(name), digest+".*.tmp")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tmp, r)
+	if err == nil && size >= 0 && n != size {
+		err = fmt.Errorf("Expected %d bytes for blob %q, got %d", size,
+			digest, n)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (fs *FSBlobStore) Get(digest string) (io.ReadCloser, error) {
+	name, err := fs.fileName(digest)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(name)
+}
+
+func (fs *FSBlobStore) Delete(digest string) error {
+	name, err := fs.fileName(digest)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (fs *FSBlobStore) Rename(from string, to string) error {
+	fromName, err := fs.fileName(from)
+	if err != nil {
+		return err
+	}
+	toName, err := fs.fileName(to)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(toName); err == nil {
+		return fs.Delete(from)
+	}
+	if err = os.MkdirAll(filepath.Dir(toName), 0755); err != nil {
+		return err
+	}
+	return os.Rename(fromName, toName)
+}
@@ -0,0 +1,244 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/duglin/dlog"
+)
+
+// One entity in a bulk import stream (JSON-lines, one entity per line).
+// Entities are processed in order, so parents should appear before their
+// children, and Versions oldest first.
+type BulkEntity struct {
+	Path       string         `json:"path"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Document   []byte         `json:"document,omitempty"` // base64 in JSON
+}
+
+type BulkError struct {
+	Entity int    `json:"entity"` // Position in the stream, starting at 1
+	Path   string `json:"path,omitempty"`
+	Error  string `json:"error"`
+}
+
+type BulkResult struct {
+	Entities  int          `json:"entities"`  // Number processed
+	Committed int          `json:"committed"` // Number saved in the DB
+	Errors    []*BulkError `json:"errors,omitempty"`
+}
+
+// Create or replace (like a PUT) the entity at "be.Path"
+func ApplyBulkEntity(tx *Tx, reg *Registry, be *BulkEntity) error {
+	log.VPrintf(3, ">Enter: ApplyBulkEntity(%s)", be.Path)
+	defer log.VPrintf(3, "<Exit: ApplyBulkEntity")
+
+	path := strings.Trim(be.Path, "/")
+	top, _, _ := strings.Cut(path, "/")
+	if top == "model" || top == "subscriptions" || top == "import" ||
+		strings.HasPrefix(top, "reg-") || strings.HasSuffix(path, "$meta") {
+		return fmt.Errorf("Invalid \"path\" value (%s): must be the path "+
+			"to an entity in the registry", be.Path)
+	}
+
+	info := &RequestInfo{
+		tx:           tx,
+		Registry:     reg,
+		OriginalPath: path,
+	}
+	if err := info.ParseRequestURL(); err != nil {
+		return err
+	}
+	if info.What != "Entity" && info.What != "Registry" {
+		return fmt.Errorf("Invalid \"path\" value (%s): must be the path "+
+			"to an entity in the registry", be.Path)
+	}
+
+	obj := Object(be.Attributes)
+	if obj == nil {
+		obj = Object{}
+	}
+
+	if len(info.Parts) == 0 {
+		if be.Document != nil {
+			return fmt.Errorf("Only Resources and Versions can have " +
+				"a \"document\"")
+		}
+		return reg.Update(obj, ADD_UPDATE, false)
+	}
+
+	if len(info.Parts) == 2 {
+		if be.Document != nil {
+			return fmt.Errorf("Only Resources and Versions can have " +
+				"a \"document\"")
+		}
+		_, _, err := reg.UpsertGroupWithObject(info.GroupType, info.GroupUID,
+			obj, ADD_UPSERT, false)
+		return err
+	}
+
+	rm := info.ResourceModel
+	if err := ConvertResourceContents(obj, rm); err != nil {
+		return err
+	}
+	if be.Document != nil {
+		if !rm.GetHasDocument() {
+			return fmt.Errorf("Resource type %q doesn't have documents",
+				rm.Plural)
+		}
+		obj[rm.Singular] = be.Document
+	}
+
+	group, _, err := reg.UpsertGroup(info.GroupType, info.GroupUID)
+	if err != nil {
+		return err
+	}
+
+	if len(info.Parts) == 4 {
+		_, _, err = group.UpsertResourceWithObject(info.ResourceType,
+			info.ResourceUID, "", obj, ADD_UPSERT, false, false)
+		return err
+	}
+
+	// GROUPs/gID/RESOURCEs/rID/versions/vID
+	resource, err := group.FindResource(info.ResourceType, info.ResourceUID,
+		false)
+	if err != nil {
+		return err
+	}
+	if resource == nil {
+		_, err = group.AddResourceWithObject(info.ResourceType,
+			info.ResourceUID, info.VersionUID, obj, false, true)
+		return err
+	}
+	_, _, err = resource.UpsertVersionWithObject(info.VersionUID, obj,
+		ADD_UPSERT)
+	return err
+}
+
+// POST /import[?batch=N] + JSON-lines stream of BulkEntity's
+// By default it's all-or-nothing. With "batch" each set of N entities is
+// committed on its own, and a batch with any errors is rolled back. The user
+// needs write access to each entity's path, not just to /import.
+func HTTPBulkImport(info *RequestInfo) error {
+	method := strings.ToUpper(info.OriginalRequest.Method)
+
+	if len(info.Parts) > 1 {
+		info.StatusCode = http.StatusNotFound
+		return fmt.Errorf("Not found")
+	}
+
+	if method != "POST" {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("%s not allowed on /import", method)
+	}
+
+	batch := 0
+	if tmp := info.OriginalRequest.URL.Query().Get("batch"); tmp != "" {
+		var err error
+		if batch, err = strconv.Atoi(tmp); err != nil || batch < 1 {
+			info.StatusCode = http.StatusBadRequest
+			return fmt.Errorf("Invalid \"batch\" value (%s), must be an "+
+				"integer greater than zero", tmp)
+		}
+	}
+
+	result := &BulkResult{}
+	pending := 0    // Number of entities in the current batch
+	failed := false // Does the current batch have any errors?
+	denied := false // Was the user not allowed to write an entity?
+
+	flush := func() error {
+		if failed {
+			if err := info.tx.Rollback(); err != nil {
+				return err
+			}
+			// Drop any changes to the in-memory Registry too
+			if err := info.Registry.Refresh(); err != nil {
+				return err
+			}
+		} else {
+			if err := info.tx.Commit(); err != nil {
+				return err
+			}
+			result.Committed += pending
+		}
+		pending = 0
+		failed = false
+		return nil
+	}
+
+	dec := json.NewDecoder(info.OriginalRequest.Body)
+	for {
+		be := &BulkEntity{}
+		err := dec.Decode(be)
+		if err == io.EOF {
+			break
+		}
+
+		result.Entities++
+		pending++
+
+		if err != nil {
+			// Can't trust the rest of the stream so stop here
+			result.Errors = append(result.Errors, &BulkError{
+				Entity: result.Entities,
+				Error:  "Error parsing entity: " + err.Error(),
+			})
+			failed = true
+			break
+		}
+
+		// The request itself was only checked against "/import", so make
+		// sure the user can write each entity too. Like a parsing error,
+		// we don't go any further than this one.
+		if info.Auth != nil && !info.Auth.Allowed(info.User, ACCESS_WRITE,
+			info.Registry.UID, be.Path) {
+
+			result.Errors = append(result.Errors, &BulkError{
+				Entity: result.Entities,
+				Path:   be.Path,
+				Error: fmt.Sprintf("User %q isn't allowed to %s %q",
+					info.User, ACCESS_WRITE, "/"+strings.Trim(be.Path, "/")),
+			})
+			failed = true
+			denied = true
+			break
+		}
+
+		if err = ApplyBulkEntity(info.tx, info.Registry, be); err != nil {
+			result.Errors = append(result.Errors, &BulkError{
+				Entity: result.Entities,
+				Path:   be.Path,
+				Error:  err.Error(),
+			})
+			failed = true
+		}
+
+		if batch > 0 && pending == batch {
+			if err = flush(); err != nil {
+				info.StatusCode = http.StatusInternalServerError
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+
+	info.StatusCode = http.StatusOK
+	if denied {
+		info.StatusCode = http.StatusForbidden
+	} else if len(result.Errors) > 0 {
+		info.StatusCode = http.StatusBadRequest
+	}
+	info.AddHeader("Content-Type", "application/json")
+	info.Write([]byte(ToJSON(result) + "\n"))
+	return nil
+}
@@ -0,0 +1,620 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Resource compatibility modes. "backward" means the new Version can read
+// data written with the old one, "forward" is the reverse, and "full" is
+// both. Non-transitive modes only check against the default Version,
+// transitive ones check against all of them.
+const COMPAT_NONE = "none"
+const COMPAT_BACKWARD = "backward"
+const COMPAT_BACKWARD_TRANSITIVE = "backward_transitive"
+const COMPAT_FORWARD = "forward"
+const COMPAT_FORWARD_TRANSITIVE = "forward_transitive"
+const COMPAT_FULL = "full"
+const COMPAT_FULL_TRANSITIVE = "full_transitive"
+
+var CompatibilityModes = []string{COMPAT_NONE, COMPAT_BACKWARD,
+	COMPAT_BACKWARD_TRANSITIVE, COMPAT_FORWARD, COMPAT_FORWARD_TRANSITIVE,
+	COMPAT_FULL, COMPAT_FULL_TRANSITIVE}
+
+// A CompatibilityChecker returns the list of reasons why data written with
+// the "writer" document can't be read with the "reader" one. Each one
+// starts with the path, in "reader", to where the problem is.
+type CompatibilityChecker func(reader, writer []byte) ([]string, error)
+
+// Keyed the same way as ContentValidators
+var CompatibilityCheckers = map[string]CompatibilityChecker{}
+
+func RegisterCompatibilityChecker(key string, fn CompatibilityChecker) {
+	CompatibilityCheckers[strings.ToLower(key)] = fn
+}
+
+func init() {
+	for key, fn := range map[string]CompatibilityChecker{
+		"jsonschema":                       CheckJSONSchemaCompatibility,
+		"application/schema+json":          CheckJSONSchemaCompatibility,
+		"avro":                             CheckAvroCompatibility,
+		"application/vnd.apache.avro+json": CheckAvroCompatibility,
+	} {
+		RegisterCompatibilityChecker(key, fn)
+	}
+}
+
+func FindCompatibilityChecker(format string, contentType string) (string,
+	CompatibilityChecker) {
+
+	format, contentType = ContentKeys(format, contentType)
+	if fn := CompatibilityCheckers[format]; fn != nil {
+		return format, fn
+	}
+	if fn := CompatibilityCheckers[contentType]; fn != nil {
+		return contentType, fn
+	}
+	return "", nil
+}
+
+// Make sure a new Version's document is compatible with the existing
+// Version(s) per the Resource model's "compatibility" setting
+func (v *Version) CheckCompatibility() error {
+	_, rm := v.GetModels()
+	if rm == nil || rm.Compatibility == "" || rm.Compatibility == COMPAT_NONE {
+		return nil
+	}
+
+	_, checker := FindCompatibilityChecker(v.NewDocumentFormat())
+	if checker == nil {
+		return nil
+	}
+	doc, err := v.NewDocument()
+	if doc == nil || err != nil {
+		return err
+	}
+
+	others := []*Version{}
+	mode, transitive := strings.CutSuffix(rm.Compatibility, "_transitive")
+	if transitive {
+		list, err := v.Resource.GetVersions()
+		if err != nil {
+			return err
+		}
+		for _, other := range list {
+			if other.UID != v.UID {
+				others = append(others, other)
+			}
+		}
+		sort.Slice(others, func(i, j int) bool {
+			return others[i].UID < others[j].UID
+		})
+	} else {
+		def, err := v.Resource.GetDefault()
+		if err != nil {
+			return err
+		}
+		if def != nil && def.UID != v.UID {
+			others = append(others, def)
+		}
+	}
+
+	errs := []string{}
+	for _, other := range others {
+		oldDoc, _ := other.Get("#resource").([]byte)
+		if oldDoc == nil {
+			continue
+		}
+
+		if mode == COMPAT_BACKWARD || mode == COMPAT_FULL {
+			diffs, err := checker(doc, oldDoc)
+			if err != nil {
+				return fmt.Errorf("Error checking compatibility with "+
+					"Version %q: %s", other.UID, err)
+			}
+			if len(diffs) > 0 {
+				errs = append(errs, fmt.Sprintf("Version %q isn't backward "+
+					"compatible with Version %q, it can't read data written "+
+					"with it:\n- %s", v.UID, other.UID,
+					strings.Join(diffs, "\n- ")))
+			}
+		}
+
+		if mode == COMPAT_FORWARD || mode == COMPAT_FULL {
+			diffs, err := checker(oldDoc, doc)
+			if err != nil {
+				return fmt.Errorf("Error checking compatibility with "+
+					"Version %q: %s", other.UID, err)
+			}
+			if len(diffs) > 0 {
+				errs = append(errs, fmt.Sprintf("Version %q isn't forward "+
+					"compatible with Version %q, Version %q can't read data "+
+					"written with it:\n- %s", v.UID, other.UID, other.UID,
+					strings.Join(diffs, "\n- ")))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func compatDiff(path string, format string, args ...any) string {
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Sprintf("%q: %s", path, fmt.Sprintf(format, args...))
+}
+
+// JSON Schema. Every value valid against "writer" must also be valid
+// against "reader". Only the common keywords are checked.
+
+func CheckJSONSchemaCompatibility(reader, writer []byte) ([]string, error) {
+	rVal, err := parseJSONDoc(reader)
+	if err != nil {
+		return nil, err
+	}
+	wVal, err := parseJSONDoc(writer)
+	if err != nil {
+		return nil, err
+	}
+	diffs := []string{}
+	compatJSONSchema(rVal, wVal, "", &diffs)
+	return diffs, nil
+}
+
+// Returns the set of types allowed, nil means any type
+func jsonSchemaTypeSet(schema map[string]any) map[string]bool {
+	set := map[string]bool(nil)
+	add := func(t any) {
+		if str, ok := t.(string); ok {
+			set[str] = true
+		}
+	}
+	switch t := schema["type"].(type) {
+	case string:
+		set = map[string]bool{}
+		add(t)
+	case []any:
+		set = map[string]bool{}
+		for _, item := range t {
+			add(item)
+		}
+	}
+	return set
+}
+
+func jsonSchemaNum(schema map[string]any, key string) (float64, bool) {
+	num, ok := schema[key].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := num.Float64()
+	return f, err == nil
+}
+
+func compatJSONSchema(reader, writer any, path string, diffs *[]string) {
+	if rBool, ok := reader.(bool); ok {
+		if !rBool && writer != false {
+			*diffs = append(*diffs, compatDiff(path, "no values are accepted"))
+		}
+		return
+	}
+	if writer == false {
+		return // Nothing is ever written
+	}
+	rSchema, _ := reader.(map[string]any)
+	wSchema, _ := writer.(map[string]any)
+	if wSchema == nil {
+		wSchema = map[string]any{} // "true" is the same as {}
+	}
+	if rSchema == nil {
+		return
+	}
+
+	// Types
+	rTypes, wTypes := jsonSchemaTypeSet(rSchema), jsonSchemaTypeSet(wSchema)
+	if rTypes != nil {
+		if wTypes == nil {
+			*diffs = append(*diffs, compatDiff(subPath(path, "type"),
+				"only type(s) %s are accepted",
+				strings.Join(SortedKeys(rTypes), ", ")))
+		} else {
+			for _, t := range SortedKeys(wTypes) {
+				if !rTypes[t] && !(t == "integer" && rTypes["number"]) {
+					*diffs = append(*diffs, compatDiff(subPath(path, "type"),
+						"type %q isn't accepted", t))
+				}
+			}
+		}
+	}
+
+	// Enums
+	if rEnum, ok := rSchema["enum"].([]any); ok {
+		wEnum, ok := wSchema["enum"].([]any)
+		if !ok {
+			*diffs = append(*diffs, compatDiff(subPath(path, "enum"),
+				"only a fixed set of values are accepted"))
+		} else {
+			for _, wv := range wEnum {
+				found := false
+				wBuf, _ := json.Marshal(wv)
+				for _, rv := range rEnum {
+					rBuf, _ := json.Marshal(rv)
+					if string(rBuf) == string(wBuf) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					*diffs = append(*diffs, compatDiff(subPath(path, "enum"),
+						"value %s isn't accepted", string(wBuf)))
+				}
+			}
+		}
+	}
+
+	// Numeric limits
+	for _, key := range []string{"minimum", "exclusiveMinimum", "minLength",
+		"minItems", "minProperties"} {
+		if rNum, ok := jsonSchemaNum(rSchema, key); ok {
+			wNum, ok := jsonSchemaNum(wSchema, key)
+			if !ok {
+				*diffs = append(*diffs, compatDiff(subPath(path, key),
+					"%v is a new limit", rNum))
+			} else if rNum > wNum {
+				*diffs = append(*diffs, compatDiff(subPath(path, key),
+					"%v is more restrictive than %v", rNum, wNum))
+			}
+		}
+	}
+	for _, key := range []string{"maximum", "exclusiveMaximum", "maxLength",
+		"maxItems", "maxProperties"} {
+		if rNum, ok := jsonSchemaNum(rSchema, key); ok {
+			wNum, ok := jsonSchemaNum(wSchema, key)
+			if !ok {
+				*diffs = append(*diffs, compatDiff(subPath(path, key),
+					"%v is a new limit", rNum))
+			} else if rNum < wNum {
+				*diffs = append(*diffs, compatDiff(subPath(path, key),
+					"%v is more restrictive than %v", rNum, wNum))
+			}
+		}
+	}
+
+	// Required properties
+	wRequired := map[string]bool{}
+	if list, ok := wSchema["required"].([]any); ok {
+		for _, name := range list {
+			if str, ok := name.(string); ok {
+				wRequired[str] = true
+			}
+		}
+	}
+	if list, ok := rSchema["required"].([]any); ok {
+		for _, name := range list {
+			if str, ok := name.(string); ok && !wRequired[str] {
+				*diffs = append(*diffs, compatDiff(subPath(path, "required"),
+					"%q is required", str))
+			}
+		}
+	}
+
+	// Properties
+	rProps, _ := rSchema["properties"].(map[string]any)
+	wProps, _ := wSchema["properties"].(map[string]any)
+	rAdditional, hasAdditional := rSchema["additionalProperties"]
+	for _, name := range SortedKeys(wProps) {
+		if rProp, ok := rProps[name]; ok {
+			compatJSONSchema(rProp, wProps[name],
+				subPath(subPath(path, "properties"), name), diffs)
+		} else if rAdditional == false {
+			*diffs = append(*diffs, compatDiff(subPath(path, "properties"),
+				"property %q isn't accepted", name))
+		} else if hasAdditional {
+			compatJSONSchema(rAdditional, wProps[name],
+				subPath(path, "additionalProperties"), diffs)
+		}
+	}
+	if rAdditional == false {
+		if wAdditional, ok := wSchema["additionalProperties"]; !ok ||
+			wAdditional != false {
+			*diffs = append(*diffs, compatDiff(
+				subPath(path, "additionalProperties"),
+				"additional properties aren't accepted"))
+		}
+	} else if rMap, ok := rAdditional.(map[string]any); ok {
+		if wAdditional, ok := wSchema["additionalProperties"]; ok {
+			compatJSONSchema(rMap, wAdditional,
+				subPath(path, "additionalProperties"), diffs)
+		}
+	}
+
+	// Items
+	if rItems, ok := rSchema["items"]; ok {
+		if _, isList := rItems.([]any); !isList {
+			wItems, ok := wSchema["items"]
+			if _, wIsList := wItems.([]any); ok && !wIsList {
+				compatJSONSchema(rItems, wItems, subPath(path, "items"), diffs)
+			}
+		}
+	}
+}
+
+// Avro. Uses the Avro schema resolution rules to see if data written
+// with "writer" can be read with "reader".
+
+func CheckAvroCompatibility(reader, writer []byte) ([]string, error) {
+	rVal, err := parseJSONDoc(reader)
+	if err != nil {
+		return nil, err
+	}
+	wVal, err := parseJSONDoc(writer)
+	if err != nil {
+		return nil, err
+	}
+
+	ac := &avroCompat{
+		rNames: map[string]any{},
+		wNames: map[string]any{},
+		seen:   map[string]bool{},
+	}
+	avroCollectNames(rVal, "", ac.rNames)
+	avroCollectNames(wVal, "", ac.wNames)
+	ac.compat(rVal, wVal, "")
+	return ac.diffs, nil
+}
+
+type avroCompat struct {
+	rNames map[string]any // named types in reader
+	wNames map[string]any // named types in writer
+	seen   map[string]bool
+	diffs  []string
+}
+
+func avroFullName(obj map[string]any, namespace string) (string, string) {
+	name, _ := obj["name"].(string)
+	if ns, ok := obj["namespace"].(string); ok {
+		namespace = ns
+	}
+	if strings.Contains(name, ".") {
+		namespace = name[:strings.LastIndex(name, ".")]
+		return name, namespace
+	}
+	if namespace != "" {
+		return namespace + "." + name, namespace
+	}
+	return name, namespace
+}
+
+func avroCollectNames(val any, namespace string, names map[string]any) {
+	switch val := val.(type) {
+	case []any:
+		for _, item := range val {
+			avroCollectNames(item, namespace, names)
+		}
+	case map[string]any:
+		switch val["type"] {
+		case "record", "error", "enum", "fixed":
+			full, ns := avroFullName(val, namespace)
+			names[full] = val
+			if short, _ := val["name"].(string); short != full {
+				names[short] = val
+			}
+			namespace = ns
+		}
+		if t, ok := val["type"].(map[string]any); ok {
+			avroCollectNames(t, namespace, names)
+		} else if t, ok := val["type"].([]any); ok {
+			avroCollectNames(t, namespace, names)
+		}
+		if fields, ok := val["fields"].([]any); ok {
+			for _, f := range fields {
+				if field, ok := f.(map[string]any); ok {
+					avroCollectNames(field["type"], namespace, names)
+				}
+			}
+		}
+		avroCollectNames(val["items"], namespace, names)
+		avroCollectNames(val["values"], namespace, names)
+	}
+}
+
+// Returns the type name of a schema node, and the node itself with any
+// named type references resolved
+func avroResolve(val any, names map[string]any) (string, any) {
+	switch v := val.(type) {
+	case string:
+		if def, ok := names[v]; ok {
+			return avroResolve(def, nil)
+		}
+		return v, v
+	case []any:
+		return "union", v
+	case map[string]any:
+		switch t := v["type"].(type) {
+		case string:
+			if def, ok := names[t]; ok && t != "record" && t != "enum" &&
+				t != "fixed" && t != "error" && t != "array" && t != "map" {
+				return avroResolve(def, nil)
+			}
+			if t == "error" {
+				return "record", v
+			}
+			return t, v
+		default:
+			return avroResolve(t, names)
+		}
+	}
+	return "", val
+}
+
+var avroPromotions = map[string][]string{
+	"int":    {"long", "float", "double"},
+	"long":   {"float", "double"},
+	"float":  {"double"},
+	"string": {"bytes"},
+	"bytes":  {"string"},
+}
+
+// Returns true if "writer" can be read as "reader", w/o adding any diffs
+func (ac *avroCompat) matches(reader, writer any) bool {
+	saved := ac.diffs
+	ac.diffs = nil
+	ac.compat(reader, writer, "")
+	ok := len(ac.diffs) == 0
+	ac.diffs = saved
+	return ok
+}
+
+func (ac *avroCompat) add(path string, format string, args ...any) {
+	ac.diffs = append(ac.diffs, compatDiff(path, format, args...))
+}
+
+func (ac *avroCompat) compat(reader, writer any, path string) {
+	rType, rNode := avroResolve(reader, ac.rNames)
+	wType, wNode := avroResolve(writer, ac.wNames)
+
+	if wType == "union" {
+		// Every type the writer might use must be readable
+		for _, branch := range wNode.([]any) {
+			if rType == "union" {
+				found := false
+				for _, rBranch := range rNode.([]any) {
+					if ac.matches(rBranch, branch) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					bType, _ := avroResolve(branch, ac.wNames)
+					ac.add(path, "type %q isn't accepted", bType)
+				}
+			} else {
+				ac.compat(reader, branch, path)
+			}
+		}
+		return
+	}
+
+	if rType == "union" {
+		for _, rBranch := range rNode.([]any) {
+			if ac.matches(rBranch, writer) {
+				return
+			}
+		}
+		ac.add(path, "type %q isn't accepted", wType)
+		return
+	}
+
+	if rType != wType {
+		for _, t := range avroPromotions[wType] {
+			if t == rType {
+				return
+			}
+		}
+		if _, ok := reader.(map[string]any); ok {
+			path = subPath(path, "type")
+		}
+		ac.add(path, "type %q can't be read as %q", wType, rType)
+		return
+	}
+
+	rObj, _ := rNode.(map[string]any)
+	wObj, _ := wNode.(map[string]any)
+
+	switch rType {
+	case "record":
+		rName, _ := rObj["name"].(string)
+		wName, _ := wObj["name"].(string)
+		if rName != wName {
+			ac.add(subPath(path, "name"), "name %q doesn't match %q",
+				rName, wName)
+			return
+		}
+
+		// Avoid looping forever on recursive types
+		key := rName + "\x00" + path
+		if ac.seen[key] {
+			return
+		}
+		ac.seen[key] = true
+
+		wFields := map[string]map[string]any{}
+		if list, ok := wObj["fields"].([]any); ok {
+			for _, f := range list {
+				if field, ok := f.(map[string]any); ok {
+					name, _ := field["name"].(string)
+					wFields[name] = field
+				}
+			}
+		}
+
+		rFields, _ := rObj["fields"].([]any)
+		for i, f := range rFields {
+			field, _ := f.(map[string]any)
+			name, _ := field["name"].(string)
+			fPath := indexPath(subPath(path, "fields"), i)
+
+			wField := wFields[name]
+			if wField == nil {
+				if aliases, ok := field["aliases"].([]any); ok {
+					for _, alias := range aliases {
+						if str, ok := alias.(string); ok && wFields[str] != nil {
+							wField = wFields[str]
+							break
+						}
+					}
+				}
+			}
+
+			if wField == nil {
+				if _, ok := field["default"]; !ok {
+					ac.add(fPath, "field %q is missing and has no default",
+						name)
+				}
+				continue
+			}
+			ac.compat(field["type"], wField["type"], subPath(fPath, "type"))
+		}
+
+	case "enum":
+		if _, ok := rObj["default"]; ok {
+			return
+		}
+		rSymbols := map[string]bool{}
+		if list, ok := rObj["symbols"].([]any); ok {
+			for _, s := range list {
+				if str, ok := s.(string); ok {
+					rSymbols[str] = true
+				}
+			}
+		}
+		if list, ok := wObj["symbols"].([]any); ok {
+			for _, s := range list {
+				if str, ok := s.(string); ok && !rSymbols[str] {
+					ac.add(subPath(path, "symbols"),
+						"symbol %q isn't accepted", str)
+				}
+			}
+		}
+
+	case "array":
+		ac.compat(rObj["items"], wObj["items"], subPath(path, "items"))
+
+	case "map":
+		ac.compat(rObj["values"], wObj["values"], subPath(path, "values"))
+
+	case "fixed":
+		rSize, _ := rObj["size"].(json.Number)
+		wSize, _ := wObj["size"].(json.Number)
+		if rSize != wSize {
+			ac.add(subPath(path, "size"), "size %s doesn't match %s",
+				rSize, wSize)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompatibilityCheckers(t *testing.T) {
+	type Test struct {
+		Checker CompatibilityChecker
+		Reader  string
+		Writer  string
+		Diffs   string
+	}
+
+	json := CheckJSONSchemaCompatibility
+	avro := CheckAvroCompatibility
+
+	tests := []Test{
+		// JSON Schema
+		{json, `{}`, `{"type":"string"}`, ``},
+		{json, `true`, `{"type":"string"}`, ``},
+		{json, `{"type":"string"}`, `false`, ``},
+		{json, `false`, `{}`, `"(root)": no values are accepted`},
+		{json, `{"type":"number"}`, `{"type":"integer"}`, ``},
+		{json, `{"type":"integer"}`, `{"type":["integer","null"]}`,
+			`"type": type "null" isn't accepted`},
+		{json, `{"type":"integer"}`, `{}`,
+			`"type": only type(s) integer are accepted`},
+		{json, `{"enum":["a","b"]}`, `{"enum":["a"]}`, ``},
+		{json, `{"enum":["a"]}`, `{"enum":["a","b"]}`,
+			`"enum": value "b" isn't accepted`},
+		{json, `{"maxLength":5}`, `{"maxLength":10}`,
+			`"maxLength": 5 is more restrictive than 10`},
+		{json, `{"minimum":1}`, `{}`, `"minimum": 1 is a new limit`},
+		{json, `{"maximum":10}`, `{"maximum":5}`, ``},
+		{json, `{"properties":{"a":{"type":"string"}},"required":["a"]}`,
+			`{"properties":{"a":{"type":"string"}},"required":["a"]}`, ``},
+		{json, `{"properties":{"a":{},"b":{}},"required":["a","b"]}`,
+			`{"properties":{"a":{}},"required":["a"]}`,
+			`"required": "b" is required`},
+		{json, `{"properties":{"a":{"type":"integer"}}}`,
+			`{"properties":{"a":{"type":"string"},"b":{}}}`,
+			`"properties.a.type": type "string" isn't accepted`},
+		{json, `{"properties":{"a":{}},"additionalProperties":false}`,
+			`{"properties":{"a":{},"b":{}}}`,
+			`"properties": property "b" isn't accepted` + "\n" +
+				`"additionalProperties": additional properties aren't accepted`},
+		{json, `{"additionalProperties":{"type":"string"}}`,
+			`{"additionalProperties":{"type":"integer"}}`,
+			`"additionalProperties.type": type "integer" isn't accepted`},
+		{json, `{"items":{"type":"string"}}`, `{"items":{"type":"integer"}}`,
+			`"items.type": type "integer" isn't accepted`},
+
+		// Avro
+		{avro, `"long"`, `"int"`, ``},
+		{avro, `"int"`, `"long"`, `"(root)": type "long" can't be read as "int"`},
+		{avro, `["null","string"]`, `"string"`, ``},
+		{avro, `"string"`, `["null","string"]`,
+			`"(root)": type "null" can't be read as "string"`},
+		{avro, `["null","int"]`, `["null","string"]`,
+			`"(root)": type "string" isn't accepted`},
+		{avro, `{"type":"record","name":"r","fields":[
+		   {"name":"a","type":"int"},
+		   {"name":"b","type":"string","default":""}]}`,
+			`{"type":"record","name":"r","fields":[{"name":"a","type":"int"},
+		   {"name":"c","type":"int"}]}`, ``},
+		{avro, `{"type":"record","name":"r","fields":[
+		   {"name":"a","type":"int"},{"name":"b","type":"string"}]}`,
+			`{"type":"record","name":"r","fields":[{"name":"a","type":"string"}]}`,
+			`"fields[0].type": type "string" can't be read as "int"` +
+				"\n" + `"fields[1]": field "b" is missing and has no default`},
+		{avro, `{"type":"record","name":"r","fields":[
+		   {"name":"b","aliases":["a"],"type":"int"}]}`,
+			`{"type":"record","name":"r","fields":[{"name":"a","type":"int"}]}`,
+			``},
+		{avro, `{"type":"record","name":"r","fields":[]}`,
+			`{"type":"record","name":"x","fields":[]}`,
+			`"name": name "r" doesn't match "x"`},
+		{avro, `{"type":"enum","name":"e","symbols":["A"]}`,
+			`{"type":"enum","name":"e","symbols":["A","B"]}`,
+			`"symbols": symbol "B" isn't accepted`},
+		{avro, `{"type":"enum","name":"e","symbols":["A"],"default":"A"}`,
+			`{"type":"enum","name":"e","symbols":["A","B"]}`, ``},
+		{avro, `{"type":"array","items":"long"}`,
+			`{"type":"array","items":"int"}`, ``},
+		{avro, `{"type":"map","values":"int"}`,
+			`{"type":"map","values":"string"}`,
+			`"values": type "string" can't be read as "int"`},
+		{avro, `{"type":"fixed","name":"f","size":4}`,
+			`{"type":"fixed","name":"f","size":8}`,
+			`"size": size 4 doesn't match 8`},
+		// Named type references and recursion
+		{avro, `{"type":"record","name":"n","namespace":"x","fields":[
+		   {"name":"next","type":["null","n"]}]}`,
+			`{"type":"record","name":"n","namespace":"x","fields":[
+		   {"name":"next","type":["null","x.n"]}]}`, ``},
+	}
+
+	for i, test := range tests {
+		diffs, err := test.Checker([]byte(test.Reader), []byte(test.Writer))
+		if err != nil {
+			t.Errorf("Test %d: unexpected error: %s", i, err)
+			continue
+		}
+		if got := strings.Join(diffs, "\n"); got != test.Diffs {
+			t.Errorf("Test %d: Reader: %s\nWriter: %s\nExp: %s\nGot: %s",
+				i, test.Reader, test.Writer, test.Diffs, got)
+		}
+	}
+
+	_, err := CheckAvroCompatibility([]byte(`{`), []byte(`"int"`))
+	if err == nil || !strings.HasPrefix(err.Error(), "Syntax error at line 1") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
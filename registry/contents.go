@@ -0,0 +1,131 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Resource documents are stored once in ContentBlobs, keyed by the SHA-256
+// of their bytes, and each Version just points to the digest via its
+// ResourceContents row. When the last reference to a blob goes away the
+// ResourceContentsTrigger deletes the blob.
+
+// Returns the value of the "contentdigest" attribute for "buf"
+func ContentDigest(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Converts a "contentdigest" value into the value of an HTTP "Digest"
+// header (RFC 3230), e.g. "sha-256=<base64>". Returns "" if it's not valid.
+func DigestHeader(digest string) string {
+	hexStr, ok := strings.CutPrefix(digest, "sha256:")
+	if !ok {
+		return ""
+	}
+	sum, err := hex.DecodeString(hexStr)
+	if err != nil || len(sum) != sha256.Size {
+		return ""
+	}
+	return "sha-256=" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// Returns the digest (hex, w/o the "sha256:" prefix) of the document stored
+// for the Version, or "" if there isn't one
+func getContentDigest(tx *Tx, versionSID string) (string, error) {
+	results, err := Query(tx, `
+        SELECT Digest FROM ResourceContents WHERE VersionSID=?`, versionSID)
+	defer results.Close()
+	if err != nil {
+		return "", err
+	}
+
+	row := results.NextRow()
+	if row == nil {
+		return "", nil
+	}
+	return NotNilString(row[0]), nil
+}
+
+// Points the Version at "buf", adding the blob if we don't already have it.
+// Any previously referenced blob is garbage collected by the DB trigger.
+func saveContent(tx *Tx, versionSID string, buf []byte) error {
+	digest := ContentDigest(buf)[len("sha256:"):]
+
+	return setContent(tx, versionSID, digest, func() (any, error) {
+		// When there's a BlobStore the DB only holds a reference to it
+		if blobStore == nil {
+			return buf, nil
+		}
+		err := tx.putBlob(digest, int64(len(buf)), bytes.NewReader(buf))
+		if err != nil {
+			return nil, fmt.Errorf("Error saving document: %s", err)
+		}
+		return nil, nil
+	})
+}
+
+// Same as saveContent but for a document that's already in the BlobStore
+func saveStagedContent(tx *Tx, versionSID string, blob *StagedBlob) error {
+	return setContent(tx, versionSID, blob.Digest, func() (any, error) {
+		return nil, nil
+	})
+}
+
+// Points the Version at "digest". If we don't have that blob yet then
+// "contentFn" is called to get the ContentBlobs.Content value for it.
+func setContent(tx *Tx, versionSID string, digest string,
+	contentFn func() (any, error)) error {
+
+	oldDigest, err := getContentDigest(tx, versionSID)
+	if err != nil || oldDigest == digest {
+		return err
+	}
+
+	if oldDigest != "" {
+		err = Do(tx, `DELETE FROM ResourceContents WHERE VersionSID=?`,
+			versionSID)
+		if err != nil {
+			return err
+		}
+		if blobStore != nil {
+			tx.blobs = append(tx.blobs, oldDigest)
+		}
+	}
+
+	found, err := hasContentBlob(tx, digest)
+	if err != nil {
+		return err
+	}
+	if !found {
+		content, err := contentFn()
+		if err != nil {
+			return err
+		}
+		err = DoOne(tx, `
+            INSERT INTO ContentBlobs(Digest, Content) VALUES(?,?)`,
+			digest, content)
+		if err != nil {
+			return err
+		}
+	}
+
+	return DoOne(tx, `
+        INSERT INTO ResourceContents(VersionSID, Digest) VALUES(?,?)`,
+		versionSID, digest)
+}
+
+// Returns true if we already have the blob w/the specified digest
+func hasContentBlob(tx *Tx, digest string) (bool, error) {
+	results, err := Query(tx,
+		`SELECT Digest FROM ContentBlobs WHERE Digest=?`, digest)
+	defer results.Close()
+	if err != nil {
+		return false, err
+	}
+	return results.NextRow() != nil, nil
+}
@@ -0,0 +1,109 @@
+package registry
+
+import (
+	"testing"
+)
+
+func TestDigestHeader(t *testing.T) {
+	digest := ContentDigest([]byte("hello"))
+	if digest != "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e"+
+		"1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("Wrong digest: %s", digest)
+	}
+	if h := DigestHeader(digest); h != "sha-256=LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ=" {
+		t.Fatalf("Wrong header: %s", h)
+	}
+	for _, bad := range []string{"", "md5:abc", "sha256:xyz", "sha256:abcd"} {
+		if h := DigestHeader(bad); h != "" {
+			t.Fatalf("DigestHeader(%q) should be empty, got: %s", bad, h)
+		}
+	}
+}
+
+func TestContentDedup(t *testing.T) {
+	useDBDriver(t, "memory")
+
+	name := "TestContentDedup"
+	if err := CreateDB(name); err != nil {
+		t.Fatalf("CreateDB: %s", err)
+	}
+	defer DeleteDB(name)
+	if err := OpenDB(name); err != nil {
+		t.Fatalf("OpenDB: %s", err)
+	}
+
+	reg, err := NewRegistry(nil, "reg1")
+	if err != nil {
+		t.Fatalf("NewRegistry: %s", err)
+	}
+	defer reg.Rollback()
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+
+	count := func(table string) int {
+		t.Helper()
+		results, err := Query(reg.tx, `SELECT COUNT(*) FROM `+table)
+		defer results.Close()
+		if err != nil {
+			t.Fatalf("Query: %s", err)
+		}
+		return NotNilInt(results.NextRow()[0])
+	}
+
+	d1, _ := reg.AddGroup("dirs", "d1")
+	f1, _ := d1.AddResource("files", "f1", "v1")
+	f2, _ := d1.AddResource("files", "f2", "v1")
+	v1, _ := f1.FindVersion("v1", false)
+	v2, _ := f1.AddVersion("v2")
+	f2v1, _ := f2.FindVersion("v1", false)
+
+	for _, v := range []*Version{v1, v2, f2v1} {
+		if err = v.SetSave("#resource", "hello"); err != nil {
+			t.Fatalf("SetSave: %s", err)
+		}
+	}
+	if c := count("ContentBlobs"); c != 1 {
+		t.Fatalf("Should have 1 blob, not %d", c)
+	}
+	if c := count("ResourceContents"); c != 3 {
+		t.Fatalf("Should have 3 references, not %d", c)
+	}
+	if d := v2.Get("contentdigest"); d != ContentDigest([]byte("hello")) {
+		t.Fatalf("Wrong contentdigest: %v", d)
+	}
+	if doc, _ := f2.Get("#resource").([]byte); string(doc) != "hello" {
+		t.Fatalf("Wrong document: %q", string(doc))
+	}
+
+	// Changing one Version's document doesn't touch the shared blob
+	if err = v2.SetSave("#resource", "world"); err != nil {
+		t.Fatalf("SetSave: %s", err)
+	}
+	if c := count("ContentBlobs"); c != 2 {
+		t.Fatalf("Should have 2 blobs, not %d", c)
+	}
+	if doc, _ := v1.Get("#resource").([]byte); string(doc) != "hello" {
+		t.Fatalf("Wrong document: %q", string(doc))
+	}
+	if d := v2.Get("contentdigest"); d != ContentDigest([]byte("world")) {
+		t.Fatalf("Wrong contentdigest: %v", d)
+	}
+
+	// Unreferenced blobs are garbage collected
+	if err = f1.Delete(); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if c := count("ContentBlobs"); c != 1 {
+		t.Fatalf("Should have 1 blob, not %d", c)
+	}
+	if err = f2v1.SetSave("fileurl", "http://example.com"); err != nil {
+		t.Fatalf("SetSave: %s", err)
+	}
+	if c := count("ContentBlobs"); c != 0 {
+		t.Fatalf("Should have 0 blobs, not %d", c)
+	}
+	if d := f2v1.Get("contentdigest"); d != nil {
+		t.Fatalf("contentdigest should be gone: %v", d)
+	}
+}
@@ -4,30 +4,34 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
-	_ "embed"
 	"fmt"
 	"os"
 	"reflect"
 	"regexp"
 	"runtime/pprof"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/duglin/dlog"
-	_ "github.com/go-sql-driver/mysql"
 )
 
 var DB *sql.DB
 var DB_Name = ""
 var DB_InitFunc func()
 
+var DBDRIVER = "mysql"
 var DBUSER = "root"
 var DBHOST = "localhost"
 var DBPORT = "3306"
 var DBPASSWORD = "password"
+var DBDIR = "."
 
 // TODO load these from a config file
 func init() {
+	if tmp := os.Getenv("DBDRIVER"); tmp != "" {
+		DBDRIVER = tmp
+	}
 	if tmp := os.Getenv("DBUSER"); tmp != "" {
 		DBUSER = tmp
 	}
@@ -40,12 +44,33 @@ func init() {
 	if tmp := os.Getenv("DBPORT"); tmp != "" {
 		DBPORT = tmp
 	}
+	if tmp := os.Getenv("DBDIR"); tmp != "" {
+		DBDIR = tmp
+	}
 }
 
 // Active transaction - mainly for debugging and testing
 var TXs = map[string]*Tx{}
+var txsMutex sync.Mutex
+
+// The number of active Txs, not counting the background ones
+func CountRequestTXs() int {
+	txsMutex.Lock()
+	defer txsMutex.Unlock()
+
+	count := 0
+	for _, t := range TXs {
+		if !t.background {
+			count++
+		}
+	}
+	return count
+}
 
 func DumpTXs() {
+	txsMutex.Lock()
+	defer txsMutex.Unlock()
+
 	// Only show info if there are active Txs
 	if len(TXs) == 0 {
 		return
@@ -124,6 +149,7 @@ type Tx struct {
 	IgnoreEpoch                bool
 	IgnoreStickyDefaultVersion bool
 	IgnoreDefaultVersionID     bool
+	EnforceReadOnly            bool // Block changes to ReadOnly Resources
 
 	// Cache of entities this Tx is dealing with. Things can get funky if
 	// we have more than one instance of the same entity in memory.
@@ -136,6 +162,25 @@ type Tx struct {
 	// Resources  map[string]*Resource // reg.DbSID+g.DbSID+r.UID
 	Versions map[string]*Version // reg.DbSID+g.DbSID+r.DbSID+v.UID
 
+	// Events to publish once (if) this Tx is committed
+	events []*pendingEvent
+
+	// Digests of BlobStore blobs that might not be needed after the commit
+	blobs []string
+
+	// Digests of the BlobStore blobs saved by this Tx, see pinBlob
+	pins []string
+
+	// Registries (DbSIDs) whose Subscriptions were changed by this Tx, their
+	// cache is cleared once it's committed (or rolled back)
+	subsRegs []string
+
+	// Not part of a request, e.g. sending events, see NewBackgroundTx
+	background bool
+
+	// # of rows changed so far, see HasChanges
+	changes int
+
 	// For debugging
 	uuid  string   // just a unique ID for the TXs map key
 	stack []string // Stack at time NewTX
@@ -167,6 +212,17 @@ func NewTx() (*Tx, error) {
 	return tx, nil
 }
 
+// For work that's done in the background, concurrently w/the requests
+func NewBackgroundTx() (*Tx, error) {
+	tx := &Tx{background: true}
+	err := tx.NewTx()
+	if err != nil {
+		log.Printf("NewTx error: %s", err)
+		return nil, err
+	}
+	return tx, nil
+}
+
 // It's ok for this to be called multiple times for the same Tx just to
 // make sure we have an active transaction - it's a no-op at that point
 func (tx *Tx) NewTx() error {
@@ -187,8 +243,7 @@ func (tx *Tx) NewTx() error {
 		return nil
 	}
 
-	t, err := DB.BeginTx(context.Background(),
-		&sql.TxOptions{sql.LevelReadCommitted, false})
+	t, err := DB.BeginTx(context.Background(), GetDBDriver().TxOptions())
 	if err != nil {
 		DB = nil
 		return err
@@ -204,7 +259,9 @@ func (tx *Tx) NewTx() error {
 	tx.Versions = map[string]*Version{}
 	tx.uuid = NewUUID()
 	tx.stack = GetStack()
+	txsMutex.Lock()
 	TXs[tx.uuid] = tx
+	txsMutex.Unlock()
 	return nil
 }
 
@@ -218,11 +275,25 @@ func (tx *Tx) Commit() error {
 		return err
 	}
 
+	events := tx.events
+	blobs := append(tx.blobs, tx.unpinBlobs()...)
+	subsRegs := tx.subsRegs
+
+	txsMutex.Lock()
 	delete(TXs, tx.uuid)
+	txsMutex.Unlock()
 	tx.tx = nil
 	tx.CreateTime = ""
 	tx.Versions = nil // force a NPE if someone tries to use it outside of a tx
 	tx.uuid = ""
+	tx.events = nil
+	tx.blobs = nil
+	tx.subsRegs = nil
+	tx.changes = 0
+
+	ClearSubscriptionsCache(subsRegs...)
+	PublishEvents(events)
+	CollectBlobs(blobs)
 
 	return nil
 }
@@ -237,15 +308,34 @@ func (tx *Tx) Rollback() error {
 		return err
 	}
 
+	// Blobs saved by this Tx might not be needed now
+	pins := tx.unpinBlobs()
+	subsRegs := tx.subsRegs
+
+	txsMutex.Lock()
 	delete(TXs, tx.uuid)
+	txsMutex.Unlock()
 	tx.tx = nil
 	tx.CreateTime = ""
 	tx.Versions = nil // force a NPE if someone tries to use it outside of a tx
 	tx.uuid = ""
+	tx.events = nil
+	tx.blobs = nil
+	tx.subsRegs = nil
+	tx.changes = 0
+
+	ClearSubscriptionsCache(subsRegs...)
+	CollectBlobs(pins)
 
 	return nil
 }
 
+// Returns true if this Tx has changed anything in the DB that hasn't been
+// committed (or rolled back) yet
+func (tx *Tx) HasChanges() bool {
+	return tx.tx != nil && tx.changes > 0
+}
+
 func (tx *Tx) Conditional(err error) error {
 	if err == nil {
 		return tx.Commit()
@@ -482,6 +572,7 @@ func doCount(tx *Tx, cmd string, args ...interface{}) (int, error) {
 	}
 
 	count, _ := result.RowsAffected()
+	tx.changes += int(count)
 	return int(count), err
 }
 
@@ -581,48 +672,82 @@ func DoCount(tx *Tx, num int, cmd string, args ...interface{}) error {
 	return nil
 }
 
+// DBDriver hides the specifics of the underlying SQL database. Each driver
+// knows how to manage the lifecycle of a DB (create/open/delete) and
+// provides the few bits of SQL that can't be written in a portable way.
+type DBDriver interface {
+	Name() string
+	Exists(name string) bool
+	Open(name string) (*sql.DB, error)
+	Create(name string) error
+	Delete(name string) error
+
+	// Options to use when starting a new transaction, nil means "default"
+	TxOptions() *sql.TxOptions
+
+	// Wrap "expr" so that it's compared in a case sensitive manner
+	CaseSensitive(expr string) string
+
+	// Wrap "expr" so that it's compared in a case insensitive manner
+	AnyCase(expr string) string
+
+	// Convert "expr", an RFC3339 string, into something that can be
+	// compared in time order (regardless of its timezone)
+	Timestamp(expr string) string
+}
+
+var DBDrivers = map[string]DBDriver{}
+var dbDriver DBDriver
+
+func RegisterDBDriver(driver DBDriver) {
+	DBDrivers[driver.Name()] = driver
+}
+
+func SetDBDriver(name string) error {
+	driver := DBDrivers[name]
+	if driver == nil {
+		return fmt.Errorf("Unknown DB driver %q, must be one of: %s", name,
+			strings.Join(SortedKeys(DBDrivers), ","))
+	}
+	if dbDriver != nil && dbDriver != driver && DB != nil {
+		DB.Close()
+		DB = nil
+	}
+	dbDriver = driver
+	return nil
+}
+
+// Returns the active DBDriver, defaulting to the one named by DBDRIVER
+func GetDBDriver() DBDriver {
+	if dbDriver == nil {
+		Must(SetDBDriver(DBDRIVER))
+	}
+	return dbDriver
+}
+
 func DBExists(name string) bool {
 	log.VPrintf(3, ">Enter: DBExists %q", name)
 	defer log.VPrintf(3, "<Exit: DBExists")
-	db, err := sql.Open("mysql",
-		DBUSER+":"+DBPASSWORD+"@tcp("+DBHOST+":"+DBPORT+")/")
-	if err != nil {
-		panic(err)
-	}
-	defer db.Close()
 
-	rows, err := db.Query(`
-		SELECT SCHEMA_NAME
-		FROM INFORMATION_SCHEMA.SCHEMATA
-		WHERE SCHEMA_NAME=?`, name)
-	if err != nil {
-		panic(err)
-	}
-	found := rows.Next()
+	found := GetDBDriver().Exists(name)
 	log.VPrintf(3, "<Exit: found: %v", found)
 	return found
 }
 
-//go:embed init.sql
-var initDB string
 var firstTime = true
 
 func OpenDB(name string) error {
 	if firstTime {
-		log.VPrintf(1, "DB: %s:%s", DBHOST, DBPORT)
+		log.VPrintf(1, "DB: %s", GetDBDriver().Name())
 		firstTime = false
 	}
 
 	log.VPrintf(3, ">Enter: OpenDB %q", name)
 	defer log.VPrintf(3, "<Exit: OpenDB")
 
-	// DB, err := sql.Open("mysql",
-	// DBUSER + ":"+DBPASSWORD+"@tcp(localhost:3306)/")
 	var err error
 
-	DB, err = sql.Open("mysql",
-		DBUSER+":"+DBPASSWORD+"@tcp("+DBHOST+":"+DBPORT+")/"+name)
-
+	DB, err = GetDBDriver().Open(name)
 	if err != nil {
 		DB = nil
 		err = fmt.Errorf("Error talking to SQL: %s\n", err)
@@ -645,54 +770,13 @@ func CreateDB(name string) error {
 	log.VPrintf(3, ">Enter: CreateDB %q", name)
 	defer log.VPrintf(3, "<Exit: CreateDB")
 
-	db, err := sql.Open("mysql",
-		DBUSER+":"+DBPASSWORD+"@tcp("+DBHOST+":"+DBPORT+")/")
-	if err != nil {
-		panic(err)
-	}
-	defer db.Close()
-
-	if _, err = db.Exec("CREATE DATABASE " + name); err != nil {
-		panic(err)
-	}
-
-	if _, err = db.Exec("USE " + name); err != nil {
-		panic(err)
-	}
-
-	log.VPrintf(3, "Creating DB")
-
-	for _, cmd := range strings.Split(initDB, ";") {
-		cmd = strings.TrimSpace(cmd)
-		cmd = strings.Replace(cmd, "@", ";", -1) // Can't use ; in file
-		if cmd == "" {
-			continue
-		}
-
-		log.VPrintf(4, "CMD: %s", cmd)
-		if _, err := db.Exec(cmd); err != nil {
-			panic(fmt.Sprintf("Error on: %s\n%s", cmd, err))
-		}
-	}
-
-	return nil
+	return GetDBDriver().Create(name)
 }
 
 func DeleteDB(name string) error {
 	log.VPrintf(3, "Deleting DB %q", name)
 
-	db, err := sql.Open("mysql",
-		DBUSER+":"+DBPASSWORD+"@tcp("+DBHOST+":"+DBPORT+")/")
-	if err != nil {
-		panic(err)
-	}
-	defer db.Close()
-
-	_, err = db.Exec("DROP DATABASE IF EXISTS " + name)
-	if err != nil {
-		panic(err)
-	}
-	return nil
+	return GetDBDriver().Delete(name)
 }
 
 func SubQuery(query string, args []interface{}) string {
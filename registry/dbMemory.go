@@ -0,0 +1,110 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	log "github.com/duglin/dlog"
+)
+
+// In-memory DB, nothing is persisted and the DB goes away when the process
+// exits (or when it's deleted). It's just sqlite's "memdb" vfs under the
+// covers so it supports everything the sqlite driver does. Mainly used for
+// tests and throw-away servers.
+type MemoryDriver struct {
+	SQLiteDriver
+
+	mutex sync.Mutex
+
+	// An in-memory DB only lives as long as there's an open connection to
+	// it, so keep one around for each DB until it's deleted
+	conns map[string]*memoryConn
+}
+
+type memoryConn struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+func init() {
+	RegisterDBDriver(&MemoryDriver{conns: map[string]*memoryConn{}})
+}
+
+func (d *MemoryDriver) Name() string {
+	return "memory"
+}
+
+// The leading "/" is what allows all connections in this process to share
+// the same DB
+func (d *MemoryDriver) connStr(name string) string {
+	return "file:/" + name + "?vfs=memdb&_pragma=busy_timeout(10000)" +
+		"&_pragma=case_sensitive_like(1)"
+}
+
+func (d *MemoryDriver) Exists(name string) bool {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	return d.conns[name] != nil
+}
+
+func (d *MemoryDriver) Open(name string) (*sql.DB, error) {
+	if !d.Exists(name) {
+		return nil, fmt.Errorf("DB %q does not exist", name)
+	}
+
+	return sql.Open("sqlite", d.connStr(name))
+}
+
+func (d *MemoryDriver) Create(name string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.conns[name] != nil {
+		return fmt.Errorf("DB %q already exists", name)
+	}
+
+	db, err := sql.Open("sqlite", d.connStr(name))
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	log.VPrintf(3, "Creating in-memory DB: %s", name)
+
+	if _, err = conn.ExecContext(context.Background(), initSqliteDB); err != nil {
+		conn.Close()
+		db.Close()
+		return fmt.Errorf("Error creating DB %q: %s", name, err)
+	}
+
+	d.conns[name] = &memoryConn{db: db, conn: conn}
+	return nil
+}
+
+func (d *MemoryDriver) Delete(name string) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	mc := d.conns[name]
+	if mc == nil {
+		return nil
+	}
+	delete(d.conns, name)
+
+	// Any other open connection will keep the DB alive, so close ours too
+	if DB != nil && DB_Name == name {
+		DB.Close()
+		DB = nil
+	}
+
+	mc.conn.Close()
+	return mc.db.Close()
+}
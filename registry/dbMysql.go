@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"strings"
+
+	log "github.com/duglin/dlog"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+//go:embed init.sql
+var initDB string
+
+type MySQLDriver struct{}
+
+func init() {
+	RegisterDBDriver(&MySQLDriver{})
+}
+
+func (d *MySQLDriver) Name() string {
+	return "mysql"
+}
+
+func (d *MySQLDriver) connStr(name string) string {
+	return DBUSER + ":" + DBPASSWORD + "@tcp(" + DBHOST + ":" + DBPORT + ")/" +
+		name
+}
+
+func (d *MySQLDriver) Exists(name string) bool {
+	db, err := sql.Open("mysql", d.connStr(""))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`
+		SELECT SCHEMA_NAME
+		FROM INFORMATION_SCHEMA.SCHEMATA
+		WHERE SCHEMA_NAME=?`, name)
+	if err != nil {
+		panic(err)
+	}
+	defer rows.Close()
+	return rows.Next()
+}
+
+func (d *MySQLDriver) Open(name string) (*sql.DB, error) {
+	log.VPrintf(3, "MySQL: %s:%s", DBHOST, DBPORT)
+	return sql.Open("mysql", d.connStr(name))
+}
+
+func (d *MySQLDriver) Create(name string) error {
+	db, err := sql.Open("mysql", d.connStr(""))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	if _, err = db.Exec("CREATE DATABASE " + name); err != nil {
+		panic(err)
+	}
+
+	if _, err = db.Exec("USE " + name); err != nil {
+		panic(err)
+	}
+
+	log.VPrintf(3, "Creating DB")
+
+	for _, cmd := range strings.Split(initDB, ";") {
+		cmd = strings.TrimSpace(cmd)
+		cmd = strings.Replace(cmd, "@", ";", -1) // Can't use ; in file
+		if cmd == "" {
+			continue
+		}
+
+		log.VPrintf(4, "CMD: %s", cmd)
+		if _, err := db.Exec(cmd); err != nil {
+			panic(fmt.Sprintf("Error on: %s\n%s", cmd, err))
+		}
+	}
+
+	return nil
+}
+
+func (d *MySQLDriver) Delete(name string) error {
+	db, err := sql.Open("mysql", d.connStr(""))
+	if err != nil {
+		panic(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec("DROP DATABASE IF EXISTS " + name)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func (d *MySQLDriver) TxOptions() *sql.TxOptions {
+	return &sql.TxOptions{Isolation: sql.LevelReadCommitted}
+}
+
+// BINARY means case-sensitive for that operand
+func (d *MySQLDriver) CaseSensitive(expr string) string {
+	return "BINARY " + expr
+}
+
+func (d *MySQLDriver) AnyCase(expr string) string {
+	return expr + " COLLATE utf8mb4_0900_ai_ci"
+}
+
+// MySQL doesn't understand a "Z" timezone, so make it an offset
+func (d *MySQLDriver) Timestamp(expr string) string {
+	return "CAST(REPLACE(" + expr + ",'Z','+00:00') AS DATETIME(6))"
+}
@@ -0,0 +1,104 @@
+package registry
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/duglin/dlog"
+	_ "modernc.org/sqlite"
+)
+
+//go:embed initSqlite.sql
+var initSqliteDB string
+
+// Embedded DB, each DB is just a file in DBDIR. Mainly used for local dev
+// and testing so that we don't need a MySQL server running.
+type SQLiteDriver struct{}
+
+func init() {
+	RegisterDBDriver(&SQLiteDriver{})
+}
+
+func (d *SQLiteDriver) Name() string {
+	return "sqlite"
+}
+
+func (d *SQLiteDriver) fileName(name string) string {
+	return filepath.Join(DBDIR, name+".db")
+}
+
+func (d *SQLiteDriver) Exists(name string) bool {
+	_, err := os.Stat(d.fileName(name))
+	return err == nil
+}
+
+// busy_timeout: wait for other writers rather than fail right away
+// journal_mode(WAL): readers don't block writers (and vice versa)
+// case_sensitive_like: to match MySQL's LIKE on the (binary) Path columns
+func (d *SQLiteDriver) Open(name string) (*sql.DB, error) {
+	if !d.Exists(name) {
+		return nil, fmt.Errorf("DB %q does not exist", d.fileName(name))
+	}
+
+	return sql.Open("sqlite", "file:"+d.fileName(name)+
+		"?_pragma=busy_timeout(10000)"+
+		"&_pragma=journal_mode(WAL)"+
+		"&_pragma=case_sensitive_like(1)")
+}
+
+func (d *SQLiteDriver) Create(name string) error {
+	file := d.fileName(name)
+	if d.Exists(name) {
+		return fmt.Errorf("DB %q already exists", file)
+	}
+
+	db, err := sql.Open("sqlite", "file:"+file)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	log.VPrintf(3, "Creating DB: %s", file)
+
+	// SQLite can process the entire file in one call
+	if _, err = db.Exec(initSqliteDB); err != nil {
+		db.Close()
+		os.Remove(file)
+		return fmt.Errorf("Error creating DB %q: %s", file, err)
+	}
+
+	return nil
+}
+
+func (d *SQLiteDriver) Delete(name string) error {
+	file := d.fileName(name)
+	for _, f := range []string{file, file + "-wal", file + "-shm"} {
+		if err := os.Remove(f); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *SQLiteDriver) TxOptions() *sql.TxOptions {
+	return nil
+}
+
+// Regular comparisons are already case-sensitive unless the column
+// says otherwise, but be explicit about it
+func (d *SQLiteDriver) CaseSensitive(expr string) string {
+	return expr + " COLLATE BINARY"
+}
+
+func (d *SQLiteDriver) AnyCase(expr string) string {
+	return expr + " COLLATE NOCASE"
+}
+
+// Normalize to UTC (as a string) rather than use julianday() so that
+// equality checks aren't subject to floating point rounding
+func (d *SQLiteDriver) Timestamp(expr string) string {
+	return "strftime('%Y-%m-%dT%H:%M:%f'," + expr + ")"
+}
@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"testing"
+)
+
+// Switches to the "name" DB driver until the test is done
+func useDBDriver(t *testing.T, name string) {
+	t.Helper()
+	prev := GetDBDriver().Name()
+	if err := SetDBDriver(name); err != nil {
+		t.Fatalf("SetDBDriver: %s", err)
+	}
+	t.Cleanup(func() { SetDBDriver(prev) })
+}
+
+func TestMemoryDB(t *testing.T) {
+	useDBDriver(t, "memory")
+
+	name := "TestMemoryDB"
+	if DBExists(name) {
+		t.Fatalf("DB %q shouldn't exist yet", name)
+	}
+	if err := CreateDB(name); err != nil {
+		t.Fatalf("CreateDB: %s", err)
+	}
+	defer DeleteDB(name)
+
+	if !DBExists(name) {
+		t.Fatalf("DB %q should exist", name)
+	}
+	if err := CreateDB(name); err == nil {
+		t.Fatalf("CreateDB of an existing DB should fail")
+	}
+	if err := OpenDB(name); err != nil {
+		t.Fatalf("OpenDB: %s", err)
+	}
+
+	reg, err := NewRegistry(nil, "reg1")
+	if err != nil {
+		t.Fatalf("NewRegistry: %s", err)
+	}
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	if err != nil {
+		t.Fatalf("AddGroupModel: %s", err)
+	}
+	if _, err = gm.AddResourceModel("files", "file", 0, true, true, true); err != nil {
+		t.Fatalf("AddResourceModel: %s", err)
+	}
+
+	d1, err := reg.AddGroup("dirs", "d1")
+	if err != nil {
+		t.Fatalf("AddGroup: %s", err)
+	}
+	f1, err := d1.AddResource("files", "f1", "v1")
+	if err != nil {
+		t.Fatalf("AddResource: %s", err)
+	}
+	if _, err = f1.AddVersion("v2"); err != nil {
+		t.Fatalf("AddVersion: %s", err)
+	}
+	if err = reg.Commit(); err != nil {
+		t.Fatalf("Commit: %s", err)
+	}
+
+	// Should be visible from a new Tx
+	reg, err = FindRegistry(nil, "reg1")
+	if err != nil || reg == nil {
+		t.Fatalf("FindRegistry: %v %s", reg, err)
+	}
+	defer reg.Rollback()
+
+	g, err := reg.FindGroup("dirs", "D1", true)
+	if err != nil || g == nil || g.UID != "d1" {
+		t.Fatalf("FindGroup(anyCase): %v %s", g, err)
+	}
+	if g, _ = reg.FindGroup("dirs", "D1", false); g != nil {
+		t.Fatalf("FindGroup should be case sensitive: %v", g)
+	}
+
+	g, _ = reg.FindGroup("dirs", "d1", false)
+	r, err := g.FindResource("files", "f1", false)
+	if err != nil || r == nil {
+		t.Fatalf("FindResource: %v %s", r, err)
+	}
+	vIDs, err := r.GetVersionIDs()
+	if err != nil || len(vIDs) != 2 || vIDs[0] != "v1" || vIDs[1] != "v2" {
+		t.Fatalf("GetVersionIDs: %v %s", vIDs, err)
+	}
+	if r.Get("defaultversionid") != "v2" {
+		t.Fatalf("Wrong defaultversionid: %v", r.Get("defaultversionid"))
+	}
+}
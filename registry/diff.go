@@ -0,0 +1,411 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	log "github.com/duglin/dlog"
+)
+
+// Result of a GET .../versions/vID?diff=otherID
+type VersionDiff struct {
+	FromVersionID string        `json:"fromversionid"`
+	ToVersionID   string        `json:"toversionid"`
+	Attributes    []JSONPatchOp `json:"attributes"`
+
+	// "jsonpatch", "unified" or "binary" - omitted if the docs are the same
+	DocumentDiff string `json:"documentdiff,omitempty"`
+	Document     any    `json:"document,omitempty"`
+}
+
+// Returns the Version's attributes as a generic JSON object, as they would
+// be serialized, minus the ones that are always different
+func diffAttributes(info *RequestInfo, v *Version) (map[string]any, error) {
+	_, rm := v.GetModels()
+	attrs := map[string]any{}
+
+	err := v.SerializeProps(info, func(e *Entity, info *RequestInfo,
+		key string, val any, attr *Attribute) error {
+
+		if key[0] != '#' && key != "id" && key != "self" {
+			attrs[key] = val
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if rm != nil && rm.GetHasDocument() {
+		if val := v.Get("#resourceURL"); val != nil {
+			attrs[rm.Singular+"url"] = val
+		}
+		if val := v.Get("#resourceProxyURL"); val != nil {
+			attrs[rm.Singular+"proxyurl"] = val
+		}
+	}
+
+	// Round-trip it so we're comparing generic JSON values
+	result := map[string]any{}
+	buf, _ := json.Marshal(attrs)
+	err = json.Unmarshal(buf, &result)
+	return result, err
+}
+
+// Diff the "from" and "to" Versions, the document is diffed based on how
+// the Resource's typemap treats the "to" Version's contenttype
+func DiffVersions(info *RequestInfo, from, to *Version) (*VersionDiff, error) {
+	result := &VersionDiff{
+		FromVersionID: from.UID,
+		ToVersionID:   to.UID,
+	}
+
+	fromAttrs, err := diffAttributes(info, from)
+	if err != nil {
+		return nil, err
+	}
+	toAttrs, err := diffAttributes(info, to)
+	if err != nil {
+		return nil, err
+	}
+	result.Attributes = JSONPatchDiff(fromAttrs, toAttrs)
+
+	fromDoc, _ := from.Get("#resource").([]byte)
+	toDoc, _ := to.Get("#resource").([]byte)
+	if bytes.Equal(fromDoc, toDoc) {
+		return result, nil
+	}
+
+	_, rm := to.GetModels()
+	ct, _ := to.Get("contenttype").(string)
+	docType := "binary"
+	if rm != nil {
+		docType = rm.MapContentType(ct)
+	}
+
+	if docType == "json" {
+		var fromVal, toVal any
+		fromErr := json.Unmarshal(fromDoc, &fromVal)
+		toErr := json.Unmarshal(toDoc, &toVal)
+		if fromDoc == nil {
+			fromErr, fromVal = nil, nil
+		}
+		if toDoc == nil {
+			toErr, toVal = nil, nil
+		}
+		if fromErr == nil && toErr == nil {
+			result.DocumentDiff = "jsonpatch"
+			result.Document = JSONPatchDiff(fromVal, toVal)
+			return result, nil
+		}
+		// Not valid JSON, so just treat it as a string
+		docType = "string"
+	}
+
+	if docType == "string" {
+		doc, err := UnifiedDiff(from.UID, to.UID, fromDoc, toDoc)
+		if err != nil {
+			info.StatusCode = http.StatusBadRequest
+			return nil, err
+		}
+		result.DocumentDiff = "unified"
+		result.Document = doc
+		return result, nil
+	}
+
+	result.DocumentDiff = "binary"
+	return result, nil
+}
+
+// GET /GROUPs/gID/RESOURCEs/rID[/versions/vID]?diff=otherID
+// The Resource form uses its default Version
+func HTTPGETDiff(info *RequestInfo) error {
+	log.VPrintf(3, ">Enter: HTTPGETDiff(%s)", info.What)
+	defer log.VPrintf(3, "<Exit: HTTPGETDiff")
+
+	if info.What != "Entity" || info.ResourceUID == "" {
+		info.StatusCode = http.StatusBadRequest
+		return fmt.Errorf("?diff is only allowed on a Resource or a Version")
+	}
+
+	fromID := info.OriginalRequest.URL.Query().Get("diff")
+	if fromID == "" {
+		info.StatusCode = http.StatusBadRequest
+		return fmt.Errorf("?diff must specify the Version to compare with")
+	}
+
+	group, err := info.Registry.FindGroup(info.GroupType, info.GroupUID, false)
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+	var resource *Resource
+	if group != nil {
+		resource, err = group.FindResource(info.ResourceType,
+			info.ResourceUID, false)
+		if err != nil {
+			info.StatusCode = http.StatusInternalServerError
+			return err
+		}
+	}
+	if resource == nil {
+		info.StatusCode = http.StatusNotFound
+		return fmt.Errorf("Not found")
+	}
+
+	var to *Version
+	if info.VersionUID == "" {
+		to, err = resource.GetDefault()
+	} else {
+		to, err = resource.FindVersion(info.VersionUID, false)
+	}
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+	if to == nil {
+		info.StatusCode = http.StatusNotFound
+		return fmt.Errorf("Not found")
+	}
+
+	from, err := resource.FindVersion(fromID, false)
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+	if from == nil {
+		info.StatusCode = http.StatusNotFound
+		return fmt.Errorf("Version %q not found", fromID)
+	}
+
+	result, err := DiffVersions(info, from, to)
+	if err != nil {
+		if info.StatusCode == 0 {
+			info.StatusCode = http.StatusInternalServerError
+		}
+		return err
+	}
+
+	info.AddHeader("Content-Type", "application/json")
+	info.Write([]byte(ToJSON(result) + "\n"))
+	return nil
+}
+
+type diffLine struct {
+	op      byte // ' ', '-' or '+'
+	text    string
+	aBefore int // # of "a" lines before this one
+	bBefore int // # of "b" lines before this one
+}
+
+// Split "buf" into lines, keeping the "\n" so that a missing one at the
+// end of the file shows up as a change
+func splitLines(buf []byte) []string {
+	if len(buf) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(buf), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// The most changed lines UnifiedDiff will deal with. Finding D changes
+// takes O((N+M)*D) time and O(D^2) memory.
+var MAX_DIFF_CHANGES = 2000
+
+// Returns the shortest edit script (' ', '-' or '+' for each line) that
+// turns "a" into "b", per Myers' O(ND) algorithm
+func diffOps(a, b []string) ([]byte, error) {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD > MAX_DIFF_CHANGES {
+		maxD = MAX_DIFF_CHANGES
+	}
+
+	// v[off+k] is the furthest "x" reached on diagonal k (x-y)
+	off := maxD + 1
+	v := make([]int, 2*off+1)
+	trace := [][]int{} // v[-d..d] before each round "d"
+
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			x := v[off+k-1] + 1 // a delete
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1] // an insert
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				return diffBacktrack(trace, n, m), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Documents are too different to diff (more "+
+		"than %d changed lines)", MAX_DIFF_CHANGES)
+}
+
+// Walks the "trace" from diffOps back from (n,m) to get the edit script
+func diffBacktrack(trace [][]int, n, m int) []byte {
+	ops := []byte{}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d] // k is at prev[k+d]
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[k-1+d] < prev[k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			ops = append(ops, ' ')
+			x--
+			y--
+		}
+		if x == prevX {
+			ops = append(ops, '+')
+			y--
+		} else {
+			ops = append(ops, '-')
+			x--
+		}
+	}
+	for ; x > 0; x-- {
+		ops = append(ops, ' ')
+	}
+	slices.Reverse(ops)
+	return ops
+}
+
+// Returns a unified diff (w/3 lines of context) of the "a" and "b" text
+func UnifiedDiff(aName, bName string, a, b []byte) (string, error) {
+	aLines, bLines := splitLines(a), splitLines(b)
+
+	// Skip the common prefix/suffix, they're not part of the edit script
+	pre := 0
+	for pre < len(aLines) && pre < len(bLines) && aLines[pre] == bLines[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(aLines)-pre && suf < len(bLines)-pre &&
+		aLines[len(aLines)-1-suf] == bLines[len(bLines)-1-suf] {
+		suf++
+	}
+	aMid, bMid := aLines[pre:len(aLines)-suf], bLines[pre:len(bLines)-suf]
+
+	ops, err := diffOps(aMid, bMid)
+	if err != nil {
+		return "", err
+	}
+
+	edits := []diffLine{}
+	ai, bi := 0, 0
+	add := func(op byte, text string) {
+		edits = append(edits, diffLine{op, text, ai, bi})
+		if op != '+' {
+			ai++
+		}
+		if op != '-' {
+			bi++
+		}
+	}
+	for _, line := range aLines[:pre] {
+		add(' ', line)
+	}
+	i, j := 0, 0
+	for _, op := range ops {
+		if op == '+' {
+			add(op, bMid[j])
+		} else {
+			add(op, aMid[i])
+		}
+		if op != '+' {
+			i++
+		}
+		if op != '-' {
+			j++
+		}
+	}
+	for _, line := range aLines[len(aLines)-suf:] {
+		add(' ', line)
+	}
+
+	// Group the changes into hunks
+	const context = 3
+	out := &strings.Builder{}
+	for start := 0; start < len(edits); {
+		if edits[start].op == ' ' {
+			start++
+			continue
+		}
+
+		// Find the end of this hunk, merging changes that are close
+		end := start
+		for k := start; k < len(edits); k++ {
+			if edits[k].op != ' ' {
+				end = k + 1
+			} else if k-end >= 2*context {
+				break
+			}
+		}
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+		last := end + context
+		if last > len(edits) {
+			last = len(edits)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(out, "--- %s\n+++ %s\n", aName, bName)
+		}
+
+		aLen, bLen := 0, 0
+		for _, e := range edits[first:last] {
+			if e.op != '+' {
+				aLen++
+			}
+			if e.op != '-' {
+				bLen++
+			}
+		}
+		aStart, bStart := edits[first].aBefore, edits[first].bBefore
+		if aLen > 0 {
+			aStart++
+		}
+		if bLen > 0 {
+			bStart++
+		}
+		fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen),
+			hunkRange(bStart, bLen))
+
+		for _, e := range edits[first:last] {
+			out.WriteByte(e.op)
+			out.WriteString(e.text)
+			if !strings.HasSuffix(e.text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		start = last
+	}
+	return out.String(), nil
+}
+
+func hunkRange(start, count int) string {
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
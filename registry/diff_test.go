@@ -0,0 +1,112 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJSONPatchDiff(t *testing.T) {
+	type Test struct {
+		From string
+		To   string
+		Ops  string
+	}
+
+	tests := []Test{
+		{`{}`, `{}`, `[]`},
+		{`1`, `2`, `[{"op":"replace","path":"","value":2}]`},
+		{`{"a":1,"b":2}`, `{"b":3,"c":null}`,
+			`[{"op":"remove","path":"/a"},` +
+				`{"op":"replace","path":"/b","value":3},` +
+				`{"op":"add","path":"/c","value":null}]`},
+		{`{"a/b":{"c~d":1}}`, `{"a/b":{"c~d":false}}`,
+			`[{"op":"replace","path":"/a~1b/c~0d","value":false}]`},
+		{`[1,2,3]`, `[1,5]`,
+			`[{"op":"replace","path":"/1","value":5},` +
+				`{"op":"remove","path":"/2"}]`},
+		{`[1]`, `[1,[2],{"x":3}]`,
+			`[{"op":"add","path":"/1","value":[2]},` +
+				`{"op":"add","path":"/2","value":{"x":3}}]`},
+		{`{"a":[1]}`, `{"a":{"0":1}}`,
+			`[{"op":"replace","path":"/a","value":{"0":1}}]`},
+	}
+
+	for _, test := range tests {
+		var from, to any
+		json.Unmarshal([]byte(test.From), &from)
+		json.Unmarshal([]byte(test.To), &to)
+		buf, _ := json.Marshal(JSONPatchDiff(from, to))
+		if string(buf) != test.Ops {
+			t.Errorf("From: %s\nTo: %s\nExp: %s\nGot: %s", test.From,
+				test.To, test.Ops, string(buf))
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	type Test struct {
+		A    string
+		B    string
+		Diff string
+	}
+
+	tests := []Test{
+		{"", "", ""},
+		{"a\nb\n", "a\nb\n", ""},
+		{"", "a\n", "--- v1\n+++ v2\n@@ -0,0 +1 @@\n+a\n"},
+		{"a\n", "", "--- v1\n+++ v2\n@@ -1 +0,0 @@\n-a\n"},
+		{"a\nb\nc\n", "a\nx\nc\n",
+			"--- v1\n+++ v2\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{"a\n", "a",
+			"--- v1\n+++ v2\n@@ -1 +1 @@\n-a\n+a\n\\ No newline at end of file\n"},
+		// Two hunks, w/3 lines of context
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\nX\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\nY\n",
+			"--- v1\n+++ v2\n" +
+				"@@ -1,5 +1,5 @@\n 1\n-2\n+X\n 3\n 4\n 5\n" +
+				"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+Y\n"},
+		// Close changes are merged into one hunk
+		{"1\n2\n3\n4\n5\n6\n7\n8\n", "1\nX\n3\n4\n5\n6\n7\nY\n",
+			"--- v1\n+++ v2\n@@ -1,8 +1,8 @@\n" +
+				" 1\n-2\n+X\n 3\n 4\n 5\n 6\n 7\n-8\n+Y\n"},
+	}
+
+	for _, test := range tests {
+		got, err := UnifiedDiff("v1", "v2", []byte(test.A), []byte(test.B))
+		if err != nil || got != test.Diff {
+			t.Errorf("A: %q\nB: %q\nExp:\n%s\nGot:\n%s%v", test.A, test.B,
+				test.Diff, got, err)
+		}
+	}
+
+	// Big documents are fine as long as they don't differ too much
+	a, b := &strings.Builder{}, &strings.Builder{}
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(a, "line %d\n", i)
+		if i%1000 == 500 {
+			fmt.Fprintf(b, "changed %d\n", i)
+		} else {
+			fmt.Fprintf(b, "line %d\n", i)
+		}
+	}
+	got, err := UnifiedDiff("v1", "v2", []byte(a.String()), []byte(b.String()))
+	if err != nil || strings.Count(got, "@@ -") != 100 ||
+		!strings.Contains(got, "@@ -98498,7 +98498,7 @@\n") {
+		t.Fatalf("Bad big diff: %v\n%.500s", err, got)
+	}
+
+	// But not if they're too different
+	a.Reset()
+	b.Reset()
+	for i := 0; i <= MAX_DIFF_CHANGES; i++ {
+		fmt.Fprintf(a, "a %d\n", i)
+		fmt.Fprintf(b, "b %d\n", i)
+	}
+	_, err = UnifiedDiff("v1", "v2", []byte(a.String()), []byte(b.String()))
+	if err == nil || err.Error() != "Documents are too different to diff "+
+		"(more than 2000 changed lines)" {
+		t.Fatalf("Should have failed: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"fmt"
+	"io"
 	"maps"
 	"reflect"
 	"strconv"
@@ -88,30 +89,21 @@ func (e *Entity) GetAsInt(path string) int {
 func (e *Entity) GetPP(pp *PropPath) any {
 	name := pp.DB()
 	if pp.Len() == 1 && pp.Top() == "#resource" {
-		results, err := Query(e.tx, `
-            SELECT Content
-            FROM ResourceContents
-            WHERE VersionSID=? OR
-			      VersionSID=(SELECT eSID FROM FullTree WHERE ParentSID=? AND
-				  PropName=? and PropValue='true')
-			`, e.DbSID, e.DbSID, NewPPP("isdefault").DB())
-		defer results.Close()
-
+		rc, err := e.OpenDocument()
 		if err != nil {
-			return fmt.Errorf("Error finding contents %q: %s", e.DbSID, err)
+			return err
 		}
-
-		row := results.NextRow()
-		if row == nil {
+		if rc == nil {
 			// No data so just return
 			return nil
 		}
+		defer rc.Close()
 
-		if results.NextRow() != nil {
-			panic("too many results")
+		buf, err := io.ReadAll(rc)
+		if err != nil {
+			return fmt.Errorf("Error reading contents %q: %s", e.DbSID, err)
 		}
-
-		return (*(row[0])).([]byte)
+		return buf
 	}
 
 	// See if we have an updated value in NewObject, if not grab from Object
@@ -209,9 +201,9 @@ func RawEntityFromPath(tx *Tx, regID string, path string, anyCase bool) (*Entity
 	// RegSID,Level,Plural,eSID,UID,PropName,PropValue,PropType,Path,Abstract
 	//   0     1      2     3    4     5         6         7     8      9
 
-	caseExpr := ""
+	pathExpr := "e.Path"
 	if anyCase {
-		caseExpr = " COLLATE utf8mb4_0900_ai_ci"
+		pathExpr = GetDBDriver().AnyCase(pathExpr)
 	}
 
 	results, err := Query(tx, `
@@ -228,7 +220,7 @@ func RawEntityFromPath(tx *Tx, regID string, path string, anyCase bool) (*Entity
             e.Abstract as Abstract
         FROM Entities AS e
         LEFT JOIN Props AS p ON (e.eSID=p.EntitySID)
-        WHERE e.RegSID=? AND e.Path`+caseExpr+`=? ORDER BY Path`,
+        WHERE e.RegSID=? AND `+pathExpr+`=? ORDER BY Path`,
 		regID, path)
 	defer results.Close()
 
@@ -486,10 +478,22 @@ func (e *Entity) SetDBProperty(pp *PropPath, val any) error {
 			if val == "" {
 				return nil
 			}
-			// The actual contents
-			err = DoOneTwo(e.tx, `
-                REPLACE INTO ResourceContents(VersionSID, Content)
-            	VALUES(?,?)`, e.DbSID, val)
+			// The actual contents. Always save it as a []byte so that
+			// DBs w/o strict column types (sqlite) don't store it as text.
+			// Unless it was already streamed into the BlobStore, then we
+			// just point to it.
+			if blob, ok := val.(*StagedBlob); ok {
+				err = saveStagedContent(e.tx, e.DbSID, blob)
+			} else {
+				buf, ok := val.([]byte)
+				if str, isStr := val.(string); isStr {
+					buf, ok = []byte(str), true
+				}
+				if !ok {
+					return fmt.Errorf("Invalid document type: %T", val)
+				}
+				err = saveContent(e.tx, e.DbSID, buf)
+			}
 			if err != nil {
 				return err
 			}
@@ -1012,6 +1016,20 @@ var OrderedSpecProps = []*Attribute{
 			updateFn:   nil,
 		},
 	},
+	{
+		Name:     "contentdigest",
+		Type:     STRING,
+		ReadOnly: true,
+
+		internals: AttrInternals{
+			levels:     "23",
+			dontStore:  false,
+			httpHeader: "Digest",
+			getFn:      nil,
+			checkFn:    nil,
+			updateFn:   nil,
+		},
+	},
 	{
 		Name:     "model",
 		Type:     OBJECT,
@@ -1123,6 +1141,7 @@ func (e *Entity) Save() error {
 
 	// TODO calculate which to delete based on attr properties
 	delete(newObj, "self")
+	delete(newObj, "contentdigest") // calculated below
 
 	e.RemoveCollections(newObj)
 
@@ -1195,13 +1214,51 @@ func (e *Entity) Save() error {
 	}
 
 	err = traverse(NewPP(), newObj, e.NewObject)
+
+	// The digest always reflects the stored document, not what was sent
+	if err == nil && e.Level == 3 {
+		digest := ""
+		digest, err = getContentDigest(e.tx, e.DbSID)
+		if err == nil && digest != "" {
+			newObj["contentdigest"] = "sha256:" + digest
+			err = e.SetDBProperty(NewPPP("contentdigest"),
+				newObj["contentdigest"])
+		}
+	}
+
 	if err == nil {
+		e.addSaveEvents(e.Object, newObj)
 		e.Object = newObj
 		e.NewObject = nil
 	}
 	return err
 }
 
+// Queue up the events for this Save based on what changed. Internal ("#")
+// props don't count and a change of just the defaultversionid is only
+// a "defaultversionchanged" event, not an "updated" one too.
+func (e *Entity) addSaveEvents(oldObj map[string]any, newObj map[string]any) {
+	oldVals := maps.Clone(oldObj)
+	newVals := maps.Clone(newObj)
+	maps.DeleteFunc(oldVals, func(k string, v any) bool { return k[0] == '#' })
+	maps.DeleteFunc(newVals, func(k string, v any) bool { return k[0] == '#' })
+
+	if e.Level == 2 && oldVals != nil &&
+		!IsNil(oldVals["defaultversionid"]) &&
+		oldVals["defaultversionid"] != newVals["defaultversionid"] {
+
+		e.tx.AddEvent(EVENT_DEFAULTCHANGED, e)
+		delete(oldVals, "defaultversionid")
+		delete(newVals, "defaultversionid")
+		delete(oldVals, "stickydefaultversion")
+		delete(newVals, "stickydefaultversion")
+	}
+
+	if !reflect.DeepEqual(oldVals, newVals) {
+		e.tx.AddEvent(EVENT_UPDATED, e)
+	}
+}
+
 // This will add in the calculated properties into the entity. This will
 // normally be called after a query using FullTree view and before we serialize
 // the entity we need to add the non-DB-stored properties (meaning, the
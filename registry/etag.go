@@ -0,0 +1,199 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EntityETag returns the ETag for the entity. When "content" is true we're
+// serializing the Resource's (or Version's) document rather than its
+// metadata, so the ETag is a hash of the document. Otherwise it's based on
+// the epoch. A Resource's metadata is really its default Version's metadata,
+// so include the defaultversionid since switching the default Version
+// doesn't change any epoch values.
+func EntityETag(e *Entity, content bool) string {
+	if content && e.Get("#resourceURL") == nil &&
+		e.Get("#resourceProxyURL") == nil {
+
+		// Same as hashing the document, w/o having to load it
+		if digest, ok := e.Get("contentdigest").(string); ok {
+			if hexStr, ok := strings.CutPrefix(digest, "sha256:"); ok {
+				return strconv.Quote(hexStr)
+			}
+		}
+
+		buf, _ := e.Get("#resource").([]byte)
+		sum := sha256.Sum256(buf)
+		return strconv.Quote(hex.EncodeToString(sum[:]))
+	}
+
+	tag := fmt.Sprintf("%v", e.Get("epoch"))
+	if e.Level == 2 {
+		tag = fmt.Sprintf("%v-%s", e.Get("defaultversionid"), tag)
+	}
+	return strconv.Quote(tag)
+}
+
+// The ETag of the entity's metadata as it'll be serialized for this request.
+// Besides the entity's own attributes the response includes the counts of
+// its child collections, and maybe (per the "inline", "filter" and "sort"
+// query parameters) the children themselves, none of which change the
+// entity's epoch. So if there are any children ("results" holds the rows
+// left after reading "e"), or any query parameters, a hash of them is added.
+// YAML isn't the same representation as the JSON so it gets its own ETag.
+func (info *RequestInfo) MetadataETag(e *Entity, results *Result,
+	query string) string {
+
+	etag := EntityETag(e, false)
+
+	rows := results.AllRows
+	if results.Reuse {
+		rows = append([][]*any{results.Data}, rows...)
+	}
+	if len(rows) > 0 || query != "" {
+		hash := sha256.New()
+		hash.Write([]byte(query))
+		for _, row := range rows {
+			for _, col := range row {
+				if IsNil(col) || IsNil(*col) {
+					hash.Write([]byte{0})
+				} else {
+					fmt.Fprintf(hash, "%v\x00", *col)
+				}
+			}
+		}
+		etag = strings.TrimSuffix(etag, `"`) + "-" +
+			hex.EncodeToString(hash.Sum(nil))[:16] + `"`
+	}
+
+	if _, ok := info.HTTPWriter.(*YAMLWriter); ok {
+		etag = strings.TrimSuffix(etag, `"`) + `-yaml"`
+	}
+	return etag
+}
+
+// Returns true if "etag" is in the list of ETags in the "header" value.
+// "*" matches any existing entity. Weak ETags (W/"...") only match when
+// "weak" is true - as per RFC 9110 If-Match uses the strong comparison
+// and If-None-Match uses the weak one.
+func ETagMatches(header string, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the GET should result in a 304 (Not Modified)
+func (info *RequestInfo) NotModified(etag string) bool {
+	if !strings.EqualFold(info.OriginalRequest.Method, "GET") {
+		return false
+	}
+	header := info.OriginalRequest.Header.Get("If-None-Match")
+	if header == "" || !ETagMatches(header, etag, true) {
+		return false
+	}
+	info.StatusCode = http.StatusNotModified
+	return true
+}
+
+// CheckPreconditions verifies the If-Match and If-None-Match headers on
+// write operations against the current state of the entity in the URL.
+// Collections don't have an ETag so only "*" can match them.
+func CheckPreconditions(info *RequestInfo) error {
+	ifMatch := info.OriginalRequest.Header.Get("If-Match")
+	ifNoneMatch := info.OriginalRequest.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return nil
+	}
+
+	etag := ""
+	exists := true
+	if info.What != "Coll" {
+		path := strings.Join(info.Parts, "/")
+		content := info.ResourceModel != nil &&
+			info.ResourceModel.GetHasDocument() && !info.ShowMeta
+
+		// The metadata's ETag depends on the children too, so get the
+		// same rows a GET w/o any query parameters would
+		query, args := `
+SELECT
+  RegSID,Level,Plural,eSID,UID,PropName,PropValue,PropType,Path,Abstract
+FROM FullTree WHERE RegSID=? AND Path=?`, []any{info.Registry.DbSID, path}
+		if !content {
+			var err error
+			query, args, err = GenerateQuery(info.Registry, info.What,
+				[]string{path}, nil, "", 0)
+			if err != nil {
+				info.StatusCode = http.StatusInternalServerError
+				return err
+			}
+		}
+
+		results, err := Query(info.tx, query, args...)
+		defer results.Close()
+		if err != nil {
+			info.StatusCode = http.StatusInternalServerError
+			return err
+		}
+
+		entity, err := readNextEntity(info.tx, results)
+		if err != nil {
+			info.StatusCode = http.StatusInternalServerError
+			return err
+		}
+
+		if entity == nil {
+			exists = false
+		} else if content {
+			etag = EntityETag(entity, true)
+		} else {
+			etag = info.MetadataETag(entity, results, "")
+		}
+	}
+
+	current := etag
+	if current == "" {
+		current = "none"
+	}
+
+	if ifMatch != "" {
+		if !exists || (strings.TrimSpace(ifMatch) != "*" &&
+			!ETagMatches(ifMatch, etag, false)) {
+
+			info.StatusCode = http.StatusPreconditionFailed
+			return fmt.Errorf("If-Match (%s) doesn't match the current ETag (%s)",
+				ifMatch, current)
+		}
+	}
+
+	if ifNoneMatch != "" && exists {
+		if strings.TrimSpace(ifNoneMatch) == "*" ||
+			ETagMatches(ifNoneMatch, etag, true) {
+
+			info.StatusCode = http.StatusPreconditionFailed
+			return fmt.Errorf("If-None-Match (%s) matches the current ETag (%s)",
+				ifNoneMatch, current)
+		}
+	}
+
+	return nil
+}
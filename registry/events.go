@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/duglin/dlog"
+	"github.com/google/uuid"
+)
+
+// The CloudEvents "type" values of the events we generate
+const (
+	EVENT_CREATED        = "io.xregistry.created"
+	EVENT_UPDATED        = "io.xregistry.updated"
+	EVENT_DELETED        = "io.xregistry.deleted"
+	EVENT_DEFAULTCHANGED = "io.xregistry.defaultversionchanged"
+)
+
+// A CloudEvent, in its structured JSON format
+type Event struct {
+	SpecVersion     string         `json:"specversion"`
+	ID              string         `json:"id"`
+	Source          string         `json:"source"`
+	Type            string         `json:"type"`
+	Subject         string         `json:"subject,omitempty"`
+	Time            string         `json:"time,omitempty"`
+	DataContentType string         `json:"datacontenttype,omitempty"`
+	Data            map[string]any `json:"data,omitempty"`
+
+	entity *Entity // The entity the event is about, for local listeners
+}
+
+// Called for each event after the Tx that caused it is committed. It's
+// called in-line with the Commit() so it should return quickly.
+type EventListener func(event *Event)
+
+var eventMutex sync.RWMutex
+var eventListeners = map[string]EventListener{}
+
+// Returns an ID that can be used to remove the listener
+func AddEventListener(fn EventListener) string {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+
+	id := NewUUID()
+	eventListeners[id] = fn
+	return id
+}
+
+func RemoveEventListener(id string) {
+	eventMutex.Lock()
+	defer eventMutex.Unlock()
+
+	delete(eventListeners, id)
+}
+
+// Returns the ID of the listener that was added for the webhook
+func AddWebhook(url string) string {
+	return AddEventListener(func(event *Event) {
+		go DeliverEvent(url, event)
+	})
+}
+
+// Webhook retry policy. The delay doubles after each failed attempt.
+var WebhookRetries = 3
+var WebhookRetryDelay = time.Second
+var WebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// DeliverEvent POSTs the event to "url", retrying on connection errors,
+// 429s and 5xx responses. Any other error response is treated as the sink
+// rejecting the event so there's no point in retrying.
+func DeliverEvent(url string, event *Event) error {
+	buf, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	delay := WebhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		res, err := WebhookClient.Post(url, "application/cloudevents+json",
+			bytes.NewReader(buf))
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode/100 == 2 {
+				return nil
+			}
+			err = fmt.Errorf("%s", res.Status)
+			if res.StatusCode != http.StatusTooManyRequests &&
+				res.StatusCode/100 != 5 {
+				log.Printf("Event %s rejected by %s: %s", event.ID, url, err)
+				return err
+			}
+		}
+
+		if attempt >= WebhookRetries {
+			log.Printf("Error sending event %s to %s: %s", event.ID, url, err)
+			return err
+		}
+
+		log.VPrintf(2, "Retrying event %s to %s: %s", event.ID, url, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// An event waiting for its Tx to be committed. We hold onto the entity
+// rather than building the Event right away so that the data reflects
+// the final state of the entity in the Tx.
+type pendingEvent struct {
+	eventType string
+	entity    *Entity
+}
+
+// AddEvent queues up an event for the entity. Since one operation can touch
+// the same entity many times the events are coalesced so that there's just
+// one for each entity (per type) in the Tx, e.g. created+updated is just
+// created, and created+deleted is nothing at all.
+func (tx *Tx) AddEvent(eventType string, e *Entity) {
+	switch eventType {
+	case EVENT_UPDATED:
+		for _, pe := range tx.events {
+			if pe.entity.Path == e.Path &&
+				(pe.eventType == EVENT_CREATED || pe.eventType == EVENT_UPDATED) {
+				pe.entity = e
+				return
+			}
+		}
+	case EVENT_DEFAULTCHANGED:
+		for _, pe := range tx.events {
+			if pe.entity.Path == e.Path &&
+				(pe.eventType == EVENT_CREATED || pe.eventType == eventType) {
+				pe.entity = e
+				return
+			}
+		}
+	case EVENT_DELETED:
+		// Anything pending for this entity (or its children) is moot now
+		wasCreated := false
+		events := tx.events[:0]
+		for _, pe := range tx.events {
+			if pe.entity.Path == e.Path ||
+				strings.HasPrefix(pe.entity.Path, e.Path+"/") {
+				if pe.entity.Path == e.Path && pe.eventType == EVENT_CREATED {
+					wasCreated = true
+				}
+				continue
+			}
+			events = append(events, pe)
+		}
+		tx.events = events
+		if wasCreated {
+			return
+		}
+	}
+
+	tx.events = append(tx.events, &pendingEvent{eventType: eventType, entity: e})
+}
+
+// Called after the Tx is committed
+func PublishEvents(pending []*pendingEvent) {
+	if len(pending) == 0 {
+		return
+	}
+
+	eventMutex.RLock()
+	listeners := make([]EventListener, 0, len(eventListeners))
+	for _, id := range SortedKeys(eventListeners) {
+		listeners = append(listeners, eventListeners[id])
+	}
+	eventMutex.RUnlock()
+
+	if len(listeners) == 0 {
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, pe := range pending {
+		event := NewEvent(pe.eventType, pe.entity, now)
+		for _, fn := range listeners {
+			fn(event)
+		}
+	}
+}
+
+func NewEvent(eventType string, e *Entity, now string) *Event {
+	data := map[string]any{
+		"id":     e.UID,
+		"path":   e.Path,
+		"level":  e.Level,
+		"plural": e.Plural,
+	}
+
+	obj := e.Object
+	if obj == nil {
+		obj = e.NewObject
+	}
+	if epoch, ok := obj["epoch"]; ok && eventType != EVENT_DELETED {
+		data["epoch"] = epoch
+	}
+	if eventType == EVENT_DEFAULTCHANGED {
+		data["defaultversionid"] = obj["defaultversionid"]
+	}
+
+	source := "/"
+	if e.Registry != nil {
+		source += e.Registry.UID
+	}
+
+	return &Event{
+		SpecVersion:     "1.0",
+		ID:              uuid.NewString(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         e.Path,
+		Time:            now,
+		DataContentType: "application/json",
+		Data:            data,
+
+		entity: e,
+	}
+}
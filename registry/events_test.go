@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	useDBDriver(t, "memory")
+
+	name := "TestEvents"
+	if err := CreateDB(name); err != nil {
+		t.Fatalf("CreateDB: %s", err)
+	}
+	defer DeleteDB(name)
+	if err := OpenDB(name); err != nil {
+		t.Fatalf("OpenDB: %s", err)
+	}
+
+	events := []string{}
+	id := AddEventListener(func(event *Event) {
+		events = append(events, event.Type[len("io.xregistry."):]+":"+
+			event.Subject)
+	})
+	defer RemoveEventListener(id)
+
+	check := func(step string, exp ...string) {
+		t.Helper()
+		if strings.Join(events, ",") != strings.Join(exp, ",") {
+			t.Fatalf("%s:\nExp: %v\nGot: %v", step, exp, events)
+		}
+		events = []string{}
+	}
+
+	reg, err := NewRegistry(nil, "reg1")
+	if err != nil {
+		t.Fatalf("NewRegistry: %s", err)
+	}
+	check("new registry", "created:")
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+	reg.Commit()
+	check("model changes")
+
+	d1, _ := reg.AddGroup("dirs", "d1")
+	f1, _ := d1.AddResource("files", "f1", "v1")
+	d1.SetSave("name", "dir1")
+	check("nothing until commit")
+	reg.Commit()
+	check("create",
+		"created:dirs/d1",
+		"created:dirs/d1/files/f1",
+		"created:dirs/d1/files/f1/versions/v1")
+
+	d1.SetSave("name", "dir one")
+	reg.Rollback()
+	check("rollback")
+
+	d1, _ = reg.FindGroup("dirs", "d1", false)
+	d1.SetSave("name", "dir one")
+	d1.SetSave("description", "my dir")
+	reg.Commit()
+	check("update", "updated:dirs/d1")
+
+	f1, _ = d1.FindResource("files", "f1", false)
+	v2, _ := f1.AddVersion("v2")
+	reg.Commit()
+	check("new version",
+		"created:dirs/d1/files/f1/versions/v2",
+		"defaultversionchanged:dirs/d1/files/f1")
+
+	f1.SetDefaultID("v1")
+	reg.Commit()
+	check("set default", "defaultversionchanged:dirs/d1/files/f1")
+
+	v2.Delete("")
+	reg.Commit()
+	check("delete version", "deleted:dirs/d1/files/f1/versions/v2")
+
+	d2, _ := reg.AddGroup("dirs", "d2")
+	d2.AddResource("files", "f2", "v1")
+	d2.Delete()
+	reg.Commit()
+	check("create+delete")
+
+	d1.Delete()
+	reg.Commit()
+	check("delete group", "deleted:dirs/d1")
+}
+
+func TestEventsWebhook(t *testing.T) {
+	saveDelay := WebhookRetryDelay
+	WebhookRetryDelay = 10 * time.Millisecond
+	defer func() { WebhookRetryDelay = saveDelay }()
+
+	mutex := sync.Mutex{}
+	attempts := 0
+	bodies := []*Event{}
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			attempts++
+			if attempts < 3 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			buf, _ := io.ReadAll(r.Body)
+			event := &Event{}
+			json.Unmarshal(buf, event)
+			bodies = append(bodies, event)
+		}))
+	defer server.Close()
+
+	event := &Event{
+		SpecVersion: "1.0",
+		ID:          "123",
+		Source:      "/reg1",
+		Type:        EVENT_CREATED,
+		Subject:     "dirs/d1",
+	}
+
+	if err := DeliverEvent(server.URL, event); err != nil {
+		t.Fatalf("DeliverEvent: %s", err)
+	}
+	if attempts != 3 || len(bodies) != 1 || bodies[0].ID != "123" ||
+		bodies[0].Subject != "dirs/d1" {
+		t.Fatalf("Bad delivery: %d %#v", attempts, bodies)
+	}
+
+	// 4xx errors aren't retried
+	attempts = -100
+	server.Config.Handler = http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusBadRequest)
+		})
+	if err := DeliverEvent(server.URL, event); err == nil {
+		t.Fatalf("DeliverEvent should have failed")
+	}
+	if attempts != -99 {
+		t.Fatalf("Should have only tried once: %d", attempts)
+	}
+
+	// Give up after WebhookRetries
+	attempts = 0
+	server.Config.Handler = http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	if err := DeliverEvent(server.URL, event); err == nil {
+		t.Fatalf("DeliverEvent should have failed")
+	}
+	if attempts != WebhookRetries+1 {
+		t.Fatalf("Wrong # of attempts: %d", attempts)
+	}
+}
+
+func TestSubscriptionsCache(t *testing.T) {
+	useDBDriver(t, "memory")
+
+	name := "TestSubscriptionsCache"
+	if err := CreateDB(name); err != nil {
+		t.Fatalf("CreateDB: %s", err)
+	}
+	defer DeleteDB(name)
+	if err := OpenDB(name); err != nil {
+		t.Fatalf("OpenDB: %s", err)
+	}
+
+	reg, err := NewRegistry(nil, "reg1")
+	if err != nil {
+		t.Fatalf("NewRegistry: %s", err)
+	}
+	reg.Commit()
+
+	cached := func() bool {
+		subsMutex.Lock()
+		defer subsMutex.Unlock()
+		_, ok := subsCache[reg.DbSID]
+		return ok
+	}
+
+	// Others can still (re)load the old ones until the Tx is committed
+	if subs := getSubscriptions(reg); len(subs) != 0 || !cached() {
+		t.Fatalf("Should have cached no subscriptions: %v", subs)
+	}
+	sub := &Subscription{ID: "s1", Sink: "http://localhost/s1"}
+	if err = sub.Save(reg.tx, reg); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+	if !cached() {
+		t.Fatalf("Cache shouldn't be cleared before the commit")
+	}
+	reg.Commit()
+	if cached() {
+		t.Fatalf("Cache should have been cleared by the commit")
+	}
+	if subs := getSubscriptions(reg); len(subs) != 1 {
+		t.Fatalf("Should see the new subscription: %v", subs)
+	}
+
+	// Rolled back changes clear it too
+	if err = sub.Delete(reg.tx, reg); err != nil {
+		t.Fatalf("Delete: %s", err)
+	}
+	if !cached() {
+		t.Fatalf("Cache shouldn't be cleared before the rollback")
+	}
+	reg.Rollback()
+	if cached() {
+		t.Fatalf("Cache should have been cleared by the rollback")
+	}
+	if subs := getSubscriptions(reg); len(subs) != 1 {
+		t.Fatalf("Delete should have been rolled back: %v", subs)
+	}
+}
@@ -0,0 +1,82 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+// The same filters are checked in SQL for queries and in memory for
+// subscriptions, so they need to agree
+func TestFilterMatchesQuery(t *testing.T) {
+	useDBDriver(t, "memory")
+
+	name := "TestFilterMatchesQuery"
+	if err := CreateDB(name); err != nil {
+		t.Fatalf("CreateDB: %s", err)
+	}
+	defer DeleteDB(name)
+	if err := OpenDB(name); err != nil {
+		t.Fatalf("OpenDB: %s", err)
+	}
+
+	reg, err := NewRegistry(nil, "reg1")
+	if err != nil {
+		t.Fatalf("NewRegistry: %s", err)
+	}
+	reg.Model.AddGroupModel("dirs", "dir")
+	for id, val := range map[string]string{"d1": "Dir One", "d2": "dir one",
+		"d3": "DIR TWO", "d4": "Élan", "d5": "élan"} {
+		d, err := reg.AddGroup("dirs", id)
+		if err != nil {
+			t.Fatalf("AddGroup: %s", err)
+		}
+		d.SetSave("name", val)
+	}
+	reg.Commit()
+
+	info := &RequestInfo{tx: reg.tx, Registry: reg}
+	for _, expr := range []string{"dirs.name=dir one", "dirs.name=Dir One",
+		"dirs.name!=dir one", "dirs.name>dir", "dirs.name<=Dir One",
+		"dirs.name=dir*", "dirs.name=*ONE", "dirs.name=*i*", "dirs.name=élan",
+		"dirs.name=*LAN", "dirs.name>=é"} {
+
+		filter, err := info.ParseFilterExpr(expr)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err)
+		}
+
+		query, args, err := GenerateQuery(reg, "Coll", []string{"dirs"},
+			[][]*FilterExpr{{filter}}, "", 0)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err)
+		}
+		results, err := Query(reg.tx, query, args...)
+		if err != nil {
+			t.Fatalf("%s: %s", expr, err)
+		}
+		inDB := []string{}
+		for {
+			e, err := readNextEntity(reg.tx, results)
+			if err != nil {
+				t.Fatalf("%s: %s", expr, err)
+			}
+			if e == nil {
+				break
+			}
+			inDB = append(inDB, e.UID)
+		}
+		results.Close()
+
+		inMem := []string{}
+		for _, id := range []string{"d1", "d2", "d3", "d4", "d5"} {
+			d, _ := reg.FindGroup("dirs", id, false)
+			if filter.Matches(d.Object) {
+				inMem = append(inMem, id)
+			}
+		}
+
+		if strings.Join(inDB, ",") != strings.Join(inMem, ",") {
+			t.Errorf("%s:\nDB:     %v\nMemory: %v", expr, inDB, inMem)
+		}
+	}
+}
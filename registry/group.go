@@ -2,6 +2,7 @@ package registry
 
 import (
 	"fmt"
+	"strings"
 
 	log "github.com/duglin/dlog"
 )
@@ -74,6 +75,18 @@ func (g *Group) UpsertResourceWithObject(rType string, id string, vID string, ob
 			rType, g.Plural)
 	}
 
+	if rModel.ReadOnly && g.tx.EnforceReadOnly {
+		return nil, false, fmt.Errorf("Write operations to read-only " +
+			"resources are not allowed")
+	}
+
+	if err := g.CheckMirrored(); err != nil {
+		return nil, false, err
+	}
+	if err := g.CheckLocked(); err != nil {
+		return nil, false, err
+	}
+
 	r, err := g.FindResource(rType, id, true)
 	if err != nil {
 		return nil, false, fmt.Errorf("Error checking for Resource(%s) %q: %s",
@@ -163,6 +176,7 @@ func (g *Group) UpsertResourceWithObject(rType string, id string, vID string, ob
 			log.Print(err)
 			return nil, false, err
 		}
+		r.tx.AddEvent(EVENT_CREATED, &r.Entity)
 
 		// Use the ID passed as an arg, not from the metadata, as the true
 		// ID. If the one in the metadata differs we'll flag it down below
@@ -502,5 +516,93 @@ func (g *Group) Delete() error {
 	log.VPrintf(3, ">Enter: Group.Delete(%s)", g.UID)
 	defer log.VPrintf(3, "<Exit: Group.Delete")
 
-	return DoOne(g.tx, `DELETE FROM "Groups" WHERE SID=?`, g.DbSID)
+	if err := g.CheckMirrored(); err != nil {
+		return err
+	}
+	if err := g.CheckLocked(); err != nil {
+		return err
+	}
+
+	if err := g.tx.checkBlobs(&g.Entity); err != nil {
+		return err
+	}
+
+	if err := DoOne(g.tx, `DELETE FROM "Groups" WHERE SID=?`, g.DbSID); err != nil {
+		return err
+	}
+	g.tx.AddEvent(EVENT_DELETED, &g.Entity)
+	return nil
+}
+
+func (g *Group) IsLocked() (bool, error) {
+	results, err := Query(g.tx, `SELECT Locked FROM "Groups" WHERE SID=?`,
+		g.DbSID)
+	defer results.Close()
+
+	if err != nil {
+		return false, fmt.Errorf("Error checking Group %q: %s", g.UID, err)
+	}
+
+	row := results.NextRow()
+	if row == nil {
+		return false, nil
+	}
+	return NotNilBoolDef(row[0], false), nil
+}
+
+// While a Group is locked none of its Resources (or their Versions) can be
+// created, updated or deleted, nor can the Group itself be deleted. It's not
+// one of the Group's attributes, but PUT/PATCH of the Group can set it via
+// "locked" (see UpsertGroupWithObject).
+func (g *Group) SetLocked(val bool) error {
+	locked := 0
+	if val {
+		locked = 1
+	}
+	return Do(g.tx, `UPDATE "Groups" SET Locked=? WHERE SID=?`,
+		locked, g.DbSID)
+}
+
+// Returned when something tries to change a locked Group's Resources
+type LockedError struct {
+	Path string
+}
+
+func (le *LockedError) Error() string {
+	return fmt.Sprintf("Group %q is locked", le.Path)
+}
+
+func (g *Group) CheckLocked() error {
+	locked, err := g.IsLocked()
+	if err == nil && locked {
+		err = &LockedError{Path: "/" + g.Path}
+	}
+	return err
+}
+
+// A Group is mirrored if its "origin" points into the Registry's upstream
+// xRegistry. End-users can't change it, or anything in it, since the next
+// sync would just undo it.
+func (g *Group) IsMirrored() (bool, error) {
+	origin, _ := g.Get("origin").(string)
+	if origin == "" {
+		return false, nil
+	}
+	upstream, err := g.Registry.GetMirror()
+	if err != nil {
+		return false, err
+	}
+	return upstream != "" && strings.HasPrefix(origin, upstream+"/"), nil
+}
+
+func (g *Group) CheckMirrored() error {
+	if !g.tx.EnforceReadOnly {
+		return nil
+	}
+	mirrored, err := g.IsMirrored()
+	if err == nil && mirrored {
+		err = fmt.Errorf("Group %q is a read-only mirror of %q", "/"+g.Path,
+			g.Get("origin"))
+	}
+	return err
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	// "encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -19,6 +20,8 @@ import (
 type Server struct {
 	Port       int
 	HTTPServer *http.Server
+	Auth       *Auth // nil means anyone can do anything
+	ReadOnly   bool  // Reject all writes, regardless of the Registry
 }
 
 var DefaultRegDbSID string
@@ -48,6 +51,7 @@ func NewServer(port int) *Server {
 		},
 	}
 	server.HTTPServer.Handler = server
+	EnableSubscriptions()
 	return server
 }
 
@@ -98,7 +102,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// As of now we should never have more than one active Tx during
 		// testing
 		if TESTING {
-			l := len(TXs)
+			l := CountRequestTXs()
 			if (tx.tx == nil && l > 0) || (tx.tx != nil && l > 1) {
 				log.Printf(">End of HTTP Request")
 				DumpTXs()
@@ -129,8 +133,31 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	log.VPrintf(2, "%s %s", r.Method, r.URL)
 
+	// Check the credentials before even looking at the request, so that
+	// bad ones don't get told anything about it (like why it's invalid)
+	user := ""
+	if s.Auth != nil {
+		if user, err = s.Auth.Authenticate(r); err != nil {
+			log.VPrintf(2, "Authentication failed: %s", err)
+			s.Auth.Challenge(w.Header())
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(fmt.Sprintf("%s\n", err.Error())))
+			return
+		}
+	}
+
 	info, err = ParseRequest(tx, w, r)
 
+	// Same for users who aren't allowed to do it, so this wins over any
+	// parsing errors
+	if s.Auth != nil {
+		info.Auth = s.Auth
+		info.User = user
+		if authErr := s.Auth.Check(info); authErr != nil {
+			err = authErr
+		}
+	}
+
 	if err != nil {
 		w.WriteHeader(info.StatusCode)
 		w.Write([]byte(fmt.Sprintf("%s\n", err.Error())))
@@ -151,6 +178,14 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		info.HTTPWriter = NewBufferedWriter(info)
 	}
 
+	if AcceptsYAML(r.Header.Get("Accept")) && !r.URL.Query().Has("ui") &&
+		!r.URL.Query().Has("html") {
+		info.HTTPWriter = NewYAMLWriter(info)
+	}
+
+	// Metadata can be returned as JSON or YAML
+	info.AddHeader("Vary", "Accept")
+
 	if info.ResourceModel != nil && info.ResourceModel.GetHasDocument() == false &&
 		info.ShowMeta {
 		info.StatusCode = http.StatusBadRequest
@@ -158,6 +193,14 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			"model \"hasdocument\" value set to \"false\" is invalid")
 	}
 
+	if err == nil {
+		err = CheckReadOnly(info, s.ReadOnly)
+	}
+
+	if err == nil {
+		err = ConvertYAMLRequest(info)
+	}
+
 	if err == nil {
 		// These should only return an error if they didn't already
 		// send a response back to the client.
@@ -181,6 +224,12 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	Must(tx.Conditional(err))
 
 	if err != nil {
+		// A locked Group is always a 423, no matter where it was noticed
+		lockedErr := (*LockedError)(nil)
+		if errors.As(err, &lockedErr) {
+			info.StatusCode = http.StatusLocked
+		}
+
 		if info.StatusCode == 0 {
 			// Only default to BadRequest if not set by someone else
 			info.StatusCode = http.StatusBadRequest
@@ -189,6 +238,30 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Only reads are allowed if the server, or the Registry, is read-only
+func CheckReadOnly(info *RequestInfo, serverReadOnly bool) error {
+	method := strings.ToUpper(info.OriginalRequest.Method)
+	if method == "GET" || method == "HEAD" {
+		return nil
+	}
+
+	readOnly := serverReadOnly
+	if !readOnly && info.Registry != nil {
+		var err error
+		if readOnly, err = info.Registry.IsReadOnly(); err != nil {
+			info.StatusCode = http.StatusInternalServerError
+			return err
+		}
+	}
+
+	if readOnly {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("Write operations to a read-only registry are not " +
+			"allowed")
+	}
+	return nil
+}
+
 type HTTPWriter interface {
 	Write([]byte) (int, error)
 	AddHeader(string, string)
@@ -199,6 +272,7 @@ var _ HTTPWriter = &DefaultWriter{}
 var _ HTTPWriter = &BufferedWriter{}
 var _ HTTPWriter = &DiscardWriter{}
 var _ HTTPWriter = &PageWriter{}
+var _ HTTPWriter = &YAMLWriter{}
 
 func DefaultHTTPWriter(info *RequestInfo) HTTPWriter {
 	return &DefaultWriter{
@@ -349,9 +423,12 @@ func (pw *PageWriter) Done() {
 			}
 			next := MustPropPathFromDB(FE.Path).UI()
 			next, _ = strings.CutPrefix(next, prefix)
+			if FE.Absent {
+				subF += "!"
+			}
 			subF += next
 			if FE.HasEqual {
-				subF += "="
+				subF += FE.Operator
 				subF += FE.Value
 			}
 		}
@@ -722,6 +799,12 @@ FROM FullTree WHERE RegSID=? AND `
 
 	log.VPrintf(3, "Version: %#v", version)
 
+	etag := EntityETag(entity, true)
+	info.AddHeader("ETag", etag)
+	if info.NotModified(etag) {
+		return nil
+	}
+
 	headerIt := func(e *Entity, info *RequestInfo, key string, val any, attr *Attribute) error {
 		if key[0] == '#' {
 			return nil
@@ -747,6 +830,9 @@ FROM FullTree WHERE RegSID=? AND `
 		}
 
 		str := fmt.Sprintf("%v", val)
+		if key == "contentdigest" {
+			str = DigestHeader(str)
+		}
 		info.AddHeader(headerName, str)
 
 		return nil
@@ -817,8 +903,13 @@ FROM FullTree WHERE RegSID=? AND `
 		return nil
 	}
 
-	buf := version.Get("#resource")
-	if buf == nil {
+	// Stream it since it might be large and live in a BlobStore
+	doc, err := version.OpenDocument()
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+	if doc == nil {
 		// No data so just return
 		/*
 			if info.StatusCode == 0 {
@@ -827,7 +918,12 @@ FROM FullTree WHERE RegSID=? AND `
 		*/
 		return nil
 	}
-	info.Write(buf.([]byte))
+	defer doc.Close()
+
+	if _, err = io.Copy(info, doc); err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
 
 	return nil
 }
@@ -842,6 +938,18 @@ func HTTPGet(info *RequestInfo) error {
 		return HTTPGETModel(info)
 	}
 
+	if len(info.Parts) > 0 && info.Parts[0] == "subscriptions" {
+		return HTTPSubscriptions(info)
+	}
+
+	if len(info.Parts) > 0 && info.Parts[0] == "import" {
+		return HTTPBulkImport(info)
+	}
+
+	if info.OriginalRequest.URL.Query().Has("diff") {
+		return HTTPGETDiff(info)
+	}
+
 	metaInBody := (info.ResourceModel == nil) ||
 		(info.ResourceModel.GetHasDocument() == false || info.ShowMeta)
 
@@ -865,7 +973,8 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 		}
 	}()
 
-	query, args, err := GenerateQuery(info.Registry, what, paths, filters)
+	query, args, err := GenerateQuery(info.Registry, what, paths, filters,
+		info.CursorPath(), info.QueryLimit())
 	results, err := Query(info.tx, query, args...)
 	defer results.Close()
 
@@ -881,6 +990,9 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 			len(results.AllRows), diff)
 	}
 
+	SortResults(info, results)
+	PageResults(info, results)
+
 	jw := NewJsonWriter(info, results)
 	jw.NextEntity()
 
@@ -890,6 +1002,13 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 			info.StatusCode = http.StatusNotFound
 			return fmt.Errorf("Not found")
 		}
+
+		etag := info.MetadataETag(jw.Entity, results,
+			info.OriginalRequest.URL.Query().Encode())
+		info.AddHeader("ETag", etag)
+		if info.NotModified(etag) {
+			return nil
+		}
 	}
 
 	// Special case, if we're doing a collection, let's make sure we didn't
@@ -911,6 +1030,7 @@ func SerializeQuery(info *RequestInfo, paths []string, what string,
 
 	info.AddHeader("Content-Type", "application/json")
 	if what == "Coll" {
+		jw.limit = info.Limit
 		_, err = jw.WriteCollection()
 	} else {
 		err = jw.WriteEntity()
@@ -957,17 +1077,76 @@ func HTTPPutPost(info *RequestInfo) error {
 		return HTTPPUTModel(info)
 	}
 
+	if len(info.Parts) > 0 && info.Parts[0] == "subscriptions" {
+		return HTTPSubscriptions(info)
+	}
+
+	if len(info.Parts) > 0 && info.Parts[0] == "import" {
+		return HTTPBulkImport(info)
+	}
+
+	if err := CheckPreconditions(info); err != nil {
+		return err
+	}
+
 	// Load-up the body
 	// //////////////////////////////////////////////////////
-	body, err := io.ReadAll(info.OriginalRequest.Body)
-	if err != nil {
-		info.StatusCode = http.StatusBadRequest
-		return fmt.Errorf("Error reading body: %s", err)
+	body := []byte(nil)
+	err := error(nil)
+
+	// A Resource's document is streamed into the BlobStore (if there is
+	// one) rather than held in memory
+	if blobStore != nil && !metaInBody &&
+		((method == "PUT" && len(info.Parts) == 6) ||
+			(method != "PATCH" && len(info.Parts) == 4)) {
+
+		info.document, err = info.tx.StageBlob(info.OriginalRequest.Body,
+			info.OriginalRequest.ContentLength)
+		if err != nil {
+			info.StatusCode = http.StatusBadRequest
+			return err
+		}
+		if info.document.Size == 0 {
+			info.document = nil
+		}
+	} else {
+		body, err = io.ReadAll(info.OriginalRequest.Body)
+		if err != nil {
+			info.StatusCode = http.StatusBadRequest
+			return fmt.Errorf("Error reading body: %s", err)
+		}
 	}
 	if len(body) == 0 {
 		body = nil
 	}
 
+	// PUT/POST/PATCH /GROUPs/gID/RESOURCEs... + ReadOnly Resource
+	if info.ResourceModel != nil && info.ResourceModel.ReadOnly {
+		// Note that we only block it for end-user interactions, like via
+		// HTTP. If people try to change it via the internal APIs, then
+		// we don't stop it yet. Not sure if we should. TODO
+
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("Write operations to read-only resources are not " +
+			"allowed")
+	}
+
+	// PUT/POST/PATCH /GROUPs/gID... + mirrored Group
+	if len(info.Parts) > 1 {
+		group, err := info.Registry.FindGroup(info.GroupType, info.GroupUID,
+			false)
+		if err != nil {
+			info.StatusCode = http.StatusInternalServerError
+			return fmt.Errorf("Error finding group(%s): %s", info.GroupUID, err)
+		}
+		if group != nil {
+			if err = group.CheckMirrored(); err != nil {
+				info.StatusCode = http.StatusMethodNotAllowed
+				return err
+			}
+		}
+	}
+
 	// POST /groups/gID/resources/rID?setdefaultversiond is special in that
 	// it only moves the "default" point, nothing else is meant to be done
 	if metaInBody && len(info.Parts) == 4 && method == "POST" && body == nil {
@@ -1003,21 +1182,22 @@ func HTTPPutPost(info *RequestInfo) error {
 		return fmt.Errorf("POST not allowed on a version")
 	}
 
-	if !metaInBody && method == "PATCH" {
+	patchType := ""
+	if method == "PATCH" {
+		patchType = PatchContentType(info)
+	}
+
+	if !metaInBody && method == "PATCH" && patchType == "" {
 		info.StatusCode = http.StatusBadRequest
 		return fmt.Errorf("PATCH is not allowed on Resource documents")
 	}
 
-	// PUT/POST /GROUPs/gID/RESOURCEs... + ReadOnly Resource
-	if info.ResourceModel != nil && info.ResourceModel.ReadOnly &&
-		(method == "PUT" || method == "POST") {
-		// Note that we only block it for end-user interactions, like via
-		// HTTP. If people try to change it via the internal APIs, then
-		// we don't stop it yet. Not sure if we should. TODO
-
-		info.StatusCode = http.StatusMethodNotAllowed
-		return fmt.Errorf("Write operations to read-only resources are not " +
-			"allowed")
+	// Turn a JSON Patch or JSON Merge Patch into a regular PATCH
+	if patchType != "" {
+		if body, err = PatchRequestBody(info, patchType, body,
+			metaInBody); err != nil {
+			return err
+		}
 	}
 
 	// Ok, now start to deal with the incoming request
@@ -1029,6 +1209,11 @@ func HTTPPutPost(info *RequestInfo) error {
 		return err
 	}
 
+	// The Content-Type was the patch's, not the new document's
+	if patchType != "" && !metaInBody {
+		delete(IncomingObj, "contenttype")
+	}
+
 	// If ID is in the incoming object, grab it for later use
 	propsID := ""
 	if v, ok := IncomingObj["id"]; ok {
@@ -1481,20 +1666,36 @@ func HTTPPUTModel(info *RequestInfo) error {
 		return err
 	}
 
-	model := Model{}
-	// err = json.Unmarshal(reqBody, &model)
-	err = Unmarshal(reqBody, &model)
+	// The model can include the steps needed to migrate the existing
+	// entities to it
+	update := struct {
+		Model
+		Migrations []*MigrationStep `json:"$migrations,omitempty"`
+	}{}
+	err = Unmarshal(reqBody, &update)
 	if err != nil {
-		info.StatusCode = http.StatusInternalServerError
+		info.StatusCode = http.StatusBadRequest
 		return err
 	}
 
-	if err != nil {
-		info.StatusCode = http.StatusInternalServerError
-		return err
+	// Just report what would happen to the existing entities
+	if info.OriginalRequest.URL.Query().Has("dryrun") {
+		report, err := info.Registry.DryRunNewModel(&update.Model,
+			update.Migrations)
+		if err != nil {
+			info.StatusCode = http.StatusBadRequest
+			return err
+		}
+
+		buf, _ := json.MarshalIndent(report, "", "  ")
+		info.AddHeader("Content-Type", "application/json")
+		info.Write(buf)
+		info.Write([]byte("\n"))
+		return nil
 	}
 
-	err = info.Registry.Model.ApplyNewModel(&model)
+	_, err = info.Registry.Model.ApplyNewModelWithMigrations(&update.Model,
+		update.Migrations)
 	if err != nil {
 		info.StatusCode = http.StatusBadRequest
 		return err
@@ -1553,7 +1754,7 @@ func ProcessSetDefaultVersionIDFlag(info *RequestInfo, resource *Resource, versi
 	err = resource.SetDefault(version)
 	if err != nil {
 		info.StatusCode = http.StatusInternalServerError
-		return fmt.Errorf("Error setting default version: %s", err)
+		return fmt.Errorf("Error setting default version: %w", err)
 	}
 
 	return nil
@@ -1597,6 +1798,18 @@ func HTTPDelete(info *RequestInfo) error {
 		return fmt.Errorf("Can't delete an entire registry")
 	}
 
+	if info.Parts[0] == "subscriptions" {
+		return HTTPSubscriptions(info)
+	}
+
+	if info.Parts[0] == "import" {
+		return HTTPBulkImport(info)
+	}
+
+	if err := CheckPreconditions(info); err != nil {
+		return err
+	}
+
 	var err error
 	epochStr := info.OriginalRequest.URL.Query().Get("epoch")
 	epochInt := -1
@@ -1631,6 +1844,12 @@ func HTTPDelete(info *RequestInfo) error {
 		return fmt.Errorf(`Group %q not found`, info.GroupUID)
 	}
 
+	// Nothing in, or of, a mirrored Group can be deleted
+	if err = group.CheckMirrored(); err != nil {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return err
+	}
+
 	if len(info.Parts) == 2 {
 		// DELETE /GROUPs/gID
 		if epochInt >= 0 {
@@ -1640,7 +1859,7 @@ func HTTPDelete(info *RequestInfo) error {
 		}
 		if err = group.Delete(); err != nil {
 			info.StatusCode = http.StatusInternalServerError
-			return fmt.Errorf(`Error deleting Group %q: %s`, info.GroupUID, err)
+			return fmt.Errorf(`Error deleting Group %q: %w`, info.GroupUID, err)
 		}
 
 		info.StatusCode = http.StatusNoContent
@@ -1654,6 +1873,12 @@ func HTTPDelete(info *RequestInfo) error {
 		return fmt.Errorf(`Resource type %q not found`, info.ResourceType)
 	}
 
+	if rm.ReadOnly {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("Write operations to read-only resources are not " +
+			"allowed")
+	}
+
 	if len(info.Parts) == 3 {
 		// DELETE /GROUPs/gID/RESOURCEs
 		return HTTPDeleteResources(info)
@@ -1682,7 +1907,7 @@ func HTTPDelete(info *RequestInfo) error {
 
 		if err != nil {
 			info.StatusCode = http.StatusInternalServerError
-			return fmt.Errorf(`Error deleting Resource %q: %s`,
+			return fmt.Errorf(`Error deleting Resource %q: %w`,
 				info.ResourceUID, err)
 		}
 
@@ -1807,10 +2032,15 @@ func HTTPDeleteGroups(info *RequestInfo) error {
 			}
 		}
 
+		if err = group.CheckMirrored(); err != nil {
+			info.StatusCode = http.StatusMethodNotAllowed
+			return err
+		}
+
 		err = group.Delete()
 		if err != nil {
 			info.StatusCode = http.StatusInternalServerError
-			return fmt.Errorf(`Error deleting %q: %s`, entry.ID, err)
+			return fmt.Errorf(`Error deleting %q: %w`, entry.ID, err)
 		}
 	}
 
@@ -1876,7 +2106,7 @@ func HTTPDeleteResources(info *RequestInfo) error {
 		err = resource.Delete()
 		if err != nil {
 			info.StatusCode = http.StatusInternalServerError
-			return fmt.Errorf(`Error deleting %q: %s`, entry.ID, err)
+			return fmt.Errorf(`Error deleting %q: %w`, entry.ID, err)
 		}
 	}
 
@@ -2028,7 +2258,11 @@ func ExtractIncomingObject(info *RequestInfo, body []byte) (Object, error) {
 	// copy over the existing properties later once we know what entity
 	// we're dealing with
 	if len(info.Parts) > 2 && !metaInBody {
-		IncomingObj[resSingular] = body // save new body
+		if info.document != nil {
+			IncomingObj[resSingular] = info.document
+		} else {
+			IncomingObj[resSingular] = body // save new body
+		}
 
 		seenMaps := map[string]bool{}
 
@@ -2065,7 +2299,7 @@ func ExtractIncomingObject(info *RequestInfo, body []byte) (Object, error) {
 			}
 
 			if key == resSingular+"url" || key == resSingular+"proxyurl" {
-				if len(body) != 0 {
+				if len(body) != 0 || info.document != nil {
 					return nil, fmt.Errorf("'xRegistry-%s' isn't allowed "+
 						"if there's a body", key)
 				}
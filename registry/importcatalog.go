@@ -0,0 +1,396 @@
+package registry
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// The name of the optional file, at the root of an ImportCatalog, that maps
+// URL prefixes to paths in the catalog, e.g.:
+//
+//	{ "https://raw.githubusercontent.com/xregistry/spec/main/": "spec/" }
+const IMPORT_CATALOG_MAP = "catalog.json"
+
+// An ImportCatalog holds local copies of the documents that models $import
+// by URL, so they can be processed w/o network access. It's either a
+// directory or an archive (.zip, .tar, .tar.gz or .tgz) and a URL's copy is
+// at HOST/PATH in it (e.g. raw.githubusercontent.com/xregistry/spec/main/
+// endpoint/model.json) unless IMPORT_CATALOG_MAP says otherwise.
+type ImportCatalog struct {
+	Source   string            // the dir or archive it was loaded from
+	Prefixes map[string]string // URL prefix -> path prefix in the catalog
+
+	dir   string            // if it's a dir
+	files map[string][]byte // if it's an archive: path -> contents
+}
+
+var importCatalog *ImportCatalog // nil means there isn't one
+var importCacheDir string        // "" means no caching
+var importOffline bool           // if true, never fetch URLs
+
+// How long a cached document is used before it's fetched again
+var importCacheTTL = 24 * time.Hour
+
+func SetImportCatalog(catalog *ImportCatalog) {
+	importCatalog = catalog
+}
+
+func GetImportCatalog() *ImportCatalog {
+	return importCatalog
+}
+
+// Documents fetched from URLs are saved in "dir", w/the same layout as an
+// ImportCatalog's, and reused from then on. "" turns off caching.
+func SetImportCacheDir(dir string) {
+	importCacheDir = dir
+}
+
+func GetImportCacheDir() string {
+	return importCacheDir
+}
+
+// Cached documents older than "ttl" are fetched again, and the cached copy
+// is only used if that fails. 0 means they never expire, in which case
+// ClearImportCache() is the only way to pick up changes to them.
+func SetImportCacheTTL(ttl time.Duration) {
+	importCacheTTL = ttl
+}
+
+func GetImportCacheTTL() time.Duration {
+	return importCacheTTL
+}
+
+// Deletes all of the cached documents, the dir itself is kept
+func ClearImportCache() error {
+	if importCacheDir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(importCacheDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		err = os.RemoveAll(filepath.Join(importCacheDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// When "offline" is true URLs that aren't in the catalog, or the cache,
+// result in an error instead of being fetched
+func SetImportOffline(offline bool) {
+	importOffline = offline
+}
+
+func GetImportOffline() bool {
+	return importOffline
+}
+
+// A helper for the commands to set all of the import options at once.
+// An empty "catalog" means no catalog.
+func ConfigureImports(catalog string, cacheDir string, offline bool) error {
+	SetImportCatalog(nil)
+	if catalog != "" {
+		cat, err := LoadImportCatalog(catalog)
+		if err != nil {
+			return err
+		}
+		SetImportCatalog(cat)
+	}
+	SetImportCacheDir(cacheDir)
+	SetImportOffline(offline)
+	return nil
+}
+
+func LoadImportCatalog(src string) (*ImportCatalog, error) {
+	catalog := &ImportCatalog{
+		Source:   src,
+		Prefixes: map[string]string{},
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading import catalog: %s", err)
+	}
+
+	if info.IsDir() {
+		catalog.dir = src
+	} else {
+		catalog.files, err = readCatalogArchive(src)
+		if err != nil {
+			return nil, fmt.Errorf("Error loading import catalog %q: %s",
+				src, err)
+		}
+	}
+
+	buf, err := catalog.readFile(IMPORT_CATALOG_MAP)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if buf != nil {
+		if err = Unmarshal(buf, &catalog.Prefixes); err != nil {
+			return nil, fmt.Errorf("Error parsing %q in import catalog %q: %s",
+				IMPORT_CATALOG_MAP, src, err)
+		}
+	}
+
+	return catalog, nil
+}
+
+// Loads all of the files in the archive into memory, they're meant to be
+// small (model files)
+func readCatalogArchive(src string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+
+	if strings.HasSuffix(src, ".zip") {
+		zr, err := zip.OpenReader(src)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			r, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			buf, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[path.Clean(f.Name)] = buf
+		}
+		return files, nil
+	}
+
+	if !strings.HasSuffix(src, ".tar") && !strings.HasSuffix(src, ".tar.gz") &&
+		!strings.HasSuffix(src, ".tgz") {
+		return nil, fmt.Errorf("must be a directory, or a .zip, .tar, " +
+			".tar.gz or .tgz file")
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := io.Reader(file)
+	if !strings.HasSuffix(src, ".tar") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		buf, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(hdr.Name)] = buf
+	}
+	return files, nil
+}
+
+// "name" is a "/" separated path relative to the root of the catalog
+func (catalog *ImportCatalog) readFile(name string) ([]byte, error) {
+	if catalog.files != nil {
+		buf, ok := catalog.files[name]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+		return buf, nil
+	}
+	return os.ReadFile(filepath.Join(catalog.dir, filepath.FromSlash(name)))
+}
+
+// Returns the local copy of the document at "u", or nil if there isn't one
+func (catalog *ImportCatalog) Lookup(u string) ([]byte, error) {
+	names := []string{}
+
+	// Longest matching prefix wins
+	prefix := ""
+	for p := range catalog.Prefixes {
+		if strings.HasPrefix(u, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	if prefix != "" {
+		names = append(names, catalog.Prefixes[prefix]+u[len(prefix):])
+	}
+	if name := URLToCatalogPath(u); name != "" {
+		names = append(names, name)
+	}
+
+	for _, name := range names {
+		name = path.Clean(name)
+		if name == ".." || strings.HasPrefix(name, "../") ||
+			path.IsAbs(name) {
+			continue // don't allow it to point outside of the catalog
+		}
+		buf, err := catalog.readFile(name)
+		if err == nil {
+			return buf, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// Returns the HOST/PATH (relative) location of a URL in a catalog or the
+// cache, or "" if it can't have one (e.g. it has a query string)
+func URLToCatalogPath(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" || parsed.RawQuery != "" ||
+		(parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+	p := path.Clean("/" + parsed.Path)
+	if p == "/" {
+		return ""
+	}
+	return parsed.Host + p
+}
+
+// Returns the cached copy of "u" (nil if there isn't one), and whether it's
+// older than the TTL
+func readImportCache(u string) ([]byte, bool) {
+	name := URLToCatalogPath(u)
+	if importCacheDir == "" || name == "" {
+		return nil, false
+	}
+	file := filepath.Join(importCacheDir, filepath.FromSlash(name))
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, false
+	}
+	buf, err := os.ReadFile(file)
+	if err != nil {
+		return nil, false
+	}
+	expired := importCacheTTL > 0 &&
+		time.Since(info.ModTime()) > importCacheTTL
+	return buf, expired
+}
+
+// A failure to cache it isn't fatal, we just log it
+func writeImportCache(u string, buf []byte) {
+	name := URLToCatalogPath(u)
+	if importCacheDir == "" || name == "" {
+		return
+	}
+
+	file := filepath.Join(importCacheDir, filepath.FromSlash(name))
+	err := os.MkdirAll(filepath.Dir(file), 0755)
+	if err == nil {
+		// Write it under a temp name 1st so no one sees a partial file
+		var tmp *os.File
+		tmp, err = os.CreateTemp(filepath.Dir(file), ".tmp-")
+		if err == nil {
+			_, err = tmp.Write(buf)
+			if closeErr := tmp.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = os.Rename(tmp.Name(), file)
+			}
+			if err != nil {
+				os.Remove(tmp.Name())
+			}
+		}
+	}
+	if err != nil {
+		log.Printf("Error caching %q: %s", u, err)
+	}
+}
+
+// Returns the document at URL "u" from the import catalog, then the cache,
+// and only then by fetching it (unless we're offline). An expired copy in
+// the cache is used when we're offline, or when fetching it fails.
+func FetchURL(u string) ([]byte, error) {
+	if importCatalog != nil {
+		buf, err := importCatalog.Lookup(u)
+		if err != nil {
+			return nil, err
+		}
+		if buf != nil {
+			return buf, nil
+		}
+	}
+
+	cached, expired := readImportCache(u)
+	if cached != nil && (!expired || importOffline) {
+		return cached, nil
+	}
+
+	if importOffline {
+		return nil, fmt.Errorf("Can't get %q, it's not in the import "+
+			"catalog and we're offline", u)
+	}
+
+	buf, err := fetchURL(u)
+	if err != nil {
+		if cached != nil {
+			log.Printf("Using the expired cached copy of %q: %s", u, err)
+			return cached, nil
+		}
+		return nil, err
+	}
+
+	writeImportCache(u, buf)
+	return buf, nil
+}
+
+func fetchURL(u string) ([]byte, error) {
+	res, err := http.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("Error getting %q: %s", u, res.Status)
+	}
+	return buf, nil
+}
@@ -0,0 +1,261 @@
+package registry
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var catalogFiles = map[string]string{
+	"example.com/models/base.json": `{"attributes":{"x":{"type":"string"}}}`,
+	"mapped/other.json":            `{"name":"other"}`,
+	"catalog.json": `{
+  "https://example.com/": "nothere/",
+  "https://example.com/mapped/": "mapped/"
+}`,
+}
+
+func checkCatalog(t *testing.T, src string) {
+	t.Helper()
+
+	catalog, err := LoadImportCatalog(src)
+	if err != nil {
+		t.Fatalf("LoadImportCatalog(%s): %s", src, err)
+	}
+
+	// HOST/PATH layout, after the (longest) prefix match misses
+	buf, err := catalog.Lookup("https://example.com/models/./base.json")
+	if err != nil || string(buf) != catalogFiles["example.com/models/base.json"] {
+		t.Fatalf("%s: bad base.json: %q %v", src, string(buf), err)
+	}
+
+	// Via catalog.json
+	buf, err = catalog.Lookup("https://example.com/mapped/other.json")
+	if err != nil || string(buf) != catalogFiles["mapped/other.json"] {
+		t.Fatalf("%s: bad other.json: %q %v", src, string(buf), err)
+	}
+
+	// Not there
+	buf, err = catalog.Lookup("https://example.com/models/missing.json")
+	if err != nil || buf != nil {
+		t.Fatalf("%s: missing.json should be nil: %q %v", src, string(buf), err)
+	}
+
+	// Can't get out of the catalog
+	buf, err = catalog.Lookup("https://example.com/mapped/../../../etc/passwd")
+	if err != nil || buf != nil {
+		t.Fatalf("%s: escaped the catalog: %q %v", src, string(buf), err)
+	}
+}
+
+func TestImportCatalogDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, data := range catalogFiles {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatalf("MkdirAll: %s", err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+	}
+	checkCatalog(t, dir)
+}
+
+func TestImportCatalogArchives(t *testing.T) {
+	dir := t.TempDir()
+
+	zipFile := filepath.Join(dir, "catalog.zip")
+	file, err := os.Create(zipFile)
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	zw := zip.NewWriter(file)
+	for name, data := range catalogFiles {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip Create: %s", err)
+		}
+		w.Write([]byte(data))
+	}
+	zw.Close()
+	file.Close()
+	checkCatalog(t, zipFile)
+
+	tgzFile := filepath.Join(dir, "catalog.tgz")
+	file, err = os.Create(tgzFile)
+	if err != nil {
+		t.Fatalf("Create: %s", err)
+	}
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+	for name, data := range catalogFiles {
+		tw.WriteHeader(&tar.Header{
+			Name:     "./" + name,
+			Mode:     0644,
+			Size:     int64(len(data)),
+			Typeflag: tar.TypeReg,
+		})
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	gw.Close()
+	file.Close()
+	checkCatalog(t, tgzFile)
+
+	badFile := filepath.Join(dir, "catalog.rar")
+	os.WriteFile(badFile, []byte("junk"), 0644)
+	if _, err := LoadImportCatalog(badFile); err == nil ||
+		!strings.Contains(err.Error(), "must be a directory") {
+		t.Fatalf("Should have failed: %v", err)
+	}
+}
+
+func TestImportCache(t *testing.T) {
+	defer ConfigureImports("", "", false)
+
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			if r.URL.Path != "/model.json" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"hello":"world"}`))
+		}))
+	u := server.URL + "/model.json"
+
+	cacheDir := t.TempDir()
+	if err := ConfigureImports("", cacheDir, false); err != nil {
+		t.Fatalf("ConfigureImports: %s", err)
+	}
+
+	buf, err := FetchURL(u)
+	if err != nil || string(buf) != `{"hello":"world"}` || hits != 1 {
+		t.Fatalf("Bad fetch: %q %v %d", string(buf), err, hits)
+	}
+
+	if _, err = FetchURL(server.URL + "/missing.json"); err == nil ||
+		!strings.Contains(err.Error(), "404") {
+		t.Fatalf("Should have failed: %v", err)
+	}
+	server.Close()
+
+	// From the cache now, even when offline
+	SetImportOffline(true)
+	buf, err = FetchURL(u)
+	if err != nil || string(buf) != `{"hello":"world"}` || hits != 2 {
+		t.Fatalf("Bad cached fetch: %q %v %d", string(buf), err, hits)
+	}
+
+	_, err = FetchURL(server.URL + "/other.json")
+	if err == nil || !strings.Contains(err.Error(), "we're offline") {
+		t.Fatalf("Should have failed offline: %v", err)
+	}
+
+	// Query strings aren't cached
+	if name := URLToCatalogPath(u + "?x=1"); name != "" {
+		t.Fatalf("Query shouldn't have a path: %q", name)
+	}
+}
+
+func TestImportCacheTTL(t *testing.T) {
+	defer ConfigureImports("", "", false)
+	defer SetImportCacheTTL(GetImportCacheTTL())
+
+	hits := 0
+	server := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			fmt.Fprintf(w, `{"version":%d}`, hits)
+		}))
+	u := server.URL + "/model.json"
+
+	cacheDir := t.TempDir()
+	if err := ConfigureImports("", cacheDir, false); err != nil {
+		t.Fatalf("ConfigureImports: %s", err)
+	}
+	SetImportCacheTTL(time.Hour)
+	file := filepath.Join(cacheDir, filepath.FromSlash(URLToCatalogPath(u)))
+	expire := func() {
+		old := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(file, old, old); err != nil {
+			t.Fatalf("Chtimes: %s", err)
+		}
+	}
+	check := func(exp string, expHits int) {
+		t.Helper()
+		buf, err := FetchURL(u)
+		if err != nil || string(buf) != exp || hits != expHits {
+			t.Fatalf("Bad fetch: %q %v %d", string(buf), err, hits)
+		}
+	}
+
+	check(`{"version":1}`, 1)
+	check(`{"version":1}`, 1) // cached
+
+	expire()
+	check(`{"version":2}`, 2) // expired, so it's fetched again
+	check(`{"version":2}`, 2)
+
+	// If it can't be fetched then the expired copy is still used
+	expire()
+	server.Close()
+	check(`{"version":2}`, 2)
+	SetImportOffline(true)
+	check(`{"version":2}`, 2)
+
+	// Never expires
+	SetImportCacheTTL(0)
+	SetImportOffline(false)
+	check(`{"version":2}`, 2)
+
+	if err := ClearImportCache(); err != nil {
+		t.Fatalf("ClearImportCache: %s", err)
+	}
+	if entries, _ := os.ReadDir(cacheDir); len(entries) != 0 {
+		t.Fatalf("Cache wasn't cleared: %v", entries)
+	}
+	if _, err := FetchURL(u); err == nil {
+		t.Fatalf("Should have failed w/o a cached copy")
+	}
+}
+
+func TestProcessImportsCatalog(t *testing.T) {
+	defer ConfigureImports("", "", false)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "example.com", "spec", "message", "model.json")
+	os.MkdirAll(filepath.Dir(file), 0755)
+	os.WriteFile(file, []byte(`{"groups":{"msgs":{"plural":"msgs"}}}`), 0644)
+
+	if err := ConfigureImports(dir, "", true); err != nil {
+		t.Fatalf("ConfigureImports: %s", err)
+	}
+
+	// The relative import is resolved against the URL, then found in
+	// the catalog
+	buf, err := ProcessImports("https://example.com/spec/endpoint/model.json",
+		[]byte(`{"$import": "../message/model.json#/groups"}`), false)
+	if err != nil {
+		t.Fatalf("ProcessImports: %s", err)
+	}
+	if string(buf) != `{"msgs":{"plural":"msgs"}}` {
+		t.Fatalf("Bad result: %s", string(buf))
+	}
+
+	_, err = ProcessImports("https://example.com/spec/endpoint/model.json",
+		[]byte(`{"$import": "../schema/model.json"}`), false)
+	if err == nil || !strings.Contains(err.Error(), "we're offline") {
+		t.Fatalf("Should have failed offline: %v", err)
+	}
+}
@@ -3,7 +3,9 @@ package registry
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/duglin/dlog"
 )
@@ -29,8 +31,16 @@ type RequestInfo struct {
 	HasNested        bool
 	Inlines          []string        // TODO store a PropPaths instead
 	Filters          [][]*FilterExpr // [OR][AND] filter=e,e(and) &(or) filter=e
+	SortKey          string          // sort=attr[=asc|desc], in UI format
+	SortDesc         bool
+	Limit            int         // limit=N, 0 means no limit
+	Cursor           *pageCursor // cursor=xxx, where the previous page ended
 	ShowModel        bool
-	ShowMeta         bool //	was $meta present
+	ShowMeta         bool   //	was $meta present
+	User             string // Authenticated user, "" if anonymous
+	Auth             *Auth  // nil means anyone can do anything
+
+	document *StagedBlob // Uploaded document, already in the BlobStore
 
 	StatusCode int
 	SentStatus bool
@@ -98,6 +108,16 @@ func (info *RequestInfo) ShouldInline(entityPath string) bool {
 	return false
 }
 
+// Returns true if the body of the request (and of the response) holds the
+// xRegistry metadata, or the model, rather than a Resource's document
+func (info *RequestInfo) HasMetaBody() bool {
+	if info.What != "Entity" || info.ResourceUID == "" {
+		return true
+	}
+	return info.ResourceModel == nil ||
+		info.ResourceModel.GetHasDocument() == false || info.ShowMeta
+}
+
 func (ri *RequestInfo) Write(b []byte) (int, error) {
 	return ri.HTTPWriter.Write(b)
 }
@@ -109,7 +129,41 @@ func (ri *RequestInfo) AddHeader(name, value string) {
 type FilterExpr struct {
 	Path     string // endpoints.id  TODO store a PropPath?
 	Value    string // myEndpoint
-	HasEqual bool
+	HasEqual bool   // true if there's an Operator (and Value)
+	Operator string // =, !=, <, <=, >, >=
+	Absent   bool   // !path - the attribute must not be present
+
+	// Set by ParseFilters so GenerateQuery doesn't need to look at the model
+	Abstract string // Path of the entity being checked, e.g. dirs,files
+	PropName string // Path of the attribute on that entity, e.g. labels,a,
+	Type     string // How to compare: STRING, DECIMAL, TIMESTAMP, BOOLEAN
+	Wildcard bool   // Value has a "*" in it
+}
+
+// Order matters, longest ones first
+var filterOperators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// Split "expr" into the attribute path, operator and value. Skip over
+// any operator-looking chars in the path's [...] sections since those can
+// hold quoted map keys.
+func splitFilterExpr(expr string) (string, string, string) {
+	inBracket := false
+	for i := 0; i < len(expr); i++ {
+		switch ch := expr[i]; {
+		case ch == '[':
+			inBracket = true
+		case ch == ']':
+			inBracket = false
+		case inBracket:
+		default:
+			for _, op := range filterOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					return expr[:i], op, expr[i+len(op):]
+				}
+			}
+		}
+	}
+	return expr, "", ""
 }
 
 func ParseRequest(tx *Tx, w http.ResponseWriter, r *http.Request) (*RequestInfo, error) {
@@ -128,6 +182,7 @@ func ParseRequest(tx *Tx, w http.ResponseWriter, r *http.Request) (*RequestInfo,
 	tx.IgnoreEpoch = r.URL.Query().Has("noepoch")
 	tx.IgnoreStickyDefaultVersion = r.URL.Query().Has("nostickydefaultversion")
 	tx.IgnoreDefaultVersionID = r.URL.Query().Has("nodefaultversionid")
+	tx.EnforceReadOnly = true // Only the internal APIs can bypass it
 
 	if info.Registry != nil && tx.Registry == nil {
 		tx.Registry = info.Registry
@@ -192,6 +247,18 @@ func ParseRequest(tx *Tx, w http.ResponseWriter, r *http.Request) (*RequestInfo,
 	}
 
 	err = info.ParseFilters()
+	if err != nil {
+		info.StatusCode = http.StatusBadRequest
+		return info, err
+	}
+
+	err = info.ParseSort()
+	if err != nil {
+		info.StatusCode = http.StatusBadRequest
+		return info, err
+	}
+
+	err = info.ParsePaging()
 	if err != nil {
 		info.StatusCode = http.StatusBadRequest
 	}
@@ -199,9 +266,49 @@ func ParseRequest(tx *Tx, w http.ResponseWriter, r *http.Request) (*RequestInfo,
 	return info, err
 }
 
+func (info *RequestInfo) ParseSort() error {
+	if !info.OriginalRequest.URL.Query().Has("sort") {
+		return nil
+	}
+
+	// ?sort=path.to.attribute[=asc|desc]
+	sortQ := strings.TrimSpace(info.OriginalRequest.URL.Query().Get("sort"))
+	key, order, _ := strings.Cut(sortQ, "=")
+	key = strings.TrimSpace(key)
+	order = strings.ToLower(strings.TrimSpace(order))
+
+	if key == "" {
+		return fmt.Errorf("Sort %q is missing an attribute name", sortQ)
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		return fmt.Errorf("Sort %q has an invalid order, must be one of: "+
+			"asc, desc", sortQ)
+	}
+
+	pp, err := PropPathFromUI(key)
+	if err != nil {
+		return err
+	}
+
+	// When asking for a collection we know what type of entity we're
+	// sorting, so make sure it's something we can compare
+	if info.What == "Coll" {
+		absPP, _ := PropPathFromPath(info.Abstract)
+		daType := info.Registry.Model.GetPropType(absPP.Abstract(), pp)
+		if daType != "" && daType != ANY && !IsScalar(daType) {
+			return fmt.Errorf("Sort %q must use a scalar attribute", sortQ)
+		}
+	}
+
+	info.SortKey = pp.UI()
+	info.SortDesc = (order == "desc")
+	return nil
+}
+
 func (info *RequestInfo) ParseFilters() error {
 	for _, filterQ := range info.OriginalRequest.URL.Query()["filter"] {
-		// ?filter=path.to.attribute[=value],* & filter=...
+		// ?filter=[!]path.to.attribute[op value],* & filter=...
+		// op is one of: = != < <= > >=
 
 		filterQ = strings.TrimSpace(filterQ)
 		exprs := strings.Split(filterQ, ",")
@@ -211,33 +318,11 @@ func (info *RequestInfo) ParseFilters() error {
 			if expr == "" {
 				continue
 			}
-			path, value, found := strings.Cut(expr, "=")
-			pp, err := PropPathFromUI(path)
+
+			filter, err := info.ParseFilterExpr(expr)
 			if err != nil {
 				return err
 			}
-			path = pp.DB()
-
-			/*
-				if info.What != "Coll" && strings.Index(path, "/") < 0 {
-					info.StatusCode = http.StatusBadRequest
-					return fmt.Errorf("A filter with just an attribute name (%s) "+
-						"isn't allowed in this context", path)
-				}
-			*/
-
-			if info.Abstract != "" {
-				// Want: path = abs + "," + path in DB format
-				absPP, _ := PropPathFromPath(info.Abstract)
-				absPP = absPP.Append(pp)
-				path = absPP.DB()
-			}
-
-			filter := &FilterExpr{
-				Path:     path,
-				Value:    value,
-				HasEqual: found,
-			}
 
 			if AndFilters == nil {
 				AndFilters = []*FilterExpr{}
@@ -255,6 +340,114 @@ func (info *RequestInfo) ParseFilters() error {
 	return nil
 }
 
+func (info *RequestInfo) ParseFilterExpr(expr string) (*FilterExpr, error) {
+	path, op, value := splitFilterExpr(expr)
+
+	filter := &FilterExpr{
+		Value:    value,
+		HasEqual: op != "",
+		Operator: op,
+	}
+
+	if strings.HasPrefix(path, "!") {
+		if op != "" {
+			return nil, fmt.Errorf("Filter %q can't use \"!\" and %q at "+
+				"the same time", expr, op)
+		}
+		filter.Absent = true
+		path = path[1:]
+	}
+
+	pp, err := PropPathFromUI(path)
+	if err != nil {
+		return nil, err
+	}
+	if pp.Len() == 0 {
+		return nil, fmt.Errorf("Filter %q is missing an attribute name", expr)
+	}
+
+	/*
+		if info.What != "Coll" && strings.Index(path, "/") < 0 {
+			info.StatusCode = http.StatusBadRequest
+			return fmt.Errorf("A filter with just an attribute name (%s) "+
+				"isn't allowed in this context", path)
+		}
+	*/
+
+	if info.Abstract != "" {
+		// Want: path = abs + "," + path in DB format
+		absPP, _ := PropPathFromPath(info.Abstract)
+		pp = absPP.Append(pp)
+	}
+	filter.Path = pp.DB()
+
+	// Split the path into the entity and attribute parts
+	m := info.Registry.Model
+	absPP := NewPP()
+	if gm := m.Groups[pp.Top()]; gm != nil && pp.Len() > 1 {
+		absPP = absPP.P(gm.Plural)
+		if rm := gm.Resources[pp.Parts[1].Text]; rm != nil && pp.Len() > 2 {
+			absPP = absPP.P(rm.Plural)
+			if pp.Parts[2].Text == "versions" && pp.Len() > 3 {
+				absPP = absPP.P("versions")
+			}
+		}
+	}
+	filter.Abstract = absPP.Abstract()
+	filter.PropName = (&PropPath{Parts: pp.Parts[absPP.Len():]}).DB()
+
+	if !filter.HasEqual {
+		return filter, nil
+	}
+
+	// Now figure out how to compare the value based on the attribute's type
+	daType := m.GetPropType(filter.Abstract, MustPropPathFromDB(filter.PropName))
+	ordered := (op != "=" && op != "!=")
+
+	_, numErr := strconv.ParseFloat(value, 64)
+	_, tsErr := time.Parse(time.RFC3339, value)
+
+	switch daType {
+	case INTEGER, UINTEGER, DECIMAL:
+		if numErr == nil {
+			filter.Type = DECIMAL
+		} else if ordered {
+			return nil, fmt.Errorf("Filter %q must use a numeric value", expr)
+		}
+	case TIMESTAMP:
+		if tsErr == nil {
+			filter.Type = TIMESTAMP
+		} else if ordered {
+			return nil, fmt.Errorf("Filter %q must use a timestamp value",
+				expr)
+		}
+	case BOOLEAN:
+		if ordered {
+			return nil, fmt.Errorf("Filter %q can't use %q on a boolean",
+				expr, op)
+		}
+	case "", ANY:
+		// Not defined in the model so guess based on the value
+		if numErr == nil {
+			filter.Type = DECIMAL
+		} else if tsErr == nil && ordered {
+			filter.Type = TIMESTAMP
+		}
+	default:
+		if !IsScalar(daType) {
+			return nil, fmt.Errorf("Filter %q can't compare a value of "+
+				"type %q", expr, daType)
+		}
+	}
+
+	if filter.Type == "" {
+		filter.Type = STRING
+		filter.Wildcard = !ordered && strings.Contains(value, "*")
+	}
+
+	return filter, nil
+}
+
 func (info *RequestInfo) ParseRequestURL() error {
 	path := strings.Trim(info.OriginalPath, " /")
 	info.Parts = strings.Split(path, "/")
@@ -291,6 +484,16 @@ func (info *RequestInfo) ParseRequestURL() error {
 		return nil
 	}
 
+	// /subscriptions[/ID]
+	if info.Parts[0] == "subscriptions" {
+		return nil
+	}
+
+	// /import
+	if info.Parts[0] == "import" {
+		return nil
+	}
+
 	// /GROUPs
 	if strings.HasSuffix(info.Parts[0], "$meta") {
 		info.StatusCode = http.StatusBadRequest
@@ -36,6 +36,8 @@ CREATE TABLE Registries (
     SID     VARCHAR(255) NOT NULL,  # System ID
     UID     VARCHAR(255) NOT NULL,  # User defined
     Attributes  JSON,               # Until we use the Attributes table
+    ReadOnly    BOOL NOT NULL DEFAULT 0,   # Reject all writes via HTTP
+    Mirror      VARCHAR(255),       # Upstream xRegistry URL, if a mirror
 
     PRIMARY KEY (SID),
     UNIQUE INDEX (UID)
@@ -47,8 +49,17 @@ BEGIN
     DELETE FROM Props    WHERE EntitySID=OLD.SID @
     DELETE FROM "Groups" WHERE RegistrySID=OLD.SID @
     DELETE FROM Models   WHERE RegistrySID=OLD.SID @
+    DELETE FROM Subscriptions WHERE RegistrySID=OLD.SID @
 END ;
 
+CREATE TABLE Subscriptions (
+    RegistrySID VARCHAR(64) NOT NULL,
+    UID         VARCHAR(255) NOT NULL,  # User defined
+    Attributes  JSON,               # sink, path, filters, types
+
+    PRIMARY KEY (RegistrySID, UID)
+);
+
 CREATE TABLE Models (
     RegistrySID VARCHAR(64) NOT NULL,
 
@@ -85,6 +96,7 @@ CREATE TABLE ModelEntities (        # Group or Resource (no parent=Group)
     HasDocument       BOOL,     # For Resources
     ReadOnly          BOOL,     # For Resources
     TypeMap           JSON,
+    Compatibility     VARCHAR(64),  # For Resources
 
     PRIMARY KEY(SID),
     UNIQUE INDEX (RegistrySID, ParentSID, Plural),
@@ -159,6 +171,7 @@ CREATE TABLE "Groups" (
     ModelSID        VARCHAR(64) NOT NULL,
     Path            VARCHAR(255) NOT NULL COLLATE utf8mb4_bin,
     Abstract        VARCHAR(255) NOT NULL COLLATE utf8mb4_bin,
+    Locked          BOOL NOT NULL DEFAULT 0,  # No changes to its Resources
 
     PRIMARY KEY (SID),
     INDEX(RegistrySID, UID),
@@ -228,11 +241,29 @@ CREATE TABLE Props (
 
 CREATE TABLE ResourceContents (
     VersionSID      VARCHAR(255),
+    Digest          VARCHAR(64) NOT NULL,   # SHA-256 of the content (hex)
+
+    PRIMARY KEY (VersionSID),
+    INDEX (Digest)
+);
+
+# Documents are stored once, keyed by their digest, no matter how many
+# Versions use them
+CREATE TABLE ContentBlobs (
+    Digest          VARCHAR(64) NOT NULL,
     Content         MEDIUMBLOB,
 
-    PRIMARY KEY (VersionSID)
+    PRIMARY KEY (Digest)
 );
 
+# Garbage collect the blob once nothing references it anymore
+CREATE TRIGGER ResourceContentsTrigger AFTER DELETE ON ResourceContents
+FOR EACH ROW
+BEGIN
+    DELETE FROM ContentBlobs WHERE Digest=OLD.Digest AND
+        NOT EXISTS (SELECT 1 FROM ResourceContents WHERE Digest=OLD.Digest) @
+END ;
+
 CREATE VIEW DefaultProps AS
 SELECT
     p.RegistrySID,
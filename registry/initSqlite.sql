@@ -0,0 +1,349 @@
+-- SQLite version of init.sql. Keep the two in sync.
+--
+-- Differences from the MySQL version:
+-- - UIDs, names and prop values use "COLLATE NOCASE" to mimic the default
+--   (case-insensitive) collation that MySQL uses. Paths are case-sensitive.
+-- - Versions.Counter is the (auto-incrementing) primary key since SQLite
+--   only supports auto-increment on primary keys. SID is just unique.
+-- - Indexes are created via "CREATE INDEX" rather than inline.
+-- - Triggers can use ";" directly since the whole file is run in one shot.
+--
+-- See init.sql for the general notes about the tables.
+
+CREATE TABLE Registries (
+    SID     VARCHAR(255) NOT NULL,  -- System ID
+    UID     VARCHAR(255) NOT NULL COLLATE NOCASE,  -- User defined
+    Attributes  JSON,               -- Until we use the Attributes table
+    ReadOnly    INT NOT NULL DEFAULT 0,   -- Reject all writes via HTTP
+    Mirror      VARCHAR(255),       -- Upstream xRegistry URL, if a mirror
+
+    PRIMARY KEY (SID),
+    UNIQUE (UID)
+);
+
+CREATE TRIGGER RegistryTrigger BEFORE DELETE ON Registries
+FOR EACH ROW
+BEGIN
+    DELETE FROM Props    WHERE EntitySID=OLD.SID ;
+    DELETE FROM "Groups" WHERE RegistrySID=OLD.SID ;
+    DELETE FROM Models   WHERE RegistrySID=OLD.SID ;
+    DELETE FROM Subscriptions WHERE RegistrySID=OLD.SID ;
+END ;
+
+CREATE TABLE Subscriptions (
+    RegistrySID VARCHAR(64) NOT NULL,
+    UID         VARCHAR(255) NOT NULL COLLATE NOCASE,  -- User defined
+    Attributes  JSON,               -- sink, path, filters, types
+
+    PRIMARY KEY (RegistrySID, UID)
+);
+
+CREATE TABLE Models (
+    RegistrySID VARCHAR(64) NOT NULL,
+
+    PRIMARY KEY (RegistrySID)
+);
+
+CREATE TRIGGER ModelsTrigger BEFORE DELETE ON Models
+FOR EACH ROW
+BEGIN
+    DELETE FROM ModelEntities WHERE RegistrySID=OLD.RegistrySID ;
+    DELETE FROM "Schemas"     WHERE RegistrySID=OLD.RegistrySID ;
+END ;
+
+CREATE TABLE "Schemas" (
+    RegistrySID  VARCHAR(64) NOT NULL,
+    "Schema"     VARCHAR(255) NOT NULL COLLATE NOCASE,
+
+    PRIMARY KEY(RegistrySID, "Schema")
+);
+
+CREATE TABLE ModelEntities (        -- Group or Resource (no parent=Group)
+    SID               VARCHAR(64),        -- my System ID
+    RegistrySID       VARCHAR(64),
+    ParentSID         VARCHAR(64),        -- ID of parent ModelEntity
+
+    Singular          VARCHAR(64) COLLATE NOCASE,
+    Plural            VARCHAR(64) COLLATE NOCASE,
+    Attributes        JSON,               -- Until we use the Attributes table
+
+    MaxVersions       INT,      -- For Resources
+    SetVersionId      INT,      -- For Resources
+    SetStickyDefault  INT,      -- For Resources
+    HasDocument       INT,      -- For Resources
+    ReadOnly          INT,      -- For Resources
+    TypeMap           JSON,
+    Compatibility     VARCHAR(64),  -- For Resources
+
+    PRIMARY KEY(SID),
+    UNIQUE (RegistrySID, ParentSID, Plural),
+    CONSTRAINT UC_Singular UNIQUE (RegistrySID, ParentSID, Singular)
+);
+
+CREATE TRIGGER ModelTrigger BEFORE DELETE ON ModelEntities
+FOR EACH ROW
+BEGIN
+    DELETE FROM "Groups"        WHERE ModelSID=OLD.SID ;
+    DELETE FROM Resources       WHERE ModelSID=OLD.SID ;
+    DELETE FROM ModelAttributes WHERE ParentSID=OLD.SID ;
+END ;
+
+-- Not used yet
+CREATE TABLE ModelAttributes (
+    SID           VARCHAR(64) NOT NULL,   -- my System ID
+    RegistrySID   VARCHAR(64) NOT NULL,
+    ParentSID     VARCHAR(64),            -- NULL=Root. Model or IfValue SID
+    Name          VARCHAR(64) NOT NULL COLLATE NOCASE,
+    Type          VARCHAR(64) NOT NULL,
+    Description   VARCHAR(255),
+    Strict        INT NOT NULL,
+    Required      INT NOT NULL,
+    ItemType      VARCHAR(64),
+
+    PRIMARY KEY(RegistrySID, ParentSID, SID),
+    UNIQUE (SID),
+    CONSTRAINT UC_Name UNIQUE (RegistrySID, ParentSID, Name)
+);
+
+CREATE TRIGGER ModelAttributeTrigger BEFORE DELETE ON ModelAttributes
+FOR EACH ROW
+BEGIN
+    DELETE FROM ModelEnums    WHERE AttributeSID=OLD.SID ;
+    DELETE FROM ModelIfValues WHERE AttributeSID=OLD.SID ;
+END ;
+
+CREATE TABLE ModelEnums (
+    RegistrySID   VARCHAR(64) NOT NULL,
+    AttributeSID  VARCHAR(64) NOT NULL,
+    Value         VARCHAR(255) NOT NULL COLLATE NOCASE,
+
+    PRIMARY KEY(RegistrySID, AttributeSID),
+    CONSTRAINT UC_Value UNIQUE (RegistrySID, AttributeSID, Value)
+);
+
+CREATE INDEX ModelEnumsAttr ON ModelEnums (AttributeSID);
+
+CREATE TABLE ModelIfValues (
+    SID           VARCHAR(64) NOT NULL,
+    RegistrySID   VARCHAR(64) NOT NULL,
+    AttributeSID  VARCHAR(64) NOT NULL,
+    Value         VARCHAR(255) NOT NULL COLLATE NOCASE,
+
+    PRIMARY KEY(RegistrySID, AttributeSID),
+    UNIQUE (SID),
+    CONSTRAINT UC_Value UNIQUE (RegistrySID, AttributeSID, Value)
+);
+
+CREATE INDEX ModelIfValuesAttr ON ModelIfValues (AttributeSID);
+
+CREATE TRIGGER ModelIfValuesTrigger BEFORE DELETE ON ModelIfValues
+FOR EACH ROW
+BEGIN
+    DELETE FROM ModelAttributes    WHERE ParentSID=OLD.SID ;
+END ;
+
+
+CREATE TABLE "Groups" (
+    SID             VARCHAR(64) NOT NULL,   -- System ID
+    UID             VARCHAR(64) NOT NULL COLLATE NOCASE,   -- User defined
+    RegistrySID     VARCHAR(64) NOT NULL,
+    ModelSID        VARCHAR(64) NOT NULL,
+    Path            VARCHAR(255) NOT NULL,
+    Abstract        VARCHAR(255) NOT NULL,
+    Locked          INT NOT NULL DEFAULT 0,  -- No changes to its Resources
+
+    PRIMARY KEY (SID),
+    UNIQUE (RegistrySID, ModelSID, UID)
+);
+
+CREATE INDEX GroupsUID ON "Groups" (RegistrySID, UID);
+
+CREATE TRIGGER GroupTrigger BEFORE DELETE ON "Groups"
+FOR EACH ROW
+BEGIN
+    DELETE FROM Props WHERE EntitySID=OLD.SID ;
+    DELETE FROM Resources WHERE GroupSID=OLD.SID ;
+END ;
+
+CREATE TABLE Resources (
+    SID             VARCHAR(64) NOT NULL,   -- System ID
+    UID             VARCHAR(64) NOT NULL COLLATE NOCASE,   -- User defined
+    GroupSID        VARCHAR(64) NOT NULL,   -- System ID
+    ModelSID        VARCHAR(64) NOT NULL,
+    Path            VARCHAR(255) NOT NULL,
+    Abstract        VARCHAR(255) NOT NULL,
+
+    PRIMARY KEY (SID),
+    UNIQUE (GroupSID, ModelSID, UID)
+);
+
+CREATE INDEX ResourcesUID ON Resources (GroupSID, UID);
+
+CREATE TRIGGER ResourcesTrigger BEFORE DELETE ON Resources
+FOR EACH ROW
+BEGIN
+    DELETE FROM Props WHERE EntitySID=OLD.SID ;
+    DELETE FROM Versions WHERE ResourceSID=OLD.SID ;
+END ;
+
+CREATE TABLE Versions (
+    Counter             INTEGER PRIMARY KEY AUTOINCREMENT,
+    SID                 VARCHAR(64) NOT NULL,   -- System ID
+    UID                 VARCHAR(64) NOT NULL COLLATE NOCASE,   -- User defined
+    ResourceSID         VARCHAR(64) NOT NULL,   -- System ID
+    Path                VARCHAR(255) NOT NULL,
+    Abstract            VARCHAR(255) NOT NULL,
+
+    ResourceURL         VARCHAR(255),
+    ResourceProxyURL    VARCHAR(255),
+    ResourceContentSID  VARCHAR(64),
+
+    UNIQUE (SID),
+    UNIQUE (ResourceSID, UID)
+);
+
+CREATE TRIGGER VersionsTrigger BEFORE DELETE ON Versions
+FOR EACH ROW
+BEGIN
+    DELETE FROM Props WHERE EntitySID=OLD.SID ;
+    DELETE FROM ResourceContents WHERE VersionSID=OLD.SID ;
+END ;
+
+CREATE TABLE Props (
+    RegistrySID VARCHAR(64) NOT NULL,
+    EntitySID   VARCHAR(64) NOT NULL,       -- Reg,Group,Res,Ver System ID
+    PropName    VARCHAR(64) NOT NULL COLLATE NOCASE,
+    PropValue   VARCHAR(255) COLLATE NOCASE,
+    PropType    CHAR(64) NOT NULL,          -- string, boolean, int, ...
+
+    PRIMARY KEY (EntitySID, PropName)
+);
+
+CREATE TABLE ResourceContents (
+    VersionSID      VARCHAR(255),
+    Digest          VARCHAR(64) NOT NULL,   -- SHA-256 of the content (hex)
+
+    PRIMARY KEY (VersionSID)
+);
+
+CREATE INDEX ResourceContentsDigest ON ResourceContents (Digest);
+
+-- Documents are stored once, keyed by their digest, no matter how many
+-- Versions use them
+CREATE TABLE ContentBlobs (
+    Digest          VARCHAR(64) NOT NULL,
+    Content         BLOB,
+
+    PRIMARY KEY (Digest)
+);
+
+-- Garbage collect the blob once nothing references it anymore
+CREATE TRIGGER ResourceContentsTrigger AFTER DELETE ON ResourceContents
+FOR EACH ROW
+BEGIN
+    DELETE FROM ContentBlobs WHERE Digest=OLD.Digest AND
+        NOT EXISTS (SELECT 1 FROM ResourceContents WHERE Digest=OLD.Digest) ;
+END ;
+
+CREATE VIEW DefaultProps AS
+SELECT
+    p.RegistrySID,
+    r.SID AS EntitySID,
+    p.PropName,
+    p.PropValue,
+    p.PropType
+FROM Props AS p
+JOIN Versions AS v ON (p.EntitySID=v.SID)
+JOIN Resources AS r ON (r.SID=v.ResourceSID)
+JOIN Props AS p1 ON (p1.EntitySID=r.SID)
+WHERE p1.PropName='defaultVersionId,' AND v.UID=p1.PropValue AND
+      p.PropName<>'id,' ;     -- Don't overwrite this
+-- NOTE!!! if DB_IN changes then the above 2 lines MUST change
+
+CREATE VIEW Entities AS
+SELECT                          -- Gather Registries
+    r.SID AS RegSID,
+    0 AS Level,
+    'registries' AS Plural,
+    NULL AS ParentSID,
+    r.SID AS eSID,
+    r.UID AS UID,
+    '' AS Abstract,
+    '' AS Path
+FROM Registries AS r
+
+UNION SELECT                    -- Gather Groups
+    g.RegistrySID AS RegSID,
+    1 AS Level,
+    m.Plural AS Plural,
+    g.RegistrySID AS ParentSID,
+    g.SID AS eSID,
+    g.UID AS UID,
+    g.Abstract,
+    g.Path
+FROM "Groups" AS g
+JOIN ModelEntities AS m ON (m.SID=g.ModelSID)
+
+UNION SELECT                    -- Add Resources
+    m.RegistrySID AS RegSID,
+    2 AS Level,
+    m.Plural AS Plural,
+    r.GroupSID AS ParentSID,
+    r.SID AS eSID,
+    r.UID AS UID,
+    r.Abstract,
+    r.Path
+FROM Resources AS r
+JOIN ModelEntities AS m ON (m.SID=r.ModelSID)
+
+UNION SELECT                    -- Add Versions
+    rm.RegistrySID AS RegSID,
+    3 AS Level,
+    'versions' AS Plural,
+    r.SID AS ParentSID,
+    v.SID AS eSID,
+    v.UID AS UID,
+    v.Abstract,
+    v.Path
+FROM Versions AS v
+JOIN Resources AS r ON (r.SID=v.ResourceSID)
+JOIN ModelEntities AS rm ON (rm.SID=r.ModelSID) ;
+
+CREATE VIEW AllProps AS
+SELECT * FROM Props
+UNION SELECT * FROM DefaultProps
+UNION SELECT                    -- Add in "isdefault", which is calculated
+  v.RegSID,
+  v.eSID,
+  'isdefault,',
+  'true',
+  'boolean'
+FROM Entities AS v
+JOIN Props AS p ON (
+  p.EntitySID=v.ParentSID AND
+  p.PropName='defaultversionid,'
+  AND p.PropValue=v.UID );
+
+
+CREATE VIEW FullTree AS
+SELECT
+    RegSID,
+    Level,
+    Plural,
+    ParentSID,
+    eSID,
+    UID,
+    Path,
+    PropName,
+    PropValue,
+    PropType,
+    Abstract
+FROM Entities
+LEFT JOIN AllProps ON (AllProps.EntitySID=Entities.eSID)
+ORDER by Path, PropName;
+
+CREATE VIEW Leaves AS
+SELECT eSID FROM Entities
+WHERE eSID NOT IN (
+    SELECT DISTINCT ParentSID FROM Entities WHERE ParentSID IS NOT NULL
+);
@@ -21,6 +21,7 @@ type JsonWriter struct {
 	results *Result // results of DB query
 	Entity  *Entity // Current row in the DB results
 	hasData bool
+	limit   int // max # of entities in the next WriteCollection, 0=no max
 }
 
 func NewJsonWriter(info *RequestInfo, results *Result) *JsonWriter {
@@ -113,6 +114,10 @@ func (jw *JsonWriter) WriteCollection() (int, error) {
 	myPlural := ""
 	count := 0
 
+	// Only applies to the top-level collection, not nested ones
+	limit := jw.limit
+	jw.limit = 0
+
 	for jw.Entity != nil {
 		if myLevel == 0 {
 			myLevel = jw.Entity.Level
@@ -131,6 +136,11 @@ func (jw *JsonWriter) WriteCollection() (int, error) {
 			break
 		}
 
+		if limit > 0 && count == limit {
+			// The rest are on the next page
+			break
+		}
+
 		jw.Printf("%s\n%s%q: ", extra, jw.indent, jw.Entity.UID)
 		if err := jw.WriteEntity(); err != nil {
 			return count, err
@@ -0,0 +1,549 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// A single RFC 6902 JSON Patch operation
+type JSONPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Escape a key for use in a JSON Pointer (RFC 6901)
+func JSONPointerEscape(key string) string {
+	key = strings.ReplaceAll(key, "~", "~0")
+	return strings.ReplaceAll(key, "/", "~1")
+}
+
+func JSONPointerUnescape(key string) string {
+	key = strings.ReplaceAll(key, "~1", "/")
+	return strings.ReplaceAll(key, "~0", "~")
+}
+
+func patchValue(val any) json.RawMessage {
+	buf, _ := json.Marshal(val)
+	return buf
+}
+
+// Returns the list of JSON Patch operations needed to turn "from" into "to".
+// Both are expected to be generic JSON values (e.g. from json.Unmarshal).
+// Maps are diffed key by key, arrays index by index.
+func JSONPatchDiff(from, to any) []JSONPatchOp {
+	ops := []JSONPatchOp{}
+	jsonPatchDiff("", from, to, &ops)
+	return ops
+}
+
+func jsonPatchDiff(path string, from, to any, ops *[]JSONPatchOp) {
+	switch fromVal := from.(type) {
+	case map[string]any:
+		toVal, ok := to.(map[string]any)
+		if !ok {
+			break
+		}
+		for _, key := range SortedKeys(fromVal) {
+			if _, ok := toVal[key]; !ok {
+				*ops = append(*ops, JSONPatchOp{
+					Op:   "remove",
+					Path: path + "/" + JSONPointerEscape(key),
+				})
+			}
+		}
+		for _, key := range SortedKeys(toVal) {
+			kPath := path + "/" + JSONPointerEscape(key)
+			if fVal, ok := fromVal[key]; ok {
+				jsonPatchDiff(kPath, fVal, toVal[key], ops)
+			} else {
+				*ops = append(*ops, JSONPatchOp{
+					Op:    "add",
+					Path:  kPath,
+					Value: patchValue(toVal[key]),
+				})
+			}
+		}
+		return
+
+	case []any:
+		toVal, ok := to.([]any)
+		if !ok {
+			break
+		}
+		i := 0
+		for ; i < len(fromVal) && i < len(toVal); i++ {
+			jsonPatchDiff(path+"/"+strconv.Itoa(i), fromVal[i], toVal[i], ops)
+		}
+		// Remove from the end so the indexes stay valid
+		for j := len(fromVal) - 1; j >= i; j-- {
+			*ops = append(*ops, JSONPatchOp{
+				Op:   "remove",
+				Path: path + "/" + strconv.Itoa(j),
+			})
+		}
+		for ; i < len(toVal); i++ {
+			*ops = append(*ops, JSONPatchOp{
+				Op:    "add",
+				Path:  path + "/" + strconv.Itoa(i),
+				Value: patchValue(toVal[i]),
+			})
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*ops = append(*ops, JSONPatchOp{
+			Op:    "replace",
+			Path:  path,
+			Value: patchValue(to),
+		})
+	}
+}
+
+const JSON_PATCH_CT = "application/json-patch+json"
+const MERGE_PATCH_CT = "application/merge-patch+json"
+
+// Returned when a patch can't be applied. Test is true if it was due to a
+// failed "test" operation.
+type PatchError struct {
+	Test bool
+	Msg  string
+}
+
+func (pe *PatchError) Error() string {
+	return pe.Msg
+}
+
+func patchErr(test bool, format string, args ...any) error {
+	return &PatchError{Test: test, Msg: fmt.Sprintf(format, args...)}
+}
+
+func parsePointer(ptr string) ([]string, error) {
+	if ptr == "" {
+		return []string{}, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("Invalid JSON Pointer %q, must start with \"/\"",
+			ptr)
+	}
+	tokens := strings.Split(ptr[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = JSONPointerUnescape(token)
+	}
+	return tokens, nil
+}
+
+// Returns the array index for "token". "-" (the end) is only allowed when
+// adding.
+func patchIndex(token string, list []any, adding bool) (int, error) {
+	if token == "-" && adding {
+		return len(list), nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if i > len(list) || (i == len(list) && !adding) {
+		return 0, fmt.Errorf("array index %d is out of bounds", i)
+	}
+	return i, nil
+}
+
+func pointerGet(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch node := doc.(type) {
+		case map[string]any:
+			val, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%q doesn't exist", token)
+			}
+			doc = val
+		case []any:
+			i, err := patchIndex(token, node, false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("%q doesn't exist", token)
+		}
+	}
+	return doc, nil
+}
+
+// Add (or replace) "val" at "tokens". Returns the updated "doc".
+func pointerSet(doc any, tokens []string, val any, replace bool) (any, error) {
+	if len(tokens) == 0 {
+		return val, nil
+	}
+	token := tokens[0]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		if len(tokens) == 1 {
+			if _, ok := node[token]; replace && !ok {
+				return nil, fmt.Errorf("%q doesn't exist", token)
+			}
+			node[token] = val
+			return node, nil
+		}
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%q doesn't exist", token)
+		}
+		child, err := pointerSet(child, tokens[1:], val, replace)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+
+	case []any:
+		i, err := patchIndex(token, node, len(tokens) == 1 && !replace)
+		if err != nil {
+			return nil, err
+		}
+		if len(tokens) == 1 {
+			if replace {
+				node[i] = val
+				return node, nil
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = val
+			return node, nil
+		}
+		child, err := pointerSet(node[i], tokens[1:], val, replace)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("%q doesn't exist", token)
+}
+
+// Remove what's at "tokens". Returns the updated "doc".
+func pointerRemove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	token := tokens[0]
+
+	switch node := doc.(type) {
+	case map[string]any:
+		child, ok := node[token]
+		if !ok {
+			return nil, fmt.Errorf("%q doesn't exist", token)
+		}
+		if len(tokens) == 1 {
+			delete(node, token)
+			return node, nil
+		}
+		child, err := pointerRemove(child, tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+
+	case []any:
+		i, err := patchIndex(token, node, false)
+		if err != nil {
+			return nil, err
+		}
+		if len(tokens) == 1 {
+			return append(node[:i], node[i+1:]...), nil
+		}
+		child, err := pointerRemove(node[i], tokens[1:])
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("%q doesn't exist", token)
+}
+
+// Make a deep copy of a generic JSON value
+func jsonCopy(val any) any {
+	var result any
+	buf, _ := json.Marshal(val)
+	json.Unmarshal(buf, &result)
+	return result
+}
+
+// Parse an RFC 6902 JSON Patch document
+func ParseJSONPatch(buf []byte) ([]JSONPatchOp, error) {
+	ops := []JSONPatchOp{}
+	if err := json.Unmarshal(buf, &ops); err != nil {
+		return nil, fmt.Errorf("Invalid JSON Patch: %s", err)
+	}
+	for i, op := range ops {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("Invalid JSON Patch: operation %d "+
+					"(%s) is missing \"value\"", i, op.Op)
+			}
+		case "move", "copy":
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("Invalid JSON Patch: operation %d "+
+					"(%s): %s", i, op.Op, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("Invalid JSON Patch: operation %d has an "+
+				"invalid \"op\" value (%s)", i, op.Op)
+		}
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("Invalid JSON Patch: operation %d (%s): %s",
+				i, op.Op, err)
+		}
+	}
+	return ops, nil
+}
+
+// Apply the "ops" to "doc" (a generic JSON value), returning the new
+// document. Any failure returns a *PatchError.
+func ApplyJSONPatch(doc any, ops []JSONPatchOp) (any, error) {
+	doc = jsonCopy(doc)
+
+	for i, op := range ops {
+		tokens, _ := parsePointer(op.Path)
+
+		var val any
+		if op.Value != nil {
+			if err := json.Unmarshal(op.Value, &val); err != nil {
+				return nil, patchErr(false, "Error in operation %d (%s): %s",
+					i, op.Op, err)
+			}
+		}
+
+		var err error
+		switch op.Op {
+		case "add":
+			doc, err = pointerSet(doc, tokens, val, false)
+		case "replace":
+			if _, err = pointerGet(doc, tokens); err == nil {
+				doc, err = pointerSet(doc, tokens, val, true)
+			}
+		case "remove":
+			doc, err = pointerRemove(doc, tokens)
+		case "move", "copy":
+			from, _ := parsePointer(op.From)
+			if op.Op == "move" && strings.HasPrefix(op.Path+"/", op.From+"/") &&
+				op.Path != op.From {
+				err = fmt.Errorf("can't move %q into itself", op.From)
+				break
+			}
+			if val, err = pointerGet(doc, from); err != nil {
+				break
+			}
+			val = jsonCopy(val)
+			if op.Op == "move" {
+				if doc, err = pointerRemove(doc, from); err != nil {
+					break
+				}
+			}
+			doc, err = pointerSet(doc, tokens, val, false)
+		case "test":
+			var current any
+			if current, err = pointerGet(doc, tokens); err == nil &&
+				!reflect.DeepEqual(current, val) {
+				return nil, patchErr(true, "Test operation %d failed: "+
+					"value at %q isn't %s", i, op.Path, string(op.Value))
+			}
+			if err != nil {
+				return nil, patchErr(true, "Test operation %d failed: %s",
+					i, err)
+			}
+		}
+		if err != nil {
+			return nil, patchErr(false, "Error in operation %d (%s %q): %s",
+				i, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+// Apply an RFC 7396 JSON Merge Patch to "target", returning the result
+func ApplyMergePatch(target, patch any) any {
+	patchMap, ok := patch.(map[string]any)
+	if !ok {
+		return jsonCopy(patch)
+	}
+
+	result, ok := jsonCopy(target).(map[string]any)
+	if !ok {
+		result = map[string]any{}
+	}
+	for _, key := range SortedKeys(patchMap) {
+		if patchMap[key] == nil {
+			delete(result, key)
+		} else {
+			result[key] = ApplyMergePatch(result[key], patchMap[key])
+		}
+	}
+	return result
+}
+
+// Apply "patch" (of type JSON_PATCH_CT or MERGE_PATCH_CT) to "doc"
+func ApplyPatch(patchType string, doc any, patch []byte) (any, error) {
+	if patchType == JSON_PATCH_CT {
+		ops, err := ParseJSONPatch(patch)
+		if err != nil {
+			return nil, err
+		}
+		return ApplyJSONPatch(doc, ops)
+	}
+
+	var patchVal any
+	if err := Unmarshal(patch, &patchVal); err != nil {
+		return nil, fmt.Errorf("Invalid JSON Merge Patch: %s", err)
+	}
+	return ApplyMergePatch(doc, patchVal), nil
+}
+
+// Returns JSON_PATCH_CT or MERGE_PATCH_CT if that's the request's
+// Content-Type, "" otherwise
+func PatchContentType(info *RequestInfo) string {
+	ct := info.OriginalRequest.Header.Get("Content-Type")
+	ct, _, _ = strings.Cut(ct, ";")
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	if ct == JSON_PATCH_CT || ct == MERGE_PATCH_CT {
+		return ct
+	}
+	return ""
+}
+
+// Find the entity being PATCHed. For a Resource it's the default Version
+// (plus the Resource's own attributes). Returns nil if it doesn't exist.
+func patchTarget(info *RequestInfo) (*Entity, *Version, error) {
+	reg := info.Registry
+	if len(info.Parts) == 0 {
+		return &reg.Entity, nil, nil
+	}
+
+	group, err := reg.FindGroup(info.GroupType, info.GroupUID, false)
+	if err != nil || group == nil {
+		return nil, nil, err
+	}
+	if len(info.Parts) == 2 {
+		return &group.Entity, nil, nil
+	}
+
+	resource, err := group.FindResource(info.ResourceType, info.ResourceUID,
+		false)
+	if err != nil || resource == nil {
+		return nil, nil, err
+	}
+
+	var version *Version
+	if info.VersionUID == "" {
+		version, err = resource.GetDefault()
+	} else {
+		version, err = resource.FindVersion(info.VersionUID, false)
+	}
+	if err != nil || version == nil {
+		return nil, nil, err
+	}
+	if info.VersionUID == "" {
+		return &resource.Entity, version, nil
+	}
+	return &version.Entity, version, nil
+}
+
+// Convert a JSON Patch or JSON Merge Patch request body into a regular
+// PATCH body. When "metaInBody" the patch is applied to the entity's
+// attributes and the result is just the top-level attributes that changed.
+// Otherwise it's applied to the Resource's document and the result is the
+// new document.
+func PatchRequestBody(info *RequestInfo, patchType string, body []byte,
+	metaInBody bool) ([]byte, error) {
+
+	entity, version, err := patchTarget(info)
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return nil, err
+	}
+
+	var current any
+	if metaInBody {
+		attrs := map[string]any{}
+		if entity != nil {
+			if version != nil && entity != &version.Entity {
+				// Resource, so its default Version + its own attributes
+				maps.Copy(attrs, version.Object)
+			}
+			maps.Copy(attrs, entity.Object)
+		}
+		for key := range attrs {
+			if key[0] == '#' {
+				delete(attrs, key)
+			}
+		}
+		current = jsonCopy(attrs)
+	} else if version != nil {
+		if version.Get("#resourceURL") != nil ||
+			version.Get("#resourceProxyURL") != nil {
+			info.StatusCode = http.StatusBadRequest
+			return nil, fmt.Errorf("Can't patch a Resource document that's " +
+				"stored externally")
+		}
+		if doc, _ := version.Get("#resource").([]byte); len(doc) > 0 {
+			if err = json.Unmarshal(doc, &current); err != nil {
+				info.StatusCode = http.StatusBadRequest
+				return nil, fmt.Errorf("Can't patch a Resource document " +
+					"that isn't JSON")
+			}
+		}
+	}
+
+	patched, err := ApplyPatch(patchType, current, body)
+	if err != nil {
+		info.StatusCode = http.StatusBadRequest
+		if pErr, ok := err.(*PatchError); ok {
+			info.StatusCode = http.StatusConflict
+			if pErr.Test {
+				info.StatusCode = http.StatusPreconditionFailed
+			}
+		}
+		return nil, err
+	}
+
+	if !metaInBody {
+		return json.Marshal(patched)
+	}
+
+	// Only pass along what changed, removed attributes are "null"
+	newAttrs, ok := patched.(map[string]any)
+	if !ok {
+		info.StatusCode = http.StatusBadRequest
+		return nil, fmt.Errorf("The patched entity must be a JSON object")
+	}
+	oldAttrs, _ := current.(map[string]any)
+	delta := map[string]any{}
+	for key, val := range oldAttrs {
+		if _, ok := newAttrs[key]; !ok {
+			delta[key] = nil
+		} else if !reflect.DeepEqual(val, newAttrs[key]) {
+			delta[key] = newAttrs[key]
+		}
+	}
+	for key, val := range newAttrs {
+		if _, ok := oldAttrs[key]; !ok {
+			delta[key] = val
+		}
+	}
+	return json.Marshal(delta)
+}
@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	type Test struct {
+		Doc    string
+		Patch  string
+		Result string
+		Err    string
+	}
+
+	tests := []Test{
+		{`{}`, `[]`, `{}`, ``},
+		{`{"a":1}`, `[{"op":"add","path":"/b","value":[1]}]`,
+			`{"a":1,"b":[1]}`, ``},
+		{`{"a":[1,3]}`, `[{"op":"add","path":"/a/1","value":2},
+		  {"op":"add","path":"/a/-","value":4}]`, `{"a":[1,2,3,4]}`, ``},
+		{`{"a":{"b":1}}`, `[{"op":"replace","path":"/a/b","value":null}]`,
+			`{"a":{"b":null}}`, ``},
+		{`{"a":[1,2,3]}`, `[{"op":"remove","path":"/a/0"}]`, `{"a":[2,3]}`,
+			``},
+		{`{"a":{"x":1},"b":{}}`,
+			`[{"op":"move","from":"/a/x","path":"/b/y"}]`,
+			`{"a":{},"b":{"y":1}}`, ``},
+		{`{"a":{"x":[1]}}`, `[{"op":"copy","from":"/a/x","path":"/b"},
+		  {"op":"add","path":"/b/-","value":2}]`,
+			`{"a":{"x":[1]},"b":[1,2]}`, ``},
+		{`{"a/b":{"c~d":1}}`, `[{"op":"test","path":"/a~1b/c~0d","value":1},
+		  {"op":"remove","path":"/a~1b/c~0d"}]`, `{"a/b":{}}`, ``},
+		{`{"a":1}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`, ``},
+		{`{"a":1}`, `[{"op":"add","path":"/a","value":2,"extra":true}]`,
+			`{"a":2}`, ``},
+
+		{`{}`, `{}`, ``, `Invalid JSON Patch: json: cannot unmarshal ` +
+			`object into Go value of type []registry.JSONPatchOp`},
+		{`{}`, `[{"op":"bad","path":"/a"}]`, ``, `Invalid JSON Patch: ` +
+			`operation 0 has an invalid "op" value (bad)`},
+		{`{}`, `[{"op":"add","path":"/a"}]`, ``, `Invalid JSON Patch: ` +
+			`operation 0 (add) is missing "value"`},
+		{`{}`, `[{"op":"add","path":"a","value":1}]`, ``, `Invalid JSON ` +
+			`Patch: operation 0 (add): Invalid JSON Pointer "a", must start ` +
+			`with "/"`},
+		{`{}`, `[{"op":"remove","path":"/a"}]`, ``,
+			`Error in operation 0 (remove "/a"): "a" doesn't exist`},
+		{`{}`, `[{"op":"replace","path":"/a","value":1}]`, ``,
+			`Error in operation 0 (replace "/a"): "a" doesn't exist`},
+		{`{"a":[1]}`, `[{"op":"add","path":"/a/5","value":1}]`, ``,
+			`Error in operation 0 (add "/a/5"): array index 5 is out of bounds`},
+		{`{"a":[1]}`, `[{"op":"remove","path":"/a/01"}]`, ``,
+			`Error in operation 0 (remove "/a/01"): invalid array index "01"`},
+		{`{"a":{}}`, `[{"op":"move","from":"/a","path":"/a/b"}]`, ``,
+			`Error in operation 0 (move "/a/b"): can't move "/a" into itself`},
+		{`{"a":1}`, `[{"op":"test","path":"/a","value":"1"}]`, ``,
+			`Test operation 0 failed: value at "/a" isn't "1"`},
+		{`{"a":1}`, `[{"op":"test","path":"/b","value":1}]`, ``,
+			`Test operation 0 failed: "b" doesn't exist`},
+	}
+
+	for _, test := range tests {
+		var doc any
+		json.Unmarshal([]byte(test.Doc), &doc)
+		result, err := ApplyPatch(JSON_PATCH_CT, doc, []byte(test.Patch))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.Err {
+			t.Errorf("Doc: %s\nPatch: %s\nExp err: %s\nGot err: %s",
+				test.Doc, test.Patch, test.Err, got)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		buf, _ := json.Marshal(result)
+		if string(buf) != test.Result {
+			t.Errorf("Doc: %s\nPatch: %s\nExp: %s\nGot: %s", test.Doc,
+				test.Patch, test.Result, string(buf))
+		}
+	}
+
+	// The original doc isn't changed
+	doc := map[string]any{"a": 1.0}
+	ApplyPatch(JSON_PATCH_CT, doc, []byte(`[{"op":"remove","path":"/a"}]`))
+	if len(doc) != 1 {
+		t.Errorf("Original doc was changed: %v", doc)
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	// From RFC 7396, Appendix A
+	tests := [][3]string{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		var doc any
+		json.Unmarshal([]byte(test[0]), &doc)
+		result, err := ApplyPatch(MERGE_PATCH_CT, doc, []byte(test[1]))
+		if err != nil {
+			t.Errorf("Doc: %s Patch: %s: %s", test[0], test[1], err)
+			continue
+		}
+		buf, _ := json.Marshal(result)
+		if string(buf) != test[2] {
+			t.Errorf("Doc: %s\nPatch: %s\nExp: %s\nGot: %s", test[0],
+				test[1], test[2], string(buf))
+		}
+	}
+
+	_, err := ApplyPatch(MERGE_PATCH_CT, nil, []byte(`{`))
+	if err == nil || err.Error() != "Invalid JSON Merge Patch: Error "+
+		"parsing json: unexpected EOF" {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
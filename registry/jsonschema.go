@@ -0,0 +1,287 @@
+package registry
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+const JSONSCHEMA = "JSONSchema"
+const JSONSCHEMA_DRAFT = "draft-2020-12"
+const JSONSCHEMA_URI = "https://json-schema.org/draft/2020-12/schema"
+
+func init() {
+	RegisterModelSerializer(JSONSCHEMA+"/"+JSONSCHEMA_DRAFT, Model2JSONSchema)
+}
+
+// The model serializer for the "JSONSchema" schema format. It generates a
+// JSON Schema (draft 2020-12) document with one "$defs" entry per type of
+// entity, describing its serialization:
+//
+//	registry                      - the Registry (also the root "$ref")
+//	GROUPS                        - each Group type
+//	GROUPS-RESOURCES              - each Resource type
+//	GROUPS-RESOURCES-versions     - each Resource type's Versions
+//
+// "-" isn't allowed in a plural name so the keys can't collide, and they're
+// valid OpenAPI component names too.
+func Model2JSONSchema(m *Model, format string) ([]byte, error) {
+	schema := map[string]any{
+		"$schema": JSONSCHEMA_URI,
+		"$ref":    "#/$defs/registry",
+		"$defs":   ModelJSONSchemaDefs(m, "#/$defs/"),
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// The $defs key of the schema for the Resource type, or its Versions
+func JSONSchemaResourceKey(gm *GroupModel, rm *ResourceModel) string {
+	return gm.Plural + "-" + rm.Plural
+}
+
+func JSONSchemaVersionKey(gm *GroupModel, rm *ResourceModel) string {
+	return JSONSchemaResourceKey(gm, rm) + "-versions"
+}
+
+// Returns the schemas of all of the entities defined by the model, keyed as
+// described in Model2JSONSchema. 'refBase' is what's used to point to them
+// (e.g. "#/$defs/").
+func ModelJSONSchemaDefs(m *Model, refBase string) map[string]any {
+	defs := map[string]any{}
+	groupColls := [][2]string{}
+
+	for _, gName := range SortedKeys(m.Groups) {
+		gm := m.Groups[gName]
+		resColls := [][2]string{}
+
+		for _, rName := range SortedKeys(gm.Resources) {
+			rm := gm.Resources[rName]
+			rKey := JSONSchemaResourceKey(gm, rm)
+			vKey := JSONSchemaVersionKey(gm, rm)
+
+			attrs := rm.GetBaseAttributes()
+			defs[vKey] = entityJSONSchema(rm.Singular+" version", attrs, 3,
+				refBase, nil)
+			defs[rKey] = entityJSONSchema(rm.Singular, attrs, 2, refBase,
+				[][2]string{{"versions", vKey}})
+
+			resColls = append(resColls, [2]string{rm.Plural, rKey})
+		}
+
+		defs[gm.Plural] = entityJSONSchema(gm.Singular, gm.GetBaseAttributes(),
+			1, refBase, resColls)
+		groupColls = append(groupColls, [2]string{gm.Plural, gm.Plural})
+	}
+
+	defs["registry"] = entityJSONSchema("registry", m.GetBaseAttributes(), 0,
+		refBase, groupColls)
+
+	return defs
+}
+
+// Returns true if 'attr' appears in the serialization of an entity at
+// 'level'. Resources show their default Version's attributes too, except
+// for the ones that only make sense on a Version (isdefault).
+func attrInJSONSchemaLevel(attr *Attribute, level int) bool {
+	specProp, ok := SpecProps[attr.Name]
+	if !ok {
+		return true // user defined extensions are on all levels
+	}
+	if level == 2 {
+		return specProp.InLevel(2) ||
+			(specProp.InLevel(3) && attr.Name != "isdefault")
+	}
+	return specProp.InLevel(level)
+}
+
+// Returns the attributes that appear in the serialization of an entity at
+// 'level'. The spec defined ones might not have been added to the model yet.
+func LevelAttributes(modelAttrs Attributes, level int) Attributes {
+	attrs := Attributes{}
+	for _, specProp := range OrderedSpecProps {
+		if attrInJSONSchemaLevel(specProp, level) {
+			attrs[specProp.Name] = specProp
+		}
+	}
+	for name, attr := range modelAttrs {
+		if attrInJSONSchemaLevel(attr, level) {
+			attrs[name] = attr
+		}
+	}
+	return attrs
+}
+
+// 'colls' is the list of plural/$defs-key pairs of the entity's collections
+func entityJSONSchema(title string, modelAttrs Attributes, level int,
+	refBase string, colls [][2]string) map[string]any {
+
+	schema := objectJSONSchema(LevelAttributes(modelAttrs, level))
+	schema["title"] = title
+
+	if len(colls) > 0 {
+		props, _ := schema["properties"].(map[string]any)
+		if props == nil {
+			props = map[string]any{}
+			schema["properties"] = props
+		}
+		for _, coll := range colls {
+			props[coll[0]] = map[string]any{
+				"type": "object",
+				"additionalProperties": map[string]any{
+					"$ref": refBase + coll[1],
+				},
+			}
+			props[coll[0]+"count"] = map[string]any{
+				"type":     "integer",
+				"minimum":  0,
+				"readOnly": true,
+			}
+			props[coll[0]+"url"] = map[string]any{
+				"type":     "string",
+				"format":   "uri",
+				"readOnly": true,
+			}
+		}
+	}
+
+	return schema
+}
+
+// The schema for a set of attributes, without any "type" so it can be used
+// for an "ifValues" set of sibling attributes too
+func attrsJSONSchema(attrs Attributes) map[string]any {
+	schema := map[string]any{}
+	props := map[string]any{}
+	required := []string{}
+	allOf := []any{}
+
+	for _, name := range SortedKeys(attrs) {
+		attr := attrs[name]
+		if name == "*" {
+			schema["additionalProperties"] = attrJSONSchema(attr)
+			continue
+		}
+
+		props[name] = attrJSONSchema(attr)
+		if attr.ClientRequired {
+			required = append(required, name)
+		}
+
+		for _, val := range SortedKeys(attr.IfValues) {
+			siblings := attrsJSONSchema(attr.IfValues[val].SiblingAttributes)
+			allOf = append(allOf, map[string]any{
+				"if": map[string]any{
+					"properties": map[string]any{
+						name: map[string]any{"const": ifValueConst(attr, val)},
+					},
+					"required": []string{name},
+				},
+				"then": siblings,
+			})
+		}
+	}
+
+	if len(props) > 0 {
+		schema["properties"] = props
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	if len(allOf) > 0 {
+		schema["allOf"] = allOf
+	}
+	return schema
+}
+
+// Objects only allow the attributes defined for them, which includes the
+// ones pulled in by an "ifValues", unless there's a "*" attribute
+func objectJSONSchema(attrs Attributes) map[string]any {
+	schema := attrsJSONSchema(attrs)
+	schema["type"] = "object"
+	if _, ok := attrs["*"]; !ok {
+		schema["unevaluatedProperties"] = false
+	}
+	return schema
+}
+
+func attrJSONSchema(attr *Attribute) map[string]any {
+	schema := typeJSONSchema(attr.Type, attr.Item, attr.Attributes)
+
+	if attr.Description != "" {
+		schema["description"] = attr.Description
+	}
+	if len(attr.Enum) > 0 {
+		// Non-strict enums are just suggestions
+		if attr.GetStrict() {
+			schema["enum"] = attr.Enum
+		} else {
+			schema["examples"] = attr.Enum
+		}
+	}
+	if attr.ReadOnly {
+		schema["readOnly"] = true
+	}
+	if !IsNil(attr.Default) {
+		schema["default"] = attr.Default
+	}
+	return schema
+}
+
+func itemJSONSchema(item *Item) map[string]any {
+	if item == nil {
+		return map[string]any{}
+	}
+	return typeJSONSchema(item.Type, item.Item, item.Attributes)
+}
+
+func typeJSONSchema(daType string, item *Item, attrs Attributes) map[string]any {
+	switch daType {
+	case BOOLEAN:
+		return map[string]any{"type": "boolean"}
+	case DECIMAL:
+		return map[string]any{"type": "number"}
+	case INTEGER:
+		return map[string]any{"type": "integer"}
+	case UINTEGER:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case STRING:
+		return map[string]any{"type": "string"}
+	case TIMESTAMP:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case URI, URL:
+		return map[string]any{"type": "string", "format": "uri"}
+	case URI_REFERENCE:
+		return map[string]any{"type": "string", "format": "uri-reference"}
+	case URI_TEMPLATE:
+		return map[string]any{"type": "string", "format": "uri-template"}
+	case MAP:
+		return map[string]any{
+			"type":                 "object",
+			"additionalProperties": itemJSONSchema(item),
+		}
+	case ARRAY:
+		return map[string]any{
+			"type":  "array",
+			"items": itemJSONSchema(item),
+		}
+	case OBJECT:
+		return objectJSONSchema(attrs)
+	}
+	return map[string]any{} // ANY
+}
+
+// "ifValues" keys are strings, but are compared to the string form of the
+// attribute's value, so convert them back to the attribute's type
+func ifValueConst(attr *Attribute, val string) any {
+	switch attr.Type {
+	case BOOLEAN:
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	case DECIMAL, INTEGER, UINTEGER:
+		if _, err := strconv.ParseFloat(val, 64); err == nil {
+			return json.Number(val)
+		}
+	}
+	return val
+}
@@ -0,0 +1,155 @@
+package registry
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestModel2JSONSchema(t *testing.T) {
+	m := &Model{
+		Attributes: Attributes{
+			"owner": {Name: "owner", Type: STRING, ClientRequired: true},
+		},
+		Groups: map[string]*GroupModel{
+			"dirs": {
+				Plural:   "dirs",
+				Singular: "dir",
+				Attributes: Attributes{
+					"kind": {
+						Name: "kind",
+						Type: STRING,
+						Enum: []any{"a", "b"},
+						IfValues: IfValues{
+							"a": {SiblingAttributes: Attributes{
+								"alevel": {Name: "alevel", Type: UINTEGER},
+							}},
+						},
+					},
+					"tags": {Name: "tags", Type: ARRAY,
+						Item: &Item{Type: MAP, Item: &Item{Type: URL}}},
+					"size": {Name: "size", Type: INTEGER,
+						Enum: []any{1, 2}, Strict: PtrBool(false), Default: 1},
+					"obj": {Name: "obj", Type: OBJECT, Attributes: Attributes{
+						"x": {Name: "x", Type: TIMESTAMP, ReadOnly: true},
+						"flag": {Name: "flag", Type: BOOLEAN,
+							IfValues: IfValues{"true": {SiblingAttributes: Attributes{
+								"*": {Name: "*", Type: ANY},
+							}}},
+						},
+					}},
+				},
+				Resources: map[string]*ResourceModel{
+					"files": {
+						Plural:   "files",
+						Singular: "file",
+						Attributes: Attributes{
+							"*": {Name: "*", Type: DECIMAL},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := Model2JSONSchema(m, JSONSCHEMA)
+	if err != nil {
+		t.Fatalf("Model2JSONSchema: %s", err)
+	}
+
+	schema := map[string]any{}
+	if err = json.Unmarshal(buf, &schema); err != nil {
+		t.Fatalf("Unmarshal: %s\n%s", err, buf)
+	}
+
+	// Walks down 'schema' and returns the compact JSON found at 'path'
+	get := func(path string) string {
+		var val any = schema
+		for _, key := range strings.Split(path, "/") {
+			obj, ok := val.(map[string]any)
+			if !ok {
+				return ""
+			}
+			val = obj[key]
+		}
+		res, _ := json.Marshal(val)
+		return string(res)
+	}
+
+	for _, test := range []struct {
+		path string
+		exp  string
+	}{
+		{"$schema", `"https://json-schema.org/draft/2020-12/schema"`},
+		{"$ref", `"#/$defs/registry"`},
+
+		// Registry
+		{"$defs/registry/title", `"registry"`},
+		{"$defs/registry/required", `["owner"]`},
+		{"$defs/registry/unevaluatedProperties", `false`},
+		{"$defs/registry/properties/specversion",
+			`{"readOnly":true,"type":"string"}`},
+		{"$defs/registry/properties/dirs",
+			`{"additionalProperties":{"$ref":"#/$defs/dirs"},"type":"object"}`},
+		{"$defs/registry/properties/dirscount",
+			`{"minimum":0,"readOnly":true,"type":"integer"}`},
+		{"$defs/registry/properties/origin", `null`},
+
+		// Group
+		{"$defs/dirs/properties/kind", `{"enum":["a","b"],"type":"string"}`},
+		{"$defs/dirs/allOf", `[{"if":{"properties":{"kind":{"const":"a"}},` +
+			`"required":["kind"]},"then":{"properties":` +
+			`{"alevel":{"minimum":0,"type":"integer"}}}}]`},
+		{"$defs/dirs/properties/size",
+			`{"default":1,"examples":[1,2],"type":"integer"}`},
+		{"$defs/dirs/properties/tags", `{"items":{"additionalProperties":` +
+			`{"format":"uri","type":"string"},"type":"object"},"type":"array"}`},
+		{"$defs/dirs/properties/obj", `{"allOf":[{"if":{"properties":` +
+			`{"flag":{"const":true}},"required":["flag"]},` +
+			`"then":{"additionalProperties":{}}}],"properties":` +
+			`{"flag":{"type":"boolean"},"x":{"format":"date-time",` +
+			`"readOnly":true,"type":"string"}},"type":"object",` +
+			`"unevaluatedProperties":false}`},
+		{"$defs/dirs/properties/files/additionalProperties",
+			`{"$ref":"#/$defs/dirs-files"}`},
+		{"$defs/dirs/properties/specversion", `null`},
+
+		// Resource
+		{"$defs/dirs-files/title", `"file"`},
+		{"$defs/dirs-files/additionalProperties", `{"type":"number"}`},
+		{"$defs/dirs-files/unevaluatedProperties", `null`},
+		{"$defs/dirs-files/properties/defaultversionid",
+			`{"readOnly":true,"type":"string"}`},
+		{"$defs/dirs-files/properties/file", `{}`},
+		{"$defs/dirs-files/properties/fileurl",
+			`{"format":"uri","type":"string"}`},
+		{"$defs/dirs-files/properties/versions/additionalProperties",
+			`{"$ref":"#/$defs/dirs-files-versions"}`},
+		{"$defs/dirs-files/properties/isdefault", `null`},
+
+		// Version
+		{"$defs/dirs-files-versions/title", `"file version"`},
+		{"$defs/dirs-files-versions/properties/isdefault",
+			`{"readOnly":true,"type":"boolean"}`},
+		{"$defs/dirs-files-versions/properties/filebase64", `{"type":"string"}`},
+		{"$defs/dirs-files-versions/properties/defaultversionid", `null`},
+		{"$defs/dirs-files-versions/properties/versions", `null`},
+	} {
+		if got := get(test.path); got != test.exp {
+			t.Errorf("%s:\nGot: %s\nExp: %s", test.path, got, test.exp)
+		}
+	}
+
+	// No document means no RESOURCExxx attributes
+	m.Groups["dirs"].Resources["files"].HasDocument = PtrBool(false)
+	buf, _ = Model2JSONSchema(m, JSONSCHEMA)
+	schema = map[string]any{}
+	json.Unmarshal(buf, &schema)
+	if got := get("$defs/dirs-files/properties/file"); got != `null` {
+		t.Errorf("'file' shouldn't be there: %s", got)
+	}
+
+	if GetModelSerializer("jsonschema") == nil {
+		t.Errorf("Missing the JSONSchema serializer")
+	}
+}
@@ -0,0 +1,376 @@
+package registry
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+
+	log "github.com/duglin/dlog"
+)
+
+// A MigrationStep is a change made to the existing entities, in the same
+// transaction, when a new model is applied so that they're still valid under
+// it. "entities" says which ones:
+//
+//	""                - the Registry
+//	GROUPS            - all Groups of that type
+//	GROUPS/RESOURCES  - all Versions of that Resource type
+//
+// and "op" is one of:
+//
+//	coerce  - convert "attribute" to "type" (a scalar type)
+//	move    - rename "attribute" to "to"
+//	default - set "attribute" to "value" if it's not already set
+//
+// Entities w/o the attribute are left alone, except for "default".
+type MigrationStep struct {
+	Op        string `json:"op"`
+	Entities  string `json:"entities,omitempty"`
+	Attribute string `json:"attribute"`
+	To        string `json:"to,omitempty"`
+	Type      string `json:"type,omitempty"`
+	Value     any    `json:"value,omitempty"`
+
+	abstract string    // "entities" in DB form (e.g. "dirs,files,versions")
+	pp       *PropPath // "attribute"
+	toPP     *PropPath // "to"
+}
+
+// What happened, or would happen, to the existing entities when a new model
+// is applied
+type ModelReport struct {
+	DryRun   bool             `json:"dryrun"`
+	Checked  int              `json:"checked"`            // # of entities
+	Migrated []string         `json:"migrated,omitempty"` // changed by steps
+	Invalid  []*InvalidEntity `json:"invalid,omitempty"`
+	Deleted  []string         `json:"deleted,omitempty"` // type was removed
+}
+
+type InvalidEntity struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// Checks the step against the (new) model, and sets up its internal fields
+func (step *MigrationStep) Verify(m *Model) error {
+	where := fmt.Sprintf("Migration step %q", step.Op)
+
+	parts := []string{}
+	if step.Entities != "" {
+		parts = strings.Split(strings.Trim(step.Entities, "/"), "/")
+	}
+	switch len(parts) {
+	case 0:
+		step.abstract = ""
+	case 1, 2:
+		gm := m.Groups[parts[0]]
+		if gm == nil {
+			return fmt.Errorf("%s: unknown Group type %q", where, parts[0])
+		}
+		step.abstract = gm.Plural
+		if len(parts) == 2 {
+			rm := gm.Resources[parts[1]]
+			if rm == nil {
+				return fmt.Errorf("%s: unknown Resource type %q", where,
+					step.Entities)
+			}
+			step.abstract = NewPPP(gm.Plural).P(rm.Plural).P("versions").
+				Abstract()
+		}
+	default:
+		return fmt.Errorf("%s: invalid \"entities\" value %q, must be "+
+			"\"\", GROUPS or GROUPS/RESOURCES", where, step.Entities)
+	}
+
+	var err error
+	if step.pp, err = migrationPropPath(where, step.Attribute); err != nil {
+		return err
+	}
+
+	switch step.Op {
+	case "coerce":
+		if !IsScalar(step.Type) {
+			return fmt.Errorf("%s: \"type\" must be a scalar type, not %q",
+				where, step.Type)
+		}
+	case "move":
+		if step.toPP, err = migrationPropPath(where, step.To); err != nil {
+			return err
+		}
+	case "default":
+		if IsNil(step.Value) {
+			return fmt.Errorf("%s: \"value\" must be set", where)
+		}
+	default:
+		return fmt.Errorf("Invalid migration step op %q, must be one of: "+
+			"coerce, move, default", step.Op)
+	}
+
+	return nil
+}
+
+// The server manages some of the spec defined attributes (e.g. epoch), so
+// those can't be migrated
+func migrationPropPath(where string, attr string) (*PropPath, error) {
+	if attr == "" {
+		return nil, fmt.Errorf("%s: an attribute name is required", where)
+	}
+	pp, err := PropPathFromUI(attr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", where, err)
+	}
+	if specProp, ok := SpecProps[pp.Top()]; ok && (specProp.ReadOnly ||
+		specProp.Immutable || specProp.internals.updateFn != nil) {
+		return nil, fmt.Errorf("%s: %q is managed by the server", where,
+			pp.Top())
+	}
+	return pp, nil
+}
+
+// Apply the step to 'obj'. Returns true if it changed anything.
+func (step *MigrationStep) Apply(obj map[string]any) (bool, error) {
+	val, found, err := ObjectGetProp(obj, step.pp)
+	if err != nil || IsNil(val) {
+		// Something along the path is missing, which is the same as not
+		// having the attribute
+		found = false
+	}
+
+	switch step.Op {
+	case "coerce":
+		if !found {
+			return false, nil
+		}
+		newVal, err := CoerceValue(val, step.Type)
+		if err != nil {
+			return false, fmt.Errorf("Attribute %q: %s", step.pp.UI(), err)
+		}
+		if reflect.DeepEqual(val, newVal) {
+			return false, nil
+		}
+		return true, ObjectSetProp(obj, step.pp, newVal)
+
+	case "move":
+		if !found {
+			return false, nil
+		}
+		if dst, ok, err := ObjectGetProp(obj, step.toPP); err == nil && ok &&
+			!IsNil(dst) {
+			return false, fmt.Errorf("Can't move %q to %q, it's already set",
+				step.pp.UI(), step.toPP.UI())
+		}
+		if err := ObjectSetProp(obj, step.pp, nil); err != nil {
+			return false, err
+		}
+		return true, ObjectSetProp(obj, step.toPP, val)
+
+	case "default":
+		if found {
+			return false, nil
+		}
+		return true, ObjectSetProp(obj, step.pp, step.Value)
+	}
+
+	return false, nil
+}
+
+// Convert 'val' to 'daType' (a scalar type). Strings are parsed, and
+// numbers/booleans are formatted, as needed. Whether the result is a valid
+// value of the type (e.g. a timestamp) is left to the entity's validation.
+func CoerceValue(val any, daType string) (any, error) {
+	v := reflect.ValueOf(val)
+	bad := func() (any, error) {
+		return nil, fmt.Errorf("can't convert %v to %s", val, daType)
+	}
+
+	switch daType {
+	case BOOLEAN:
+		switch v.Kind() {
+		case reflect.Bool:
+			return val, nil
+		case reflect.String:
+			if b, err := strconv.ParseBool(v.String()); err == nil {
+				return b, nil
+			}
+		}
+
+	case DECIMAL:
+		switch {
+		case v.CanFloat():
+			return v.Float(), nil
+		case v.CanInt():
+			return float64(v.Int()), nil
+		case v.Kind() == reflect.String:
+			if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+				return f, nil
+			}
+		}
+
+	case INTEGER, UINTEGER:
+		f := 0.0
+		switch {
+		case v.CanInt():
+			f = float64(v.Int())
+		case v.CanFloat():
+			f = v.Float()
+		case v.Kind() == reflect.String:
+			var err error
+			if f, err = strconv.ParseFloat(v.String(), 64); err != nil {
+				return bad()
+			}
+		default:
+			return bad()
+		}
+		if f != math.Trunc(f) || (daType == UINTEGER && f < 0) {
+			return bad()
+		}
+		return int(f), nil
+
+	default: // The string types
+		switch {
+		case v.Kind() == reflect.String:
+			return val, nil
+		case v.Kind() == reflect.Bool:
+			return strconv.FormatBool(v.Bool()), nil
+		case v.CanInt():
+			return strconv.FormatInt(v.Int(), 10), nil
+		case v.CanFloat():
+			return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+		}
+	}
+
+	return bad()
+}
+
+// Applies the new model, and then the migration steps, and checks all of the
+// existing entities against the new model. Any invalid ones are listed in
+// the report and result in an error, in which case the caller needs to
+// rollback the transaction.
+func (m *Model) ApplyNewModelWithMigrations(newM *Model, steps []*MigrationStep) (*ModelReport, error) {
+	report, err := m.migrate(newM, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(report.Invalid) > 0 {
+		msgs := []string{}
+		for _, inv := range report.Invalid {
+			msgs = append(msgs, fmt.Sprintf("  %s: %s", inv.Path, inv.Error))
+		}
+		return report, fmt.Errorf("The new model would leave these entities "+
+			"invalid:\n%s", strings.Join(msgs, "\n"))
+	}
+
+	return report, nil
+}
+
+// Returns what ApplyNewModelWithMigrations would do, w/o making any changes.
+// Invalid entities are just listed in the report, not an error. This
+// uses, and then rolls back, the Registry's transaction so it's an error
+// if that transaction has any pending changes.
+func (reg *Registry) DryRunNewModel(newM *Model, steps []*MigrationStep) (*ModelReport, error) {
+	if reg.tx.HasChanges() {
+		return nil, fmt.Errorf("A model dry run can't be done while there " +
+			"are uncommitted changes")
+	}
+
+	defer func() {
+		reg.Rollback()
+		reg.LoadModel()
+	}()
+
+	report, err := reg.Model.migrate(newM, steps)
+	if report != nil {
+		report.DryRun = true
+	}
+	return report, err
+}
+
+func (m *Model) migrate(newM *Model, steps []*MigrationStep) (*ModelReport, error) {
+	reg := m.Registry
+	report := &ModelReport{}
+
+	// Find the entities that will be deleted along w/their type. If a
+	// Group is deleted we don't bother listing its Resources.
+	entities, err := RawEntitiesFromQuery(reg.tx, reg.DbSID,
+		`Level=1 OR Level=2`)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		parts := strings.Split(e.Abstract, string(DB_IN))
+		newGM := newM.Groups[parts[0]]
+		if newGM == nil {
+			if e.Level == 1 {
+				report.Deleted = append(report.Deleted, "/"+e.Path)
+			}
+		} else if e.Level == 2 && newGM.Resources[parts[1]] == nil {
+			report.Deleted = append(report.Deleted, "/"+e.Path)
+		}
+	}
+
+	if err := m.ApplyNewModel(newM); err != nil {
+		return nil, err
+	}
+
+	for _, step := range steps {
+		if err := step.Verify(m); err != nil {
+			return nil, err
+		}
+	}
+
+	// Now migrate and check what's left
+	entities, err = RawEntitiesFromQuery(reg.tx, reg.DbSID, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entities {
+		if e.Level == 2 {
+			// Resources are just a wrapper around their Versions
+			continue
+		}
+		e.Registry = reg
+		e.NewObject = maps.Clone(e.Object)
+		if e.NewObject == nil {
+			e.NewObject = map[string]any{}
+		}
+		report.Checked++
+
+		changed := false
+		var stepErr error
+		for _, step := range steps {
+			if step.abstract != e.Abstract {
+				continue
+			}
+			ok := false
+			if ok, stepErr = step.Apply(e.NewObject); stepErr != nil {
+				break
+			}
+			changed = changed || ok
+		}
+		if stepErr == nil {
+			stepErr = e.Validate()
+		}
+		if stepErr != nil {
+			report.Invalid = append(report.Invalid,
+				&InvalidEntity{Path: "/" + e.Path, Error: stepErr.Error()})
+			continue
+		}
+
+		if changed {
+			log.VPrintf(3, "Migrated: /%s", e.Path)
+			if err := PrepUpdateEntity(e); err != nil {
+				return nil, err
+			}
+			if err := e.Save(); err != nil {
+				return nil, err
+			}
+			report.Migrated = append(report.Migrated, "/"+e.Path)
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,119 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		val    any
+		daType string
+		exp    any
+		err    string
+	}{
+		{"10", INTEGER, 10, ""},
+		{10.0, INTEGER, 10, ""},
+		{"1.5", INTEGER, nil, "can't convert 1.5 to integer"},
+		{-1, UINTEGER, nil, "can't convert -1 to uinteger"},
+		{"abc", INTEGER, nil, "can't convert abc to integer"},
+		{5, DECIMAL, 5.0, ""},
+		{"2.5", DECIMAL, 2.5, ""},
+		{"true", BOOLEAN, true, ""},
+		{false, BOOLEAN, false, ""},
+		{1, BOOLEAN, nil, "can't convert 1 to boolean"},
+		{12, STRING, "12", ""},
+		{1.5, STRING, "1.5", ""},
+		{true, URL, "true", ""},
+		{"x", TIMESTAMP, "x", ""}, // the entity's validation catches this
+		{map[string]any{}, STRING, nil, "can't convert map[] to string"},
+	}
+
+	for i, test := range tests {
+		got, err := CoerceValue(test.val, test.daType)
+		errStr := ""
+		if err != nil {
+			errStr = err.Error()
+		}
+		if errStr != test.err || !reflect.DeepEqual(got, test.exp) {
+			t.Fatalf("Test %d: %v->%s\nExp: %#v (%s)\nGot: %#v (%s)", i,
+				test.val, test.daType, test.exp, test.err, got, errStr)
+		}
+	}
+}
+
+func TestMigrationStepApply(t *testing.T) {
+	m := &Model{
+		Groups: map[string]*GroupModel{
+			"dirs": {
+				Plural: "dirs",
+				Resources: map[string]*ResourceModel{
+					"files": {Plural: "files"},
+				},
+			},
+		},
+	}
+
+	obj := map[string]any{
+		"size":   "10",
+		"labels": map[string]any{"a": "b"},
+	}
+	steps := []*MigrationStep{
+		{Op: "coerce", Entities: "dirs", Attribute: "size", Type: INTEGER},
+		{Op: "coerce", Entities: "dirs", Attribute: "size", Type: INTEGER},
+		{Op: "move", Entities: "dirs/files", Attribute: "labels.a",
+			To: "owner.name"},
+		{Op: "move", Entities: "dirs", Attribute: "missing", To: "x"},
+		{Op: "default", Entities: "/dirs/", Attribute: "owner.name",
+			Value: "x"},
+		{Op: "default", Attribute: "labels.env", Value: "prod"},
+	}
+	changes := []bool{true, false, true, false, false, true}
+	abstracts := []string{"dirs", "dirs", "dirs,files,versions", "dirs",
+		"dirs", ""}
+
+	for i, step := range steps {
+		if err := step.Verify(m); err != nil {
+			t.Fatalf("Step %d: %s", i, err)
+		}
+		if step.abstract != abstracts[i] {
+			t.Fatalf("Step %d: abstract %q", i, step.abstract)
+		}
+		changed, err := step.Apply(obj)
+		if err != nil || changed != changes[i] {
+			t.Fatalf("Step %d: %v %s\n%s", i, changed, err, ToJSON(obj))
+		}
+	}
+
+	exp := map[string]any{
+		"size":   10,
+		"labels": map[string]any{"env": "prod"},
+		"owner":  map[string]any{"name": "b"},
+	}
+	if !reflect.DeepEqual(obj, exp) {
+		t.Fatalf("Bad result:\n%s", ToJSON(obj))
+	}
+
+	// Won't overwrite an existing value
+	step := &MigrationStep{Op: "move", Attribute: "size", To: "owner.name"}
+	if err := step.Verify(m); err != nil {
+		t.Fatalf("Verify: %s", err)
+	}
+	_, err := step.Apply(obj)
+	if err == nil || err.Error() != `Can't move "size" to "owner.name", `+
+		`it's already set` {
+		t.Fatalf("Should have failed: %v", err)
+	}
+
+	for _, step := range []*MigrationStep{
+		{Op: "default", Attribute: "x"},
+		{Op: "move", Attribute: "x"},
+		{Op: "coerce", Entities: "a/b/c", Attribute: "x", Type: STRING},
+		{Op: "coerce", Entities: "files", Attribute: "x", Type: STRING},
+		{Op: "coerce", Attribute: "createdat", Type: STRING},
+	} {
+		if err := step.Verify(m); err == nil {
+			t.Fatalf("Should have failed: %s", ToJSON(step))
+		}
+	}
+}
@@ -0,0 +1,471 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/duglin/dlog"
+)
+
+// A mirror is a Registry that pulls its model, Groups, Resources and
+// Versions from another (upstream) xRegistry. Mirrored Groups have their
+// "origin" set to the upstream's "self" URL for them, and end-users can't
+// change them (see Group.CheckMirrored). Groups that only exist locally are
+// left alone.
+
+var MirrorClient = &http.Client{Timeout: time.Minute}
+
+func mirrorGet(url string) ([]byte, error) {
+	res, err := MirrorClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching %q: %s", url, err)
+	}
+	defer res.Body.Close()
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching %q: %s", url, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Error fetching %q: %s\n%s", url, res.Status,
+			string(buf))
+	}
+	return buf, nil
+}
+
+// Fetches a Version's document. If there's a BlobStore then it's streamed
+// into it, w/o any DB changes, and a *StagedBlob is returned. Otherwise it's
+// the document's bytes.
+func mirrorGetDoc(tx *Tx, url string) (any, error) {
+	if blobStore == nil {
+		return mirrorGet(url)
+	}
+
+	res, err := MirrorClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching %q: %s", url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		buf, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("Error fetching %q: %s\n%s", url, res.Status,
+			string(buf))
+	}
+	blob, err := tx.StageBlob(res.Body, res.ContentLength)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching %q: %s", url, err)
+	}
+	return blob, nil
+}
+
+// The IDs of the entities of type "abstract" directly under "parentSID"
+func childUIDs(tx *Tx, regSID string, parentSID string,
+	abstract string) ([]string, error) {
+
+	results, err := Query(tx, `
+		SELECT UID
+		FROM Entities
+		WHERE RegSID=? AND ParentSID=? AND Abstract=?`,
+		regSID, parentSID, abstract)
+	defer results.Close()
+
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the list: %s", err)
+	}
+
+	ids := []string{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		ids = append(ids, NotNilString(row[0]))
+	}
+	return ids, nil
+}
+
+// Returns a copy of "obj" w/o the attributes that we can't, or shouldn't,
+// copy from the upstream entity, plus "origin"
+func mirrorAttrs(obj map[string]any, skip ...string) Object {
+	res := Object{}
+	for k, v := range obj {
+		res[k] = v
+	}
+	for _, k := range append(skip, "epoch", "self", "isdefault") {
+		delete(res, k)
+	}
+	res["origin"] = obj["self"]
+	return res
+}
+
+// True if the local entity already has the upstream's copy of "upObj"
+func mirrorIsCurrent(local *Entity, upObj map[string]any) bool {
+	return local.Get("origin") == upObj["self"] &&
+		local.Get("modifiedat") == upObj["modifiedat"]
+}
+
+// The Version IDs of an upstream Resource, oldest first so that the newest
+// Version is the same once they're created locally
+func mirrorVersionIDs(versions map[string]any) []string {
+	ids := SortedKeys(versions)
+
+	createdAt := func(id string) string {
+		vObj, _ := versions[id].(map[string]any)
+		str, _ := vObj["createdat"].(string)
+		return str
+	}
+	sort.SliceStable(ids, func(i, j int) bool {
+		ti, tj := createdAt(ids[i]), createdAt(ids[j])
+		if ti != tj {
+			return ti < tj
+		}
+		ni, erri := strconv.Atoi(ids[i])
+		nj, errj := strconv.Atoi(ids[j])
+		if erri == nil && errj == nil {
+			return ni < nj
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// Pull everything from the Registry's upstream xRegistry. All of the
+// upstream's data is fetched before any changes are made, and the Registry's
+// Tx is rolled back before the first request so that no DB locks (or Txs)
+// are held while waiting on the network. That means any pending changes
+// need to be committed first. The changes are then made in a new Tx, and
+// it's up to the caller to Commit it.
+func (reg *Registry) SyncMirror() error {
+	log.VPrintf(3, ">Enter: SyncMirror(%s)", reg.UID)
+	defer log.VPrintf(3, "<Exit: SyncMirror")
+
+	upstream, err := reg.GetMirror()
+	if err != nil {
+		return err
+	}
+	if upstream == "" {
+		return fmt.Errorf("Registry %q isn't a mirror", reg.UID)
+	}
+
+	current, err := reg.mirrorCurrentVersions()
+	if err != nil {
+		return err
+	}
+	if err = reg.Rollback(); err != nil {
+		return err
+	}
+
+	buf, err := mirrorGet(upstream + "/model")
+	if err != nil {
+		return err
+	}
+	newModel := &Model{}
+	if err = Unmarshal(buf, newModel); err != nil {
+		return fmt.Errorf("Error parsing the upstream model: %s", err)
+	}
+
+	inlines := []string{}
+	for _, gm := range newModel.Groups {
+		for _, rm := range gm.Resources {
+			inlines = append(inlines, "inline="+gm.Plural+"."+rm.Plural+
+				".versions")
+		}
+	}
+	buf, err = mirrorGet(upstream + "?" + strings.Join(inlines, "&"))
+	if err != nil {
+		return err
+	}
+	upReg := map[string]any{}
+	if err = Unmarshal(buf, &upReg); err != nil {
+		return fmt.Errorf("Error parsing the upstream registry: %s", err)
+	}
+
+	docs, err := mirrorFetchDocs(reg.tx, newModel, upReg, current)
+	if err != nil {
+		return err
+	}
+
+	// Now apply it all, model first so the entities can be created
+	if ToJSON(newModel) != ToJSON(reg.Model) {
+		if err = reg.Model.ApplyNewModel(newModel); err != nil {
+			return fmt.Errorf("Error applying the upstream model: %s", err)
+		}
+		// Reload it so the spec defined attributes are set up correctly
+		reg.LoadModel()
+	}
+
+	for _, gm := range reg.Model.Groups {
+		upGroups, _ := upReg[gm.Plural].(map[string]any)
+		for _, gID := range SortedKeys(upGroups) {
+			gObj, _ := upGroups[gID].(map[string]any)
+			if err = reg.mirrorGroup(gm, gID, gObj, docs); err != nil {
+				return err
+			}
+		}
+
+		// Delete the mirrored Groups that are gone from the upstream
+		ids, err := childUIDs(reg.tx, reg.DbSID, reg.DbSID, gm.Plural)
+		if err != nil {
+			return err
+		}
+		for _, gID := range ids {
+			if _, ok := upGroups[gID]; ok {
+				continue
+			}
+			group, err := reg.FindGroup(gm.Plural, gID, false)
+			if err != nil {
+				return err
+			}
+			if mirrored, err := group.IsMirrored(); err != nil || !mirrored {
+				continue
+			}
+			if err = group.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// The "modifiedat" of each local Version that came from the upstream,
+// indexed by its "origin"
+func (reg *Registry) mirrorCurrentVersions() (map[string]any, error) {
+	entities, err := RawEntitiesFromQuery(reg.tx, reg.DbSID, `e.Level=3`)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]any{}
+	for _, e := range entities {
+		if origin, _ := e.Object["origin"].(string); origin != "" {
+			current[origin] = e.Object["modifiedat"]
+		}
+	}
+	return current, nil
+}
+
+// Returns the documents of the upstream Versions that need to be copied,
+// indexed by the Version's upstream "self" URL. "current" is what
+// mirrorCurrentVersions returned, so we don't fetch the ones we already have.
+// See mirrorGetDoc for the type of each document.
+func mirrorFetchDocs(tx *Tx, newModel *Model, upReg map[string]any,
+	current map[string]any) (map[string]any, error) {
+
+	docs := map[string]any{}
+	for _, gm := range newModel.Groups {
+		upGroups, _ := upReg[gm.Plural].(map[string]any)
+		for _, gID := range SortedKeys(upGroups) {
+			gObj, _ := upGroups[gID].(map[string]any)
+
+			for _, rm := range gm.Resources {
+				if !rm.GetHasDocument() {
+					continue
+				}
+				upRes, _ := gObj[rm.Plural].(map[string]any)
+				for _, rID := range SortedKeys(upRes) {
+					rObj, _ := upRes[rID].(map[string]any)
+					versions, _ := rObj["versions"].(map[string]any)
+					for _, vID := range SortedKeys(versions) {
+						vObj, _ := versions[vID].(map[string]any)
+						if _, ok := vObj[rm.Singular+"url"]; ok {
+							continue
+						}
+						if _, ok := vObj[rm.Singular+"proxyurl"]; ok {
+							continue
+						}
+
+						self, _ := vObj["self"].(string)
+						if modAt, ok := current[self]; ok &&
+							modAt == vObj["modifiedat"] {
+							continue
+						}
+
+						doc, err := mirrorGetDoc(tx,
+							strings.TrimSuffix(self, "$meta"))
+						if err != nil {
+							return nil, err
+						}
+						docs[self] = doc
+					}
+				}
+			}
+		}
+	}
+	return docs, nil
+}
+
+func (reg *Registry) mirrorGroup(gm *GroupModel, gID string,
+	gObj map[string]any, docs map[string]any) error {
+
+	group, err := reg.FindGroup(gm.Plural, gID, false)
+	if err != nil {
+		return err
+	}
+	if group == nil || !mirrorIsCurrent(&group.Entity, gObj) {
+		skip := []string{}
+		for _, rm := range gm.Resources {
+			skip = append(skip, rm.Plural, rm.Plural+"count", rm.Plural+"url")
+		}
+		group, _, err = reg.UpsertGroupWithObject(gm.Plural, gID,
+			mirrorAttrs(gObj, skip...), ADD_UPSERT, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rm := range gm.Resources {
+		upRes, _ := gObj[rm.Plural].(map[string]any)
+		for _, rID := range SortedKeys(upRes) {
+			rObj, _ := upRes[rID].(map[string]any)
+			if err = mirrorResource(group, rm, rID, rObj, docs); err != nil {
+				return err
+			}
+		}
+
+		// Nothing in a mirrored Group can be local-only
+		ids, err := childUIDs(reg.tx, reg.DbSID, group.DbSID,
+			gm.Plural+string(DB_IN)+rm.Plural)
+		if err != nil {
+			return err
+		}
+		for _, rID := range ids {
+			if _, ok := upRes[rID]; ok {
+				continue
+			}
+			resource, err := group.FindResource(rm.Plural, rID, false)
+			if err != nil {
+				return err
+			}
+			if err = resource.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func mirrorResource(group *Group, rm *ResourceModel, rID string,
+	rObj map[string]any, docs map[string]any) error {
+
+	resource, err := group.FindResource(rm.Plural, rID, false)
+	if err != nil {
+		return err
+	}
+
+	versions, _ := rObj["versions"].(map[string]any)
+	for _, vID := range mirrorVersionIDs(versions) {
+		vObj, _ := versions[vID].(map[string]any)
+
+		if resource != nil {
+			v, err := resource.FindVersion(vID, false)
+			if err != nil {
+				return err
+			}
+			if v != nil && mirrorIsCurrent(&v.Entity, vObj) {
+				continue
+			}
+		}
+
+		obj := mirrorAttrs(vObj, rm.Singular, rm.Singular+"base64")
+		if self, _ := vObj["self"].(string); docs[self] != nil {
+			obj[rm.Singular] = docs[self]
+		}
+
+		if resource == nil {
+			resource, err = group.AddResourceWithObject(rm.Plural, rID, vID,
+				obj, false, true)
+		} else {
+			_, _, err = resource.UpsertVersionWithObject(vID, obj, ADD_UPSERT)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if resource == nil {
+		return nil
+	}
+
+	// Delete the Versions that are gone from the upstream
+	vIDs, err := resource.GetVersionIDs()
+	if err != nil {
+		return err
+	}
+	for _, vID := range vIDs {
+		if _, ok := versions[vID]; ok {
+			continue
+		}
+		v, err := resource.FindVersion(vID, false)
+		if err != nil {
+			return err
+		}
+		if err = v.Delete(""); err != nil {
+			return err
+		}
+	}
+
+	// Make the default Version (and its stickiness) match the upstream's
+	defaultID, _ := rObj["defaultversionid"].(string)
+	if rObj["stickydefaultversion"] == true {
+		if resource.Get("stickydefaultversion") != true ||
+			resource.Get("defaultversionid") != defaultID {
+			return resource.SetDefaultID(defaultID)
+		}
+	} else if resource.Get("stickydefaultversion") == true ||
+		resource.Get("defaultversionid") != defaultID {
+		if err = resource.JustSet("stickydefaultversion", nil); err != nil {
+			return err
+		}
+		return resource.SetSave("defaultversionid", defaultID)
+	}
+	return nil
+}
+
+// Sync the Registry (by its DbSID) from its upstream right away and then
+// every "interval", until the returned func is called. Each sync's changes
+// are made in their own Tx (see SyncMirror), and a failed sync is just
+// logged and retried next time.
+func StartMirror(regSID string, interval time.Duration) func() {
+	stop := make(chan struct{})
+
+	sync := func() {
+		tx, err := NewTx()
+		if err != nil {
+			log.Printf("Mirror: %s", err)
+			return
+		}
+		reg, err := FindRegistryBySID(tx, regSID)
+		if err == nil && reg == nil {
+			err = fmt.Errorf("Can't find registry %q", regSID)
+		}
+		if err == nil {
+			err = reg.SyncMirror()
+		}
+		if err != nil {
+			log.Printf("Mirror: %s", err)
+			tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			log.Printf("Mirror: %s", err)
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			sync()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() { close(stop) }
+}
@@ -8,6 +8,7 @@ import (
 	"maps"
 	"reflect"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -116,6 +117,7 @@ type ResourceModel struct {
 	SetStickyDefault *bool             `json:"setstickydefaultversion"` // do not include omitempty
 	HasDocument      *bool             `json:"hasdocument"`             // do not include omitempty
 	ReadOnly         bool              `json:"readonly,omitempty"`
+	Compatibility    string            `json:"compatibility,omitempty"`
 	TypeMap          map[string]string `json:"typemap,omitempty"`
 	Attributes       Attributes        `json:"attributes,omitempty"`
 }
@@ -604,7 +606,7 @@ func LoadModel(reg *Registry) *Model {
         SELECT
             SID, RegistrySID, ParentSID, Plural, Singular, Attributes,
 			MaxVersions, SetVersionId, SetStickyDefault, HasDocument, ReadOnly,
-			TypeMap
+			TypeMap, Compatibility
         FROM ModelEntities
         WHERE RegistrySID=?
         ORDER BY ParentSID ASC`, reg.DbSID)
@@ -657,6 +659,7 @@ func LoadModel(reg *Registry) *Model {
 					SetStickyDefault: PtrBool(NotNilBoolDef(row[8], SETSTICKYDEFAULT)),
 					HasDocument:      PtrBool(NotNilBoolDef(row[9], HASDOCUMENT)),
 					ReadOnly:         NotNilBoolDef(row[10], READONLY),
+					Compatibility:    NotNilString(row[12]),
 					TypeMap:          typemap,
 				}
 
@@ -681,6 +684,45 @@ func (m *Model) FindGroupModel(gTypePlural string) *GroupModel {
 	return nil
 }
 
+// Given the Abstract path of an entity (in DB format, e.g. "dirs,files")
+// and the PropPath of one of its attributes, return the attribute's type as
+// defined by the model. Returns "" if the model doesn't know about it.
+func (m *Model) GetPropType(abs string, pp *PropPath) string {
+	attrs := m.GetBaseAttributes()
+	if abs != "" {
+		gm, rm := AbstractToModels(m.Registry, abs)
+		if rm != nil {
+			attrs = rm.GetBaseAttributes()
+		} else {
+			attrs = gm.GetBaseAttributes()
+		}
+	}
+
+	daType := ""
+	item := (*Item)(nil)
+	for _, part := range pp.Parts {
+		if attrs != nil {
+			attr := attrs[part.Text]
+			if attr == nil {
+				attr = attrs["*"]
+			}
+			if attr == nil {
+				return ""
+			}
+			daType, attrs, item = attr.Type, attr.Attributes, attr.Item
+		} else if item != nil {
+			// part is a map key or an array index
+			daType, attrs, item = item.Type, item.Attributes, item.Item
+		} else if daType == ANY {
+			return ANY
+		} else {
+			// Trying to go into a scalar
+			return ""
+		}
+	}
+	return daType
+}
+
 func (m *Model) ApplyNewModel(newM *Model) error {
 	newM.Registry = m.Registry
 	if err := newM.Verify(); err != nil {
@@ -748,6 +790,7 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 					SetStickyDefault: newRM.SetStickyDefault,
 					HasDocument:      newRM.HasDocument,
 					ReadOnly:         newRM.ReadOnly,
+					Compatibility:    newRM.Compatibility,
 				})
 				if err != nil {
 					log.VPrintf(4, "Err: %s", err)
@@ -761,6 +804,7 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 				oldRM.SetStickyDefault = newRM.SetStickyDefault
 				oldRM.HasDocument = newRM.HasDocument
 				oldRM.ReadOnly = newRM.ReadOnly
+				oldRM.Compatibility = newRM.Compatibility
 			}
 			oldRM.Attributes = newRM.Attributes
 			oldRM.TypeMap = newRM.TypeMap
@@ -779,6 +823,12 @@ func (m *Model) ApplyNewModel(newM *Model) error {
 func (gm *GroupModel) Delete() error {
 	log.VPrintf(3, ">Enter: Delete.GroupModel: %s", gm.Plural)
 	defer log.VPrintf(3, "<Exit: Delete.GroupModel")
+
+	// The triggers delete the Groups, but not the blobs of their documents
+	if err := gm.Registry.tx.checkModelBlobs(gm.SID); err != nil {
+		return err
+	}
+
 	err := DoOne(gm.Registry.tx, `
         DELETE FROM ModelEntities
 		WHERE RegistrySID=? AND SID=?`, // SID should be enough, but ok
@@ -800,17 +850,12 @@ func (gm *GroupModel) Save() error {
 	buf, _ := json.Marshal(gm.Attributes)
 	attrs := string(buf)
 
-	err := DoZeroTwo(gm.Registry.tx, `
-        INSERT INTO ModelEntities(
-            SID, RegistrySID,
-			ParentSID, Plural, Singular, Attributes)
-        VALUES(?,?,?,?,?,?)
-        ON DUPLICATE KEY UPDATE
-		    ParentSID=?,Plural=?,Singular=?,Attributes=?
-		`,
-		gm.SID, gm.Registry.DbSID,
+	err := DoZeroOne(gm.Registry.tx, `
+        UPDATE ModelEntities
+        SET ParentSID=?,Plural=?,Singular=?,Attributes=?
+        WHERE SID=? AND RegistrySID=?`,
 		nil, gm.Plural, gm.Singular, attrs,
-		nil, gm.Plural, gm.Singular, attrs)
+		gm.SID, gm.Registry.DbSID)
 	if err != nil {
 		log.Printf("Error updating groupModel(%s): %s", gm.Plural, err)
 	}
@@ -951,10 +996,12 @@ func (gm *GroupModel) AddResourceModelFull(rm *ResourceModel) (*ResourceModel, e
 	err := DoOne(gm.Registry.tx, `
 		INSERT INTO ModelEntities(
 			SID, RegistrySID, ParentSID, Plural, Singular, MaxVersions,
-			SetVersionId, SetStickyDefault, HasDocument, ReadOnly, TypeMap)
-		VALUES(?,?,?,?,?,?,?,?,?,?,?)`,
+			SetVersionId, SetStickyDefault, HasDocument, ReadOnly, TypeMap,
+			Compatibility)
+		VALUES(?,?,?,?,?,?,?,?,?,?,?,?)`,
 		rm.SID, gm.Registry.DbSID, gm.SID, rm.Plural, rm.Singular, rm.MaxVersions,
-		rm.GetSetVersionId(), rm.GetSetStickyDefault(), rm.GetHasDocument(), rm.ReadOnly, typemap)
+		rm.GetSetVersionId(), rm.GetSetStickyDefault(), rm.GetHasDocument(), rm.ReadOnly, typemap,
+		rm.Compatibility)
 	if err != nil {
 		log.Printf("Error inserting resourceModel(%s): %s", rm.Plural, err)
 		return nil, err
@@ -987,6 +1034,12 @@ func (rm *ResourceModel) GetHasDocument() bool {
 func (rm *ResourceModel) Delete() error {
 	log.VPrintf(3, ">Enter: Delete.ResourceModel: %s", rm.Plural)
 	defer log.VPrintf(3, "<Exit: Delete.ResourceModel")
+
+	// The triggers delete the Resources, but not the blobs of their documents
+	if err := rm.GroupModel.Registry.tx.checkModelBlobs(rm.SID); err != nil {
+		return err
+	}
+
 	err := DoOne(rm.GroupModel.Registry.tx, `
         DELETE FROM ModelEntities
 		WHERE RegistrySID=? AND SID=?`, // SID should be enough, but ok
@@ -1010,25 +1063,18 @@ func (rm *ResourceModel) Save() error {
 	buf, _ = json.Marshal(rm.TypeMap)
 	typemap := string(buf)
 
-	err := DoZeroTwo(rm.GroupModel.Registry.tx, `
-        INSERT INTO ModelEntities(
-            SID, RegistrySID,
-			ParentSID, Plural, Singular, MaxVersions,
-			Attributes,
-			SetVersionId, SetStickyDefault, HasDocument, ReadOnly, TypeMap)
-        VALUES(?,?,?,?,?,?,?,?,?,?,?,?)
-        ON DUPLICATE KEY UPDATE
-            ParentSID=?, Plural=?, Singular=?,
+	err := DoZeroOne(rm.GroupModel.Registry.tx, `
+        UPDATE ModelEntities
+        SET ParentSID=?, Plural=?, Singular=?,
 			Attributes=?,
-            MaxVersions=?, SetVersionId=?, SetStickyDefault=?, HasDocument=?, ReadOnly=?, TypeMap=?`,
-		rm.SID, rm.GroupModel.Registry.DbSID,
-		rm.GroupModel.SID, rm.Plural, rm.Singular, rm.MaxVersions,
-		attrs,
-		rm.GetSetVersionId(), rm.GetSetStickyDefault(), rm.GetHasDocument(), rm.ReadOnly, typemap,
-
+            MaxVersions=?, SetVersionId=?, SetStickyDefault=?, HasDocument=?, ReadOnly=?, TypeMap=?,
+			Compatibility=?
+        WHERE SID=? AND RegistrySID=?`,
 		rm.GroupModel.SID, rm.Plural, rm.Singular,
 		attrs,
-		rm.MaxVersions, rm.GetSetVersionId(), rm.GetSetStickyDefault(), rm.GetHasDocument(), rm.ReadOnly, typemap)
+		rm.MaxVersions, rm.GetSetVersionId(), rm.GetSetStickyDefault(), rm.GetHasDocument(), rm.ReadOnly, typemap,
+		rm.Compatibility,
+		rm.SID, rm.GroupModel.Registry.DbSID)
 	if err != nil {
 		log.Printf("Error updating resourceModel(%s): %s", rm.Plural, err)
 		return err
@@ -1516,6 +1562,13 @@ func (rm *ResourceModel) Verify(rmName string) error {
 		}
 	}
 
+	if rm.Compatibility != "" &&
+		!slices.Contains(CompatibilityModes, rm.Compatibility) {
+		return fmt.Errorf("Resource %q has an invalid 'compatibility' value "+
+			"(%s). Must be one of: %s", rmName, rm.Compatibility,
+			strings.Join(CompatibilityModes, ", "))
+	}
+
 	// Make sure the typemap's values are just certain strings
 	for _, v := range rm.TypeMap {
 		if v != "string" && v != "json" && v != "binary" {
@@ -1749,6 +1802,18 @@ func (rm *ResourceModel) RemoveTypeMap(ct string) error {
 	return nil
 }
 
+func (rm *ResourceModel) SetCompatibility(mode string) error {
+	oldMode := rm.Compatibility
+	rm.Compatibility = mode
+
+	if err := rm.GroupModel.Registry.Model.VerifyAndSave(); err != nil {
+		// Undo
+		rm.Compatibility = oldMode
+		return err
+	}
+	return nil
+}
+
 // Map incoming "contentType" (ct) to its typemap value.
 // If there is no match (or more than one match with a different type)
 // then default to "binary"
@@ -417,6 +417,11 @@ func TestGetModelSerializer(t *testing.T) {
 		},
 	}
 
+	// Put back the real ones when we're done
+	defer func(saved map[string]ModelSerializer) {
+		ModelSerializers = saved
+	}(ModelSerializers)
+
 	for _, test := range tests {
 		// Start out clean
 		ModelSerializers = map[string]ModelSerializer{}
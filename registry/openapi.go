@@ -0,0 +1,690 @@
+package registry
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+const OPENAPI = "OpenAPI"
+const OPENAPI_VERSION = "3.1.0"
+
+func init() {
+	RegisterModelSerializer(OPENAPI+"/3.1", Model2OpenAPI)
+}
+
+// The model serializer for the "OpenAPI" schema format. It generates an
+// OpenAPI 3.1 document describing the Registry's URL space as defined by its
+// model. The entity schemas are the ones from Model2JSONSchema, but under
+// "components/schemas".
+func Model2OpenAPI(m *Model, format string) ([]byte, error) {
+	title := "xRegistry"
+	if m.Registry != nil && m.Registry.UID != "" {
+		title += ": " + m.Registry.UID
+	}
+
+	paths := map[string]any{}
+
+	paths["/"] = map[string]any{
+		"get": openAPIOp("getRegistry", "Get the Registry", "registry",
+			[]any{openAPIParam("inline"), openAPIParam("filter"),
+				openAPIParam("model")},
+			nil, openAPIEntityResponses("registry", false)),
+		"put": openAPIOp("putRegistry", "Update the Registry", "registry",
+			[]any{openAPIParam("nested")}, openAPIEntityBody("registry"),
+			openAPIEntityResponses("registry", false)),
+		"patch": openAPIOp("patchRegistry", "Update some of the Registry's "+
+			"attributes", "registry", []any{openAPIParam("nested")},
+			openAPIPatchBody("registry"),
+			openAPIEntityResponses("registry", false)),
+	}
+
+	paths["/model"] = map[string]any{
+		"get": openAPIOp("getModel", "Get the model", "registry",
+			[]any{openAPIParam("schema")}, nil, map[string]any{
+				"200": map[string]any{
+					"description": "The model",
+					"content":     openAPIMeta(map[string]any{"type": "object"}),
+				},
+				"default": openAPIRef("responses", "error"),
+			}),
+		"put": openAPIOp("putModel", "Replace the model", "registry",
+			[]any{openAPIParam("dryrun")},
+			map[string]any{
+				"required": true,
+				"content":  openAPIMeta(map[string]any{"type": "object"}),
+			}, map[string]any{
+				"200": map[string]any{
+					"description": "The new model, or with ?dryrun a " +
+						"report of what would happen to the existing " +
+						"entities",
+					"content": map[string]any{
+						"application/json": map[string]any{
+							"schema": map[string]any{
+								"oneOf": []any{
+									map[string]any{"type": "object"},
+									openAPIModelReport(),
+								},
+							},
+						},
+						"application/yaml": map[string]any{
+							"schema": map[string]any{"type": "object"},
+						},
+					},
+				},
+				"default": openAPIRef("responses", "error"),
+			}),
+	}
+
+	for _, gName := range SortedKeys(m.Groups) {
+		gm := m.Groups[gName]
+		gName := openAPIName(gm.Singular)
+		gsName := openAPIName(gm.Plural)
+		gPath := "/" + gm.Plural
+		gParams := []any{openAPIPathParam(gm.Singular + "id")}
+		gmPath := gPath + "/{" + gm.Singular + "id}"
+
+		paths[gPath] = openAPICollPaths(gsName, gm.Singular, gm.Plural,
+			gm.Plural, nil)
+		paths[gmPath] = map[string]any{
+			"parameters": gParams,
+			"get": openAPIOp("get"+gName, "Get a "+gm.Singular, gm.Plural,
+				[]any{openAPIParam("inline"), openAPIParam("filter")},
+				nil, openAPIEntityResponses(gm.Plural, false)),
+			"put": openAPIOp("put"+gName, "Create or update a "+gm.Singular,
+				gm.Plural, []any{openAPIParam("nested")},
+				openAPIEntityBody(gm.Plural),
+				openAPIEntityResponses(gm.Plural, true)),
+			"patch": openAPIOp("patch"+gName, "Update some of a "+
+				gm.Singular+"'s attributes", gm.Plural,
+				[]any{openAPIParam("nested")}, openAPIPatchBody(gm.Plural),
+				openAPIEntityResponses(gm.Plural, true)),
+			"delete": openAPIOp("delete"+gName, "Delete a "+gm.Singular,
+				gm.Plural, []any{openAPIParam("epoch")}, nil,
+				openAPIDeleteResponses()),
+		}
+
+		for _, rName := range SortedKeys(gm.Resources) {
+			rm := gm.Resources[rName]
+			addOpenAPIResourcePaths(paths, gm, rm, gmPath, gParams)
+		}
+	}
+
+	doc := map[string]any{
+		"openapi":           OPENAPI_VERSION,
+		"jsonSchemaDialect": JSONSCHEMA_URI,
+		"info": map[string]any{
+			"title":   title,
+			"version": SPECVERSION,
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas":    ModelJSONSchemaDefs(m, "#/components/schemas/"),
+			"parameters": openAPIParams,
+			"responses": map[string]any{
+				"error": map[string]any{
+					"description": "The reason for the error",
+					"content": map[string]any{
+						"text/plain": map[string]any{
+							"schema": map[string]any{"type": "string"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+func addOpenAPIResourcePaths(paths map[string]any, gm *GroupModel,
+	rm *ResourceModel, gmPath string, gParams []any) {
+
+	hasDoc := rm.GetHasDocument()
+	rKey := JSONSchemaResourceKey(gm, rm)
+	vKey := JSONSchemaVersionKey(gm, rm)
+	rName := openAPIName(gm.Singular) + openAPIName(rm.Singular)
+	rsName := openAPIName(gm.Singular) + openAPIName(rm.Plural)
+	tag := gm.Plural + "/" + rm.Plural
+
+	rPath := gmPath + "/" + rm.Plural
+	rParams := append(slices.Clone(gParams),
+		openAPIPathParam(rm.Singular+"id"))
+	rmPath := rPath + "/{" + rm.Singular + "id}"
+	vPath := rmPath + "/versions"
+	vParams := append(slices.Clone(rParams), openAPIPathParam("versionid"))
+	vmPath := vPath + "/{versionid}"
+
+	// The metadata of the entity is either at its URL or at URL$meta
+	metaSuffix, metaName := "", ""
+	if hasDoc {
+		metaSuffix, metaName = "$meta", "Meta"
+	}
+
+	paths[rPath] = openAPICollPaths(rsName, rm.Singular, tag, rKey, gParams)
+
+	rMeta := map[string]any{
+		"parameters": rParams,
+		"get": openAPIOp("get"+rName+metaName, "Get a "+rm.Singular, tag,
+			[]any{openAPIParam("inline"), openAPIParam("filter"),
+				openAPIParam("diff")},
+			nil, openAPIEntityResponses(rKey, false)),
+		"put": openAPIOp("put"+rName+metaName, "Create or update a "+
+			rm.Singular+" and its default version", tag,
+			[]any{openAPIParam("nested")}, openAPIEntityBody(rKey),
+			openAPIEntityResponses(rKey, true)),
+		"patch": openAPIOp("patch"+rName+metaName, "Update some of a "+
+			rm.Singular+"'s attributes", tag, []any{openAPIParam("nested")},
+			openAPIPatchBody(rKey), openAPIEntityResponses(rKey, true)),
+		"post": openAPIOp("post"+rName+metaName, "Create a new version of a "+
+			rm.Singular, tag, []any{openAPIParam("setdefaultversionid")},
+			openAPIEntityBody(vKey), openAPIEntityResponses(vKey, true)),
+	}
+	paths[rmPath+metaSuffix] = rMeta
+
+	paths[vPath] = openAPICollPaths(rName+"Versions", rm.Singular+" version",
+		tag, vKey, rParams)
+	versions := paths[vPath].(map[string]any)
+	versions["post"].(map[string]any)["parameters"] =
+		[]any{openAPIParam("setdefaultversionid")}
+	versions["delete"].(map[string]any)["parameters"] =
+		[]any{openAPIParam("setdefaultversionid")}
+
+	vMeta := map[string]any{
+		"parameters": vParams,
+		"get": openAPIOp("get"+rName+"Version"+metaName, "Get a "+
+			rm.Singular+" version", tag,
+			[]any{openAPIParam("inline"), openAPIParam("filter"),
+				openAPIParam("diff")},
+			nil, openAPIEntityResponses(vKey, false)),
+		"put": openAPIOp("put"+rName+"Version"+metaName, "Create or update "+
+			"a "+rm.Singular+" version", tag,
+			[]any{openAPIParam("setdefaultversionid")},
+			openAPIEntityBody(vKey), openAPIEntityResponses(vKey, true)),
+		"patch": openAPIOp("patch"+rName+"Version"+metaName, "Update some "+
+			"of a "+rm.Singular+" version's attributes", tag,
+			[]any{openAPIParam("setdefaultversionid")},
+			openAPIPatchBody(vKey), openAPIEntityResponses(vKey, true)),
+	}
+	paths[vmPath+metaSuffix] = vMeta
+
+	rDelete := openAPIOp("delete"+rName, "Delete a "+rm.Singular, tag,
+		[]any{openAPIParam("epoch")}, nil, openAPIDeleteResponses())
+	vDelete := openAPIOp("delete"+rName+"Version", "Delete a "+
+		rm.Singular+" version", tag,
+		[]any{openAPIParam("epoch"), openAPIParam("setdefaultversionid")},
+		nil, openAPIDeleteResponses())
+
+	if !hasDoc {
+		rMeta["delete"] = rDelete
+		vMeta["delete"] = vDelete
+		return
+	}
+
+	// The documents themselves, w/their metadata in xRegistry headers
+	attrs := rm.GetBaseAttributes()
+	paths[rmPath] = map[string]any{
+		"parameters": rParams,
+		"get": openAPIOp("get"+rName, "Get the document of a "+rm.Singular+
+			"'s default version", tag, nil, nil,
+			openAPIDocResponses(rm, attrs, 2, false)),
+		"put": openAPIOp("put"+rName, "Create or update the document of a "+
+			rm.Singular+"'s default version", tag,
+			openAPIDocHeaders(rm, attrs), openAPIDocBody(),
+			openAPIDocResponses(rm, attrs, 2, true)),
+		"post": openAPIOp("post"+rName, "Create a new version of a "+
+			rm.Singular+" from a document", tag,
+			append(openAPIDocHeaders(rm, attrs),
+				openAPIParam("setdefaultversionid")),
+			openAPIDocBody(), openAPIDocResponses(rm, attrs, 3, true)),
+		"delete": rDelete,
+	}
+
+	paths[vmPath] = map[string]any{
+		"parameters": vParams,
+		"get": openAPIOp("get"+rName+"Version", "Get the document of a "+
+			rm.Singular+" version", tag, nil, nil,
+			openAPIDocResponses(rm, attrs, 3, false)),
+		"put": openAPIOp("put"+rName+"Version", "Create or update the "+
+			"document of a "+rm.Singular+" version", tag,
+			append(openAPIDocHeaders(rm, attrs),
+				openAPIParam("setdefaultversionid")),
+			openAPIDocBody(), openAPIDocResponses(rm, attrs, 3, true)),
+		"delete": vDelete,
+	}
+}
+
+// The query parameters, shared via "components/parameters"
+var openAPIParams = map[string]any{
+	"inline": map[string]any{
+		"name": "inline",
+		"in":   "query",
+		"description": "Comma separated list of the nested collections, " +
+			"or documents, to include. No value means all of them",
+		"schema": map[string]any{"type": "string"},
+	},
+	"filter": map[string]any{
+		"name":        "filter",
+		"in":          "query",
+		"description": "Only return entities that match: PATH[=VALUE],...",
+		"schema":      map[string]any{"type": "string"},
+	},
+	"sort": map[string]any{
+		"name":        "sort",
+		"in":          "query",
+		"description": "Sort the collection by: ATTRIBUTE[=asc|desc]",
+		"schema":      map[string]any{"type": "string"},
+	},
+	"limit": map[string]any{
+		"name": "limit",
+		"in":   "query",
+		"description": "The most entities to return, the \"next\" Link " +
+			"header has the URL of the next page",
+		"schema": map[string]any{"type": "integer", "minimum": 1},
+	},
+	"cursor": map[string]any{
+		"name": "cursor",
+		"in":   "query",
+		"description": "Where the previous page ended, only use the one " +
+			"in the \"next\" Link header's URL",
+		"schema": map[string]any{"type": "string"},
+	},
+	"dryrun": map[string]any{
+		"name": "dryrun",
+		"in":   "query",
+		"description": "Don't change the model, just report what would " +
+			"happen to the existing entities",
+		"allowEmptyValue": true,
+		"schema":          map[string]any{"type": "string"},
+	},
+	"model": map[string]any{
+		"name":            "model",
+		"in":              "query",
+		"description":     "Include the model in the response",
+		"allowEmptyValue": true,
+		"schema":          map[string]any{"type": "string"},
+	},
+	"schema": map[string]any{
+		"name": "schema",
+		"in":   "query",
+		"description": "The format of the model: " + XREGSCHEMA + ", " +
+			JSONSCHEMA + " or " + OPENAPI,
+		"schema": map[string]any{"type": "string"},
+	},
+	"nested": map[string]any{
+		"name":            "nested",
+		"in":              "query",
+		"description":     "Also process the nested collections in the body",
+		"allowEmptyValue": true,
+		"schema":          map[string]any{"type": "string"},
+	},
+	"epoch": map[string]any{
+		"name":        "epoch",
+		"in":          "query",
+		"description": "Only delete it if its epoch matches this value",
+		"schema":      map[string]any{"type": "integer", "minimum": 0},
+	},
+	"setdefaultversionid": map[string]any{
+		"name": "setdefaultversionid",
+		"in":   "query",
+		"description": "The ID of the version to make the default one, " +
+			"\"request\" means the one in the request",
+		"schema": map[string]any{"type": "string"},
+	},
+	"diff": map[string]any{
+		"name":        "diff",
+		"in":          "query",
+		"description": "The ID of the version to compare it to",
+		"schema":      map[string]any{"type": "string"},
+	},
+}
+
+func openAPIRef(kind string, name string) map[string]any {
+	return map[string]any{"$ref": "#/components/" + kind + "/" + name}
+}
+
+func openAPIParam(name string) map[string]any {
+	PanicIf(openAPIParams[name] == nil, "Unknown OpenAPI param: %s", name)
+	return openAPIRef("parameters", name)
+}
+
+func openAPIPathParam(name string) map[string]any {
+	return map[string]any{
+		"name":     name,
+		"in":       "path",
+		"required": true,
+		"schema":   map[string]any{"type": "string"},
+	}
+}
+
+// Turns a plural/singular name into something for an operationId
+func openAPIName(name string) string {
+	res := strings.Builder{}
+	upper := true
+	for _, ch := range name {
+		if ch == '_' || ch == '.' || ch == '/' {
+			upper = true
+			continue
+		}
+		if upper {
+			ch = []rune(strings.ToUpper(string(ch)))[0]
+			upper = false
+		}
+		res.WriteRune(ch)
+	}
+	return res.String()
+}
+
+func openAPIOp(id string, summary string, tag string, params []any,
+	body map[string]any, responses map[string]any) map[string]any {
+
+	op := map[string]any{
+		"operationId": id,
+		"summary":     summary,
+		"tags":        []string{tag},
+		"responses":   responses,
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = body
+	}
+	return op
+}
+
+func openAPIJSON(schema any) map[string]any {
+	return map[string]any{
+		"application/json": map[string]any{"schema": schema},
+	}
+}
+
+// Metadata (and the model) can be sent, and returned, as JSON or YAML
+func openAPIMeta(schema any) map[string]any {
+	return map[string]any{
+		"application/json": map[string]any{"schema": schema},
+		"application/yaml": map[string]any{"schema": schema},
+	}
+}
+
+func openAPIEntityBody(key string) map[string]any {
+	return map[string]any{
+		"content": openAPIMeta(openAPIRef("schemas", key)),
+	}
+}
+
+func openAPIPatchBody(key string) map[string]any {
+	return map[string]any{
+		"content": map[string]any{
+			"application/json": map[string]any{
+				"schema": openAPIRef("schemas", key),
+			},
+			"application/yaml": map[string]any{
+				"schema": openAPIRef("schemas", key),
+			},
+			"application/merge-patch+json": map[string]any{
+				"schema": map[string]any{"type": "object"},
+			},
+			"application/json-patch+json": map[string]any{
+				"schema": map[string]any{
+					"type":  "array",
+					"items": map[string]any{"type": "object"},
+				},
+			},
+		},
+	}
+}
+
+// The ?dryrun response of PUT /model, see ModelReport
+func openAPIModelReport() map[string]any {
+	paths := map[string]any{
+		"type":  "array",
+		"items": map[string]any{"type": "string"},
+	}
+	return map[string]any{
+		"type":     "object",
+		"required": []string{"dryrun", "checked"},
+		"properties": map[string]any{
+			"dryrun":   map[string]any{"type": "boolean"},
+			"checked":  map[string]any{"type": "integer", "minimum": 0},
+			"migrated": paths,
+			"invalid": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"path":  map[string]any{"type": "string"},
+						"error": map[string]any{"type": "string"},
+					},
+				},
+			},
+			"deleted": paths,
+		},
+	}
+}
+
+func openAPIEntityResponses(key string, canCreate bool) map[string]any {
+	res := map[string]any{
+		"200": map[string]any{
+			"description": "The entity",
+			"content":     openAPIMeta(openAPIRef("schemas", key)),
+		},
+		"default": openAPIRef("responses", "error"),
+	}
+	if canCreate {
+		res["201"] = map[string]any{
+			"description": "The new entity",
+			"headers": map[string]any{
+				"Location": map[string]any{
+					"schema": map[string]any{"type": "string", "format": "uri"},
+				},
+			},
+			"content": openAPIMeta(openAPIRef("schemas", key)),
+		}
+	}
+	return res
+}
+
+func openAPIDeleteResponses() map[string]any {
+	return map[string]any{
+		"204":     map[string]any{"description": "Deleted"},
+		"default": openAPIRef("responses", "error"),
+	}
+}
+
+// The GET, POST and DELETE of a collection of entities
+func openAPICollPaths(name string, singular string, tag string,
+	key string, params []any) map[string]any {
+
+	coll := map[string]any{
+		"type":                 "object",
+		"additionalProperties": openAPIRef("schemas", key),
+	}
+	paths := map[string]any{
+		"get": openAPIOp("get"+name, "Get the "+singular+" collection", tag,
+			[]any{openAPIParam("inline"), openAPIParam("filter"),
+				openAPIParam("sort"), openAPIParam("limit"),
+				openAPIParam("cursor")},
+			nil, map[string]any{
+				"200": map[string]any{
+					"description": "The " + singular + " collection",
+					"headers": map[string]any{
+						"Link": map[string]any{
+							"description": "When there are more " +
+								"entities: <URL>; rel=\"next\"",
+							"schema": map[string]any{"type": "string"},
+						},
+					},
+					"content": openAPIMeta(coll),
+				},
+				"default": openAPIRef("responses", "error"),
+			}),
+		"post": openAPIOp("post"+name, "Create or update "+singular+
+			" entities, keyed by their IDs", tag, nil,
+			map[string]any{"content": openAPIMeta(coll)},
+			map[string]any{
+				"200": map[string]any{
+					"description": "The entities created or updated",
+					"content":     openAPIMeta(coll),
+				},
+				"default": openAPIRef("responses", "error"),
+			}),
+		"delete": openAPIOp("delete"+name, "Delete "+singular+" entities, "+
+			"all of them if there's no body", tag, nil,
+			map[string]any{"content": openAPIJSON(map[string]any{
+				"type": "object",
+				"additionalProperties": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"epoch": map[string]any{
+							"type":    "integer",
+							"minimum": 0,
+						},
+					},
+				},
+			})}, openAPIDeleteResponses()),
+	}
+	if len(params) > 0 {
+		paths["parameters"] = params
+	}
+	return paths
+}
+
+func openAPIDocBody() map[string]any {
+	return map[string]any{
+		"content": map[string]any{
+			"*/*": map[string]any{"schema": map[string]any{}},
+		},
+	}
+}
+
+// Only scalar attributes are sent as headers, maps of scalars are sent as
+// one header per key
+func openAPIHeaderName(attr *Attribute) string {
+	if sp, ok := SpecProps[attr.Name]; ok && sp.internals.httpHeader != "" {
+		return sp.internals.httpHeader
+	}
+	return "xRegistry-" + attr.Name
+}
+
+func openAPIHeaderAttrs(rm *ResourceModel, attrs Attributes,
+	level int) []*Attribute {
+
+	res := []*Attribute{}
+	levelAttrs := LevelAttributes(attrs, level)
+	for _, name := range SortedKeys(levelAttrs) {
+		attr := levelAttrs[name]
+		// RESOURCEurl is only sent on a redirect
+		if name == "*" || name == rm.Singular || name == rm.Singular+"url" ||
+			name == rm.Singular+"base64" || name == rm.Singular+"proxyurl" {
+			continue
+		}
+		if IsScalar(attr.Type) || (attr.Type == MAP && attr.Item != nil &&
+			IsScalar(attr.Item.Type)) {
+			res = append(res, attr)
+		}
+	}
+	return res
+}
+
+// The writable attributes that can be passed as headers w/a document
+func openAPIDocHeaders(rm *ResourceModel, attrs Attributes) []any {
+	params := []any{}
+	for _, attr := range openAPIHeaderAttrs(rm, attrs, 3) {
+		if attr.ReadOnly || attr.Name == "contenttype" {
+			continue
+		}
+		schema := typeJSONSchema(attr.Type, attr.Item, attr.Attributes)
+		name := openAPIHeaderName(attr)
+		if attr.Type == MAP {
+			// Can't be expressed in OpenAPI so just document it
+			params = append(params, map[string]any{
+				"name": name,
+				"in":   "header",
+				"description": "Each \"" + attr.Name + "\" entry is in " +
+					"its own " + name + "-KEY header",
+				"schema": itemJSONSchema(attr.Item),
+			})
+			continue
+		}
+		params = append(params, map[string]any{
+			"name":   name,
+			"in":     "header",
+			"schema": schema,
+		})
+	}
+	return params
+}
+
+func openAPIDocResponses(rm *ResourceModel, attrs Attributes, level int,
+	canCreate bool) map[string]any {
+
+	headers := map[string]any{
+		"ETag": map[string]any{
+			"schema": map[string]any{"type": "string"},
+		},
+		"Content-Location": map[string]any{
+			"description": "The URL of the version",
+			"schema":      map[string]any{"type": "string", "format": "uri"},
+		},
+	}
+	for _, attr := range openAPIHeaderAttrs(rm, attrs, level) {
+		name := openAPIHeaderName(attr)
+		if attr.Type == MAP {
+			headers[name] = map[string]any{
+				"description": "Each \"" + attr.Name + "\" entry is in " +
+					"its own " + name + "-KEY header",
+				"schema": itemJSONSchema(attr.Item),
+			}
+			continue
+		}
+		headers[name] = map[string]any{
+			"schema": typeJSONSchema(attr.Type, attr.Item, attr.Attributes),
+		}
+	}
+	// The "contentdigest" attribute, in the RFC 3230 format
+	headers["Digest"] = map[string]any{
+		"description": "The document's SHA-256: sha-256=<base64>",
+		"schema":      map[string]any{"type": "string"},
+	}
+	if level == 2 {
+		headers["xRegistry-versionscount"] = map[string]any{
+			"schema": map[string]any{"type": "integer", "minimum": 0},
+		}
+		headers["xRegistry-versionsurl"] = map[string]any{
+			"schema": map[string]any{"type": "string", "format": "uri"},
+		}
+	}
+
+	res := map[string]any{
+		"200": map[string]any{
+			"description": "The document",
+			"headers":     headers,
+			"content": map[string]any{
+				"*/*": map[string]any{"schema": map[string]any{}},
+			},
+		},
+		"303": map[string]any{
+			"description": "The document is stored elsewhere",
+			"headers": map[string]any{
+				"Location": map[string]any{
+					"schema": map[string]any{"type": "string", "format": "uri"},
+				},
+				"xRegistry-" + rm.Singular + "url": map[string]any{
+					"schema": map[string]any{"type": "string", "format": "uri"},
+				},
+			},
+		},
+		"default": openAPIRef("responses", "error"),
+	}
+	if canCreate {
+		res["201"] = map[string]any{
+			"description": "The new document",
+			"headers":     headers,
+			"content": map[string]any{
+				"*/*": map[string]any{"schema": map[string]any{}},
+			},
+		}
+	}
+	return res
+}
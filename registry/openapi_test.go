@@ -0,0 +1,162 @@
+package registry
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestModel2OpenAPI(t *testing.T) {
+	m := &Model{
+		Groups: map[string]*GroupModel{
+			"dirs": {
+				Plural:   "dirs",
+				Singular: "dir",
+				Resources: map[string]*ResourceModel{
+					"files": {
+						Plural:   "files",
+						Singular: "file",
+						Attributes: Attributes{
+							"owner": {Name: "owner", Type: STRING},
+							"tags": {Name: "tags", Type: MAP,
+								Item: &Item{Type: INTEGER}},
+						},
+					},
+					"links": {
+						Plural:      "links",
+						Singular:    "link",
+						HasDocument: PtrBool(false),
+					},
+				},
+			},
+		},
+	}
+
+	buf, err := Model2OpenAPI(m, OPENAPI)
+	if err != nil {
+		t.Fatalf("Model2OpenAPI: %s", err)
+	}
+
+	doc := map[string]any{}
+	if err = json.Unmarshal(buf, &doc); err != nil {
+		t.Fatalf("Unmarshal: %s\n%s", err, buf)
+	}
+
+	// Every $ref must point to something, and operationIds must be unique
+	opIDs := map[string]bool{}
+	var walk func(val any, path string)
+	walk = func(val any, path string) {
+		switch v := val.(type) {
+		case map[string]any:
+			if ref, ok := v["$ref"].(string); ok {
+				var target any = doc
+				for _, key := range strings.Split(ref[2:], "/") {
+					obj, _ := target.(map[string]any)
+					target = obj[key]
+				}
+				if target == nil {
+					t.Errorf("%s: bad $ref %q", path, ref)
+				}
+			}
+			if id, ok := v["operationId"].(string); ok {
+				if opIDs[id] {
+					t.Errorf("%s: duplicate operationId %q", path, id)
+				}
+				opIDs[id] = true
+			}
+			for k, child := range v {
+				walk(child, path+"/"+k)
+			}
+		case []any:
+			for _, child := range v {
+				walk(child, path)
+			}
+		}
+	}
+	walk(doc, "")
+
+	paths := doc["paths"].(map[string]any)
+	for path, methods := range map[string]string{
+		"/":                                     "get,patch,put",
+		"/model":                                "get,put",
+		"/dirs":                                 "delete,get,post",
+		"/dirs/{dirid}":                         "delete,get,patch,put",
+		"/dirs/{dirid}/files":                   "delete,get,post",
+		"/dirs/{dirid}/files/{fileid}":          "delete,get,post,put",
+		"/dirs/{dirid}/files/{fileid}$meta":     "get,patch,post,put",
+		"/dirs/{dirid}/files/{fileid}/versions": "delete,get,post",
+		"/dirs/{dirid}/files/{fileid}/versions/{versionid}":      "delete,get,put",
+		"/dirs/{dirid}/files/{fileid}/versions/{versionid}$meta": "get,patch,put",
+		"/dirs/{dirid}/links/{linkid}":                           "delete,get,patch,post,put",
+		"/dirs/{dirid}/links/{linkid}/versions/{versionid}":      "delete,get,patch,put",
+	} {
+		ops, _ := paths[path].(map[string]any)
+		got := []string{}
+		for _, k := range SortedKeys(ops) {
+			if k != "parameters" {
+				got = append(got, k)
+			}
+		}
+		if strings.Join(got, ",") != methods {
+			t.Errorf("%s: got %v, expected %s", path, got, methods)
+		}
+	}
+	if len(paths) != 14 {
+		t.Errorf("Wrong number of paths: %v", SortedKeys(paths))
+	}
+
+	// The document's metadata is in headers
+	get := paths["/dirs/{dirid}/files/{fileid}"].(map[string]any)["get"]
+	headers := get.(map[string]any)["responses"].(map[string]any)["200"].(map[string]any)["headers"].(map[string]any)
+	for _, name := range []string{"Content-Type", "Digest", "ETag",
+		"Content-Location", "xRegistry-id", "xRegistry-epoch",
+		"xRegistry-owner", "xRegistry-tags", "xRegistry-labels",
+		"xRegistry-defaultversionid", "xRegistry-versionscount"} {
+		if headers[name] == nil {
+			t.Errorf("Missing header %q: %v", name, SortedKeys(headers))
+		}
+	}
+	for _, name := range []string{"xRegistry-file", "xRegistry-filebase64",
+		"xRegistry-fileurl",
+		"xRegistry-isdefault", "xRegistry-contenttype"} {
+		if headers[name] != nil {
+			t.Errorf("Extra header %q", name)
+		}
+	}
+
+	redirect := get.(map[string]any)["responses"].(map[string]any)["303"]
+	if redirect.(map[string]any)["headers"].(map[string]any)["xRegistry-fileurl"] == nil {
+		t.Errorf("Missing xRegistry-fileurl on the redirect")
+	}
+
+	// Paging, YAML and ?dryrun
+	getColl := paths["/dirs/{dirid}/files"].(map[string]any)["get"].(map[string]any)
+	params := ToJSON(getColl["parameters"])
+	for _, name := range []string{"limit", "cursor"} {
+		if !strings.Contains(params, "#/components/parameters/"+name) {
+			t.Errorf("Missing %q param: %s", name, params)
+		}
+	}
+	res200 := getColl["responses"].(map[string]any)["200"].(map[string]any)
+	if res200["headers"].(map[string]any)["Link"] == nil {
+		t.Errorf("Missing the Link header: %s", ToJSON(res200))
+	}
+	if res200["content"].(map[string]any)["application/yaml"] == nil {
+		t.Errorf("Missing the YAML response: %s", ToJSON(res200))
+	}
+
+	putDir := paths["/dirs/{dirid}"].(map[string]any)["put"].(map[string]any)
+	if putDir["requestBody"].(map[string]any)["content"].(map[string]any)["application/yaml"] == nil {
+		t.Errorf("Missing the YAML body: %s", ToJSON(putDir))
+	}
+
+	putModel := paths["/model"].(map[string]any)["put"].(map[string]any)
+	if !strings.Contains(ToJSON(putModel["parameters"]),
+		"#/components/parameters/dryrun") {
+		t.Errorf("Missing the dryrun param: %s", ToJSON(putModel))
+	}
+
+	if GetModelSerializer("openapi") == nil {
+		t.Errorf("Missing the OpenAPI serializer")
+	}
+}
@@ -0,0 +1,183 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Where the previous page of a collection stopped. It's handed out to the
+// client as an opaque (base64) string in the "next" Link header's URL.
+// When there's no "?sort" the entities are in Path order so Path is all we
+// need (and GenerateQuery can do the skipping). When sorted, the sort value
+// of the last entity is needed too and the skipping is done after sorting.
+type pageCursor struct {
+	Path  string  `json:"p"`
+	Value *string `json:"v,omitempty"`
+	Sort  string  `json:"s,omitempty"`
+	Desc  bool    `json:"d,omitempty"`
+}
+
+func (pc *pageCursor) String() string {
+	buf, _ := json.Marshal(pc)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func parsePageCursor(str string) (*pageCursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid cursor: %s", str)
+	}
+	pc := &pageCursor{}
+	if err = json.Unmarshal(buf, pc); err != nil {
+		return nil, fmt.Errorf("Invalid cursor: %s", str)
+	}
+	return pc, nil
+}
+
+// The Path that GenerateQuery should start after, if any
+func (info *RequestInfo) CursorPath() string {
+	if info.Cursor == nil || info.Cursor.Sort != "" {
+		return ""
+	}
+	return info.Cursor.Path
+}
+
+// How many entities GenerateQuery should return, 0 means all of them.
+// One more than the page size so we know if there's a next page. When
+// sorted we need all of them since the sorting isn't done in SQL.
+func (info *RequestInfo) QueryLimit() int {
+	if info.Limit == 0 || info.SortKey != "" {
+		return 0
+	}
+	return info.Limit + 1
+}
+
+func (info *RequestInfo) ParsePaging() error {
+	query := info.OriginalRequest.URL.Query()
+
+	// Paging only makes sense for collections
+	if info.What != "Coll" {
+		return nil
+	}
+
+	// ?limit=N
+	if query.Has("limit") {
+		limitQ := strings.TrimSpace(query.Get("limit"))
+		limit, err := strconv.Atoi(limitQ)
+		if err != nil || limit <= 0 {
+			return fmt.Errorf("Invalid 'limit' value: %q, must be a "+
+				"positive integer", limitQ)
+		}
+		info.Limit = limit
+	}
+
+	// ?cursor=xxx  (from a previous page's Link header)
+	if query.Has("cursor") {
+		pc, err := parsePageCursor(query.Get("cursor"))
+		if err != nil {
+			return err
+		}
+		if pc.Sort != info.SortKey || pc.Desc != info.SortDesc {
+			return fmt.Errorf("The 'cursor' value doesn't match the " +
+				"'sort' value used to create it")
+		}
+		info.Cursor = pc
+	}
+
+	return nil
+}
+
+// One top-level entity (and its children) in a query's result set
+type pageBlock struct {
+	rows     [][]*any
+	path     string
+	abstract string
+	value    *string
+}
+
+// PageResults removes any entities that were on a previous page (when
+// sorted, otherwise GenerateQuery already skipped them) and, if there are
+// more than "?limit" entities left, adds the Link header for the next page.
+// The JsonWriter is in charge of stopping after "limit" entities.
+func PageResults(info *RequestInfo, results *Result) {
+	if info.What != "Coll" || (info.Limit == 0 && info.Cursor == nil) {
+		return
+	}
+	if results == nil || len(results.AllRows) == 0 {
+		return
+	}
+
+	propName := ""
+	pp := (*PropPath)(nil)
+	if info.SortKey != "" {
+		pp = MustPropPathFromUI(info.SortKey)
+		propName = pp.DB()
+	}
+
+	// RegSID,Level,Plural,eSID,UID,PropName,PropValue,PropType,Path,Abstract
+	//   0     1      2     3    4     5         6         7     8      9
+	topLevel := int((*results.AllRows[0][1]).(int64))
+	blocks := []*pageBlock{}
+	block := (*pageBlock)(nil)
+	for _, row := range results.AllRows {
+		level := int((*row[1]).(int64))
+		path := NotNilString(row[8])
+		if level == topLevel && (block == nil || block.path != path) {
+			block = &pageBlock{
+				path:     path,
+				abstract: NotNilString(row[9]),
+			}
+			blocks = append(blocks, block)
+		}
+		block.rows = append(block.rows, row)
+		if level == topLevel && propName != "" &&
+			NotNilString(row[5]) == propName {
+			val := NotNilString(row[6])
+			block.value = &val
+		}
+	}
+
+	// Skip everything up to, and including, the cursor's position
+	if pc := info.Cursor; pc != nil && pc.Sort != "" {
+		daType := info.Registry.Model.GetPropType(blocks[0].abstract, pp)
+		for len(blocks) > 0 {
+			b := blocks[0]
+			if sortLess(daType, pc.Value, b.value, pc.Desc) ||
+				(!sortLess(daType, b.value, pc.Value, pc.Desc) &&
+					b.path > pc.Path) {
+				break
+			}
+			blocks = blocks[1:]
+		}
+
+		results.AllRows = nil
+		for _, b := range blocks {
+			results.AllRows = append(results.AllRows, b.rows...)
+		}
+	}
+
+	if info.Limit == 0 || len(blocks) <= info.Limit {
+		return
+	}
+
+	last := blocks[info.Limit-1]
+	next := &pageCursor{Path: last.path}
+	if info.SortKey != "" {
+		next.Value = last.value
+		next.Sort = info.SortKey
+		next.Desc = info.SortDesc
+	}
+
+	query := info.OriginalRequest.URL.Query()
+	query.Set("cursor", next.String())
+	u := url.URL{
+		Path:     "/" + info.OriginalPath,
+		RawQuery: query.Encode(),
+	}
+	info.AddHeader("Link", fmt.Sprintf("<%s%s>; rel=\"next\"",
+		info.BaseURL, u.String()))
+}
@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateQueryPage(t *testing.T) {
+	useDBDriver(t, "memory")
+
+	name := "TestGenerateQueryPage"
+	if err := CreateDB(name); err != nil {
+		t.Fatalf("CreateDB: %s", err)
+	}
+	defer DeleteDB(name)
+	if err := OpenDB(name); err != nil {
+		t.Fatalf("OpenDB: %s", err)
+	}
+
+	reg, err := NewRegistry(nil, "reg1")
+	if err != nil {
+		t.Fatalf("NewRegistry: %s", err)
+	}
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+
+	// "_" is a LIKE wildcard so "a_b/%" would match "axb/..." too
+	for _, id := range []string{"a_b", "axb", "ay", "az"} {
+		d, err := reg.AddGroup("dirs", id)
+		if err != nil {
+			t.Fatalf("AddGroup: %s", err)
+		}
+		if _, err = d.AddResource("files", "f1", "v1"); err != nil {
+			t.Fatalf("AddResource: %s", err)
+		}
+	}
+	reg.Commit()
+
+	getPaths := func(after string, limit int) string {
+		t.Helper()
+		query, args, err := GenerateQuery(reg, "Coll", []string{"dirs"},
+			nil, after, limit)
+		if err != nil {
+			t.Fatalf("GenerateQuery: %s", err)
+		}
+		results, err := Query(reg.tx, query, args...)
+		if err != nil {
+			t.Fatalf("Query: %s", err)
+		}
+		defer results.Close()
+
+		paths := []string{}
+		for {
+			e, err := readNextEntity(reg.tx, results)
+			if err != nil {
+				t.Fatalf("readNextEntity: %s", err)
+			}
+			if e == nil {
+				break
+			}
+			// Just the groups, and one resource to check the children
+			if e.Level == 1 || e.Path == "dirs/axb/files/f1" {
+				paths = append(paths, e.Path)
+			}
+		}
+		return strings.Join(paths, ",")
+	}
+
+	for _, test := range []struct {
+		after  string
+		limit  int
+		result string
+	}{
+		{"", 0, "dirs/a_b,dirs/axb,dirs/axb/files/f1,dirs/ay,dirs/az"},
+		{"", 2, "dirs/a_b,dirs/axb,dirs/axb/files/f1"},
+		{"dirs/a_b", 0, "dirs/axb,dirs/axb/files/f1,dirs/ay,dirs/az"},
+		{"dirs/a_b", 2, "dirs/axb,dirs/axb/files/f1,dirs/ay"},
+		{"dirs/ay", 5, "dirs/az"},
+	} {
+		if got := getPaths(test.after, test.limit); got != test.result {
+			t.Errorf("after %q limit %d:\nExp: %s\nGot: %s", test.after,
+				test.limit, test.result, got)
+		}
+	}
+}
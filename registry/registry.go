@@ -2,10 +2,12 @@ package registry
 
 import (
 	"fmt"
-	"io"
-	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/duglin/dlog"
 )
@@ -95,6 +97,7 @@ func NewRegistry(tx *Tx, id string, regOpts ...RegOpt) (*Registry, error) {
 
 	tx.Registry = reg
 	reg.tx = tx
+	tx.AddEvent(EVENT_CREATED, &reg.Entity)
 
 	err = reg.Model.Verify()
 	if err != nil {
@@ -175,7 +178,74 @@ func (reg *Registry) Delete() error {
 	log.VPrintf(3, ">Enter: Reg.Delete(%s)", reg.UID)
 	defer log.VPrintf(3, "<Exit: Reg.Delete")
 
-	return DoOne(reg.tx, `DELETE FROM Registries WHERE SID=?`, reg.DbSID)
+	if err := reg.tx.checkBlobs(&reg.Entity); err != nil {
+		return err
+	}
+
+	if err := DoOne(reg.tx, `DELETE FROM Registries WHERE SID=?`, reg.DbSID); err != nil {
+		return err
+	}
+	reg.tx.AddEvent(EVENT_DELETED, &reg.Entity)
+	return nil
+}
+
+// A read-only Registry rejects all writes that come in via HTTP. The
+// internal APIs can still be used to modify it.
+func (reg *Registry) IsReadOnly() (bool, error) {
+	results, err := Query(reg.tx, `SELECT ReadOnly FROM Registries WHERE SID=?`,
+		reg.DbSID)
+	defer results.Close()
+
+	if err != nil {
+		return false, fmt.Errorf("Error checking Registry %q: %s", reg.UID, err)
+	}
+
+	row := results.NextRow()
+	if row == nil {
+		return false, nil
+	}
+	return NotNilBoolDef(row[0], false), nil
+}
+
+func (reg *Registry) SetReadOnly(val bool) error {
+	readOnly := 0
+	if val {
+		readOnly = 1
+	}
+	return Do(reg.tx, `UPDATE Registries SET ReadOnly=? WHERE SID=?`,
+		readOnly, reg.DbSID)
+}
+
+// The URL of the xRegistry that this Registry mirrors, "" if it's not a
+// mirror. See mirror.go.
+func (reg *Registry) GetMirror() (string, error) {
+	results, err := Query(reg.tx, `SELECT Mirror FROM Registries WHERE SID=?`,
+		reg.DbSID)
+	defer results.Close()
+
+	if err != nil {
+		return "", fmt.Errorf("Error checking Registry %q: %s", reg.UID, err)
+	}
+
+	row := results.NextRow()
+	if row == nil {
+		return "", nil
+	}
+	return NotNilString(row[0]), nil
+}
+
+func (reg *Registry) SetMirror(upstream string) error {
+	upstream = strings.TrimRight(upstream, "/")
+	if upstream != "" {
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.Host == "" {
+			return fmt.Errorf("Invalid mirror URL (%s), must be an absolute "+
+				"http(s) URL", upstream)
+		}
+	}
+	return Do(reg.tx, `UPDATE Registries SET Mirror=? WHERE SID=?`,
+		upstream, reg.DbSID)
 }
 
 func FindRegistryBySID(tx *Tx, sid string) (*Registry, error) {
@@ -294,16 +364,7 @@ func (reg *Registry) LoadModelFromFile(file string) error {
 	var err error
 	buf := []byte{}
 	if strings.HasPrefix(file, "http") {
-		res, err := http.Get(file)
-		if err == nil {
-			buf, err = io.ReadAll(res.Body)
-			res.Body.Close()
-
-			if res.StatusCode/100 != 2 {
-				err = fmt.Errorf("Error getting model: %s\n%s",
-					res.Status, string(buf))
-			}
-		}
+		buf, err = FetchURL(file)
 	} else {
 		buf, err = os.ReadFile(file)
 	}
@@ -444,6 +505,23 @@ func (reg *Registry) UpsertGroupWithObject(gType string, id string, obj Object,
 			id, gType)
 	}
 
+	if g != nil && obj != nil {
+		if err = g.CheckMirrored(); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// "locked" isn't stored w/the Group's attributes, and leaving it out
+	// of a PUT doesn't unlock it, see Group.SetLocked()
+	locked, setLocked := obj["locked"]
+	if setLocked {
+		if _, ok := locked.(bool); !ok {
+			return nil, false, fmt.Errorf("Attribute \"locked\" must be " +
+				"a boolean")
+		}
+		delete(obj, "locked")
+	}
+
 	isNew := (g == nil)
 	if g == nil {
 		// Not found, so create a new one
@@ -476,6 +554,7 @@ func (reg *Registry) UpsertGroupWithObject(gType string, id string, obj Object,
 			log.Print(err)
 			return nil, false, err
 		}
+		reg.tx.AddEvent(EVENT_CREATED, &g.Entity)
 
 		// Use the ID passed as an arg, not from the metadata, as the true
 		// ID. If the one in the metadata differs we'll flag it down below
@@ -503,6 +582,12 @@ func (reg *Registry) UpsertGroupWithObject(gType string, id string, obj Object,
 		}
 	}
 
+	if setLocked {
+		if err = g.SetLocked(locked.(bool)); err != nil {
+			return nil, false, err
+		}
+	}
+
 	if doChildren {
 		colls := g.GetCollections()
 		for _, coll := range colls {
@@ -538,34 +623,155 @@ func (reg *Registry) UpsertGroupWithObject(gType string, id string, obj Object,
 	return g, isNew, nil
 }
 
-func GenerateQuery(reg *Registry, what string, paths []string, filters [][]*FilterExpr) (string, []interface{}, error) {
-	query := ""
-	args := []any{}
+// String filters ignore case, but only for A-Z like the DB's LOWER() and
+// NOCASE do. filterCheck and FilterExpr.Matches must agree on this.
+func filterFold(str string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, str)
+}
 
-	args = []interface{}{reg.DbSID}
-	query = `
-SELECT
-  RegSID,Level,Plural,eSID,UID,PropName,PropValue,PropType,Path,Abstract
-FROM FullTree WHERE RegSID=?`
+// Returns the SQL (and args) needed to check a filter's value against
+// PropValue. For "!=" this is the same as "=" since the caller will
+// negate the results
+// Escapes the LIKE special chars in "str", for use w/ESCAPE '!'
+func likeEscape(str string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(str)
+}
 
-	// Remove entities that are higher than the GET PATH specified
-	if what != "Registry" && len(paths) > 0 {
-		query += "\nAND ("
-		for i, p := range paths {
-			if i > 0 {
-				query += " OR "
+func filterCheck(filter *FilterExpr) (string, []any) {
+	if !filter.HasEqual {
+		return "PropValue IS NOT NULL", nil
+	}
+
+	op := filter.Operator
+	if op == "!=" {
+		op = "="
+	}
+
+	switch filter.Type {
+	case DECIMAL:
+		val, _ := strconv.ParseFloat(filter.Value, 64)
+		return "PropType IN ('" + INTEGER + "','" + UINTEGER + "','" +
+			DECIMAL + "') AND PropValue+0" + op + "?", []any{val}
+	case TIMESTAMP:
+		driver := GetDBDriver()
+		return driver.Timestamp("PropValue") + op + driver.Timestamp("?"),
+			[]any{filter.Value}
+	}
+
+	if filter.Wildcard {
+		// Escape the LIKE special chars, then "*" becomes "%"
+		val := strings.ReplaceAll(likeEscape(filter.Value), "*", "%")
+		return "LOWER(PropValue) LIKE LOWER(?) ESCAPE '!'", []any{val}
+	}
+
+	return "PropValue" + op + "?", []any{filter.Value}
+}
+
+// Matches is the in-memory version of filterCheck, for when we already have
+// the entity's properties rather than needing to search the DB for them.
+// "obj" is the Object of the entity at the filter's Abstract level.
+func (filter *FilterExpr) Matches(obj map[string]any) bool {
+	val, found, _ := ObjectGetProp(obj, MustPropPathFromDB(filter.PropName))
+	found = found && !IsNil(val)
+
+	if filter.Absent {
+		return !found
+	}
+	if filter.Operator == "!=" {
+		tmp := *filter
+		tmp.Operator = "="
+		return !tmp.Matches(obj)
+	}
+	if !found {
+		return false
+	}
+	if !filter.HasEqual {
+		return true
+	}
+
+	// -1, 0, 1 just like strings.Compare
+	cmp := 0
+	switch filter.Type {
+	case DECIMAL:
+		num := 0.0
+		switch v := val.(type) {
+		case int:
+			num = float64(v)
+		case int64:
+			num = float64(v)
+		case float64:
+			num = v
+		default:
+			return false
+		}
+		fVal, _ := strconv.ParseFloat(filter.Value, 64)
+		if num < fVal {
+			cmp = -1
+		} else if num > fVal {
+			cmp = 1
+		}
+	case TIMESTAMP:
+		str, _ := val.(string)
+		ts, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return false
+		}
+		fTS, _ := time.Parse(time.RFC3339Nano, filter.Value)
+		if ts.Before(fTS) {
+			cmp = -1
+		} else if ts.After(fTS) {
+			cmp = 1
+		}
+	default:
+		switch val.(type) {
+		case map[string]any, []any:
+			return false
+		}
+		str := filterFold(fmt.Sprintf("%v", val))
+		if filter.Wildcard {
+			parts := strings.Split(filterFold(filter.Value), "*")
+			for i, part := range parts {
+				parts[i] = regexp.QuoteMeta(part)
 			}
-			query += "Path=? OR Path LIKE ?"
-			args = append(args, p, p+"/%")
+			re := regexp.MustCompile("(?s)^" + strings.Join(parts, ".*") + "$")
+			return re.MatchString(str)
 		}
-		query += ")"
+		cmp = strings.Compare(str, filterFold(filter.Value))
+	}
+
+	switch filter.Operator {
+	case "=":
+		return cmp == 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
 
-	}
+// "after", if not empty, is the Path of the last entity on the previous page,
+// so skip it (and its children) and everything before it. If "limit" isn't
+// zero then only that many entities of the collection (and their children)
+// are returned.
+func GenerateQuery(reg *Registry, what string, paths []string, filters [][]*FilterExpr, after string, limit int) (string, []interface{}, error) {
+	query := ""
+	args := []any{}
 
+	// The filters are done first since they're needed for "limit" too
+	filterSQL := ""
+	filterArgs := []any{}
 	if len(filters) != 0 {
-		query += `
-AND
-(
+		filterSQL = `
 eSID IN ( -- eSID from query
   WITH RECURSIVE cte(eSID,ParentSID,Path) AS (
     SELECT eSID,ParentSID,Path FROM Entities
@@ -573,11 +779,11 @@ eSID IN ( -- eSID from query
 		firstOr := true
 		for _, OrFilters := range filters {
 			if !firstOr {
-				query += `
+				filterSQL += `
       UNION -- Adding another OR`
 			}
 			firstOr = false
-			query += `
+			filterSQL += `
       -- start of one Filter AND grouping (expre1 AND expr2)
       -- below find SIDs of interest (then find their leaves)
       SELECT list.eSID FROM (
@@ -589,49 +795,116 @@ eSID IN ( -- eSID from query
 			for _, filter := range OrFilters { // AndFilters
 				andCount++
 				if !firstAnd {
-					query += `
+					filterSQL += `
           UNION ALL`
 				}
 				firstAnd = false
-				check := ""
-				args = append(args, reg.DbSID, filter.Path)
-				if filter.HasEqual {
-					args = append(args, filter.Value)
-					check = "PropValue=?"
-				} else {
-					check = "PropValue IS NOT NULL"
+				check, checkArgs := filterCheck(filter)
+
+				// "!=" and "absent" are done by finding the entities that
+				// do match and then choosing all of the others
+				negate := filter.Absent || filter.Operator == "!="
+				cols := "eSID,Path"
+				if negate {
+					cols = "eSID"
+					filterSQL += `
+          SELECT eSID,Path FROM Entities
+          WHERE RegSID=? AND Abstract=? AND eSID NOT IN (`
+					filterArgs = append(filterArgs, reg.DbSID, filter.Abstract)
 				}
-				// BINARY means case-sensitive for that operand
-				query += `
-          SELECT eSID,Path FROM FullTree
+
+				// Abstract+PropName must be compared case-sensitively
+				filterSQL += `
+          SELECT ` + cols + ` FROM FullTree
           WHERE
             RegSID=? AND
-            (BINARY CONCAT(IF(Abstract<>'',CONCAT(Abstract,'` + string(DB_IN) + `'),''),PropName)=? AND
+            (` + GetDBDriver().CaseSensitive(`CONCAT(CASE WHEN Abstract<>'' THEN CONCAT(Abstract,'`+string(DB_IN)+`') ELSE '' END,PropName)`) + `=? AND
                ` + check + `)`
+				filterArgs = append(filterArgs, reg.DbSID, filter.Path)
+				filterArgs = append(filterArgs, checkArgs...)
+
+				if negate {
+					filterSQL += `
+          )`
+				}
 			} // end of AndFilter
-			query += `
+			filterSQL += `
           -- end of expr1
         ) AS res ON ( res.eSID=e1.eSID )
         JOIN Entities AS e2 ON (
           (e2.Path=res.Path OR e2.Path LIKE
-             CONCAT(IF(res.Path<>'',CONCAT(res.Path,'/'),''),'%'))
+             CONCAT(CASE WHEN res.Path<>'' THEN CONCAT(res.Path,'/') ELSE '' END,'%'))
           AND e2.eSID IN (SELECT * from Leaves)
         ) GROUP BY e2.eSID
         -- end of RIGHT JOIN
       ) as list
       WHERE list.cnt=?
       -- end of one Filter AND grouping (expr1 AND expr2 ...)`
-			args = append(args, andCount)
+			filterArgs = append(filterArgs, andCount)
 		} // end of OrFilter
 
-		query += `
+		filterSQL += `
     ) -- end of all OR Filter groupings
     UNION ALL SELECT e.eSID,e.ParentSID,e.Path FROM Entities AS e
     INNER JOIN cte ON e.eSID=cte.ParentSID)
-  SELECT DISTINCT eSID FROM cte )
-)
-ORDER BY Path ;
-`
+  SELECT DISTINCT eSID FROM cte )`
+	}
+
+	args = []interface{}{reg.DbSID}
+	query = `
+SELECT
+  RegSID,Level,Plural,eSID,UID,PropName,PropValue,PropType,Path,Abstract
+FROM FullTree WHERE RegSID=?`
+
+	// Remove entities that are higher than the GET PATH specified
+	if what != "Registry" && len(paths) > 0 {
+		query += "\nAND ("
+		for i, p := range paths {
+			if i > 0 {
+				query += " OR "
+			}
+			query += "Path=? OR Path LIKE ?"
+			args = append(args, p, p+"/%")
+		}
+		query += ")"
+
+	}
+
+	if after != "" {
+		query += "\nAND Path>? AND Path NOT LIKE ? ESCAPE '!'"
+		args = append(args, after, likeEscape(after)+"/%")
+	}
+
+	// Just the first "limit" entities in the collection, and their children
+	if limit > 0 && what == "Coll" && len(paths) == 1 {
+		coll := paths[0]
+		query += `
+AND EXISTS (
+  SELECT 1 FROM (
+    SELECT Path FROM Entities
+    WHERE RegSID=? AND Level=? AND Path LIKE ? ESCAPE '!'`
+		args = append(args, reg.DbSID, (strings.Count(coll, "/")+2)/2,
+			likeEscape(coll)+"/%")
+		if after != "" {
+			query += " AND Path>?"
+			args = append(args, after)
+		}
+		if filterSQL != "" {
+			query += " AND " + filterSQL
+			args = append(args, filterArgs...)
+		}
+		query += `
+    ORDER BY Path LIMIT ?
+  ) AS page
+  WHERE FullTree.Path=page.Path OR FullTree.Path LIKE CONCAT(REPLACE(REPLACE(
+    REPLACE(page.Path,'!','!!'),'%','!%'),'_','!_'),'/%') ESCAPE '!'
+)`
+		args = append(args, limit)
+	}
+
+	if filterSQL != "" {
+		query += "\nAND (" + filterSQL + "\n)\nORDER BY Path ;\n"
+		args = append(args, filterArgs...)
 	}
 
 	log.VPrintf(3, "Query:\n%s\n\n", SubQuery(query, args))
@@ -141,6 +141,10 @@ func (r *Resource) SetDefaultID(vID string) error {
 // Only call this if you want things to be sticky (when not nil).
 // Creating a new version should do this directly
 func (r *Resource) SetDefault(newDefault *Version) error {
+	if err := r.CheckWritable(); err != nil {
+		return err
+	}
+
 	// already set
 	if newDefault != nil && r.Get("defaultversionid") == newDefault.UID {
 		// But make sure we're sticky, could just be a coincidence
@@ -186,6 +190,10 @@ func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddTyp
 	var v *Version
 	var err error
 
+	if err = r.CheckWritable(); err != nil {
+		return nil, false, err
+	}
+
 	if id == "" {
 		// No versionID provided so grab the next available one
 		tmp := r.Get("#nextversionid")
@@ -257,6 +265,7 @@ func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddTyp
 		}
 
 		v.tx.AddVersion(v)
+		v.tx.AddEvent(EVENT_CREATED, &v.Entity)
 
 		if err = v.JustSet("id", id); err != nil {
 			return nil, false, err
@@ -288,6 +297,16 @@ func (r *Resource) UpsertVersionWithObject(id string, obj Object, addType AddTyp
 				}
 			}
 		}
+
+		if err = v.ValidateContent(); err != nil {
+			return nil, false, err
+		}
+
+		if isNew {
+			if err = v.CheckCompatibility(); err != nil {
+				return nil, false, err
+			}
+		}
 	}
 
 	if err = v.ValidateAndSave(); err != nil {
@@ -371,6 +390,15 @@ func (r *Resource) EnsureMaxVersions() error {
 			if err != nil {
 				return fmt.Errorf("Error deleting Version %q: %s", vIDs[0], err)
 			}
+			r.tx.AddEvent(EVENT_DELETED, &Entity{
+				tx:       r.tx,
+				Registry: r.Registry,
+				Plural:   "versions",
+				UID:      vIDs[0],
+				Level:    3,
+				Path:     r.Path + "/versions/" + vIDs[0],
+				Abstract: r.Abstract + string(DB_IN) + "versions",
+			})
 			count--
 		}
 		vIDs = vIDs[1:]
@@ -382,7 +410,33 @@ func (r *Resource) Delete() error {
 	log.VPrintf(3, ">Enter: Resource.Delete(%s)", r.UID)
 	defer log.VPrintf(3, "<Exit: Resource.Delete")
 
-	return DoOne(r.tx, `DELETE FROM Resources WHERE SID=?`, r.DbSID)
+	if err := r.CheckWritable(); err != nil {
+		return err
+	}
+
+	if err := r.tx.checkBlobs(&r.Entity); err != nil {
+		return err
+	}
+
+	if err := DoOne(r.tx, `DELETE FROM Resources WHERE SID=?`, r.DbSID); err != nil {
+		return err
+	}
+	r.tx.AddEvent(EVENT_DELETED, &r.Entity)
+	return nil
+}
+
+// End-users can't change Resources whose model is "readonly", or that are
+// in a mirrored Group, and no one can change the Resources in a locked Group
+func (r *Resource) CheckWritable() error {
+	rm := r.Registry.Model.Groups[r.Group.Plural].Resources[r.Plural]
+	if rm != nil && rm.ReadOnly && r.tx.EnforceReadOnly {
+		return fmt.Errorf("Write operations to read-only resources are not " +
+			"allowed")
+	}
+	if err := r.Group.CheckMirrored(); err != nil {
+		return err
+	}
+	return r.Group.CheckLocked()
 }
 
 func (r *Resource) GetVersions() ([]*Version, error) {
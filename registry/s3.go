@@ -0,0 +1,304 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The hex SHA-256 of an empty payload
+const EMPTY_SHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// The payload hash to use when it's not known up front
+const UNSIGNED_PAYLOAD = "UNSIGNED-PAYLOAD"
+
+// Used when an S3BlobStore doesn't have its own Client. Documents are
+// streamed thru it so it's more generous than MirrorClient.
+var S3Client = &http.Client{Timeout: 10 * time.Minute}
+
+// S3BlobStore saves blobs in an S3 (compatible) bucket, using path-style
+// URLs (ENDPOINT/BUCKET/PREFIX/DIGEST) so it works w/local stand-ins too.
+// If there's no AccessKey then the requests aren't signed.
+type S3BlobStore struct {
+	Endpoint  string // e.g. https://s3.us-east-1.amazonaws.com
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func init() {
+	RegisterBlobStoreFactory("s3", NewS3BlobStoreFromURL)
+}
+
+// s3://BUCKET[/PREFIX][?endpoint=URL&region=REGION]
+// The credentials come from $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY,
+// and the region defaults to $AWS_REGION or "us-east-1"
+func NewS3BlobStoreFromURL(u *url.URL) (BlobStore, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("Missing the bucket name in %q", u.String())
+	}
+
+	store := &S3BlobStore{
+		Endpoint:  u.Query().Get("endpoint"),
+		Bucket:    u.Host,
+		Prefix:    strings.Trim(u.Path, "/"),
+		Region:    u.Query().Get("region"),
+		AccessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if store.Region == "" {
+		store.Region = os.Getenv("AWS_REGION")
+	}
+	if store.Region == "" {
+		store.Region = "us-east-1"
+	}
+	if store.Endpoint == "" {
+		store.Endpoint = "https://s3." + store.Region + ".amazonaws.com"
+	}
+	return store, nil
+}
+
+func (s3 *S3BlobStore) Name() string {
+	return "s3"
+}
+
+// "/BUCKET/PREFIX/DIGEST"
+func (s3 *S3BlobStore) objectPath(digest string) string {
+	key := digest
+	if s3.Prefix != "" {
+		key = s3.Prefix + "/" + digest
+	}
+	return "/" + s3.Bucket + "/" + key
+}
+
+func (s3 *S3BlobStore) objectURL(digest string) string {
+	return strings.TrimRight(s3.Endpoint, "/") + s3.objectPath(digest)
+}
+
+func (s3 *S3BlobStore) do(method string, digest string, body io.Reader,
+	size int64, payloadHash string, headers ...string) (*http.Response, error) {
+
+	req, err := http.NewRequest(method, s3.objectURL(digest), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	if s3.AccessKey != "" {
+		SignS3Request(req, payloadHash, s3.Region, s3.AccessKey,
+			s3.SecretKey, time.Now())
+	}
+
+	client := s3.Client
+	if client == nil {
+		client = S3Client
+	}
+	return client.Do(req)
+}
+
+func s3Error(method string, digest string, res *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	err := fmt.Errorf("S3 %s of blob %q failed: %s %s", method, digest,
+		res.Status, strings.TrimSpace(string(msg)))
+	if res.StatusCode == http.StatusNotFound {
+		err = fmt.Errorf("%w: %s", os.ErrNotExist, err)
+	}
+	return err
+}
+
+func (s3 *S3BlobStore) Put(digest string, size int64, r io.Reader) error {
+	// Skip the upload if it's already there
+	res, err := s3.do("HEAD", digest, nil, 0, EMPTY_SHA256)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	// S3 needs the length up front
+	if size < 0 {
+		buf, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		r, size = bytes.NewReader(buf), int64(len(buf))
+	}
+
+	// The digest is the SHA-256 of the contents, so S3 will verify it.
+	// Temporary keys (see StageBlob) are checked once they're renamed.
+	payloadHash := digest
+	if sum, err := hex.DecodeString(digest); err != nil ||
+		len(sum) != sha256.Size {
+		payloadHash = UNSIGNED_PAYLOAD
+	}
+	res, err = s3.do("PUT", digest, r, size, payloadHash)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return s3Error("PUT", digest, res)
+	}
+	return nil
+}
+
+func (s3 *S3BlobStore) Get(digest string) (io.ReadCloser, error) {
+	res, err := s3.do("GET", digest, nil, 0, EMPTY_SHA256)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		return nil, s3Error("GET", digest, res)
+	}
+	return res.Body, nil
+}
+
+func (s3 *S3BlobStore) Delete(digest string) error {
+	res, err := s3.do("DELETE", digest, nil, 0, EMPTY_SHA256)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 && res.StatusCode != http.StatusNotFound {
+		return s3Error("DELETE", digest, res)
+	}
+	return nil
+}
+
+// S3 can't rename objects so it's a copy and then a delete
+func (s3 *S3BlobStore) Rename(from string, to string) error {
+	res, err := s3.do("HEAD", to, nil, 0, EMPTY_SHA256)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		res, err = s3.do("PUT", to, nil, 0, EMPTY_SHA256,
+			"x-amz-copy-source", s3.objectPath(from))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode/100 != 2 {
+			return s3Error("copy", to, res)
+		}
+	}
+	return s3.Delete(from)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Escape per the SigV4 rules: everything but A-Z a-z 0-9 - _ . ~ (and "/"
+// when "path" is true)
+func s3Escape(str string, path bool) string {
+	res := strings.Builder{}
+	for _, b := range []byte(str) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') ||
+			(b >= '0' && b <= '9') || strings.IndexByte("-_.~", b) >= 0 ||
+			(path && b == '/') {
+			res.WriteByte(b)
+		} else {
+			fmt.Fprintf(&res, "%%%02X", b)
+		}
+	}
+	return res.String()
+}
+
+// Adds the AWS Signature Version 4 "Authorization" header (and the
+// x-amz-date and x-amz-content-sha256 ones it needs) to "req"
+func SignS3Request(req *http.Request, payloadHash string, region string,
+	accessKey string, secretKey string, now time.Time) {
+
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	scope := date + "/" + region + "/s3/aws4_request"
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, vals := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" ||
+			name == "content-type" || name == "content-md5" {
+			headers[name] = strings.TrimSpace(strings.Join(vals, ","))
+		}
+	}
+	names := SortedKeys(headers)
+
+	canonHeaders := strings.Builder{}
+	for _, name := range names {
+		canonHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	params := []string{}
+	for key, vals := range query {
+		for _, val := range vals {
+			params = append(params, s3Escape(key, false)+"="+
+				s3Escape(val, false))
+		}
+	}
+	sort.Strings(params)
+
+	path := req.URL.EscapedPath()
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = s3Escape(unescaped, true)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		path,
+		strings.Join(params, "&"),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	reqHash := sha256.Sum256([]byte(canonReq))
+
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" +
+		hex.EncodeToString(reqHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+
+		accessKey+"/"+scope+", SignedHeaders="+signedHeaders+
+		", Signature="+sig)
+}
@@ -0,0 +1,157 @@
+package registry
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// One Entity (and its nested Entities) from a query's result set
+type sortNode struct {
+	rows     [][]*any
+	level    int
+	plural   string
+	uid      string
+	path     string
+	abstract string
+	value    *string // value of the sort attribute, nil if not present
+
+	children []*sortNode
+}
+
+// SortResults reorders the rows of a query's results so that each collection
+// (including any nested inlined ones) is ordered by the "?sort" attribute.
+// The JsonWriter expects an Entity's children to follow it, so the rows are
+// turned into a tree, the siblings in each collection are sorted, and then
+// the tree is flattened back out again. Entities w/o the attribute always
+// appear at the end, and ties keep their original (Path) order.
+func SortResults(info *RequestInfo, results *Result) {
+	if info.SortKey == "" || results == nil || len(results.AllRows) == 0 {
+		return
+	}
+
+	pp := MustPropPathFromUI(info.SortKey)
+	propName := pp.DB()
+
+	// RegSID,Level,Plural,eSID,UID,PropName,PropValue,PropType,Path,Abstract
+	//   0     1      2     3    4     5         6         7     8      9
+	roots := []*sortNode{}
+	nodes := map[string]*sortNode{}
+	node := (*sortNode)(nil)
+
+	for _, row := range results.AllRows {
+		level := int((*row[1]).(int64))
+		plural := NotNilString(row[2])
+		uid := NotNilString(row[4])
+
+		if node == nil || node.level != level || node.plural != plural ||
+			node.uid != uid {
+
+			node = &sortNode{
+				level:    level,
+				plural:   plural,
+				uid:      uid,
+				path:     NotNilString(row[8]),
+				abstract: NotNilString(row[9]),
+			}
+			nodes[node.path] = node
+
+			parent := (*sortNode)(nil)
+			if parts := strings.Split(node.path, "/"); len(parts) >= 2 {
+				parent = nodes[strings.Join(parts[:len(parts)-2], "/")]
+			}
+			if parent != nil {
+				parent.children = append(parent.children, node)
+			} else {
+				roots = append(roots, node)
+			}
+		}
+
+		node.rows = append(node.rows, row)
+		if NotNilString(row[5]) == propName {
+			val := NotNilString(row[6])
+			node.value = &val
+		}
+	}
+
+	sortNodes(info, pp, roots)
+
+	allRows := make([][]*any, 0, len(results.AllRows))
+	var flatten func(list []*sortNode)
+	flatten = func(list []*sortNode) {
+		for _, n := range list {
+			allRows = append(allRows, n.rows...)
+			flatten(n.children)
+		}
+	}
+	flatten(roots)
+
+	results.AllRows = allRows
+}
+
+// Sort each run of siblings that belong to the same collection, then
+// do the same for all of their children
+func sortNodes(info *RequestInfo, pp *PropPath, list []*sortNode) {
+	for start := 0; start < len(list); {
+		end := start + 1
+		for end < len(list) && list[end].plural == list[start].plural {
+			end++
+		}
+
+		coll := list[start:end]
+		daType := info.Registry.Model.GetPropType(coll[0].abstract, pp)
+		sort.SliceStable(coll, func(i, j int) bool {
+			return sortLess(daType, coll[i].value, coll[j].value, info.SortDesc)
+		})
+
+		start = end
+	}
+
+	for _, n := range list {
+		sortNodes(info, pp, n.children)
+	}
+}
+
+func sortLess(daType string, a *string, b *string, desc bool) bool {
+	// Missing values always go last, regardless of the order
+	if a == nil || b == nil {
+		return a != nil && b == nil
+	}
+
+	cmp := compareValues(daType, *a, *b)
+	if desc {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// Compare two values from the DB based on their model type. If either value
+// can't be converted to that type then just compare them as strings.
+func compareValues(daType string, a string, b string) int {
+	switch daType {
+	case INTEGER, UINTEGER, DECIMAL:
+		aF, aErr := strconv.ParseFloat(a, 64)
+		bF, bErr := strconv.ParseFloat(b, 64)
+		if aErr == nil && bErr == nil {
+			if aF < bF {
+				return -1
+			} else if aF > bF {
+				return 1
+			}
+			return 0
+		}
+	case TIMESTAMP:
+		aT, aErr := time.Parse(time.RFC3339Nano, a)
+		bT, bErr := time.Parse(time.RFC3339Nano, b)
+		if aErr == nil && bErr == nil {
+			return aT.Compare(bT)
+		}
+	}
+
+	// Case-insensitive first so "a" and "B" sort like a user would expect
+	if cmp := strings.Compare(strings.ToLower(a), strings.ToLower(b)); cmp != 0 {
+		return cmp
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,521 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+
+	log "github.com/duglin/dlog"
+)
+
+// A Subscription asks for the events of the entities at, or under, "path"
+// (that match "filters") to be sent to "sink". An empty "path" means the
+// entire registry. "filters" uses the same syntax as the ?filter query
+// parameter, relative to "path", and each entry is OR'd with the others.
+// "types" limits which events are sent, empty means all of them.
+type Subscription struct {
+	ID      string   `json:"id"`
+	Sink    string   `json:"sink"`
+	Path    string   `json:"path,omitempty"`
+	Filters []string `json:"filters,omitempty"`
+	Types   []string `json:"types,omitempty"`
+
+	filters [][]*FilterExpr // "filters" after being parsed
+}
+
+var eventTypes = []string{EVENT_CREATED, EVENT_UPDATED, EVENT_DELETED,
+	EVENT_DEFAULTCHANGED}
+
+// Verify the Subscription and parse its filters against the model
+func (sub *Subscription) Verify(tx *Tx, reg *Registry) error {
+	if sub.Sink == "" {
+		return fmt.Errorf("Subscription must have a \"sink\" value")
+	}
+	u, err := url.Parse(sub.Sink)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") ||
+		u.Host == "" {
+		return fmt.Errorf("Invalid \"sink\" value (%s), must be an absolute "+
+			"http(s) URL", sub.Sink)
+	}
+
+	for _, t := range sub.Types {
+		if !slices.Contains(eventTypes, t) {
+			return fmt.Errorf("Invalid \"types\" value (%s), must be one of: %s",
+				t, strings.Join(eventTypes, ", "))
+		}
+	}
+
+	// Use the same logic as the URL parser so "path" and "filters" are
+	// treated just like a GET of "path" with those ?filter values
+	path := strings.Trim(sub.Path, "/")
+	info := &RequestInfo{
+		tx:           tx,
+		Registry:     reg,
+		OriginalPath: path,
+	}
+	top, _, _ := strings.Cut(path, "/")
+	if top == "model" || top == "subscriptions" || top == "import" ||
+		strings.HasPrefix(top, "reg-") {
+		return fmt.Errorf("Invalid \"path\" value (%s): must be the path "+
+			"to an entity or collection in the registry", sub.Path)
+	}
+	if err := info.ParseRequestURL(); err != nil {
+		return fmt.Errorf("Invalid \"path\" value (%s): %s", sub.Path, err)
+	}
+	if info.ShowMeta {
+		return fmt.Errorf("Invalid \"path\" value (%s): $meta isn't allowed",
+			sub.Path)
+	}
+	sub.Path = ""
+	if path != "" {
+		sub.Path = "/" + path
+	}
+
+	sub.filters = nil
+	for _, filterStr := range sub.Filters {
+		AndFilters := []*FilterExpr{}
+		for _, expr := range strings.Split(filterStr, ",") {
+			expr = strings.TrimSpace(expr)
+			if expr == "" {
+				continue
+			}
+			filter, err := info.ParseFilterExpr(expr)
+			if err != nil {
+				return fmt.Errorf("Invalid \"filters\" value (%s): %s",
+					filterStr, err)
+			}
+			AndFilters = append(AndFilters, filter)
+		}
+		if len(AndFilters) > 0 {
+			sub.filters = append(sub.filters, AndFilters)
+		}
+	}
+
+	return nil
+}
+
+// Returns true if the event should be sent to the Subscription's sink.
+// "entities" returns the entity the event is about, and its parents, keyed
+// by their Abstract. It's a func so we only hit the DB when needed.
+func (sub *Subscription) Matches(event *Event,
+	entities func() map[string]*Entity) bool {
+
+	if len(sub.Types) > 0 && !slices.Contains(sub.Types, event.Type) {
+		return false
+	}
+
+	// Deleting a parent implicitly deletes everything under "path" too
+	path := strings.Trim(sub.Path, "/")
+	if path != "" && event.Subject != path &&
+		!strings.HasPrefix(event.Subject, path+"/") &&
+		!(event.Type == EVENT_DELETED &&
+			(event.Subject == "" || strings.HasPrefix(path, event.Subject+"/"))) {
+		return false
+	}
+
+	if len(sub.filters) == 0 {
+		return true
+	}
+
+	// Unlike a query, filters are only checked against the entity in the
+	// event and its parents, not its children
+	ents := entities()
+	for _, AndFilters := range sub.filters {
+		match := true
+		for _, filter := range AndFilters {
+			e := ents[filter.Abstract]
+			if e == nil || !filter.Matches(e.Object) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscriptions are cached per registry (by DbSID) so that we don't need to
+// go to the DB for each event. Any change to them clears the cache, once the
+// Tx that made it is done. subsGen is bumped on each clear so that a load
+// that started before it doesn't put the old ones back in the cache.
+var subsMutex sync.Mutex
+var subsCache = map[string][]*Subscription{}
+var subsGen = 0
+var subsOnce sync.Once
+
+// Events are matched against the Subscriptions, and sent, in the background
+// so that a slow sink (or DB) doesn't hold up the Commit() of the Tx that
+// generated them. They're still processed in order.
+var subsQueueMutex sync.Mutex
+var subsQueue []*Event
+var subsQueueReady = make(chan struct{}, 1)
+
+// Adds the EventListener that sends the events to the subscribers. Called
+// by NewServer, so anything done before the server is created (e.g. loading
+// sample data) doesn't generate any notifications.
+func EnableSubscriptions() {
+	subsOnce.Do(func() {
+		go processSubscriptionEvents()
+		AddEventListener(SubscriptionsListener)
+	})
+}
+
+func ClearSubscriptionsCache(regSIDs ...string) {
+	if len(regSIDs) == 0 {
+		return
+	}
+	subsMutex.Lock()
+	defer subsMutex.Unlock()
+	for _, regSID := range regSIDs {
+		delete(subsCache, regSID)
+	}
+	subsGen++
+}
+
+func LoadSubscriptions(tx *Tx, reg *Registry) ([]*Subscription, error) {
+	results, err := Query(tx, `
+		SELECT UID, Attributes FROM Subscriptions
+		WHERE RegistrySID=? ORDER BY UID`, reg.DbSID)
+	defer results.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	subs := []*Subscription{}
+	for row := results.NextRow(); row != nil; row = results.NextRow() {
+		sub := &Subscription{}
+		if err := Unmarshal([]byte(NotNilString(row[1])), sub); err != nil {
+			return nil, fmt.Errorf("Error parsing subscription %q: %s",
+				NotNilString(row[0]), err)
+		}
+		sub.ID = NotNilString(row[0])
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func FindSubscription(tx *Tx, reg *Registry, id string) (*Subscription, error) {
+	subs, err := LoadSubscriptions(tx, reg)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range subs {
+		if strings.EqualFold(sub.ID, id) {
+			return sub, nil
+		}
+	}
+	return nil, nil
+}
+
+func (sub *Subscription) Save(tx *Tx, reg *Registry) error {
+	id := sub.ID
+	sub.ID = "" // no need to store it twice
+	buf := ToJSON(sub)
+	sub.ID = id
+
+	err := Do(tx, `
+		REPLACE INTO Subscriptions(RegistrySID, UID, Attributes)
+		VALUES(?,?,?)`, reg.DbSID, sub.ID, buf)
+	tx.subsRegs = append(tx.subsRegs, reg.DbSID)
+	return err
+}
+
+func (sub *Subscription) Delete(tx *Tx, reg *Registry) error {
+	err := DoOne(tx, `
+		DELETE FROM Subscriptions WHERE RegistrySID=? AND UID=?`,
+		reg.DbSID, sub.ID)
+	tx.subsRegs = append(tx.subsRegs, reg.DbSID)
+	return err
+}
+
+// Returns the (verified) Subscriptions for the registry, from the cache if
+// possible. Ones that are no longer valid, e.g. due to a model change, are
+// skipped.
+func getSubscriptions(reg *Registry) []*Subscription {
+	subsMutex.Lock()
+	subs, ok := subsCache[reg.DbSID]
+	gen := subsGen
+	subsMutex.Unlock()
+	if ok {
+		return subs
+	}
+
+	tx, err := NewBackgroundTx()
+	if err != nil {
+		log.Printf("Error loading subscriptions: %s", err)
+		return nil
+	}
+	defer tx.Rollback()
+	tx.Registry = reg
+
+	all, err := LoadSubscriptions(tx, reg)
+	if err != nil {
+		log.Printf("Error loading subscriptions: %s", err)
+		return nil
+	}
+
+	subs = []*Subscription{}
+	for _, sub := range all {
+		if err := sub.Verify(tx, reg); err != nil {
+			log.Printf("Skipping subscription %q: %s", sub.ID, err)
+			continue
+		}
+		subs = append(subs, sub)
+	}
+
+	subsMutex.Lock()
+	if gen == subsGen {
+		subsCache[reg.DbSID] = subs
+	}
+	subsMutex.Unlock()
+	return subs
+}
+
+// Loads the entity at "path", and all of its parents, from the DB. "e" is
+// the in-memory version of the entity, used when it's no longer in the DB.
+func loadEntityAndParents(e *Entity) map[string]*Entity {
+	paths := []any{""}
+	parts := strings.Split(e.Path, "/")
+	for i := 2; i <= len(parts) && e.Path != ""; i += 2 {
+		paths = append(paths, strings.Join(parts[:i], "/"))
+	}
+
+	res := map[string]*Entity{}
+
+	tx, err := NewBackgroundTx()
+	if err != nil {
+		log.Printf("Error loading entities: %s", err)
+		return res
+	}
+	defer tx.Rollback()
+	tx.Registry = e.Registry
+
+	results, err := Query(tx, `
+SELECT
+  RegSID,Level,Plural,eSID,UID,PropName,PropValue,PropType,Path,Abstract
+FROM FullTree WHERE RegSID=? AND Path IN (?`+
+		strings.Repeat(",?", len(paths)-1)+`)
+ORDER BY Path`, append([]any{e.Registry.DbSID}, paths...)...)
+	defer results.Close()
+	if err != nil {
+		log.Printf("Error loading entities: %s", err)
+		return res
+	}
+
+	for {
+		entity, err := readNextEntity(tx, results)
+		if err != nil {
+			log.Printf("Error loading entities: %s", err)
+			break
+		}
+		if entity == nil {
+			break
+		}
+		res[entity.Abstract] = entity
+	}
+
+	// Deleted (or not yet visible) entity, use what we have in memory
+	if abs := e.Abstract; res[abs] == nil || res[abs].Path != e.Path {
+		res[abs] = e
+	}
+	return res
+}
+
+// The EventListener that queues up each event for processSubscriptionEvents
+func SubscriptionsListener(event *Event) {
+	if e := event.entity; e == nil || e.Registry == nil {
+		return
+	}
+
+	subsQueueMutex.Lock()
+	subsQueue = append(subsQueue, event)
+	subsQueueMutex.Unlock()
+
+	select {
+	case subsQueueReady <- struct{}{}:
+	default: // it's already been told there's something to do
+	}
+}
+
+func processSubscriptionEvents() {
+	for range subsQueueReady {
+		for {
+			subsQueueMutex.Lock()
+			events := subsQueue
+			subsQueue = nil
+			subsQueueMutex.Unlock()
+
+			if len(events) == 0 {
+				break
+			}
+			for _, event := range events {
+				sendToSubscriptions(event)
+			}
+		}
+	}
+}
+
+// Sends the event to the matching Subscriptions
+func sendToSubscriptions(event *Event) {
+	e := event.entity
+
+	if event.Type == EVENT_DELETED && e.Level == 0 {
+		ClearSubscriptionsCache(e.Registry.DbSID)
+		return
+	}
+
+	var ents map[string]*Entity
+	entities := func() map[string]*Entity {
+		if ents == nil {
+			ents = loadEntityAndParents(e)
+		}
+		return ents
+	}
+
+	for _, sub := range getSubscriptions(e.Registry) {
+		if sub.Matches(event, entities) {
+			log.VPrintf(3, "Sending event %s to subscription %q",
+				event.ID, sub.ID)
+			go DeliverEvent(sub.Sink, event)
+		}
+	}
+}
+
+// GET/PUT/POST/DELETE /subscriptions[/ID]
+func HTTPSubscriptions(info *RequestInfo) error {
+	method := strings.ToUpper(info.OriginalRequest.Method)
+	reg := info.Registry
+
+	if len(info.Parts) > 2 {
+		info.StatusCode = http.StatusNotFound
+		return fmt.Errorf("Not found")
+	}
+
+	id := ""
+	if len(info.Parts) == 2 {
+		id = info.Parts[1]
+		if id == "" {
+			info.StatusCode = http.StatusBadRequest
+			return fmt.Errorf("Subscription id in URL can't be blank")
+		}
+	}
+
+	writeJSON := func(obj any) error {
+		info.AddHeader("Content-Type", "application/json")
+		info.Write([]byte(ToJSON(obj) + "\n"))
+		return nil
+	}
+
+	if method == "GET" {
+		if id == "" {
+			subs, err := LoadSubscriptions(info.tx, reg)
+			if err != nil {
+				info.StatusCode = http.StatusInternalServerError
+				return err
+			}
+			res := map[string]*Subscription{}
+			for _, sub := range subs {
+				res[sub.ID] = sub
+			}
+			return writeJSON(res)
+		}
+
+		sub, err := FindSubscription(info.tx, reg, id)
+		if err != nil {
+			info.StatusCode = http.StatusInternalServerError
+			return err
+		}
+		if sub == nil {
+			info.StatusCode = http.StatusNotFound
+			return fmt.Errorf("Subscription %q not found", id)
+		}
+		return writeJSON(sub)
+	}
+
+	if method == "DELETE" {
+		if id == "" {
+			info.StatusCode = http.StatusMethodNotAllowed
+			return fmt.Errorf("DELETE not allowed on /subscriptions")
+		}
+		sub, err := FindSubscription(info.tx, reg, id)
+		if err == nil && sub == nil {
+			info.StatusCode = http.StatusNotFound
+			return fmt.Errorf("Subscription %q not found", id)
+		}
+		if err == nil {
+			err = sub.Delete(info.tx, reg)
+		}
+		if err != nil {
+			info.StatusCode = http.StatusInternalServerError
+			return err
+		}
+		info.StatusCode = http.StatusNoContent
+		return nil
+	}
+
+	if (method == "POST" && id != "") || (method == "PUT" && id == "") ||
+		(method != "POST" && method != "PUT") {
+		info.StatusCode = http.StatusMethodNotAllowed
+		return fmt.Errorf("%s not allowed on %q", method,
+			"/"+strings.Join(info.Parts, "/"))
+	}
+
+	body, err := io.ReadAll(info.OriginalRequest.Body)
+	if err != nil {
+		info.StatusCode = http.StatusBadRequest
+		return fmt.Errorf("Error reading body: %s", err)
+	}
+
+	sub := &Subscription{}
+	if err := Unmarshal(body, sub); err != nil {
+		info.StatusCode = http.StatusBadRequest
+		return err
+	}
+
+	if id == "" {
+		id = sub.ID
+		if id == "" {
+			id = NewUUID()
+		}
+	} else if sub.ID != "" && sub.ID != id {
+		info.StatusCode = http.StatusBadRequest
+		return fmt.Errorf("The \"id\" attribute must be set to %q, not %q",
+			id, sub.ID)
+	}
+	sub.ID = id
+
+	if err := sub.Verify(info.tx, reg); err != nil {
+		info.StatusCode = http.StatusBadRequest
+		return err
+	}
+
+	old, err := FindSubscription(info.tx, reg, id)
+	if err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+	if old != nil {
+		if method == "POST" {
+			info.StatusCode = http.StatusConflict
+			return fmt.Errorf("Subscription %q already exists", id)
+		}
+		sub.ID = old.ID
+	}
+
+	if err := sub.Save(info.tx, reg); err != nil {
+		info.StatusCode = http.StatusInternalServerError
+		return err
+	}
+
+	if old == nil {
+		info.StatusCode = http.StatusCreated
+		info.AddHeader("Location", info.BaseURL+"/subscriptions/"+sub.ID)
+	}
+	return writeJSON(sub)
+}
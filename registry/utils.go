@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	// "net/url"
-	"io"
 	// "maps"
 	"net/http"
 	"os"
@@ -422,17 +421,7 @@ func ImportTraverse(importArgs ImportArgs, data map[string]any) error {
 					if importData == nil {
 						data := []byte(nil)
 						if strings.HasPrefix(base, "http") {
-							res, err := http.Get(base)
-							if err != nil {
-								return err
-							}
-							if res.StatusCode != 200 {
-								return fmt.Errorf("Error getting %q: %s",
-									base, res.Status)
-							}
-							data, err = io.ReadAll(res.Body)
-							res.Body.Close()
-							if err != nil {
+							if data, err = FetchURL(base); err != nil {
 								return err
 							}
 						} else {
@@ -0,0 +1,741 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// A ContentValidator checks that a Version's document is well-formed for its
+// format. Errors should point to where the problem is, either as a line and
+// column, or as a path into the document (e.g. fields[1].type).
+type ContentValidator func(doc []byte) error
+
+// Keyed by lower-case format name (the part of a "format" attribute before
+// the "/", e.g. "avro" for "Avro/1.9.0") or by content type
+var ContentValidators = map[string]ContentValidator{}
+
+func RegisterContentValidator(key string, fn ContentValidator) {
+	ContentValidators[strings.ToLower(key)] = fn
+}
+
+func init() {
+	for key, fn := range map[string]ContentValidator{
+		"jsonschema":                        ValidateJSONSchema,
+		"application/schema+json":           ValidateJSONSchema,
+		"avro":                              ValidateAvro,
+		"application/vnd.apache.avro+json":  ValidateAvro,
+		"protobuf":                          ValidateProtobuf,
+		"application/x-protobuf":            ValidateProtobuf,
+		"application/vnd.google.protobuf":   ValidateProtobuf,
+		"openapi":                           ValidateOpenAPI,
+		"application/vnd.oai.openapi":       ValidateOpenAPI,
+		"application/vnd.oai.openapi+json":  ValidateOpenAPI,
+		"asyncapi":                          ValidateAsyncAPI,
+		"application/vnd.aai.asyncapi":      ValidateAsyncAPI,
+		"application/vnd.aai.asyncapi+json": ValidateAsyncAPI,
+	} {
+		RegisterContentValidator(key, fn)
+	}
+}
+
+// Returns the lookup keys for a document: the lower-case format name (the
+// part before any "/") and the content type w/o any parameters
+func ContentKeys(format string, contentType string) (string, string) {
+	format, _, _ = strings.Cut(format, "/")
+	contentType, _, _ = strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(format)),
+		strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// Find the validator for a document based on its "format" attribute first,
+// and then its content type. Returns the key that matched too.
+func FindContentValidator(format string, contentType string) (string,
+	ContentValidator) {
+
+	format, contentType = ContentKeys(format, contentType)
+	if fn := ContentValidators[format]; fn != nil {
+		return format, fn
+	}
+	if fn := ContentValidators[contentType]; fn != nil {
+		return contentType, fn
+	}
+	return "", nil
+}
+
+func ValidateContent(format string, contentType string, doc []byte) error {
+	key, fn := FindContentValidator(format, contentType)
+	if fn == nil {
+		return nil
+	}
+	if err := fn(doc); err != nil {
+		return fmt.Errorf("Invalid %q document: %s", key, err)
+	}
+	return nil
+}
+
+// Returns the document (if one is being set) in a Version's NewObject.
+// If it was streamed into the BlobStore then it's read back in, so only
+// call this when all of it is needed.
+func (v *Version) NewDocument() ([]byte, error) {
+	_, rm := v.GetModels()
+	if rm == nil || !rm.GetHasDocument() {
+		return nil, nil
+	}
+
+	if val, ok := v.NewObject[rm.Singular]; ok && !IsNil(val) {
+		switch val := val.(type) {
+		case []byte:
+			return val, nil
+		case string:
+			return []byte(val), nil
+		case *StagedBlob:
+			return val.Bytes()
+		default:
+			buf, _ := json.Marshal(val)
+			return buf, nil
+		}
+	}
+	if val, ok := v.NewObject[rm.Singular+"base64"].(string); ok {
+		// Any decoding error will be flagged by the "base64" attribute's check
+		buf, _ := base64.StdEncoding.DecodeString(val)
+		return buf, nil
+	}
+	return nil, nil
+}
+
+// Returns the "format" and content type of the Version's new document
+func (v *Version) NewDocumentFormat() (string, string) {
+	format, _ := v.NewObject["format"].(string)
+	ct, _ := v.NewObject["contenttype"].(string)
+	if ct == "" {
+		ct, _ = v.NewObject["#-contenttype"].(string)
+	}
+	return format, ct
+}
+
+// Check the document (if one is being set) in a Version's NewObject
+func (v *Version) ValidateContent() error {
+	format, ct := v.NewDocumentFormat()
+	if _, fn := FindContentValidator(format, ct); fn == nil {
+		return nil
+	}
+
+	doc, err := v.NewDocument()
+	if doc == nil || err != nil {
+		return err
+	}
+	return ValidateContent(format, ct, doc)
+}
+
+// Returns "line N, column M" for the byte "offset" in "buf"
+func DocPosition(buf []byte, offset int) string {
+	if offset > len(buf) {
+		offset = len(buf)
+	}
+	line := LineNum(buf, offset)
+	col := offset - (bytes.LastIndexByte(buf[:offset], '\n') + 1) + 1
+	return fmt.Sprintf("line %d, column %d", line, col)
+}
+
+// Parse "doc" as a single JSON value, with numbers as json.Number
+func parseJSONDoc(doc []byte) (any, error) {
+	var val any
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.UseNumber()
+
+	err := dec.Decode(&val)
+	if err == io.EOF {
+		return nil, fmt.Errorf("Document is empty")
+	}
+	if err == nil {
+		// Make sure there's nothing after the value
+		offset := int(dec.InputOffset())
+		var extra any
+		if err2 := dec.Decode(&extra); err2 != io.EOF {
+			for offset < len(doc) && strings.ContainsRune(" \t\r\n",
+				rune(doc[offset])) {
+				offset++
+			}
+			return nil, fmt.Errorf("Syntax error at %s: extra data after "+
+				"the JSON value", DocPosition(doc, offset))
+		}
+		return val, nil
+	}
+
+	if serr, ok := err.(*json.SyntaxError); ok {
+		// Offset is just after the bad byte
+		return nil, fmt.Errorf("Syntax error at %s: %s",
+			DocPosition(doc, int(serr.Offset)-1), serr)
+	}
+	if err == io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("Syntax error at %s: unexpected end of JSON",
+			DocPosition(doc, len(doc)))
+	}
+	return nil, fmt.Errorf("Syntax error: %s", err)
+}
+
+func docPathErr(path string, format string, args ...any) error {
+	if path == "" {
+		path = "(root)"
+	}
+	return fmt.Errorf("Error at %q: %s", path, fmt.Sprintf(format, args...))
+}
+
+func subPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func indexPath(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// JSON Schema
+
+var jsonSchemaTypes = []string{"array", "boolean", "integer", "null",
+	"number", "object", "string"}
+
+func ValidateJSONSchema(doc []byte) error {
+	val, err := parseJSONDoc(doc)
+	if err != nil {
+		return err
+	}
+	return checkJSONSchema(val, "")
+}
+
+func checkJSONSchema(val any, path string) error {
+	if _, ok := val.(bool); ok {
+		return nil
+	}
+	schema, ok := val.(map[string]any)
+	if !ok {
+		return docPathErr(path, "must be an object or a boolean")
+	}
+
+	for _, key := range SortedKeys(schema) {
+		kPath := subPath(path, key)
+		v := schema[key]
+
+		switch key {
+		case "$schema", "$id", "$ref", "$anchor", "$comment", "title",
+			"description", "pattern", "format":
+			if _, ok := v.(string); !ok {
+				return docPathErr(kPath, "must be a string")
+			}
+
+		case "type":
+			types := []any{v}
+			if list, ok := v.([]any); ok {
+				types = list
+			}
+			for _, t := range types {
+				str, ok := t.(string)
+				if !ok || !slices.Contains(jsonSchemaTypes, str) {
+					return docPathErr(kPath, "must be one of: %s, or an "+
+						"array of them", strings.Join(jsonSchemaTypes, ", "))
+				}
+			}
+
+		case "properties", "patternProperties", "$defs", "definitions",
+			"dependentSchemas":
+			m, ok := v.(map[string]any)
+			if !ok {
+				return docPathErr(kPath, "must be an object")
+			}
+			for _, name := range SortedKeys(m) {
+				if err := checkJSONSchema(m[name], subPath(kPath, name)); err != nil {
+					return err
+				}
+			}
+
+		case "additionalProperties", "additionalItems", "not", "if", "then",
+			"else", "contains", "propertyNames", "unevaluatedItems",
+			"unevaluatedProperties":
+			if err := checkJSONSchema(v, kPath); err != nil {
+				return err
+			}
+
+		case "items":
+			if list, ok := v.([]any); ok {
+				for i, item := range list {
+					if err := checkJSONSchema(item, indexPath(kPath, i)); err != nil {
+						return err
+					}
+				}
+			} else if err := checkJSONSchema(v, kPath); err != nil {
+				return err
+			}
+
+		case "allOf", "anyOf", "oneOf", "prefixItems":
+			list, ok := v.([]any)
+			if !ok || len(list) == 0 {
+				return docPathErr(kPath, "must be a non-empty array")
+			}
+			for i, item := range list {
+				if err := checkJSONSchema(item, indexPath(kPath, i)); err != nil {
+					return err
+				}
+			}
+
+		case "required":
+			list, ok := v.([]any)
+			if !ok {
+				return docPathErr(kPath, "must be an array of strings")
+			}
+			for _, item := range list {
+				if _, ok := item.(string); !ok {
+					return docPathErr(kPath, "must be an array of strings")
+				}
+			}
+
+		case "enum":
+			if _, ok := v.([]any); !ok {
+				return docPathErr(kPath, "must be an array")
+			}
+
+		case "minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum",
+			"multipleOf", "minLength", "maxLength", "minItems", "maxItems",
+			"minProperties", "maxProperties":
+			// Draft-04 used booleans for the exclusive ones
+			_, isNum := v.(json.Number)
+			_, isBool := v.(bool)
+			if !isNum && !(isBool && strings.HasPrefix(key, "exclusive")) {
+				return docPathErr(kPath, "must be a number")
+			}
+		}
+	}
+	return nil
+}
+
+// Avro
+
+var avroPrimitives = []string{"null", "boolean", "int", "long", "float",
+	"double", "bytes", "string"}
+
+func ValidateAvro(doc []byte) error {
+	val, err := parseJSONDoc(doc)
+	if err != nil {
+		return err
+	}
+	return checkAvro(val, "")
+}
+
+func checkAvroName(obj map[string]any, path string) error {
+	name, ok := obj["name"].(string)
+	if !ok || name == "" {
+		return docPathErr(subPath(path, "name"), "must be a non-empty string")
+	}
+	return nil
+}
+
+func checkAvro(val any, path string) error {
+	switch val := val.(type) {
+	case string:
+		// Either a primitive or a reference to a named type
+		if val == "" {
+			return docPathErr(path, "type name can't be empty")
+		}
+		return nil
+
+	case []any:
+		// A union
+		for i, item := range val {
+			if _, ok := item.([]any); ok {
+				return docPathErr(indexPath(path, i), "unions can't "+
+					"directly contain other unions")
+			}
+			if err := checkAvro(item, indexPath(path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case map[string]any:
+		t, ok := val["type"]
+		if !ok {
+			return docPathErr(subPath(path, "type"), "is missing")
+		}
+		str, ok := t.(string)
+		if !ok {
+			// e.g. {"type": {"type": "array", ...}}
+			return checkAvro(t, subPath(path, "type"))
+		}
+
+		switch str {
+		case "record", "error":
+			if err := checkAvroName(val, path); err != nil {
+				return err
+			}
+			fields, ok := val["fields"].([]any)
+			if !ok {
+				return docPathErr(subPath(path, "fields"), "must be an array")
+			}
+			for i, f := range fields {
+				fPath := indexPath(subPath(path, "fields"), i)
+				field, ok := f.(map[string]any)
+				if !ok {
+					return docPathErr(fPath, "must be an object")
+				}
+				if err := checkAvroName(field, fPath); err != nil {
+					return err
+				}
+				ft, ok := field["type"]
+				if !ok {
+					return docPathErr(subPath(fPath, "type"), "is missing")
+				}
+				if err := checkAvro(ft, subPath(fPath, "type")); err != nil {
+					return err
+				}
+			}
+
+		case "enum":
+			if err := checkAvroName(val, path); err != nil {
+				return err
+			}
+			symbols, ok := val["symbols"].([]any)
+			if !ok {
+				return docPathErr(subPath(path, "symbols"),
+					"must be an array of strings")
+			}
+			for i, s := range symbols {
+				if _, ok := s.(string); !ok {
+					return docPathErr(indexPath(subPath(path, "symbols"), i),
+						"must be a string")
+				}
+			}
+
+		case "array":
+			items, ok := val["items"]
+			if !ok {
+				return docPathErr(subPath(path, "items"), "is missing")
+			}
+			return checkAvro(items, subPath(path, "items"))
+
+		case "map":
+			values, ok := val["values"]
+			if !ok {
+				return docPathErr(subPath(path, "values"), "is missing")
+			}
+			return checkAvro(values, subPath(path, "values"))
+
+		case "fixed":
+			if err := checkAvroName(val, path); err != nil {
+				return err
+			}
+			if _, ok := val["size"].(json.Number); !ok {
+				return docPathErr(subPath(path, "size"), "must be a number")
+			}
+
+		default:
+			// Primitive (possibly w/ a logicalType) or a named reference
+			if str == "" {
+				return docPathErr(subPath(path, "type"),
+					"type name can't be empty")
+			}
+		}
+		return nil
+	}
+
+	return docPathErr(path, "must be a string, an array or an object")
+}
+
+// Protobuf - either a .proto file or a binary FileDescriptorSet
+
+var protoTopLevel = []string{"syntax", "edition", "package", "import",
+	"option", "message", "enum", "service", "extend"}
+
+func ValidateProtobuf(doc []byte) error {
+	if isText(doc) {
+		return checkProtoText(doc)
+	}
+	return checkProtoWire(doc, 0, true)
+}
+
+func isText(doc []byte) bool {
+	if !utf8.Valid(doc) {
+		return false
+	}
+	for _, c := range doc {
+		if c < ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+type protoToken struct {
+	text   string
+	offset int
+}
+
+func protoTokens(doc []byte) ([]protoToken, error) {
+	tokens := []protoToken{}
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+
+		case bytes.HasPrefix(doc[i:], []byte("//")):
+			end := bytes.IndexByte(doc[i:], '\n')
+			if end < 0 {
+				end = len(doc) - i
+			}
+			i += end
+
+		case bytes.HasPrefix(doc[i:], []byte("/*")):
+			end := bytes.Index(doc[i+2:], []byte("*/"))
+			if end < 0 {
+				return nil, fmt.Errorf("Syntax error at %s: unterminated "+
+					"comment", DocPosition(doc, i))
+			}
+			i += end + 4
+
+		case c == '"' || c == '\'':
+			j := i + 1
+			for ; j < len(doc) && doc[j] != c && doc[j] != '\n'; j++ {
+				if doc[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(doc) || doc[j] != c {
+				return nil, fmt.Errorf("Syntax error at %s: unterminated "+
+					"string", DocPosition(doc, i))
+			}
+			tokens = append(tokens, protoToken{string(doc[i : j+1]), i})
+			i = j + 1
+
+		case c == '_' || c == '.' || unicode.IsLetter(rune(c)) ||
+			unicode.IsDigit(rune(c)):
+			j := i
+			for j < len(doc) && (doc[j] == '_' || doc[j] == '.' ||
+				unicode.IsLetter(rune(doc[j])) || unicode.IsDigit(rune(doc[j]))) {
+				j++
+			}
+			tokens = append(tokens, protoToken{string(doc[i:j]), i})
+			i = j
+
+		default:
+			tokens = append(tokens, protoToken{string(c), i})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+func checkProtoText(doc []byte) error {
+	tokens, err := protoTokens(doc)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		return fmt.Errorf("Document is empty")
+	}
+
+	closers := map[string]string{"{": "}", "[": "]", "(": ")"}
+	stack := []protoToken{}
+	atStmtStart := true // At the start of a top-level statement
+
+	for i, tok := range tokens {
+		if len(stack) == 0 && atStmtStart && !strings.Contains(";}])",
+			tok.text) {
+			if !slices.Contains(protoTopLevel, tok.text) {
+				return fmt.Errorf("Syntax error at %s: unexpected %q, "+
+					"expected one of: %s", DocPosition(doc, tok.offset),
+					tok.text, strings.Join(protoTopLevel, ", "))
+			}
+			if tok.text == "syntax" {
+				if i+3 >= len(tokens) || tokens[i+1].text != "=" ||
+					(tokens[i+2].text != `"proto2"` &&
+						tokens[i+2].text != `"proto3"`) ||
+					tokens[i+3].text != ";" {
+					return fmt.Errorf("Syntax error at %s: must be of the "+
+						"form: syntax = \"proto2\"|\"proto3\";",
+						DocPosition(doc, tok.offset))
+				}
+			}
+			atStmtStart = false
+		}
+
+		switch tok.text {
+		case "{", "[", "(":
+			stack = append(stack, tok)
+		case "}", "]", ")":
+			if len(stack) == 0 || closers[stack[len(stack)-1].text] != tok.text {
+				return fmt.Errorf("Syntax error at %s: unexpected %q",
+					DocPosition(doc, tok.offset), tok.text)
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 && tok.text == "}" {
+				atStmtStart = true
+			}
+		case ";":
+			if len(stack) == 0 {
+				atStmtStart = true
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		tok := stack[len(stack)-1]
+		return fmt.Errorf("Syntax error at %s: %q is never closed",
+			DocPosition(doc, tok.offset), tok.text)
+	}
+	if !atStmtStart {
+		return fmt.Errorf("Syntax error at %s: unexpected end of file, "+
+			"missing \";\"", DocPosition(doc, len(doc)))
+	}
+	return nil
+}
+
+func protoVarint(doc []byte, pos int) (uint64, int, error) {
+	val := uint64(0)
+	for shift := 0; shift < 64; shift += 7 {
+		if pos >= len(doc) {
+			return 0, pos, fmt.Errorf("truncated varint")
+		}
+		b := doc[pos]
+		pos++
+		val |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return val, pos, nil
+		}
+	}
+	return 0, pos, fmt.Errorf("varint is too long")
+}
+
+// Check the protobuf wire format. A FileDescriptorSet is just a list of
+// FileDescriptorProto's (field 1), each of which must be a valid message.
+func checkProtoWire(doc []byte, base int, isSet bool) error {
+	for pos := 0; pos < len(doc); {
+		start := pos
+		tag, next, err := protoVarint(doc, pos)
+		if err != nil {
+			return fmt.Errorf("Error at byte %d: %s", base+start, err)
+		}
+		pos = next
+		field, wireType := tag>>3, tag&7
+		if field == 0 {
+			return fmt.Errorf("Error at byte %d: invalid field number 0",
+				base+start)
+		}
+		if isSet && (field != 1 || wireType != 2) {
+			return fmt.Errorf("Error at byte %d: not a FileDescriptorSet, "+
+				"unexpected field %d", base+start, field)
+		}
+
+		switch wireType {
+		case 0:
+			if _, pos, err = protoVarint(doc, pos); err != nil {
+				return fmt.Errorf("Error at byte %d: %s", base+start, err)
+			}
+		case 1, 5:
+			size := 8
+			if wireType == 5 {
+				size = 4
+			}
+			if pos+size > len(doc) {
+				return fmt.Errorf("Error at byte %d: truncated field %d",
+					base+start, field)
+			}
+			pos += size
+		case 2:
+			var size uint64
+			if size, pos, err = protoVarint(doc, pos); err != nil {
+				return fmt.Errorf("Error at byte %d: %s", base+start, err)
+			}
+			if size > uint64(len(doc)-pos) {
+				return fmt.Errorf("Error at byte %d: truncated field %d",
+					base+start, field)
+			}
+			if isSet {
+				err = checkProtoWire(doc[pos:pos+int(size)], base+pos, false)
+				if err != nil {
+					return err
+				}
+			}
+			pos += int(size)
+		default:
+			return fmt.Errorf("Error at byte %d: unsupported wire type %d",
+				base+start, wireType)
+		}
+	}
+	return nil
+}
+
+// OpenAPI and AsyncAPI. YAML documents are converted to JSON first so
+// they're checked the same way.
+
+func ValidateOpenAPI(doc []byte) error {
+	return checkAPIDoc(doc, []string{"openapi", "swagger"})
+}
+
+func ValidateAsyncAPI(doc []byte) error {
+	return checkAPIDoc(doc, []string{"asyncapi"})
+}
+
+func checkAPIDoc(doc []byte, versionKeys []string) error {
+	trimmed := bytes.TrimSpace(doc)
+	if len(trimmed) == 0 {
+		return fmt.Errorf("Document is empty")
+	}
+
+	if trimmed[0] != '{' {
+		buf, err := YAMLToJSON(doc)
+		if err != nil {
+			return err
+		}
+		doc = buf
+	}
+
+	val, err := parseJSONDoc(doc)
+	if err != nil {
+		return err
+	}
+	obj, ok := val.(map[string]any)
+	if !ok {
+		return docPathErr("", "must be an object")
+	}
+
+	found := false
+	for _, key := range versionKeys {
+		if v, ok := obj[key]; ok {
+			if _, ok := v.(string); !ok {
+				return docPathErr(key, "must be a string")
+			}
+			found = true
+		}
+	}
+	if !found {
+		return docPathErr("", "missing the \"%s\" attribute",
+			strings.Join(versionKeys, "\" or \""))
+	}
+
+	info, ok := obj["info"].(map[string]any)
+	if !ok {
+		return docPathErr("info", "must be an object")
+	}
+	for _, key := range []string{"title", "version"} {
+		if _, ok := info[key].(string); !ok {
+			return docPathErr(subPath("info", key), "must be a string")
+		}
+	}
+
+	for _, key := range []string{"paths", "channels", "components"} {
+		if v, ok := obj[key]; ok {
+			if _, ok := v.(map[string]any); !ok {
+				return docPathErr(key, "must be an object")
+			}
+		}
+	}
+	return nil
+}
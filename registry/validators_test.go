@@ -0,0 +1,169 @@
+package registry
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestContentValidators(t *testing.T) {
+	type Test struct {
+		Format      string
+		ContentType string
+		Doc         string
+		Err         string
+	}
+
+	tests := []Test{
+		// No validator, anything goes
+		{"", "", "junk", ""},
+		{"xml", "text/plain", "{", ""},
+		{"", "application/json", "{", ""},
+
+		// JSON Schema
+		{"JsonSchema/draft-07", "", `{"type":"object"}`, ""},
+		{"", "application/schema+json; charset=utf-8", `true`, ""},
+		{"jsonschema", "", `{"properties":{"a":{"type":["string","null"]}},
+		  "required":["a"], "items":[{}, false]}`, ""},
+		{"jsonschema", "", "", `Invalid "jsonschema" document: Document is empty`},
+		{"jsonschema", "", "{\n  \"type\": \"object\",\n  \"x\": }",
+			`Invalid "jsonschema" document: Syntax error at line 3, ` +
+				`column 8: invalid character '}' looking for beginning of value`},
+		{"jsonschema", "", "{\n  \"type\": \"object\"",
+			`Invalid "jsonschema" document: Syntax error at line 2, ` +
+				`column 19: unexpected end of JSON`},
+		{"jsonschema", "", `{} {}`, `Invalid "jsonschema" document: ` +
+			`Syntax error at line 1, column 4: extra data after the JSON value`},
+		{"jsonschema", "", `[]`, `Invalid "jsonschema" document: ` +
+			`Error at "(root)": must be an object or a boolean`},
+		{"jsonschema", "", `{"properties":{"a":{"type":"str"}}}`,
+			`Invalid "jsonschema" document: Error at "properties.a.type": ` +
+				`must be one of: array, boolean, integer, null, number, ` +
+				`object, string, or an array of them`},
+		{"jsonschema", "", `{"anyOf":[{},{"required":"a"}]}`,
+			`Invalid "jsonschema" document: Error at "anyOf[1].required": ` +
+				`must be an array of strings`},
+		{"jsonschema", "", `{"minimum":"1"}`, `Invalid "jsonschema" ` +
+			`document: Error at "minimum": must be a number`},
+
+		// Avro
+		{"Avro/1.11", "", `"string"`, ""},
+		{"avro", "", `["null", {"type":"array","items":"int"}]`, ""},
+		{"", "application/vnd.apache.avro+json", `{"type":"record",
+		  "name":"r", "fields":[{"name":"a","type":"long"},
+		  {"name":"b","type":{"type":"enum","name":"e","symbols":["X"]}}]}`,
+			""},
+		{"avro", "", `{"type":"record","fields":[]}`, `Invalid "avro" ` +
+			`document: Error at "name": must be a non-empty string`},
+		{"avro", "", `{"type":"record","name":"r","fields":[{"name":"a"}]}`,
+			`Invalid "avro" document: Error at "fields[0].type": is missing`},
+		{"avro", "", `{"type":"map"}`, `Invalid "avro" document: ` +
+			`Error at "values": is missing`},
+		{"avro", "", `{"type":"fixed","name":"f","size":"1"}`,
+			`Invalid "avro" document: Error at "size": must be a number`},
+		{"avro", "", `["null",["int"]]`, `Invalid "avro" document: ` +
+			`Error at "[1]": unions can't directly contain other unions`},
+		{"avro", "", `5`, `Invalid "avro" document: Error at "(root)": ` +
+			`must be a string, an array or an object`},
+
+		// Protobuf
+		{"protobuf", "", `// comment
+syntax = "proto3";
+package foo.bar;
+import "a.proto";
+message M { string s = 1; /* } */ map<string, int32> m = 2; }
+enum E { A = 0; }
+service S { rpc Get(M) returns (M) {} }
+`, ""},
+		{"protobuf", "", "syntax = \"proto3\";\nmessage M {\n  int32 a = 1;\n",
+			`Invalid "protobuf" document: Syntax error at line 2, ` +
+				`column 11: "{" is never closed`},
+		{"protobuf", "", "syntax = \"proto3\";\nmessage M { }\n}",
+			`Invalid "protobuf" document: Syntax error at line 3, ` +
+				`column 1: unexpected "}"`},
+		{"protobuf", "", "syntax = \"proto4\";", `Invalid "protobuf" ` +
+			`document: Syntax error at line 1, column 1: must be of the ` +
+			`form: syntax = "proto2"|"proto3";`},
+		{"protobuf", "", "syntax = \"proto3\";\nmesage M {}",
+			`Invalid "protobuf" document: Syntax error at line 2, ` +
+				`column 1: unexpected "mesage", expected one of: syntax, ` +
+				`edition, package, import, option, message, enum, ` +
+				`service, extend`},
+		{"protobuf", "", "package a", `Invalid "protobuf" document: ` +
+			`Syntax error at line 1, column 10: unexpected end of file, ` +
+			`missing ";"`},
+		{"protobuf", "", "message M { string s = \"abc; }",
+			`Invalid "protobuf" document: Syntax error at line 1, ` +
+				`column 24: unterminated string`},
+		// FileDescriptorSet{file: {name: "a"}}
+		{"protobuf", "", "\x0a\x03\x0a\x01a", ""},
+		{"protobuf", "", "\x0a\x05\x0a\x01a", `Invalid "protobuf" ` +
+			`document: Error at byte 0: truncated field 1`},
+		{"protobuf", "", "\x0a\x02\x0a\x05", `Invalid "protobuf" ` +
+			`document: Error at byte 2: truncated field 1`},
+		{"protobuf", "", "\x12\x00", `Invalid "protobuf" document: ` +
+			`Error at byte 0: not a FileDescriptorSet, unexpected field 2`},
+
+		// OpenAPI / AsyncAPI
+		{"OpenAPI/3.0", "", `{"openapi":"3.0.0","info":{"title":"t",
+		  "version":"1"},"paths":{}}`, ""},
+		{"openapi", "", `{"swagger":"2.0","info":{"title":"t","version":"1"}}`,
+			""},
+		{"openapi", "", "openapi: 3.1.0\ninfo:\n  title: t\n  version: \"1\"\n",
+			""},
+		{"openapi", "", "openapi: 3.1.0\ninfo:\n  title: t\n  version: 1\n",
+			`Invalid "openapi" document: Error at "info.version": must ` +
+				`be a string`},
+		{"openapi", "", "# comment\nopenapi: 3.1.0\ninfo: { title: t, " +
+			"version: v1 }\npaths: [ a ]\n", `Invalid "openapi" document: ` +
+			`Error at "paths": must be an object`},
+		{"openapi", "", `{"info":{"title":"t","version":"1"}}`,
+			`Invalid "openapi" document: Error at "(root)": missing the ` +
+				`"openapi" or "swagger" attribute`},
+		{"openapi", "", `{"openapi":"3.0.0","info":{"title":"t"}}`,
+			`Invalid "openapi" document: Error at "info.version": must ` +
+				`be a string`},
+		{"openapi", "", `{"openapi":"3.0.0","info":{"title":"t",
+		  "version":"1"},"paths":[]}`, `Invalid "openapi" document: ` +
+			`Error at "paths": must be an object`},
+		{"openapi", "", "openapi: 3.1.0\ninfo:\n\ttitle: t\n",
+			`Invalid "openapi" document: YAML error at line 3: found ` +
+				`character that cannot start any token`},
+		{"", "application/vnd.aai.asyncapi+json", `{"asyncapi":"2.6.0",
+		  "info":{"title":"t","version":"1"},"channels":{}}`, ""},
+		{"asyncapi", "", "info:\n  title: t\n", `Invalid "asyncapi" ` +
+			`document: Error at "(root)": missing the "asyncapi" attribute`},
+	}
+
+	for _, test := range tests {
+		err := ValidateContent(test.Format, test.ContentType,
+			[]byte(test.Doc))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.Err {
+			t.Errorf("Format: %q ContentType: %q Doc: %q\nExp: %s\nGot: %s",
+				test.Format, test.ContentType, test.Doc, test.Err, got)
+		}
+	}
+}
+
+func TestRegisterContentValidator(t *testing.T) {
+	defer delete(ContentValidators, "text/x-test")
+
+	RegisterContentValidator("Text/X-Test", func(doc []byte) error {
+		if string(doc) != "ok" {
+			return fmt.Errorf("Error at line 1: not ok")
+		}
+		return nil
+	})
+
+	if err := ValidateContent("", "text/x-test", []byte("ok")); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	err := ValidateContent("", "TEXT/x-test; a=b", []byte("no"))
+	if err == nil || err.Error() != `Invalid "text/x-test" document: `+
+		`Error at line 1: not ok` {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
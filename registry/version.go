@@ -35,11 +35,20 @@ func (v *Version) Delete(nextVersionID string) error {
 		return fmt.Errorf("Can't set defaultversionid to Version being deleted")
 	}
 
+	if err := v.Resource.CheckWritable(); err != nil {
+		return err
+	}
+
+	if err := v.tx.checkBlobs(&v.Entity); err != nil {
+		return err
+	}
+
 	// Zero is ok if it's already been deleted
 	err := DoZeroOne(v.tx, `DELETE FROM Versions WHERE SID=?`, v.DbSID)
 	if err != nil {
 		return fmt.Errorf("Error deleting Version %q: %s", v.UID, err)
 	}
+	v.tx.AddEvent(EVENT_DELETED, &v.Entity)
 
 	// On zero, we'll continue and process the nextVersionID... should we?
 
@@ -0,0 +1,406 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// YAML is just converted to/from JSON, since that's what everything else
+// speaks. The parsing is done by yaml.v3 (so the YAML 1.2 "core schema",
+// meaning "yes"/"no" are strings, not booleans), we just walk its nodes so
+// the order of the keys is kept. Things w/o a JSON equivalent (complex keys,
+// multiple documents, custom tags, ...) are errors.
+
+var YAML_CTS = []string{
+	"application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml",
+}
+
+// The most nodes a YAML document can have once its aliases are expanded.
+// Aliases are cheap to parse but each one is a full copy of its anchor in
+// the JSON, so a few levels of them can turn a tiny request into a huge one.
+var MAX_YAML_NODES = 100000
+
+// Returns true if "ct" (a Content-Type or Accept value) is a YAML one
+func IsYAMLContentType(ct string) bool {
+	ct, _, _ = strings.Cut(ct, ";")
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	for _, yct := range YAML_CTS {
+		if ct == yct {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the "Accept" header prefers YAML over JSON. Ties go to
+// whichever comes first.
+func AcceptsYAML(accept string) bool {
+	bestQ, yaml := 0.0, false
+	for _, mt := range strings.Split(accept, ",") {
+		mt, params, _ := strings.Cut(mt, ";")
+		mt = strings.ToLower(strings.TrimSpace(mt))
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, val, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				q, _ = strconv.ParseFloat(strings.TrimSpace(val), 64)
+			}
+		}
+
+		isYAML := IsYAMLContentType(mt)
+		if !isYAML && mt != "application/json" && mt != "application/*" &&
+			mt != "*/*" {
+			continue
+		}
+		if q > bestQ {
+			bestQ, yaml = q, isYAML
+		}
+	}
+	return yaml
+}
+
+// YAML request bodies are converted to JSON before anything else sees them.
+// Resource documents are left alone, they're just saved as is.
+func ConvertYAMLRequest(info *RequestInfo) error {
+	req := info.OriginalRequest
+	method := strings.ToUpper(req.Method)
+	if method != "PUT" && method != "POST" && method != "PATCH" {
+		return nil
+	}
+	if !IsYAMLContentType(req.Header.Get("Content-Type")) ||
+		!info.HasMetaBody() ||
+		(len(info.Parts) > 0 && info.Parts[0] == "import") {
+		return nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		info.StatusCode = http.StatusBadRequest
+		return fmt.Errorf("Error reading body: %s", err)
+	}
+	if len(bytes.TrimSpace(body)) > 0 {
+		if body, err = YAMLToJSON(body); err != nil {
+			info.StatusCode = http.StatusBadRequest
+			return err
+		}
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+	return nil
+}
+
+// YAMLWriter turns JSON (metadata) responses into YAML for clients that
+// asked for it via the "Accept" header. Anything else, like errors and
+// Resource documents, is passed along as is.
+type YAMLWriter struct {
+	Info      *RequestInfo
+	OldWriter HTTPWriter
+	Headers   *map[string]string
+	Buffer    *bytes.Buffer
+}
+
+func NewYAMLWriter(info *RequestInfo) *YAMLWriter {
+	return &YAMLWriter{
+		Info:      info,
+		OldWriter: info.HTTPWriter,
+		Headers:   &map[string]string{},
+		Buffer:    &bytes.Buffer{},
+	}
+}
+
+func (yw *YAMLWriter) Write(b []byte) (int, error) {
+	return yw.Buffer.Write(b)
+}
+
+func (yw *YAMLWriter) AddHeader(name, value string) {
+	(*yw.Headers)[name] = value
+}
+
+func (yw *YAMLWriter) Done() {
+	buf := yw.Buffer.Bytes()
+
+	ct := (*yw.Headers)["Content-Type"]
+	if strings.HasPrefix(ct, "application/json") && (yw.Info.HasMetaBody() ||
+		yw.Info.OriginalRequest.URL.Query().Has("diff")) {
+
+		if yamlBuf, err := JSONToYAML(buf); err == nil {
+			buf = yamlBuf
+			yw.AddHeader("Content-Type", "application/yaml")
+		}
+	}
+
+	for k, v := range *yw.Headers {
+		yw.OldWriter.AddHeader(k, v)
+	}
+	yw.OldWriter.Write(buf)
+}
+
+// Converts the (single) YAML document in "buf" into JSON
+func YAMLToJSON(buf []byte) ([]byte, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(buf))
+	doc := &yaml.Node{}
+	if err := dec.Decode(doc); err != nil {
+		if err == io.EOF { // Nothing but comments
+			return []byte("null"), nil
+		}
+		return nil, yamlError(err)
+	}
+	if err := dec.Decode(&yaml.Node{}); err != io.EOF {
+		if err == nil {
+			return nil, fmt.Errorf("YAML error: multiple documents aren't " +
+				"supported")
+		}
+		return nil, yamlError(err)
+	}
+
+	val, err := (&yamlConverter{}).toValue(doc.Content[0])
+	if err != nil {
+		return nil, err
+	}
+
+	res := &bytes.Buffer{}
+	enc := json.NewEncoder(res)
+	enc.SetEscapeHTML(false)
+	if err = enc.Encode(val); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(res.Bytes(), "\n"), nil
+}
+
+var yamlErrorRE = regexp.MustCompile(`^yaml: line ([0-9]+): `)
+
+// yaml.v3's errors look like "yaml: line 3: oops", make them look like ours
+func yamlError(err error) error {
+	str := err.Error()
+	if m := yamlErrorRE.FindStringSubmatch(str); m != nil {
+		return fmt.Errorf("YAML error at line %s: %s", m[1], str[len(m[0]):])
+	}
+	return fmt.Errorf("YAML error: %s", strings.TrimPrefix(str, "yaml: "))
+}
+
+func yamlNodeErrorf(node *yaml.Node, format string, args ...any) error {
+	return fmt.Errorf("YAML error at line %d: %s", node.Line,
+		fmt.Sprintf(format, args...))
+}
+
+// yamlMap keeps the keys in the order they appeared
+type yamlMap struct {
+	keys []string
+	vals map[string]any
+}
+
+func (m *yamlMap) MarshalJSON() ([]byte, error) {
+	res := &bytes.Buffer{}
+	enc := json.NewEncoder(res)
+	enc.SetEscapeHTML(false)
+
+	res.WriteByte('{')
+	for i, key := range m.keys {
+		if i > 0 {
+			res.WriteByte(',')
+		}
+		if err := enc.Encode(key); err != nil {
+			return nil, err
+		}
+		res.WriteByte(':')
+		if err := enc.Encode(m.vals[key]); err != nil {
+			return nil, err
+		}
+	}
+	res.WriteByte('}')
+	return res.Bytes(), nil
+}
+
+// yamlConverter turns yaml.v3 nodes into something encoding/json can
+// serialize
+type yamlConverter struct {
+	nodes int        // # of nodes so far, w/the aliases expanded
+	alias *yaml.Node // outermost alias being expanded, if any
+}
+
+func (c *yamlConverter) toValue(node *yaml.Node) (any, error) {
+	if c.nodes++; c.nodes > MAX_YAML_NODES {
+		// Point at the alias, not at the anchor it's a copy of
+		if c.alias != nil {
+			node = c.alias
+		}
+		return nil, yamlNodeErrorf(node, "too many nodes (more than %d) "+
+			"once the aliases are expanded", MAX_YAML_NODES)
+	}
+
+	switch node.Kind {
+	case yaml.AliasNode:
+		c.nodes-- // The alias itself doesn't count, just what it expands to
+		if c.alias == nil {
+			c.alias = node
+			defer func() { c.alias = nil }()
+		}
+		return c.toValue(node.Alias)
+
+	case yaml.MappingNode:
+		res := &yamlMap{vals: map[string]any{}}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			keyNode := node.Content[i]
+			for keyNode.Kind == yaml.AliasNode {
+				keyNode = keyNode.Alias
+			}
+			key, err := c.toValue(keyNode)
+			if err != nil {
+				return nil, err
+			}
+			if keyNode.Kind != yaml.ScalarNode || key == nil {
+				return nil, yamlNodeErrorf(keyNode, "keys must be strings, "+
+					"numbers or booleans")
+			}
+			keyStr := fmt.Sprintf("%v", key)
+			if _, ok := res.vals[keyStr]; ok {
+				return nil, yamlNodeErrorf(keyNode, "duplicate key %q",
+					keyStr)
+			}
+			val, err := c.toValue(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			res.keys = append(res.keys, keyStr)
+			res.vals[keyStr] = val
+		}
+		return res, nil
+
+	case yaml.SequenceNode:
+		res := []any{}
+		for _, child := range node.Content {
+			val, err := c.toValue(child)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, val)
+		}
+		return res, nil
+	}
+
+	// Scalars
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!str", "!!timestamp": // There are no timestamps in YAML 1.2
+		return node.Value, nil
+	case "!!bool":
+		var b bool
+		err := node.Decode(&b)
+		return b, err
+	case "!!int", "!!float":
+		// Keep the number as is if JSON allows it (e.g. "1.50", big ints)
+		if json.Valid([]byte(node.Value)) {
+			return json.Number(node.Value), nil
+		}
+		var val any
+		if err := node.Decode(&val); err != nil {
+			return nil, yamlError(err)
+		}
+		switch v := val.(type) {
+		case int:
+			return json.Number(strconv.Itoa(v)), nil
+		case uint64:
+			return json.Number(strconv.FormatUint(v, 10)), nil
+		case float64:
+			if math.IsInf(v, 0) || math.IsNaN(v) {
+				return nil, yamlNodeErrorf(node, "%q can't be represented "+
+					"in JSON", node.Value)
+			}
+			return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+		}
+	}
+	return nil, yamlNodeErrorf(node, "unsupported tag %q", node.Tag)
+}
+
+// Converts JSON into YAML, keeping the order of the object's keys
+func JSONToYAML(buf []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+
+	node, err := readJSONNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("Extra data after the JSON value")
+	}
+
+	res := &bytes.Buffer{}
+	enc := yaml.NewEncoder(res)
+	enc.SetIndent(2)
+	if err = enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err = enc.Close(); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// Reads the next JSON value from "dec" as a yaml.v3 node
+func readJSONNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok := tok.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if tok == '{' {
+			node = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				keyNode := &yaml.Node{}
+				if err = keyNode.Encode(key); err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, keyNode)
+			}
+			child, err := readJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		// Empty ones can't be in block style
+		if len(node.Content) == 0 {
+			node.Style = yaml.FlowStyle
+		}
+		_, err = dec.Token() // } or ]
+		return node, err
+
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(tok.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag,
+			Value: tok.String()}, nil
+	}
+
+	// Strings, bools and null. Encode() knows when strings need quotes.
+	node := &yaml.Node{}
+	if err = node.Encode(tok); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
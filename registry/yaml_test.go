@@ -0,0 +1,248 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	tests := []struct {
+		yaml string
+		json string // "" means it should fail
+	}{
+		{"", `null`},
+		{"# just a comment\n", `null`},
+		{"hello", `"hello"`},
+		{"--- 5", `5`},
+		{"---\na: 1\n...\n", `{"a":1}`},
+		{"a: 1\nb: two\nc: true\nd: null\ne: ~\nf:\ng: 1.50\nh: -3\n",
+			`{"a":1,"b":"two","c":true,"d":null,"e":null,"f":null,"g":1.50,"h":-3}`},
+		{"yes: no\non: off\nver: 1.2.3\nx: 0x1F\ny: +5\nz: .5\n",
+			`{"yes":"no","on":"off","ver":"1.2.3","x":31,"y":5,"z":0.5}`},
+		{"url: http://example.com:8080/x # comment\n",
+			`{"url":"http://example.com:8080/x"}`},
+		{"a:\n  b:\n    c: 1\n  d: 2\ne: 3\n",
+			`{"a":{"b":{"c":1},"d":2},"e":3}`},
+		{"- a\n- b\n-\n  - c\n- - d\n  - e\n",
+			`["a","b",["c"],["d","e"]]`},
+		{"list:\n- a\n- b\nnext: 1\n", `{"list":["a","b"],"next":1}`},
+		{"- name: x\n  val: 1\n- name: y\n", `[{"name":"x","val":1},{"name":"y"}]`},
+		{"- \n- x", `[null,"x"]`},
+		{`a: "quoted: \"yes\"\n\u00e9"` + "\nb: 'it''s'\n",
+			`{"a":"quoted: \"yes\"\né","b":"it's"}`},
+		{"\"key 1\": v\n'key: 2': w\n", `{"key 1":"v","key: 2":"w"}`},
+		{"a: \"line\n  two\n\n  three\"\n", `{"a":"line two\nthree"}`},
+		{"a: this is\n  a long\n  string\nb: 1\n",
+			`{"a":"this is a long string","b":1}`},
+		{"a: [1, two, \"three\", [4]]\nb: {x: 1, y: [a, b], z}\n",
+			`{"a":[1,"two","three",[4]],"b":{"x":1,"y":["a","b"],"z":null}}`},
+		{"a: [\n  1,\n  2, # comment\n]\n", `{"a":[1,2]}`},
+		{"a: {}\nb: []\n", `{"a":{},"b":[]}`},
+		{"a: |\n  line 1\n    indented\n\n  line 3\nb: 1\n",
+			`{"a":"line 1\n  indented\n\nline 3\n","b":1}`},
+		{"a: |-\n  x\n  y\n\n", `{"a":"x\ny"}`},
+		{"a: |+\n  x\n\nb: 1\n", `{"a":"x\n\n","b":1}`},
+		{"a: >\n  folded\n  text\n\n  para\nb: 1\n",
+			`{"a":"folded text\npara\n","b":1}`},
+		{"a: >-\n  x\n    more\n  y\n", `{"a":"x\n  more\ny"}`},
+		{"- |\n  doc\n- x\n", `["doc\n","x"]`},
+		{"a: &anc\n  x: 1\nb: *anc\nc: &s str\nd: *s\n",
+			`{"a":{"x":1},"b":{"x":1},"c":"str","d":"str"}`},
+		{"a: !!str 123\nb: !!str true\n", `{"a":"123","b":"true"}`},
+		{"a: 12345678901234567890\n", `{"a":12345678901234567890}`},
+
+		{"a: 1\na: 2\n", ""},
+		{"a: 1\n b: 2\n", ""},
+		{"a:\n\t- x\n", ""},
+		{"a: 1\n---\nb: 2\n", ""},
+		{"a: [1, 2\n", ""},
+		{"a: \"open\n", ""},
+		{"a: *nope\n", ""},
+		{"? [complex]\n: key\n", ""},
+		{"a: !foo x\n", ""},
+		{"a: b: c\n", ""},
+		{"a: \"\\q\"\n", ""},
+	}
+
+	for _, test := range tests {
+		got, err := YAMLToJSON([]byte(test.yaml))
+		if test.json == "" {
+			if err == nil {
+				t.Errorf("YAML %q should fail, got: %s", test.yaml, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("YAML %q: %s", test.yaml, err)
+			continue
+		}
+		if string(got) != test.json {
+			t.Errorf("YAML %q:\nGot: %s\nExp: %s", test.yaml, got, test.json)
+		}
+	}
+}
+
+func TestYAMLAliasLimit(t *testing.T) {
+	// Each level is 10 copies of the one before it
+	bomb := func(levels int, flow bool) string {
+		str := "a0: &a0 x\n"
+		for i := 1; i <= levels; i++ {
+			aliases := []string{}
+			for j := 0; j < 10; j++ {
+				aliases = append(aliases, fmt.Sprintf("*a%d", i-1))
+			}
+			if flow {
+				str += fmt.Sprintf("a%d: &a%d [%s]\n", i, i,
+					strings.Join(aliases, ", "))
+			} else {
+				str += fmt.Sprintf("a%d: &a%d\n  - %s\n", i, i,
+					strings.Join(aliases, "\n  - "))
+			}
+		}
+		return str
+	}
+
+	for _, flow := range []bool{false, true} {
+		_, err := YAMLToJSON([]byte(bomb(6, flow)))
+		if err == nil || !strings.Contains(err.Error(), "too many nodes") {
+			t.Fatalf("Flow(%v) should have failed: %v", flow, err)
+		}
+	}
+
+	// But a few levels are fine
+	for _, flow := range []bool{false, true} {
+		if _, err := YAMLToJSON([]byte(bomb(4, flow))); err != nil {
+			t.Fatalf("Flow(%v): %s", flow, err)
+		}
+	}
+}
+
+func TestJSONToYAML(t *testing.T) {
+	in := `{
+  "id": "x",
+  "epoch": 1,
+  "ok": true,
+  "none": null,
+  "num": 1.5e+06,
+  "strs": [ "", "123", "true", "- x", "-x", "a: b", "a #b", " lead", "x:",
+            "null", "{x}", "tab\there", "line1\nline2\n", "end\n", "é" ],
+  "empty": {}, "list": [],
+  "nested": { "b": { "c": [ 1, { "d": 2, "e": [ 3, [ 4 ] ] } ] } },
+  "seqs": [ [ 1, 2 ], [], {} ],
+  "doc": "x\n\ny",
+  "odd key": 1, "": 2, "z": 0
+}`
+	exp := `id: x
+epoch: 1
+ok: true
+none: null
+num: 1.5e+06
+strs:
+  - ""
+  - "123"
+  - "true"
+  - '- x'
+  - -x
+  - 'a: b'
+  - 'a #b'
+  - ' lead'
+  - 'x:'
+  - "null"
+  - '{x}'
+  - "tab\there"
+  - |
+    line1
+    line2
+  - |
+    end
+  - é
+empty: {}
+list: []
+nested:
+  b:
+    c:
+      - 1
+      - d: 2
+        e:
+          - 3
+          - - 4
+seqs:
+  - - 1
+    - 2
+  - []
+  - {}
+doc: |-
+  x
+
+  y
+odd key: 1
+"": 2
+z: 0
+`
+	got, err := JSONToYAML([]byte(in))
+	if err != nil {
+		t.Fatalf("JSONToYAML: %s", err)
+	}
+	if string(got) != exp {
+		t.Fatalf("Got:\n%s\nExp:\n%s", got, exp)
+	}
+
+	// And it should round-trip
+	back, err := YAMLToJSON(got)
+	if err != nil {
+		t.Fatalf("YAMLToJSON: %s\n%s", err, got)
+	}
+	var gotObj, expObj any
+	json.Unmarshal(back, &gotObj)
+	json.Unmarshal([]byte(in), &expObj)
+	if ToJSON(gotObj) != ToJSON(expObj) {
+		t.Fatalf("Round-trip failed:\n%s\n%s", ToJSON(gotObj), ToJSON(expObj))
+	}
+
+	if _, err = JSONToYAML([]byte(`{"a":1} x`)); err == nil {
+		t.Fatalf("Trailing data should fail")
+	}
+}
+
+func TestAcceptsYAML(t *testing.T) {
+	for accept, exp := range map[string]bool{
+		"":                                   false,
+		"application/json":                   false,
+		"application/yaml":                   true,
+		"text/yaml; charset=utf-8":           true,
+		"application/json, application/yaml": false,
+		"application/yaml, application/json": true,
+		"application/json;q=0.5, application/x-yaml": true,
+		"*/*":                               false,
+		"text/html, application/yaml;q=0.9": true,
+	} {
+		if got := AcceptsYAML(accept); got != exp {
+			t.Errorf("AcceptsYAML(%q) should be %v", accept, exp)
+		}
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	// Strings that older (YAML 1.1) parsers would turn into something else
+	// need quotes too
+	for str, exp := range map[string]string{
+		"plain":                "plain",
+		"yes":                  `"yes"`,
+		"Off":                  `"Off"`,
+		"2024-01-01T12:00:01Z": `"2024-01-01T12:00:01Z"`,
+		"2024-01-01":           `"2024-01-01"`,
+		"12:30":                `"12:30"`,
+		"v1.2":                 "v1.2",
+		"1.2.3":                "1.2.3",
+	} {
+		got, err := JSONToYAML([]byte(ToJSON(map[string]any{"a": str})))
+		if err != nil {
+			t.Fatalf("JSONToYAML(%q): %s", str, err)
+		}
+		if string(got) != "a: "+exp+"\n" {
+			t.Errorf("%q should be %s, not %s", str, exp, got)
+		}
+	}
+}
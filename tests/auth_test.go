@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+func TestAuthHTTP(t *testing.T) {
+	reg := NewRegistry("TestAuthHTTP")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	xNoErr(t, reg.Commit())
+
+	auth := &registry.Auth{
+		Authenticators: []registry.Authenticator{
+			&registry.TokenAuthenticator{Tokens: map[string]string{
+				"tok1": "bot",
+				"tok2": "admin",
+			}},
+			&registry.BasicAuthenticator{Users: map[string]string{
+				"john": "pwd",
+			}},
+		},
+		Rules: []*registry.AuthRule{
+			{Users: []string{"anonymous", "*"}, Access: "read"},
+			{Users: []string{"bot"}, Access: "write", Path: "/dirs/d1"},
+			{Users: []string{"bot"}, Access: "write", Path: "/import"},
+			{Users: []string{"admin"}, Access: "write",
+				Registry: "TestAuthHTTP"},
+		},
+	}
+	xNoErr(t, auth.Verify())
+
+	server := httptest.NewServer(&registry.Server{Auth: auth})
+	defer server.Close()
+
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte("john:pwd"))
+
+	for _, test := range []struct {
+		method, url, authz, body string
+		code                     int
+		resBody                  string // just the start of it
+		challenge                string
+	}{
+		{"GET", "/dirs", "", "", 200, "{}", ""},
+		{"PUT", "/dirs/d1", "", "{}", 401, "Authentication is required\n",
+			`Bearer realm="xRegistry", Basic realm="xRegistry"`},
+		{"PUT", "/dirs/d1", "Bearer foo", "{}", 401, "Invalid credentials\n",
+			`Bearer realm="xRegistry", Basic realm="xRegistry"`},
+		{"PUT", "/dirs/d1", "Basic foo", "{}", 401,
+			"Invalid basic auth credentials\n",
+			`Bearer realm="xRegistry", Basic realm="xRegistry"`},
+		{"PUT", "/dirs/d1", basic, "{}", 403,
+			"User \"john\" isn't allowed to write \"/dirs/d1\"\n", ""},
+		{"GET", "/dirs", basic, "", 200, "{}", ""},
+		{"PUT", "/dirs/d1", "Bearer tok1", "{}", 201, "{", ""},
+		{"PUT", "/dirs/d1/files/f1", "Bearer tok1", "hello", 201, "hello", ""},
+		{"PUT", "/dirs/d2", "Bearer tok1", "{}", 403,
+			"User \"bot\" isn't allowed to write \"/dirs/d2\"\n", ""},
+		{"PUT", "/model", "Bearer tok1", "{}", 403,
+			"User \"bot\" isn't allowed to write \"/model\"\n", ""},
+		// Each entity in a bulk import is checked, and one that isn't
+		// allowed rejects them all
+		{"POST", "/import", "Bearer tok1",
+			`{"path":"/dirs/d1/files/f2","document":"aGk="}` + "\n" +
+				`{"path":"/dirs/d3"}`, 403, `{
+  "entities": 2,
+  "committed": 0,
+  "errors": [
+    {
+      "entity": 2,
+      "path": "/dirs/d3",
+      "error": "User \"bot\" isn't allowed to write \"/dirs/d3\""
+    }
+  ]
+}
+`, ""},
+		{"GET", "/dirs/d1/files/f2", "", "", 404, "Not found\n", ""},
+		{"POST", "/import", "Bearer tok1",
+			`{"path":"/dirs/d1/files/f2","document":"aGk="}`, 200, `{
+  "entities": 1,
+  "committed": 1
+}
+`, ""},
+		{"GET", "/dirs/d1/files/f2", "", "", 200, "hi", ""},
+		{"DELETE", "/dirs/d1", "", "", 401, "Authentication is required\n",
+			`Bearer realm="xRegistry", Basic realm="xRegistry"`},
+		{"PUT", "/dirs/d2", "Bearer tok2", "{}", 201, "{", ""},
+		{"DELETE", "/dirs/d1", "Bearer tok2", "", 204, "", ""},
+		{"GET", "/dirs/d2", "", "", 200, "{", ""},
+		// Callers w/o access don't get to see why the request is invalid
+		{"PUT", "/dirs/d1/files/f1/versions/v1/foo", "", "{}", 401,
+			"Authentication is required\n",
+			`Bearer realm="xRegistry", Basic realm="xRegistry"`},
+		{"PUT", "/dirs/d1/files/f1/versions/v1/foo", "Basic foo", "{}", 401,
+			"Invalid basic auth credentials\n",
+			`Bearer realm="xRegistry", Basic realm="xRegistry"`},
+		{"PUT", "/dirs/d1/files/f1/versions/v1/foo", basic, "{}", 403,
+			"User \"john\" isn't allowed to write", ""},
+		{"PUT", "/dirs/d1/files/f1/versions/v1/foo", "Bearer tok2", "{}",
+			400, "", ""},
+	} {
+		name := test.method + " " + test.url + " " + test.authz
+		req, err := http.NewRequest(test.method, server.URL+test.url,
+			strings.NewReader(test.body))
+		xNoErr(t, err)
+		if test.authz != "" {
+			req.Header.Set("Authorization", test.authz)
+		}
+		res, err := http.DefaultClient.Do(req)
+		xNoErr(t, err)
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		xCheck(t, res.StatusCode == test.code, "%s: expected %d, got %d\n%s",
+			name, test.code, res.StatusCode, string(body))
+		xCheck(t, strings.HasPrefix(string(body), test.resBody),
+			"%s: expected body to start with %q, got:\n%s", name,
+			test.resBody, string(body))
+		xCheckEqual(t, name+"\nWWW-Authenticate:\n",
+			res.Header.Get("WWW-Authenticate"), test.challenge)
+	}
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"testing"
+)
+
+func TestBulkImport(t *testing.T) {
+	reg := NewRegistry("TestBulkImport")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("notes", "note", 0, true, true, false)
+	xNoErr(t, err)
+
+	// All or nothing
+	xHTTP(t, reg, "POST", "/import", `
+{"path":"/","attributes":{"name":"bulk"}}
+{"path":"dirs/d1","attributes":{"labels":{"env":"prod"}}}
+{"path":"dirs/d1/files/f1/versions/v1","document":"aGVsbG8="}
+{"path":"dirs/d1/files/f1/versions/v2","attributes":{"file":{"a":1}}}
+{"path":"dirs/d2/notes/n1","attributes":{"name":"note"}}
+`, 200, `{
+  "entities": 5,
+  "committed": 5
+}
+`)
+
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v1$meta?inline=file", "",
+		200, `{
+  "id": "v1",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1/files/f1/versions/v1$meta",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+  "filebase64": "aGVsbG8="
+}
+`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1$meta?inline=file", "", 200, `{
+  "id": "f1",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1/files/f1$meta",
+  "defaultversionid": "v2",
+  "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/v2$meta",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:01Z",
+  "contenttype": "application/json",
+  "contentdigest": "sha256:015abd7f5cc57a2dd94b7590f04ad8084273905ee33ec5cebeae62276a97f862",
+  "file": {
+    "a": 1
+  },
+
+  "versionscount": 2,
+  "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
+}
+`)
+	xHTTP(t, reg, "GET", "/dirs/d2/notes/n1", "", 200, `{
+  "id": "n1",
+  "name": "note",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d2/notes/n1",
+  "defaultversionid": "1",
+  "defaultversionurl": "http://localhost:8181/dirs/d2/notes/n1/versions/1",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:01Z",
+
+  "versionscount": 1,
+  "versionsurl": "http://localhost:8181/dirs/d2/notes/n1/versions"
+}
+`)
+
+	// Any error means nothing is saved, but all errors are reported
+	xHTTP(t, reg, "POST", "/import", `
+{"path":"dirs/d3"}
+{"path":"foos/f1"}
+{"path":"dirs/d3/notes/n1","document":"aGVsbG8="}
+{"path":"dirs/d3/files"}
+{"path":"model"}
+{"path":"dirs/d3/files/f1","attributes":{"id":"f2"}}
+`, 400, `{
+  "entities": 6,
+  "committed": 0,
+  "errors": [
+    {
+      "entity": 2,
+      "path": "foos/f1",
+      "error": "Unknown Group type: foos"
+    },
+    {
+      "entity": 3,
+      "path": "dirs/d3/notes/n1",
+      "error": "Resource type \"notes\" doesn't have documents"
+    },
+    {
+      "entity": 4,
+      "path": "dirs/d3/files",
+      "error": "Invalid \"path\" value (dirs/d3/files): must be the path to an entity in the registry"
+    },
+    {
+      "entity": 5,
+      "path": "model",
+      "error": "Invalid \"path\" value (model): must be the path to an entity in the registry"
+    },
+    {
+      "entity": 6,
+      "path": "dirs/d3/files/f1",
+      "error": "The \"id\" attribute must be set to \"f1\", not \"f2\""
+    }
+  ]
+}
+`)
+	xHTTP(t, reg, "GET", "/dirs/d3", "", 404, "Not found\n")
+
+	// Batches are committed on their own, and a bad one is rolled back
+	xHTTP(t, reg, "POST", "/import?batch=2", `
+{"path":"dirs/d4"}
+{"path":"dirs/d5"}
+{"path":"dirs/d6"}
+{"path":"dirs/d7","attributes":{"epoch":"x"}}
+{"path":"dirs/d8"}
+{"path":"dirs/d9"
+`, 400, `{
+  "entities": 6,
+  "committed": 2,
+  "errors": [
+    {
+      "entity": 4,
+      "path": "dirs/d7",
+      "error": "Attribute \"epoch\" must be a uinteger"
+    },
+    {
+      "entity": 6,
+      "error": "Error parsing entity: unexpected EOF"
+    }
+  ]
+}
+`)
+	xStatus(t, reg, "GET", "/dirs/d4", "", 200)
+	xStatus(t, reg, "GET", "/dirs/d5", "", 200)
+	xStatus(t, reg, "GET", "/dirs/d6", "", 404)
+	xStatus(t, reg, "GET", "/dirs/d8", "", 404)
+
+	xHTTP(t, reg, "GET", "/import", "", 405, "GET not allowed on /import\n")
+	xHTTP(t, reg, "POST", "/import/foo", "", 404, "Not found\n")
+	xHTTP(t, reg, "POST", "/import?batch=0", "", 400,
+		"Invalid \"batch\" value (0), must be an integer greater than zero\n")
+}
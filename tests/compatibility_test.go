@@ -0,0 +1,96 @@
+package tests
+
+import (
+	"testing"
+)
+
+func TestCompatibility(t *testing.T) {
+	reg := NewRegistry("TestCompatibility")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	rm, err := gm.AddResourceModel("schemas", "schema", 0, true, true, true)
+	xNoErr(t, err)
+
+	xCheckErr(t, rm.SetCompatibility("sideways"),
+		`Resource "schemas" has an invalid 'compatibility' value (sideways). `+
+			`Must be one of: none, backward, backward_transitive, forward, `+
+			`forward_transitive, full, full_transitive`)
+	xCheckEqual(t, "", rm.Compatibility, "")
+	xNoErr(t, rm.SetCompatibility("backward"))
+	xNoErr(t, reg.Commit())
+	rm = reg.LoadModel().FindGroupModel("dirs").Resources["schemas"]
+	xCheckEqual(t, "", rm.Compatibility, "backward")
+
+	ct := `"contenttype":"application/schema+json"`
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s1/versions/1$meta",
+		`{`+ct+`,"schema":{"properties":{"a":{"type":"string"}}}}`, 201)
+
+	// New optional property is fine
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s1/versions/2$meta",
+		`{`+ct+`,"schema":{"properties":{"a":{"type":"string"},`+
+			`"b":{"type":"integer"}}}}`, 201)
+
+	// Only checked against the default Version
+	xHTTP(t, reg, "PUT", "/dirs/d1/schemas/s1/versions/3$meta",
+		`{`+ct+`,"schema":{"properties":{"a":{"type":"integer"},`+
+			`"b":{"type":"integer"}},"required":["b"]}}`, 400,
+		`Version "3" isn't backward compatible with Version "2", it can't `+
+			`read data written with it:
+- "required": "b" is required
+- "properties.a.type": type "string" isn't accepted
+`)
+	xStatus(t, reg, "GET", "/dirs/d1/schemas/s1/versions/3", "", 404)
+
+	// Updating an existing Version isn't checked
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s1/versions/1$meta",
+		`{`+ct+`,"schema":{"type":"object"}}`, 200)
+
+	// Transitive + full checks all Versions, both ways
+	xStatus(t, reg, "PUT", "/model", `{
+  "groups": {
+    "dirs": {
+      "plural": "dirs",
+      "singular": "dir",
+      "resources": {
+        "schemas": {
+          "plural": "schemas",
+          "singular": "schema",
+          "compatibility": "full_transitive"
+        }
+      }
+    }
+  }
+}`, 200)
+
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s2/versions/1$meta",
+		`{"contenttype":"application/vnd.apache.avro+json",`+
+			`"schema":{"type":"record","name":"r","fields":[`+
+			`{"name":"a","type":"int"}]}}`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s2/versions/2$meta",
+		`{"contenttype":"application/vnd.apache.avro+json",`+
+			`"schema":{"type":"record","name":"r","fields":[`+
+			`{"name":"a","type":"int"},`+
+			`{"name":"b","type":"string","default":""}]}}`, 201)
+	xHTTP(t, reg, "PUT", "/dirs/d1/schemas/s2/versions/3$meta",
+		`{"contenttype":"application/vnd.apache.avro+json",`+
+			`"schema":{"type":"record","name":"r","fields":[`+
+			`{"name":"b","type":"string","default":""}]}}`, 400,
+		`Version "3" isn't forward compatible with Version "1", Version "1" `+
+			`can't read data written with it:
+- "fields[0]": field "a" is missing and has no default
+Version "3" isn't forward compatible with Version "2", Version "2" `+
+			`can't read data written with it:
+- "fields[0]": field "a" is missing and has no default
+`)
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s2/versions/3$meta",
+		`{"contenttype":"application/vnd.apache.avro+json",`+
+			`"schema":{"type":"record","name":"r","fields":[`+
+			`{"name":"a","type":"int"},`+
+			`{"name":"b","type":"string","default":""},`+
+			`{"name":"c","type":["null","long"],"default":null}]}}`, 201)
+
+	// Documents w/o a known format aren't checked
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s2/versions/4", "anything", 201)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -209,6 +211,14 @@ func CompareContentMeta(t *testing.T, reg *registry.Registry, test *Test) {
 			name = "xregistry-contenttype"
 		}
 
+		// The contentdigest is sent as a "Digest" header
+		if name == "digest" {
+			digest, _ := metaProps["contentdigest"].(string)
+			xCheckEqual(t, "", value[0], registry.DigestHeader(digest))
+			delete(metaProps, "contentdigest")
+			continue
+		}
+
 		if !strings.HasPrefix(name, "xregistry-") {
 			continue
 		}
@@ -276,3 +286,64 @@ func CompareContentMeta(t *testing.T, reg *registry.Registry, test *Test) {
 		t.Fatalf("Extra prop %q in $meta, not in header: %s", propName, u)
 	}
 }
+
+func TestResourceContentsBlobStore(t *testing.T) {
+	reg := NewRegistry("TestResourceContentsBlobStore")
+	defer PassDeleteReg(t, reg)
+
+	store, err := registry.NewFSBlobStore(t.TempDir())
+	xNoErr(t, err)
+	registry.SetBlobStore(store)
+	defer registry.SetBlobStore(nil)
+
+	gm, _ := reg.Model.AddGroupModel("dirs", "dir")
+	gm.AddResourceModel("files", "file", 0, true, true, true)
+
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1", "Hello blob store", 201)
+
+	digest := registry.ContentDigest([]byte("Hello blob store"))
+	hex := digest[len("sha256:"):]
+	file := store.Dir + "/" + hex[:2] + "/" + hex
+	buf, err := os.ReadFile(file)
+	xNoErr(t, err)
+	xCheckEqual(t, "", string(buf), "Hello blob store")
+
+	CompareContentMeta(t, reg, &Test{
+		Code:    200,
+		URL:     "dirs/d1/files/f1",
+		Body:    "Hello blob store",
+		Headers: []string{"Digest: " + registry.DigestHeader(digest)},
+	})
+
+	// Uploads are streamed into the store under a temporary name, which
+	// is gone once they're renamed to their digest
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/2", "Hello blob store",
+		201)
+	tmps, _ := filepath.Glob(store.Dir + "/*/tmp-*")
+	xCheck(t, len(tmps) == 0, "Temporary blobs left behind: %v", tmps)
+
+	xCheckHTTP(t, reg, &HTTPTest{
+		URL:        "/dirs/d1/files/f2",
+		Method:     "PUT",
+		ReqHeaders: []string{"xRegistry-fileurl: http://example.com"},
+		ReqBody:    "Some other doc",
+		Code:       400,
+		ResBody:    "'xRegistry-fileurl' isn't allowed if there's a body\n",
+	})
+	other := registry.ContentDigest([]byte("Some other doc"))[len("sha256:"):]
+	_, err = os.Stat(store.Dir + "/" + other[:2] + "/" + other)
+	xCheck(t, os.IsNotExist(err), "Rejected blob should be gone: %v", err)
+
+	xStatus(t, reg, "DELETE", "/dirs/d1/files/f1", "", 204)
+	_, err = os.Stat(file)
+	xCheck(t, os.IsNotExist(err), "Blob should be gone: %v", err)
+
+	// Removing the Resource type from the model removes its blobs too
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1", "Hello blob store", 201)
+	_, err = os.Stat(file)
+	xNoErr(t, err)
+	xStatus(t, reg, "PUT", "/model",
+		`{"groups":{"dirs":{"plural":"dirs","singular":"dir"}}}`, 200)
+	_, err = os.Stat(file)
+	xCheck(t, os.IsNotExist(err), "Blob should be gone: %v", err)
+}
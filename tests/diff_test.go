@@ -0,0 +1,148 @@
+package tests
+
+import (
+	"testing"
+)
+
+func TestVersionDiff(t *testing.T) {
+	reg := NewRegistry("TestVersionDiff")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	rm, err := gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	xNoErr(t, rm.AddTypeMap("text/*", "string"))
+
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1$meta",
+		`{"name":"one","labels":{"a":"1"},"file":{"x":1,"y":[1,2]}}`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2$meta",
+		`{"description":"two","labels":{"a":"2"},"file":{"x":1,"y":[1,3],"z":true}}`,
+		201)
+
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v2?diff=v1", "", 200, `{
+  "fromversionid": "v1",
+  "toversionid": "v2",
+  "attributes": [
+    {
+      "op": "remove",
+      "path": "/name"
+    },
+    {
+      "op": "replace",
+      "path": "/contentdigest",
+      "value": "sha256:2acd7306462ab577a9c28009c9af8044a6d9e3f13d45a281aa75b9b7445c2826"
+    },
+    {
+      "op": "replace",
+      "path": "/createdat",
+      "value": "2024-01-01T12:00:02Z"
+    },
+    {
+      "op": "add",
+      "path": "/description",
+      "value": "two"
+    },
+    {
+      "op": "replace",
+      "path": "/labels/a",
+      "value": "2"
+    },
+    {
+      "op": "replace",
+      "path": "/modifiedat",
+      "value": "2024-01-01T12:00:02Z"
+    }
+  ],
+  "documentdiff": "jsonpatch",
+  "document": [
+    {
+      "op": "replace",
+      "path": "/y/1",
+      "value": 3
+    },
+    {
+      "op": "add",
+      "path": "/z",
+      "value": true
+    }
+  ]
+}
+`)
+
+	// Resource form uses the default Version, and text docs get a unified diff
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f2/versions/v1$meta",
+		`{"contenttype":"text/plain","file":"a\nb\nc\n"}`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f2/versions/v2$meta",
+		`{"contenttype":"text/plain","file":"a\nB\nc\n"}`, 201)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f2$meta?diff=v1", "", 200, `{
+  "fromversionid": "v1",
+  "toversionid": "v2",
+  "attributes": [
+    {
+      "op": "replace",
+      "path": "/contentdigest",
+      "value": "sha256:4c6508965080889a0cd0250e5816021ff3b87c1c95891251f9642b67c42c8137"
+    },
+    {
+      "op": "replace",
+      "path": "/createdat",
+      "value": "2024-01-01T12:00:02Z"
+    },
+    {
+      "op": "replace",
+      "path": "/modifiedat",
+      "value": "2024-01-01T12:00:02Z"
+    }
+  ],
+  "documentdiff": "unified",
+  "document": "--- v1\n+++ v2\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+}
+`)
+
+	// Binary docs just say they're different
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f2/versions/v3$meta",
+		`{"contenttype":"image/png","filebase64":"AAEC"}`, 201)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f2/versions/v3?diff=v2", "", 200, `{
+  "fromversionid": "v2",
+  "toversionid": "v3",
+  "attributes": [
+    {
+      "op": "replace",
+      "path": "/contentdigest",
+      "value": "sha256:ae4b3280e56e2faf83f414a6e3dabe9d5fbe18976544c05fed121accb85b53fc"
+    },
+    {
+      "op": "replace",
+      "path": "/contenttype",
+      "value": "image/png"
+    },
+    {
+      "op": "replace",
+      "path": "/createdat",
+      "value": "2024-01-01T12:00:03Z"
+    },
+    {
+      "op": "replace",
+      "path": "/modifiedat",
+      "value": "2024-01-01T12:00:03Z"
+    }
+  ],
+  "documentdiff": "binary"
+}
+`)
+
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f2/versions/v3?diff=v3", "", 200, `{
+  "fromversionid": "v3",
+  "toversionid": "v3",
+  "attributes": []
+}
+`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f2/versions/v3?diff=v9", "", 404,
+		"Version \"v9\" not found\n")
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f9?diff=v1", "", 404, "Not found\n")
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f2?diff", "", 400,
+		"?diff must specify the Version to compare with\n")
+	xHTTP(t, reg, "GET", "/dirs/d1?diff=v1", "", 400,
+		"?diff is only allowed on a Resource or a Version\n")
+}
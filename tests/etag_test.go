@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+type ETagTest struct {
+	Name       string
+	Method     string
+	URL        string
+	ReqHeaders []string // name:value
+	ReqBody    string
+
+	Code    int
+	ETag    string // "" means don't check it, a trailing "*" is a prefix
+	ResBody string // "*" means don't check it
+}
+
+// Returns the response's ETag
+func xCheckETag(t *testing.T, reg *registry.Registry, test *ETagTest) string {
+	t.Helper()
+	xNoErr(t, reg.Commit())
+
+	req, err := http.NewRequest(test.Method, "http://localhost:8181"+test.URL,
+		bytes.NewReader([]byte(test.ReqBody)))
+	xNoErr(t, err)
+	for _, header := range test.ReqHeaders {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+	res, err := client.Do(req)
+	xNoErr(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	xCheck(t, res.StatusCode == test.Code, "%s: expected status %d, got %d\n%s",
+		test.Name, test.Code, res.StatusCode, string(body))
+	etag := res.Header.Get("ETag")
+	if prefix, ok := strings.CutSuffix(test.ETag, "*"); ok {
+		xCheck(t, strings.HasPrefix(etag, prefix),
+			"%s\nETag: expected %s, got %s", test.Name, test.ETag, etag)
+	} else if test.ETag != "" {
+		xCheckEqual(t, test.Name+"\nETag:\n", etag, test.ETag)
+	}
+	if test.ResBody != "*" {
+		xCheckEqual(t, test.Name+"\nBody:\n", string(body), test.ResBody)
+	}
+	return etag
+}
+
+func TestETagBasic(t *testing.T) {
+	reg := NewRegistry("TestETagBasic")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+
+	// sha256 of "hello" and "world"
+	helloTag := `"2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"`
+	worldTag := `"486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"`
+
+	tests := []ETagTest{
+		{"create d1", "PUT", "/dirs/d1",
+			nil, `{}`, 201, `"1"`,
+			"*"},
+		{"get d1", "GET", "/dirs/d1",
+			nil, "", 200, `"1"`,
+			"*"},
+		{"get d1 - if-none-match", "GET", "/dirs/d1",
+			[]string{`If-None-Match:"1"`}, "", 304, `"1"`,
+			""},
+		{"get d1 - if-none-match weak, list", "GET", "/dirs/d1",
+			[]string{`If-None-Match:"5", W/"1"`}, "", 304, `"1"`,
+			""},
+		{"get d1 - if-none-match no match", "GET", "/dirs/d1",
+			[]string{`If-None-Match:"2"`}, "", 200, `"1"`,
+			"*"},
+		{"get dirs - no etag on collections", "GET", "/dirs",
+			[]string{`If-None-Match:*`}, "", 200, "",
+			"*"},
+		{"update d1 - if-match no match", "PUT", "/dirs/d1",
+			[]string{`If-Match:"2"`}, `{}`, 412, "",
+			"If-Match (\"2\") doesn't match the current ETag (\"1\")\n"},
+		{"update d1 - if-match weak", "PATCH", "/dirs/d1",
+			[]string{`If-Match:W/"1"`}, `{}`, 412, "",
+			"If-Match (W/\"1\") doesn't match the current ETag (\"1\")\n"},
+		{"update d1 - if-match", "PUT", "/dirs/d1",
+			[]string{`If-Match:"1"`}, `{}`, 200, `"2"`,
+			"*"},
+		{"create d2 - if-match *", "PUT", "/dirs/d2",
+			[]string{`If-Match:*`}, `{}`, 412, "",
+			"If-Match (*) doesn't match the current ETag (none)\n"},
+		{"create d2 - if-none-match *", "PUT", "/dirs/d2",
+			[]string{`If-None-Match:*`}, `{}`, 201, `"1"`,
+			"*"},
+		{"create d2 again - if-none-match *", "PUT", "/dirs/d2",
+			[]string{`If-None-Match:*`}, `{}`, 412, "",
+			"If-None-Match (*) matches the current ETag (\"1\")\n"},
+		{"post to collection - if-match", "POST", "/dirs",
+			[]string{`If-Match:"1"`}, `{"d3":{}}`, 412, "",
+			"If-Match (\"1\") doesn't match the current ETag (none)\n"},
+
+		// Documents use a hash of the content, metadata uses the epoch
+		{"create f1", "PUT", "/dirs/d1/files/f1",
+			nil, `hello`, 201, helloTag,
+			"hello"},
+		{"get f1", "GET", "/dirs/d1/files/f1",
+			nil, "", 200, helloTag,
+			"hello"},
+		{"get f1 - if-none-match", "GET", "/dirs/d1/files/f1",
+			[]string{"If-None-Match:" + helloTag}, "", 304, helloTag,
+			""},
+		{"get f1 version", "GET", "/dirs/d1/files/f1/versions/1",
+			nil, "", 200, helloTag,
+			"hello"},
+		// A Resource's metadata includes its versionscount, so its ETag
+		// has a hash of its Versions. "$ETAG" is the last ETag checked
+		// w/a "*".
+		{"get f1$meta", "GET", "/dirs/d1/files/f1$meta",
+			nil, "", 200, `"1-1-*`,
+			"*"},
+		{"get f1$meta - if-none-match", "GET", "/dirs/d1/files/f1$meta",
+			[]string{`If-None-Match:$ETAG`}, "", 304, `"1-1-*`,
+			""},
+		{"update f1 - if-match wrong hash", "PUT", "/dirs/d1/files/f1",
+			[]string{"If-Match:" + worldTag}, `world`, 412, "",
+			"*"},
+		{"update f1 - if-match", "PUT", "/dirs/d1/files/f1",
+			[]string{"If-Match:" + helloTag}, `world`, 200, worldTag,
+			"world"},
+		{"update f1$meta - if-match content hash", "PATCH", "/dirs/d1/files/f1$meta",
+			[]string{"If-Match:" + worldTag}, `{}`, 412, "",
+			"*"},
+		{"get f1$meta - updated", "GET", "/dirs/d1/files/f1$meta",
+			nil, "", 200, `"1-2-*`,
+			"*"},
+		{"update f1$meta - if-match", "PATCH", "/dirs/d1/files/f1$meta",
+			[]string{`If-Match:$ETAG`}, `{}`, 200, `"1-3-*`,
+			"*"},
+		{"new version changes resource etag", "PUT", "/dirs/d1/files/f1/versions/2",
+			nil, `again`, 201, "",
+			"again"},
+		{"get f1$meta - new default", "GET", "/dirs/d1/files/f1$meta",
+			[]string{`If-None-Match:$ETAG`}, "", 200, `"2-1-*`,
+			"*"},
+
+		// Same for a Group's children, and whatever the query includes
+		{"get d1 w/files", "GET", "/dirs/d1",
+			nil, "", 200, `"2-*`,
+			"*"},
+		{"update d1 w/files - if-match", "PATCH", "/dirs/d1",
+			[]string{`If-Match:$ETAG`}, `{}`, 200, `"3-*`,
+			"*"},
+		{"get d1 inline", "GET", "/dirs/d1?inline",
+			nil, "", 200, `"3-*`,
+			"*"},
+		{"update f1's version", "PATCH", "/dirs/d1/files/f1/versions/1$meta",
+			nil, `{"name":"v1"}`, 200, "",
+			"*"},
+		{"get d1 inline - a child changed", "GET", "/dirs/d1?inline",
+			[]string{`If-None-Match:$ETAG`}, "", 200, `"3-*`,
+			"*"},
+		{"get d1 inline - if-none-match", "GET", "/dirs/d1?inline",
+			[]string{`If-None-Match:$ETAG`}, "", 304, `"3-*`,
+			""},
+		{"get d1 - not the inline etag", "GET", "/dirs/d1",
+			[]string{`If-None-Match:$ETAG`}, "", 200, `"3-*`,
+			"*"},
+		{"add f2", "PUT", "/dirs/d1/files/f2",
+			nil, `hi`, 201, "",
+			"hi"},
+		{"get d1 - new child", "GET", "/dirs/d1",
+			[]string{`If-None-Match:$ETAG`}, "", 200, `"3-*`,
+			"*"},
+
+		{"delete d2 - if-match no match", "DELETE", "/dirs/d2",
+			[]string{`If-Match:"5"`}, "", 412, "",
+			"If-Match (\"5\") doesn't match the current ETag (\"1\")\n"},
+		{"delete d2 - if-match", "DELETE", "/dirs/d2",
+			[]string{`If-Match:"1"`}, "", 204, "",
+			""},
+		{"delete d2 again - if-match *", "DELETE", "/dirs/d2",
+			[]string{`If-Match:*`}, "", 412, "",
+			"If-Match (*) doesn't match the current ETag (none)\n"},
+	}
+
+	lastETag := ""
+	for _, test := range tests {
+		for i, header := range test.ReqHeaders {
+			test.ReqHeaders[i] = strings.ReplaceAll(header, "$ETAG", lastETag)
+		}
+		etag := xCheckETag(t, reg, &test)
+		if strings.HasSuffix(test.ETag, "*") {
+			lastETag = etag
+		}
+	}
+}
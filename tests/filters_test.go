@@ -481,3 +481,90 @@ func TestANDORFilters(t *testing.T) {
 		xCheckGet(t, reg, test.URL, test.Exp)
 	}
 }
+
+func TestFilterOperators(t *testing.T) {
+	reg := NewRegistry("TestFilterOperators")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	rm, err := gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	_, err = rm.AddAttr("size", registry.INTEGER)
+	xNoErr(t, err)
+	_, err = rm.AddAttr("when", registry.TIMESTAMP)
+	xNoErr(t, err)
+	_, err = rm.AddAttr("owner", registry.STRING)
+	xNoErr(t, err)
+
+	d, _ := reg.AddGroup("dirs", "d1")
+	d.SetSave("labels.env", "prod")
+	f, _ := d.AddResource("files", "f1", "v1")
+	xNoErr(t, f.SetSave("size", 5))
+	xNoErr(t, f.SetSave("when", "2024-01-01T12:00:00Z"))
+	xNoErr(t, f.SetSave("owner", "alice"))
+
+	d, _ = reg.AddGroup("dirs", "d2")
+	f, _ = d.AddResource("files", "f2", "v1")
+	xNoErr(t, f.SetSave("size", 15))
+	xNoErr(t, f.SetSave("when", "2024-06-01T12:00:00+02:00"))
+	xNoErr(t, f.SetSave("owner", "Bob"))
+
+	d, _ = reg.AddGroup("dirs", "d3")
+	d.AddResource("files", "f3", "v1")
+
+	d1 := `{"dirs":{"d1":{"files":{"f1":{"versions":{"v1":{}}}}}}}`
+	d2 := `{"dirs":{"d2":{"files":{"f2":{"versions":{"v1":{}}}}}}}`
+	d3 := `{"dirs":{"d3":{"files":{"f3":{"versions":{"v1":{}}}}}}}`
+	d12 := `{"dirs":{"d1":{"files":{"f1":{"versions":{"v1":{}}}}},"d2":{"files":{"f2":{"versions":{"v1":{}}}}}}}`
+	d13 := `{"dirs":{"d1":{"files":{"f1":{"versions":{"v1":{}}}}},"d3":{"files":{"f3":{"versions":{"v1":{}}}}}}}`
+	d23 := `{"dirs":{"d2":{"files":{"f2":{"versions":{"v1":{}}}}},"d3":{"files":{"f3":{"versions":{"v1":{}}}}}}}`
+	none := "Not found\n"
+
+	tests := []struct {
+		Name string
+		URL  string
+		Exp  string
+	}{
+		{"int >", "?oneline&inline&filter=dirs.files.size>10", d2},
+		{"int >=", "?oneline&inline&filter=dirs.files.size>=5", d12},
+		{"int <", "?oneline&inline&filter=dirs.files.size<15", d1},
+		{"int <=", "?oneline&inline&filter=dirs.files.size<=15", d12},
+		{"int = numeric", "?oneline&inline&filter=dirs.files.size=5.0", d1},
+		{"int !=", "?oneline&inline&filter=dirs.files.size!=5", d23},
+		{"int versions", "?oneline&inline&filter=dirs.files.versions.size>10", d2},
+		{"int rel path", "dirs?oneline&inline&filter=files.size>10",
+			`{"d2":{"files":{"f2":{"versions":{"v1":{}}}}}}`},
+		{"int bad value", "?oneline&inline&filter=dirs.files.size>abc",
+			"Filter \"dirs.files.size>abc\" must use a numeric value\n"},
+
+		{"ts >", "?oneline&inline&filter=dirs.files.when>2024-03-01T00:00:00Z", d2},
+		{"ts < w/tz", "?oneline&inline&filter=dirs.files.when<2024-06-01T11:00:00Z", d12},
+		{"ts = w/tz", "?oneline&inline&filter=dirs.files.when=2024-06-01T10:00:00Z", d2},
+		{"ts bad value", "?oneline&inline&filter=dirs.files.when<yesterday",
+			"Filter \"dirs.files.when<yesterday\" must use a timestamp value\n"},
+
+		{"str wildcard", "?oneline&inline&filter=dirs.files.owner=*li*", d1},
+		{"str wildcard case", "?oneline&inline&filter=dirs.files.owner=b*", d2},
+		{"str wildcard none", "?oneline&inline&filter=dirs.files.owner=*x*", none},
+		{"str !=", "?oneline&inline&filter=dirs.files.owner!=bob", d13},
+		{"str != wildcard", "?oneline&inline&filter=dirs.files.owner!=*o*", d13},
+		{"str <", "?oneline&inline&filter=dirs.files.owner<b", d1},
+
+		{"absent", "?oneline&inline&filter=!dirs.files.size", d3},
+		{"absent map", "?oneline&inline&filter=!dirs.labels.env", d23},
+		{"present map", "?oneline&inline&filter=dirs.labels.env", d1},
+		{"map wildcard", "?oneline&inline&filter=dirs.labels.env=pr*", d1},
+		{"absent w/value", "?oneline&inline&filter=!dirs.files.size=5",
+			"Filter \"!dirs.files.size=5\" can't use \"!\" and \"=\" at the same time\n"},
+
+		{"AND", "?oneline&inline&filter=dirs.files.size>1,dirs.files.owner=bob", d2},
+		{"AND absent", "?oneline&inline&filter=!dirs.files.owner,!dirs.labels.env", d3},
+		{"OR", "?oneline&inline&filter=dirs.files.size>10&filter=!dirs.files.size", d23},
+	}
+
+	for _, test := range tests {
+		t.Logf("Test name: %s", test.Name)
+		xCheckGet(t, reg, test.URL, test.Exp)
+	}
+}
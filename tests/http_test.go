@@ -2,7 +2,7 @@ package tests
 
 import (
 	"bytes"
-	// "encoding/json"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -710,6 +710,11 @@ func TestHTTPModel(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -941,6 +946,11 @@ func TestHTTPModel(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -1175,6 +1185,11 @@ func TestHTTPModel(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -3303,6 +3318,7 @@ func TestHTTPVersions(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:cb4ce62c14d079dd0e4ae27bd37e4abbba330ab47530cc460361c624109d8206",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1-proxy/versions"
@@ -3329,6 +3345,7 @@ func TestHTTPVersions(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:cb4ce62c14d079dd0e4ae27bd37e4abbba330ab47530cc460361c624109d8206",
   "file": "Hello world! v1",
 
   "versionscount": 1,
@@ -3377,6 +3394,7 @@ func TestHTTPVersions(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:cb4ce62c14d079dd0e4ae27bd37e4abbba330ab47530cc460361c624109d8206",
   "file": "Hello world! v1",
 
   "versionscount": 1,
@@ -3408,7 +3426,8 @@ func TestHTTPVersions(t *testing.T) {
     "isdefault": true,
     "createdat": "2024-01-01T12:00:01Z",
     "modifiedat": "2024-01-01T12:00:01Z",
-    "contenttype": "application/json"
+    "contenttype": "application/json",
+    "contentdigest": "sha256:212fd8923bdcff4ac94187835ac66a3cd7e8496d0a82b4ed1cad6bba7a5f818a"
   }
 }
 `,
@@ -3466,6 +3485,7 @@ func TestHTTPVersions(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:212fd8923bdcff4ac94187835ac66a3cd7e8496d0a82b4ed1cad6bba7a5f818a",
   "file": "Hello world! v2"
 }
 `,
@@ -3624,6 +3644,7 @@ func TestHTTPVersions(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1-proxy/versions/2$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
 
   "versionscount": 3,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1-proxy/versions"
@@ -3756,7 +3777,8 @@ func TestHTTPVersions(t *testing.T) {
   "isdefault": true,
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
-  "contenttype": "application/json"
+  "contenttype": "application/json",
+  "contentdigest": "sha256:3d76230843285f2af5b98af080051f05135e6033e3651f4d33838e7686fcce23"
 }
 `,
 	})
@@ -3848,7 +3870,8 @@ func TestHTTPVersions(t *testing.T) {
   "isdefault": true,
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
-  "contenttype": "application/json"
+  "contenttype": "application/json",
+  "contentdigest": "sha256:ff9edd1c55d392a1684aabc75c1866b442b695fdf76507d92b8b8598f4c91772"
 }
 `,
 	})
@@ -3983,7 +4006,8 @@ func TestHTTPVersions(t *testing.T) {
   "isdefault": true,
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
-  "contenttype": "application/json"
+  "contenttype": "application/json",
+  "contentdigest": "sha256:a911a790e9e5faa241e2a9826e0f0985f41bd236a044963f866dc9f9b5bed85b"
 }
 `,
 	})
@@ -4188,6 +4212,7 @@ func TestHTTPVersions(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "my/format2",
+  "contentdigest": "sha256:4be79fec970e611a97110c3739b786155fd8a6e5f9ebb0948d9fb40fc5d14ec1",
 
   "versionscount": 2,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f5/versions"
@@ -4238,7 +4263,8 @@ func TestHTTPVersions(t *testing.T) {
   "epoch": 2,
   "self": "http://localhost:8181/dirs/d1/files/f5/versions/v1$meta",
   "createdat": "2024-01-01T12:00:01Z",
-  "modifiedat": "2024-01-01T12:00:02Z"
+  "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:62f1dc3755ba00d7135b630ac96bbf532091f857539d00c53e680b6ca6c9fe5c"
 }
 `,
 	})
@@ -4260,6 +4286,7 @@ func TestHTTPVersions(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "my/format2",
+  "contentdigest": "sha256:4be79fec970e611a97110c3739b786155fd8a6e5f9ebb0948d9fb40fc5d14ec1",
 
   "versionscount": 2,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f5/versions"
@@ -5121,6 +5148,7 @@ func TestHTTPNonStrings(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
   "ext": true,
   "ifext": 666,
   "mybool": true,
@@ -5436,6 +5464,7 @@ func TestHTTPDefault(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
 
   "versionscount": 3,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -5486,6 +5515,7 @@ func TestHTTPDefault(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
 
   "versionscount": 4,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -6841,6 +6871,389 @@ func TestHTTPModelSchema(t *testing.T) {
 
 }
 
+func TestHTTPModelJSONSchema(t *testing.T) {
+	reg := NewRegistry("TestHTTPModelJSONSchema")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddAttribute(&registry.Attribute{
+		Name:           "kind",
+		Type:           registry.STRING,
+		Enum:           []any{"a", "b"},
+		ClientRequired: true,
+		ServerRequired: true,
+		IfValues: registry.IfValues{
+			"a": &registry.IfValue{
+				SiblingAttributes: registry.Attributes{
+					"alevel": &registry.Attribute{
+						Name: "alevel",
+						Type: registry.UINTEGER,
+					},
+				},
+			},
+		},
+	})
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, false)
+	xNoErr(t, err)
+
+	xHTTP(t, reg, "GET", "/model?schema=JSONSchema", "", 200, `{
+  "$defs": {
+    "dirs": {
+      "allOf": [
+        {
+          "if": {
+            "properties": {
+              "kind": {
+                "const": "a"
+              }
+            },
+            "required": [
+              "kind"
+            ]
+          },
+          "then": {
+            "properties": {
+              "alevel": {
+                "minimum": 0,
+                "type": "integer"
+              }
+            }
+          }
+        }
+      ],
+      "properties": {
+        "createdat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "description": {
+          "type": "string"
+        },
+        "documentation": {
+          "format": "uri",
+          "type": "string"
+        },
+        "epoch": {
+          "minimum": 0,
+          "type": "integer"
+        },
+        "files": {
+          "additionalProperties": {
+            "$ref": "#/$defs/dirs-files"
+          },
+          "type": "object"
+        },
+        "filescount": {
+          "minimum": 0,
+          "readOnly": true,
+          "type": "integer"
+        },
+        "filesurl": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        },
+        "id": {
+          "type": "string"
+        },
+        "kind": {
+          "enum": [
+            "a",
+            "b"
+          ],
+          "type": "string"
+        },
+        "labels": {
+          "additionalProperties": {
+            "type": "string"
+          },
+          "type": "object"
+        },
+        "modifiedat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "name": {
+          "type": "string"
+        },
+        "origin": {
+          "format": "uri",
+          "type": "string"
+        },
+        "self": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        }
+      },
+      "required": [
+        "kind"
+      ],
+      "title": "dir",
+      "type": "object",
+      "unevaluatedProperties": false
+    },
+    "dirs-files": {
+      "properties": {
+        "contentdigest": {
+          "readOnly": true,
+          "type": "string"
+        },
+        "contenttype": {
+          "type": "string"
+        },
+        "createdat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "defaultversionid": {
+          "readOnly": true,
+          "type": "string"
+        },
+        "defaultversionurl": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        },
+        "description": {
+          "type": "string"
+        },
+        "documentation": {
+          "format": "uri",
+          "type": "string"
+        },
+        "epoch": {
+          "minimum": 0,
+          "type": "integer"
+        },
+        "id": {
+          "type": "string"
+        },
+        "labels": {
+          "additionalProperties": {
+            "type": "string"
+          },
+          "type": "object"
+        },
+        "modifiedat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "name": {
+          "type": "string"
+        },
+        "origin": {
+          "format": "uri",
+          "type": "string"
+        },
+        "self": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        },
+        "stickydefaultversion": {
+          "readOnly": true,
+          "type": "boolean"
+        },
+        "versions": {
+          "additionalProperties": {
+            "$ref": "#/$defs/dirs-files-versions"
+          },
+          "type": "object"
+        },
+        "versionscount": {
+          "minimum": 0,
+          "readOnly": true,
+          "type": "integer"
+        },
+        "versionsurl": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        }
+      },
+      "title": "file",
+      "type": "object",
+      "unevaluatedProperties": false
+    },
+    "dirs-files-versions": {
+      "properties": {
+        "contentdigest": {
+          "readOnly": true,
+          "type": "string"
+        },
+        "contenttype": {
+          "type": "string"
+        },
+        "createdat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "description": {
+          "type": "string"
+        },
+        "documentation": {
+          "format": "uri",
+          "type": "string"
+        },
+        "epoch": {
+          "minimum": 0,
+          "type": "integer"
+        },
+        "id": {
+          "type": "string"
+        },
+        "isdefault": {
+          "readOnly": true,
+          "type": "boolean"
+        },
+        "labels": {
+          "additionalProperties": {
+            "type": "string"
+          },
+          "type": "object"
+        },
+        "modifiedat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "name": {
+          "type": "string"
+        },
+        "origin": {
+          "format": "uri",
+          "type": "string"
+        },
+        "self": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        }
+      },
+      "title": "file version",
+      "type": "object",
+      "unevaluatedProperties": false
+    },
+    "registry": {
+      "properties": {
+        "createdat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "description": {
+          "type": "string"
+        },
+        "dirs": {
+          "additionalProperties": {
+            "$ref": "#/$defs/dirs"
+          },
+          "type": "object"
+        },
+        "dirscount": {
+          "minimum": 0,
+          "readOnly": true,
+          "type": "integer"
+        },
+        "dirsurl": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        },
+        "documentation": {
+          "format": "uri",
+          "type": "string"
+        },
+        "epoch": {
+          "minimum": 0,
+          "type": "integer"
+        },
+        "id": {
+          "type": "string"
+        },
+        "labels": {
+          "additionalProperties": {
+            "type": "string"
+          },
+          "type": "object"
+        },
+        "model": {
+          "additionalProperties": {},
+          "readOnly": true,
+          "type": "object"
+        },
+        "modifiedat": {
+          "format": "date-time",
+          "type": "string"
+        },
+        "name": {
+          "type": "string"
+        },
+        "self": {
+          "format": "uri",
+          "readOnly": true,
+          "type": "string"
+        },
+        "specversion": {
+          "readOnly": true,
+          "type": "string"
+        }
+      },
+      "title": "registry",
+      "type": "object",
+      "unevaluatedProperties": false
+    }
+  },
+  "$ref": "#/$defs/registry",
+  "$schema": "https://json-schema.org/draft/2020-12/schema"
+}
+`)
+
+	xHTTP(t, reg, "GET", "/model?schema=JSONSchema/draft-07", "", 400,
+		`Unsupported schema format: JSONSchema/draft-07
+`)
+}
+
+func TestHTTPModelOpenAPI(t *testing.T) {
+	reg := NewRegistry("TestHTTPModelOpenAPI")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	xNoErr(t, reg.Commit())
+
+	res, err := http.Get("http://localhost:8181/model?schema=OpenAPI")
+	xNoErr(t, err)
+	buf, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	xCheck(t, res.StatusCode == 200, "Bad status: %d\n%s", res.StatusCode,
+		string(buf))
+	xCheckEqual(t, "", res.Header.Get("Content-Type"), "application/json")
+
+	doc := struct {
+		OpenAPI string
+		Info    struct{ Title string }
+		Paths   map[string]map[string]any
+	}{}
+	xNoErr(t, json.Unmarshal(buf, &doc))
+	xCheckEqual(t, "", doc.OpenAPI, "3.1.0")
+	xCheckEqual(t, "", doc.Info.Title, "xRegistry: TestHTTPModelOpenAPI")
+	xCheckEqual(t, "", strings.Join(registry.SortedKeys(doc.Paths), "\n"),
+		`/
+/dirs
+/dirs/{dirid}
+/dirs/{dirid}/files
+/dirs/{dirid}/files/{fileid}
+/dirs/{dirid}/files/{fileid}$meta
+/dirs/{dirid}/files/{fileid}/versions
+/dirs/{dirid}/files/{fileid}/versions/{versionid}
+/dirs/{dirid}/files/{fileid}/versions/{versionid}$meta
+/model`)
+}
+
 func TestHTTPReadOnlyResource(t *testing.T) {
 	reg := NewRegistry("TestHTTPReadOnlyResource")
 	defer PassDeleteReg(t, reg)
@@ -7120,6 +7533,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7157,6 +7571,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
   "file": "hello",
 
   "versionscount": 1,
@@ -7182,6 +7597,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:8c5649bd9b14633003d62b94bda032349d7732a9c217ff05a0d5f5fe00e12450",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7219,6 +7635,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:8c5649bd9b14633003d62b94bda032349d7732a9c217ff05a0d5f5fe00e12450",
   "file": "\"hel\nlo",
 
   "versionscount": 1,
@@ -7245,6 +7662,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:7a38bf81f383f69433ad6e900d35b3e2385593f76a7b7ab5d4355b8ba41ee24b",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7281,6 +7699,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:7a38bf81f383f69433ad6e900d35b3e2385593f76a7b7ab5d4355b8ba41ee24b",
   "file": {
     "foo": "bar"
   },
@@ -7309,6 +7728,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:5ab6ec4e02ffce0dd0066335e87e6daa366bc35f13a7ef56820b261afe404c65",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7345,6 +7765,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:5ab6ec4e02ffce0dd0066335e87e6daa366bc35f13a7ef56820b261afe404c65",
   "file": [
     "hello",
     null,
@@ -7375,6 +7796,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:a665a45920422f9d417e4867efdc4fb8a04a1f3fff1fa07e998e86f7f7a27ae3",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7411,6 +7833,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:a665a45920422f9d417e4867efdc4fb8a04a1f3fff1fa07e998e86f7f7a27ae3",
   "file": 123,
 
   "versionscount": 1,
@@ -7435,6 +7858,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:11fc90bd25a4139f105bf5c0423c47ba4b1066cd221fabd4e255bd7d0f1b3758",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7454,6 +7878,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:11fc90bd25a4139f105bf5c0423c47ba4b1066cd221fabd4e255bd7d0f1b3758",
   "filebase64": "ImhlbGxvIgo=",
 
   "versionscount": 1,
@@ -7479,6 +7904,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7498,6 +7924,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
   "filebase64": "aGVsbG8K",
 
   "versionscount": 1,
@@ -7523,6 +7950,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:565c69994af5702f7fb799e54374fb8d5c108b64143e475ffbbcc39d2941f1e8",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7542,6 +7970,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:565c69994af5702f7fb799e54374fb8d5c108b64143e475ffbbcc39d2941f1e8",
   "filebase64": "eyAiZm9vIjoiYmFyIjogfQo=",
 
   "versionscount": 1,
@@ -7567,6 +7996,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7586,6 +8016,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -7709,6 +8140,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f11/versions"
@@ -7755,6 +8187,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:7a38bf81f383f69433ad6e900d35b3e2385593f76a7b7ab5d4355b8ba41ee24b",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f12/versions"
@@ -7801,6 +8234,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:a665a45920422f9d417e4867efdc4fb8a04a1f3fff1fa07e998e86f7f7a27ae3",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f13/versions"
@@ -7847,6 +8281,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:4c41504084d84e85ab56c9a239f39d7796cfd992b9366100e9c37b43c0df65e5",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f14/versions"
@@ -7893,6 +8328,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:b5bea41b6c623f7c09f1bf24dcae58ebab3c0cdd90ad966bc43a45b44867e12b",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f15/versions"
@@ -7939,6 +8375,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:d02b8aaedb4e86de332620884055bf82107f53048ec8846c57736e5569915b5d",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f16/versions"
@@ -7986,6 +8423,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "foo/bar",
+  "contentdigest": "sha256:d02b8aaedb4e86de332620884055bf82107f53048ec8846c57736e5569915b5d",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f17/versions"
@@ -8023,6 +8461,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "foo/bar",
+  "contentdigest": "sha256:d02b8aaedb4e86de332620884055bf82107f53048ec8846c57736e5569915b5d",
   "filebase64": "aGUJbGxv",
 
   "versionscount": 1,
@@ -8048,6 +8487,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f18/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:d02b8aaedb4e86de332620884055bf82107f53048ec8846c57736e5569915b5d",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f18/versions"
@@ -8083,6 +8523,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f18/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:d02b8aaedb4e86de332620884055bf82107f53048ec8846c57736e5569915b5d",
   "filebase64": "aGUJbGxv",
 
   "versionscount": 1,
@@ -8108,6 +8549,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f18/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f18/versions"
@@ -8143,6 +8585,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f18/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "filebase64": "Zm9v",
 
   "versionscount": 1,
@@ -8168,6 +8611,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f18/versions"
@@ -8205,6 +8649,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "file": "foo",
 
   "versionscount": 1,
@@ -8231,6 +8676,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "foo/bar",
+  "contentdigest": "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f18/versions"
@@ -8268,6 +8714,7 @@ func TestHTTPContent(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "foo/bar",
+  "contentdigest": "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
   "filebase64": "YmFy",
 
   "versionscount": 1,
@@ -8292,6 +8739,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f18/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f18/versions"
@@ -8327,6 +8775,7 @@ func TestHTTPContent(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f18/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:fcde2b2edba56bf408601fb721fe9b5c338d10ee429ea04fae5511b68fbf8fb9",
   "filebase64": "YmFy",
 
   "versionscount": 1,
@@ -8429,6 +8878,7 @@ func TestHTTPContent2(t *testing.T) {
   "createdat": "2024-01-01T12:00:00Z",
   "modifiedat": "2024-01-01T12:00:00Z",
   "contenttype": "my/format",
+  "contentdigest": "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f2/versions"
@@ -8453,6 +8903,7 @@ func TestHTTPContent2(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f2/versions/1$meta",
   "createdat": "2024-01-01T12:00:00Z",
   "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f2/versions"
@@ -8514,6 +8965,7 @@ func TestHTTPContent2(t *testing.T) {
     "createdat": "2024-01-01T12:00:02Z",
     "modifiedat": "2024-01-01T12:00:02Z",
     "contenttype": "application/json",
+    "contentdigest": "sha256:0f1128046248f83dc9b9ab187e16fad0ff596128f1524d05a9a77c4ad932f10a",
 
     "versionscount": 1,
     "versionsurl": "http://localhost:8181/dirs/d1/files/f3/versions"
@@ -8526,6 +8978,7 @@ func TestHTTPContent2(t *testing.T) {
     "defaultversionurl": "http://localhost:8181/dirs/d1/files/f4/versions/1$meta",
     "createdat": "2024-01-01T12:00:02Z",
     "modifiedat": "2024-01-01T12:00:02Z",
+    "contentdigest": "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
 
     "versionscount": 1,
     "versionsurl": "http://localhost:8181/dirs/d1/files/f4/versions"
@@ -8576,14 +9029,16 @@ func TestHTTPContent2(t *testing.T) {
     "isdefault": true,
     "createdat": "2024-01-01T12:00:00Z",
     "modifiedat": "2024-01-01T12:00:00Z",
-    "contenttype": "application/json"
+    "contenttype": "application/json",
+    "contentdigest": "sha256:0f1128046248f83dc9b9ab187e16fad0ff596128f1524d05a9a77c4ad932f10a"
   },
   "v4": {
     "id": "v4",
     "epoch": 1,
     "self": "http://localhost:8181/dirs/d1/files/fv/versions/v4$meta",
     "createdat": "2024-01-01T12:00:00Z",
-    "modifiedat": "2024-01-01T12:00:00Z"
+    "modifiedat": "2024-01-01T12:00:00Z",
+    "contentdigest": "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
   }
 }
 `})
@@ -8866,6 +9321,7 @@ func TestHTTPResourcesBulk(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/dir1/files/f4/versions"
@@ -10846,6 +11302,7 @@ func TestHTTPURLs(t *testing.T) {
     "createdat": "2024-01-01T12:00:00Z",
     "modifiedat": "2024-01-01T12:00:00Z",
     "contenttype": "application/json",
+    "contentdigest": "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
 
     "versionscount": 1,
     "versionsurl": "http://localhost:8181/dirs/d2/files/f1/versions"
@@ -10964,6 +11421,7 @@ func TestHTTPURLs(t *testing.T) {
   "description": "new v",
   "createdat": "2024-01-01T12:00:00Z",
   "modifiedat": "2024-01-01T12:00:00Z",
+  "contentdigest": "sha256:73221b0a77a4e2d92bcf424ab67477a3982428287a72724624bdfd4cefce09a2",
 
   "versionscount": 2,
   "versionsurl": "http://localhost:8181/dirs/d2/files/f1/versions"
@@ -10988,6 +11446,7 @@ func TestHTTPURLs(t *testing.T) {
   "description": "update 2",
   "createdat": "2024-01-01T12:00:00Z",
   "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:73221b0a77a4e2d92bcf424ab67477a3982428287a72724624bdfd4cefce09a2",
 
   "versionscount": 2,
   "versionsurl": "http://localhost:8181/dirs/d2/files/f1/versions"
@@ -11015,6 +11474,7 @@ func TestHTTPURLs(t *testing.T) {
   },
   "createdat": "2024-01-01T12:00:00Z",
   "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:73221b0a77a4e2d92bcf424ab67477a3982428287a72724624bdfd4cefce09a2",
 
   "versionscount": 2,
   "versionsurl": "http://localhost:8181/dirs/d2/files/f1/versions"
@@ -11041,7 +11501,8 @@ func TestHTTPURLs(t *testing.T) {
   "description": "be 3!",
   "createdat": "2024-01-01T12:00:00Z",
   "modifiedat": "2024-01-01T12:00:00Z",
-  "contenttype": "application/json"
+  "contenttype": "application/json",
+  "contentdigest": "sha256:56592dc097c9b51711eb4387741dcac6652fa94227df16fa92f67b07c331ce23"
 }
 `})
 
@@ -11062,7 +11523,8 @@ func TestHTTPURLs(t *testing.T) {
     "description": "new f1",
     "createdat": "2024-01-01T12:00:00Z",
     "modifiedat": "2024-01-01T12:00:01Z",
-    "contenttype": "application/json"
+    "contenttype": "application/json",
+    "contentdigest": "sha256:ee52d2d07491d109d5b8659ffab7c8de26dba350a1cae443ecd994c7fd9ac431"
   },
   "2": {
     "id": "2",
@@ -11073,7 +11535,8 @@ func TestHTTPURLs(t *testing.T) {
       "l1": "v1"
     },
     "createdat": "2024-01-01T12:00:02Z",
-    "modifiedat": "2024-01-01T12:00:03Z"
+    "modifiedat": "2024-01-01T12:00:03Z",
+    "contentdigest": "sha256:73221b0a77a4e2d92bcf424ab67477a3982428287a72724624bdfd4cefce09a2"
   },
   "3": {
     "id": "3",
@@ -11083,7 +11546,8 @@ func TestHTTPURLs(t *testing.T) {
     "description": "be 3!",
     "createdat": "2024-01-01T12:00:04Z",
     "modifiedat": "2024-01-01T12:00:04Z",
-    "contenttype": "application/json"
+    "contenttype": "application/json",
+    "contentdigest": "sha256:56592dc097c9b51711eb4387741dcac6652fa94227df16fa92f67b07c331ce23"
   }
 }
 `})
@@ -11136,7 +11600,8 @@ func TestHTTPURLs(t *testing.T) {
     "isdefault": true,
     "createdat": "2024-01-01T12:00:00Z",
     "modifiedat": "2024-01-01T12:00:00Z",
-    "contenttype": "application/json"
+    "contenttype": "application/json",
+    "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
   }
 }
 `})
@@ -11223,7 +11688,8 @@ func TestHTTPURLs(t *testing.T) {
   "isdefault": true,
   "createdat": "2024-01-01T12:00:00Z",
   "modifiedat": "2024-01-01T12:00:01Z",
-  "contenttype": "application/json"
+  "contenttype": "application/json",
+  "contentdigest": "sha256:1d5f671fbc083af9a0ac801f24b93569fc6f9702af3fceee0ea7ca1a0018f001"
 }
 `})
 
@@ -11245,7 +11711,8 @@ func TestHTTPURLs(t *testing.T) {
   "isdefault": true,
   "description": "cool one",
   "createdat": "2024-01-01T12:00:00Z",
-  "modifiedat": "2024-01-01T12:00:01Z"
+  "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:1d5f671fbc083af9a0ac801f24b93569fc6f9702af3fceee0ea7ca1a0018f001"
 }
 `})
 
@@ -11270,7 +11737,8 @@ func TestHTTPURLs(t *testing.T) {
     "l1": "v1"
   },
   "createdat": "2024-01-01T12:00:00Z",
-  "modifiedat": "2024-01-01T12:00:01Z"
+  "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:1d5f671fbc083af9a0ac801f24b93569fc6f9702af3fceee0ea7ca1a0018f001"
 }
 `})
 
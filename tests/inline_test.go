@@ -576,6 +576,7 @@ func TestResourceInline(t *testing.T) {
 			`"defaultversionurl"`,
 			`"createdat"`,
 			`"modifiedat"`,
+			`"contentdigest"`,
 			`"versionsurl"`,
 			`"dirsurl"`,
 		}
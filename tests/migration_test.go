@@ -0,0 +1,226 @@
+package tests
+
+import (
+	"testing"
+)
+
+func TestModelMigration(t *testing.T) {
+	reg := NewRegistry("TestModelMigration")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddAttr("size", "string")
+	xNoErr(t, err)
+	rm, err := gm.AddResourceModel("files", "file", 0, true, true, false)
+	xNoErr(t, err)
+	_, err = rm.AddAttr("owner", "string")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("notes", "note", 0, true, true, false)
+	xNoErr(t, err)
+	xNoErr(t, reg.Commit())
+
+	xStatus(t, reg, "PUT", "/dirs/d1", `{"size":"10"}`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d2", `{"size":"big"}`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d3", `{}`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1", `{"owner":"bob"}`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/notes/n1", `{}`, 201)
+
+	newModel := `
+  "groups": {
+    "dirs": {
+      "plural": "dirs",
+      "singular": "dir",
+      "attributes": {
+        "size": { "name": "size", "type": "integer" }
+      },
+      "resources": {
+        "files": {
+          "plural": "files",
+          "singular": "file",
+          "hasdocument": false,
+          "attributes": {
+            "author": { "name": "author", "type": "string" }
+          }
+        }
+      }
+    }
+  }`
+
+	// W/o any migration steps
+	xHTTP(t, reg, "PUT", "/model?dryrun", `{`+newModel+`}`, 200, `{
+  "dryrun": true,
+  "checked": 5,
+  "invalid": [
+    {
+      "path": "/dirs/d1",
+      "error": "Attribute \"size\" must be an integer"
+    },
+    {
+      "path": "/dirs/d1/files/f1/versions/1",
+      "error": "Invalid extension(s): owner"
+    },
+    {
+      "path": "/dirs/d2",
+      "error": "Attribute \"size\" must be an integer"
+    }
+  ],
+  "deleted": [
+    "/dirs/d1/notes/n1"
+  ]
+}
+`)
+
+	migrations := `,
+  "$migrations": [
+    { "op": "coerce", "entities": "dirs", "attribute": "size",
+      "type": "integer" },
+    { "op": "default", "entities": "dirs", "attribute": "size", "value": 0 },
+    { "op": "move", "entities": "dirs/files", "attribute": "owner",
+      "to": "author" }
+  ]`
+
+	xHTTP(t, reg, "PUT", "/model?dryrun", `{`+newModel+migrations+`}`, 200, `{
+  "dryrun": true,
+  "checked": 5,
+  "migrated": [
+    "/dirs/d1",
+    "/dirs/d1/files/f1/versions/1",
+    "/dirs/d3"
+  ],
+  "invalid": [
+    {
+      "path": "/dirs/d2",
+      "error": "Attribute \"size\": can't convert big to integer"
+    }
+  ],
+  "deleted": [
+    "/dirs/d1/notes/n1"
+  ]
+}
+`)
+
+	// Dry runs don't change anything
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/1", "", 200, `{
+  "id": "1",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1/files/f1/versions/1",
+  "isdefault": true,
+  "createdat": "YYYY-MM-DDTHH:MM:01Z",
+  "modifiedat": "YYYY-MM-DDTHH:MM:01Z",
+  "owner": "bob"
+}
+`)
+	xStatus(t, reg, "GET", "/dirs/d1/notes/n1", "", 200)
+
+	// A real update is all or nothing
+	xHTTP(t, reg, "PUT", "/model", `{`+newModel+migrations+`}`, 400,
+		`The new model would leave these entities invalid:
+  /dirs/d2: Attribute "size": can't convert big to integer
+`)
+	xHTTP(t, reg, "GET", "/dirs/d1", "", 200, `{
+  "id": "d1",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1",
+  "createdat": "YYYY-MM-DDTHH:MM:01Z",
+  "modifiedat": "YYYY-MM-DDTHH:MM:01Z",
+  "size": "10",
+
+  "filescount": 1,
+  "filesurl": "http://localhost:8181/dirs/d1/files",
+  "notescount": 1,
+  "notesurl": "http://localhost:8181/dirs/d1/notes"
+}
+`)
+
+	xStatus(t, reg, "PATCH", "/dirs/d2", `{"size":"20"}`, 200)
+	xStatus(t, reg, "PUT", "/model", `{`+newModel+migrations+`}`, 200)
+
+	// Migrated entities are updated like any other change
+	xHTTP(t, reg, "GET", "/dirs?inline=files", "", 200, `{
+  "d1": {
+    "id": "d1",
+    "epoch": 2,
+    "self": "http://localhost:8181/dirs/d1",
+    "createdat": "YYYY-MM-DDTHH:MM:01Z",
+    "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+    "size": 10,
+
+    "files": {
+      "f1": {
+        "id": "f1",
+        "epoch": 2,
+        "self": "http://localhost:8181/dirs/d1/files/f1",
+        "defaultversionid": "1",
+        "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1",
+        "createdat": "YYYY-MM-DDTHH:MM:03Z",
+        "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+        "author": "bob",
+
+        "versionscount": 1,
+        "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
+      }
+    },
+    "filescount": 1,
+    "filesurl": "http://localhost:8181/dirs/d1/files"
+  },
+  "d2": {
+    "id": "d2",
+    "epoch": 3,
+    "self": "http://localhost:8181/dirs/d2",
+    "createdat": "YYYY-MM-DDTHH:MM:04Z",
+    "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+    "size": 20,
+
+    "filescount": 0,
+    "filesurl": "http://localhost:8181/dirs/d2/files"
+  },
+  "d3": {
+    "id": "d3",
+    "epoch": 2,
+    "self": "http://localhost:8181/dirs/d3",
+    "createdat": "YYYY-MM-DDTHH:MM:05Z",
+    "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+    "size": 0,
+
+    "filescount": 0,
+    "filesurl": "http://localhost:8181/dirs/d3/files"
+  }
+}
+`)
+	xStatus(t, reg, "GET", "/dirs/d1/notes/n1", "", 404)
+
+	// Bad steps
+	xHTTP(t, reg, "PUT", "/model?dryrun", `{`+newModel+`,
+  "$migrations": [ { "op": "rename", "attribute": "x" } ]
+}`, 400, "Invalid migration step op \"rename\", must be one of: coerce, "+
+		"move, default\n")
+	xHTTP(t, reg, "PUT", "/model?dryrun", `{`+newModel+`,
+  "$migrations": [ { "op": "coerce", "entities": "dirs/notes",
+    "attribute": "x", "type": "string" } ]
+}`, 400, "Migration step \"coerce\": unknown Resource type \"dirs/notes\"\n")
+	xHTTP(t, reg, "PUT", "/model?dryrun", `{`+newModel+`,
+  "$migrations": [ { "op": "coerce", "entities": "dirs",
+    "attribute": "size", "type": "map" } ]
+}`, 400, "Migration step \"coerce\": \"type\" must be a scalar type, not "+
+		"\"map\"\n")
+	xHTTP(t, reg, "PUT", "/model?dryrun", `{`+newModel+`,
+  "$migrations": [ { "op": "move", "entities": "dirs",
+    "attribute": "size", "to": "epoch" } ]
+}`, 400, "Migration step \"move\": \"epoch\" is managed by the "+
+		"server\n")
+
+	// Models that can't be parsed are the client's fault
+	xStatus(t, reg, "PUT", "/model", `{"groups":`, 400)
+	xStatus(t, reg, "PUT", "/model?dryrun", `{"groups":`, 400)
+
+	// A dry run is rolled back, so it can't be mixed w/other changes
+	_, err = reg.AddGroup("dirs", "d9")
+	xNoErr(t, err)
+	_, err = reg.DryRunNewModel(reg.Model, nil)
+	xCheck(t, err != nil && err.Error() == "A model dry run can't be done "+
+		"while there are uncommitted changes", "Expected an error, got: %v",
+		err)
+	xNoErr(t, reg.Rollback())
+	xStatus(t, reg, "GET", "/dirs/d9", "", 404)
+}
@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+func xUpstream(t *testing.T, method string, url string, body string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	xNoErr(t, err)
+	res, err := http.DefaultClient.Do(req)
+	xNoErr(t, err)
+	buf, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	xCheck(t, res.StatusCode/100 == 2, "%s %s: %d\n%s", method, url,
+		res.StatusCode, string(buf))
+}
+
+func TestMirror(t *testing.T) {
+	upReg := NewRegistry("TestMirrorUpstream")
+	defer PassDeleteReg(t, upReg)
+	gm, err := upReg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	xNoErr(t, upReg.Commit())
+
+	// The upstream is a 2nd server
+	server := httptest.NewServer(&registry.Server{})
+	defer server.Close()
+	upURL := server.URL + "/reg-TestMirrorUpstream"
+
+	xUpstream(t, "PUT", upURL+"/dirs/d1", `{"name":"dir1"}`)
+	xUpstream(t, "PUT", upURL+"/dirs/d1/files/f1", "hello")
+	xUpstream(t, "PUT", upURL+"/dirs/d1/files/f1/versions/2", "world")
+	xUpstream(t, "POST", upURL+"/dirs/d1/files/f1$meta?setdefaultversionid=1", "")
+	xUpstream(t, "PUT", upURL+"/dirs/d2/files/f2", "two")
+
+	reg := NewRegistry("TestMirror")
+	defer PassDeleteReg(t, reg)
+
+	xCheckErr(t, reg.SyncMirror(), "Registry \"TestMirror\" isn't a mirror")
+	xCheckErr(t, reg.SetMirror("foo"),
+		"Invalid mirror URL (foo), must be an absolute http(s) URL")
+	xNoErr(t, reg.SetMirror(upURL+"/"))
+	xNoErr(t, reg.Commit())
+	mirror, err := reg.GetMirror()
+	xNoErr(t, err)
+	xCheckEqual(t, "", mirror, upURL)
+
+	// The sync talks to the upstream (this same process) w/o any Tx, so
+	// nothing can be pending
+	xNoErr(t, reg.Commit())
+	xNoErr(t, reg.SyncMirror())
+	xNoErr(t, reg.Commit())
+
+	xHTTP(t, reg, "GET", "/dirs/d1", "", 200, `{
+  "id": "d1",
+  "name": "dir1",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1",
+  "origin": "`+upURL+`/dirs/d1",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:01Z",
+
+  "filescount": 1,
+  "filesurl": "http://localhost:8181/dirs/d1/files"
+}
+`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1$meta?inline=versions", "", 200, `{
+  "id": "f1",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1/files/f1$meta",
+  "stickydefaultversion": true,
+  "defaultversionid": "1",
+  "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
+  "origin": "`+upURL+`/dirs/d1/files/f1/versions/1$meta",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:01Z",
+  "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824",
+
+  "versions": {
+    "1": {
+      "id": "1",
+      "epoch": 1,
+      "self": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
+      "isdefault": true,
+      "origin": "`+upURL+`/dirs/d1/files/f1/versions/1$meta",
+      "createdat": "2024-01-01T12:00:01Z",
+      "modifiedat": "2024-01-01T12:00:01Z",
+      "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+    },
+    "2": {
+      "id": "2",
+      "epoch": 1,
+      "self": "http://localhost:8181/dirs/d1/files/f1/versions/2$meta",
+      "origin": "`+upURL+`/dirs/d1/files/f1/versions/2$meta",
+      "createdat": "2024-01-01T12:00:02Z",
+      "modifiedat": "2024-01-01T12:00:02Z",
+      "contentdigest": "sha256:486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7"
+    }
+  },
+  "versionscount": 2,
+  "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
+}
+`)
+
+	res, err := http.Get("http://localhost:8181/dirs/d1/files/f1/versions/2")
+	xNoErr(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	xCheckEqual(t, "", string(body), "world")
+
+	// Mirrored entities are read-only
+	msg := "Group \"/dirs/d1\" is a read-only mirror of \"" + upURL +
+		"/dirs/d1\"\n"
+	xHTTP(t, reg, "PATCH", "/dirs/d1", `{"name":"x"}`, 405, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", "new", 405, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f9", "new", 405, msg)
+	xHTTP(t, reg, "POST", "/dirs/d1/files/f1$meta?setdefaultversionid=2", "",
+		405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1/versions/1", "", 405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1", "", 405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs", `[{"id":"d1"}]`, 405, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d1?nested", `{"files":{"f3":{}}}`, 405, msg)
+
+	// But local-only Groups are fine
+	xStatus(t, reg, "PUT", "/dirs/local/files/f1", "mine", 201)
+
+	// A sync w/o any upstream changes doesn't change anything
+	xNoErr(t, reg.Commit())
+	xNoErr(t, reg.SyncMirror())
+	xNoErr(t, reg.Commit())
+	d1, err := reg.FindGroup("dirs", "d1", false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", d1.Get("epoch"), 1)
+	xNoErr(t, reg.Commit())
+
+	// Now change the upstream and let the scheduled sync pick it up
+	xUpstream(t, "PATCH", upURL+"/dirs/d1", `{"name":"dir1b"}`)
+	xUpstream(t, "PUT", upURL+"/dirs/d1/files/f1/versions/3", "again")
+	xUpstream(t, "DELETE", upURL+"/dirs/d1/files/f1/versions/2", "")
+	xUpstream(t, "POST", upURL+"/dirs/d1/files/f1$meta?setdefaultversionid=null",
+		"")
+	xUpstream(t, "DELETE", upURL+"/dirs/d2", "")
+
+	stop := registry.StartMirror(reg.DbSID, 50*time.Millisecond)
+	for i := 0; i < 100; i++ {
+		res, err = http.Get("http://localhost:8181/dirs/d2")
+		xNoErr(t, err)
+		res.Body.Close()
+		if res.StatusCode == 404 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	stop()
+	time.Sleep(100 * time.Millisecond) // let any in-flight sync finish
+	xCheckEqual(t, "", res.StatusCode, 404)
+
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1$meta?inline=versions", "", 200, `{
+  "id": "f1",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1/files/f1$meta",
+  "defaultversionid": "3",
+  "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/3$meta",
+  "origin": "`+upURL+`/dirs/d1/files/f1/versions/3$meta",
+  "createdat": "2024-01-01T12:00:02Z",
+  "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:b4c9e14061c2fd453b36700e3b0da008db2189c711ac629f0f583089164e267d",
+
+  "versions": {
+    "1": {
+      "id": "1",
+      "epoch": 1,
+      "self": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
+      "origin": "`+upURL+`/dirs/d1/files/f1/versions/1$meta",
+      "createdat": "2024-01-01T12:00:01Z",
+      "modifiedat": "2024-01-01T12:00:01Z",
+      "contentdigest": "sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+    },
+    "3": {
+      "id": "3",
+      "epoch": 1,
+      "self": "http://localhost:8181/dirs/d1/files/f1/versions/3$meta",
+      "isdefault": true,
+      "origin": "`+upURL+`/dirs/d1/files/f1/versions/3$meta",
+      "createdat": "2024-01-01T12:00:02Z",
+      "modifiedat": "2024-01-01T12:00:02Z",
+      "contentdigest": "sha256:b4c9e14061c2fd453b36700e3b0da008db2189c711ac629f0f583089164e267d"
+    }
+  },
+  "versionscount": 2,
+  "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
+}
+`)
+	xCheckEqual(t, "", reg.Refresh(), nil)
+	xNoErr(t, reg.Commit())
+	d1, err = reg.FindGroup("dirs", "d1", false)
+	xNoErr(t, err)
+	xCheckEqual(t, "", d1.Get("name"), "dir1b")
+	xStatus(t, reg, "GET", "/dirs/local/files/f1", "", 200)
+}
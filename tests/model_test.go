@@ -1000,6 +1000,11 @@ func TestResourceModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -1138,6 +1143,11 @@ func TestResourceModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -1339,6 +1349,11 @@ func TestResourceModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -1593,6 +1608,11 @@ func TestResourceModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -1848,6 +1868,11 @@ func TestResourceModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -2048,6 +2073,11 @@ func TestResourceModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -2278,6 +2308,11 @@ func TestResourceModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -2509,6 +2544,11 @@ func TestResourceModelCreate(t *testing.T) {
               "contenttype": {
                 "name": "contenttype",
                 "type": "string"
+              },
+              "contentdigest": {
+                "name": "contentdigest",
+                "type": "string",
+                "readonly": true
               }
             }
           }
@@ -2766,6 +2806,11 @@ func TestResourceModelCreate(t *testing.T) {
               "contenttype": {
                 "name": "contenttype",
                 "type": "string"
+              },
+              "contentdigest": {
+                "name": "contentdigest",
+                "type": "string",
+                "readonly": true
               }
             }
           }
@@ -3289,6 +3334,11 @@ func TestMultModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         },
@@ -3371,6 +3421,11 @@ func TestMultModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -3509,6 +3564,11 @@ func TestMultModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         },
@@ -3591,6 +3651,11 @@ func TestMultModelCreate(t *testing.T) {
             "contenttype": {
               "name": "contenttype",
               "type": "string"
+            },
+            "contentdigest": {
+              "name": "contentdigest",
+              "type": "string",
+              "readonly": true
             }
           }
         }
@@ -3840,6 +3905,11 @@ func TestMultModel2Create(t *testing.T) {
               "contenttype": {
                 "name": "contenttype",
                 "type": "string"
+              },
+              "contentdigest": {
+                "name": "contentdigest",
+                "type": "string",
+                "readonly": true
               }
             }
           }
@@ -3978,6 +4048,11 @@ func TestMultModel2Create(t *testing.T) {
               "contenttype": {
                 "name": "contenttype",
                 "type": "string"
+              },
+              "contentdigest": {
+                "name": "contentdigest",
+                "type": "string",
+                "readonly": true
               }
             }
           }
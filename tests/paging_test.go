@@ -0,0 +1,128 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+var nextLinkRE = regexp.MustCompile(`^<(.*)>; rel="next"$`)
+
+// Follow the "next" Link headers, starting at "url", and make sure each page
+// is what's expected. The last page must not have a Link header.
+func xCheckPages(t *testing.T, reg *registry.Registry, url string, pages []string) {
+	t.Helper()
+	xNoErr(t, reg.Commit())
+
+	next := "http://localhost:8181/" + url
+	for i, page := range pages {
+		xCheck(t, next != "", "Missing Link header for page %d of %q", i, url)
+
+		res, err := http.Get(next)
+		xNoErr(t, err)
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		xCheck(t, res.StatusCode == 200, "%s: bad status: %d\n%s", next,
+			res.StatusCode, string(body))
+		xCheckEqual(t, "URL: "+next+"\n", string(OneLine(body)), page)
+
+		next = ""
+		if link := res.Header.Get("Link"); link != "" {
+			m := nextLinkRE.FindStringSubmatch(link)
+			xCheck(t, m != nil, "Bad Link header: %s", link)
+			next = m[1]
+		}
+	}
+	xCheck(t, next == "", "Extra Link header after last page of %q: %s",
+		url, next)
+}
+
+func TestPagingBasic(t *testing.T) {
+	reg := NewRegistry("TestPagingBasic")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddAttr("rank", registry.INTEGER)
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+
+	for i, rank := range []int{3, 5, 1, 4, 2} {
+		d, _ := reg.AddGroup("dirs", "d"+string(rune('1'+i)))
+		xNoErr(t, d.SetSave("rank", rank))
+	}
+	d, _ := reg.FindGroup("dirs", "d1", false)
+	d.AddResource("files", "f1", "v1")
+	d.AddResource("files", "f2", "v1")
+	d.AddResource("files", "f3", "v1")
+	d.AddResource("files", "f4", "v1")
+
+	xCheckPages(t, reg, "dirs?limit=2", []string{
+		`{"d1":{},"d2":{}}`,
+		`{"d3":{},"d4":{}}`,
+		`{"d5":{}}`,
+	})
+
+	xCheckPages(t, reg, "dirs?limit=5", []string{
+		`{"d1":{},"d2":{},"d3":{},"d4":{},"d5":{}}`,
+	})
+
+	xCheckPages(t, reg, "dirs?limit=3&sort=rank=desc", []string{
+		`{"d2":{},"d4":{},"d1":{}}`,
+		`{"d5":{},"d3":{}}`,
+	})
+
+	xCheckPages(t, reg, "dirs/d1/files?limit=3", []string{
+		`{"f1":{},"f2":{},"f3":{}}`,
+		`{"f4":{}}`,
+	})
+
+	// Nested collections aren't paged, and their counts are the full totals
+	xCheckPages(t, reg, "dirs?inline&limit=1", []string{
+		`{"d1":{"files":{"f1":{"versions":{"v1":{}}},` +
+			`"f2":{"versions":{"v1":{}}},` +
+			`"f3":{"versions":{"v1":{}}},` +
+			`"f4":{"versions":{"v1":{}}}}}}`,
+		`{"d2":{"files":{}}}`,
+		`{"d3":{"files":{}}}`,
+		`{"d4":{"files":{}}}`,
+		`{"d5":{"files":{}}}`,
+	})
+	xCheckGet(t, reg, "dirs?limit=1", `{
+  "d1": {
+    "id": "d1",
+    "epoch": 1,
+    "self": "http://localhost:8181/dirs/d1",
+    "createdat": "YYYY-MM-DDTHH:MM:01Z",
+    "modifiedat": "YYYY-MM-DDTHH:MM:01Z",
+    "rank": 3,
+
+    "filescount": 4,
+    "filesurl": "http://localhost:8181/dirs/d1/files"
+  }
+}
+`)
+
+	// Cursors are tied to the sort that created them
+	res, err := http.Get("http://localhost:8181/dirs?limit=1&sort=rank")
+	xNoErr(t, err)
+	res.Body.Close()
+	link := nextLinkRE.FindStringSubmatch(res.Header.Get("Link"))
+	xCheck(t, link != nil, "Missing Link header: %v", res.Header)
+	_, cursor, _ := strings.Cut(link[1], "cursor=")
+	cursor, _, _ = strings.Cut(cursor, "&")
+
+	xCheckGet(t, reg, "dirs?limit=1&cursor="+cursor,
+		"The 'cursor' value doesn't match the 'sort' value used to create it\n")
+	xCheckGet(t, reg, "dirs?limit=1&cursor=foo",
+		"Invalid cursor: foo\n")
+	xCheckGet(t, reg, "dirs?limit=0",
+		"Invalid 'limit' value: \"0\", must be a positive integer\n")
+	xCheckGet(t, reg, "dirs?limit=abc",
+		"Invalid 'limit' value: \"abc\", must be a positive integer\n")
+}
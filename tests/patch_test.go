@@ -0,0 +1,202 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+func xPatch(t *testing.T, reg *registry.Registry, url string, ct string,
+	body string, code int, resBody string) {
+
+	t.Helper()
+	xNoErr(t, reg.Commit())
+
+	req, err := http.NewRequest("PATCH", "http://localhost:8181"+url,
+		strings.NewReader(body))
+	xNoErr(t, err)
+	req.Header.Add("Content-Type", ct)
+	res, err := http.DefaultClient.Do(req)
+	xNoErr(t, err)
+	buf, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	xCheck(t, res.StatusCode == code, "PATCH %s: expected %d, got %d\n%s",
+		url, code, res.StatusCode, string(buf))
+	if resBody != "*" {
+		xCheckEqual(t, "", MaskTimestamps(string(buf)), resBody)
+	}
+}
+
+func TestPatchContentTypes(t *testing.T) {
+	reg := NewRegistry("TestPatchContentTypes")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	_, err = gm.AddAttr("obj", registry.ANY)
+	xNoErr(t, err)
+
+	xStatus(t, reg, "PUT", "/dirs/d1",
+		`{"name":"d1","labels":{"a":"1","b":"2"},"obj":{"x":[1,2],"y":{"z":1}}}`,
+		201)
+
+	// JSON Patch, deep edits
+	xPatch(t, reg, "/dirs/d1", "application/json-patch+json", `[
+  {"op":"test","path":"/name","value":"d1"},
+  {"op":"remove","path":"/labels/a"},
+  {"op":"add","path":"/obj/x/1","value":5},
+  {"op":"replace","path":"/obj/y/z","value":"new"},
+  {"op":"move","from":"/name","path":"/description"}
+]`, 200, `{
+  "id": "d1",
+  "epoch": 2,
+  "self": "http://localhost:8181/dirs/d1",
+  "description": "d1",
+  "labels": {
+    "b": "2"
+  },
+  "createdat": "YYYY-MM-DDTHH:MM:01Z",
+  "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+  "obj": {
+    "x": [
+      1,
+      5,
+      2
+    ],
+    "y": {
+      "z": "new"
+    }
+  },
+
+  "filescount": 0,
+  "filesurl": "http://localhost:8181/dirs/d1/files"
+}
+`)
+
+	// JSON Merge Patch
+	xPatch(t, reg, "/dirs/d1", "application/merge-patch+json; charset=utf-8",
+		`{"description":null,"labels":{"c":"3"},"obj":{"y":{"w":true}}}`,
+		200, `{
+  "id": "d1",
+  "epoch": 3,
+  "self": "http://localhost:8181/dirs/d1",
+  "labels": {
+    "b": "2",
+    "c": "3"
+  },
+  "createdat": "YYYY-MM-DDTHH:MM:01Z",
+  "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+  "obj": {
+    "x": [
+      1,
+      5,
+      2
+    ],
+    "y": {
+      "w": true,
+      "z": "new"
+    }
+  },
+
+  "filescount": 0,
+  "filesurl": "http://localhost:8181/dirs/d1/files"
+}
+`)
+
+	// Failures
+	xPatch(t, reg, "/dirs/d1", "application/json-patch+json",
+		`[{"op":"test","path":"/epoch","value":1},
+		  {"op":"remove","path":"/labels"}]`, 412,
+		"Test operation 0 failed: value at \"/epoch\" isn't 1\n")
+	xPatch(t, reg, "/dirs/d1", "application/json-patch+json",
+		`[{"op":"remove","path":"/labels/zzz"}]`, 409,
+		"Error in operation 0 (remove \"/labels/zzz\"): \"zzz\" doesn't exist\n")
+	xPatch(t, reg, "/dirs/d1", "application/json-patch+json",
+		`[{"op":"foo","path":"/labels"}]`, 400,
+		"Invalid JSON Patch: operation 0 has an invalid \"op\" value (foo)\n")
+	xPatch(t, reg, "/dirs/d1", "application/json-patch+json",
+		`[{"op":"replace","path":"","value":[]}]`, 400,
+		"The patched entity must be a JSON object\n")
+	xPatch(t, reg, "/dirs/d1", "application/merge-patch+json",
+		`{"epoch":"x"}`, 400, "Attribute \"epoch\" must be a uinteger\n")
+	xPatch(t, reg, "/dirs", "application/merge-patch+json", `{}`, 405,
+		"PATCH not allowed on collections\n")
+
+	// Versions ($meta) and Resources
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1$meta",
+		`{"contenttype":"application/json","file":{"a":{"b":1},"c":[1]}}`, 201)
+	xPatch(t, reg, "/dirs/d1/files/f1$meta", "application/merge-patch+json",
+		`{"labels":{"l":"v"}}`, 200, "*")
+	xPatch(t, reg, "/dirs/d1/files/f1/versions/v1$meta",
+		"application/json-patch+json",
+		`[{"op":"test","path":"/id","value":"v1"},
+		  {"op":"test","path":"/labels/l","value":"v"},
+		  {"op":"add","path":"/name","value":"ver1"}]`, 200, "*")
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1/versions/v1$meta", "", 200, `{
+  "id": "v1",
+  "name": "ver1",
+  "epoch": 3,
+  "self": "http://localhost:8181/dirs/d1/files/f1/versions/v1$meta",
+  "isdefault": true,
+  "labels": {
+    "l": "v"
+  },
+  "createdat": "YYYY-MM-DDTHH:MM:01Z",
+  "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+  "contenttype": "application/json",
+  "contentdigest": "sha256:7e2e788e7a301de6529af1c2937ba09a19846a298fed4b6ab56f993e0802ad61"
+}
+`)
+
+	// Resource documents
+	xPatch(t, reg, "/dirs/d1/files/f1", "application/json-patch+json",
+		`[{"op":"replace","path":"/a/b","value":2},
+		  {"op":"add","path":"/c/-","value":3}]`, 200,
+		`{"a":{"b":2},"c":[1,3]}`)
+	xPatch(t, reg, "/dirs/d1/files/f1/versions/v1",
+		"application/merge-patch+json", `{"a":null,"d":"x"}`, 200,
+		`{"c":[1,3],"d":"x"}`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1$meta", "", 200, `{
+  "id": "f1",
+  "name": "ver1",
+  "epoch": 5,
+  "self": "http://localhost:8181/dirs/d1/files/f1$meta",
+  "defaultversionid": "v1",
+  "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/v1$meta",
+  "labels": {
+    "l": "v"
+  },
+  "createdat": "YYYY-MM-DDTHH:MM:01Z",
+  "modifiedat": "YYYY-MM-DDTHH:MM:02Z",
+  "contenttype": "application/json",
+  "contentdigest": "sha256:c3aae72c1dd90194651612509066ed39586030a1dbe865c0bdbbbd040031f191",
+
+  "versionscount": 1,
+  "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
+}
+`)
+
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f2", "not json", 201)
+	xPatch(t, reg, "/dirs/d1/files/f2", "application/merge-patch+json",
+		`{"a":1}`, 400, "Can't patch a Resource document that isn't JSON\n")
+	xPatch(t, reg, "/dirs/d1/files/f2", "application/json", `{"a":1}`, 400,
+		"PATCH is not allowed on Resource documents\n")
+
+	// Documents we don't have a copy of can't be patched
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f3$meta",
+		`{"fileurl":"http://example.com/doc"}`, 201)
+	xPatch(t, reg, "/dirs/d1/files/f3", "application/merge-patch+json",
+		`{"a":1}`, 400,
+		"Can't patch a Resource document that's stored externally\n")
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f4$meta",
+		`{"fileproxyurl":"http://example.com/doc"}`, 201)
+	xPatch(t, reg, "/dirs/d1/files/f4", "application/merge-patch+json",
+		`{"a":1}`, 400,
+		"Can't patch a Resource document that's stored externally\n")
+}
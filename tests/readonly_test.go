@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+func TestReadOnlyRegistry(t *testing.T) {
+	reg := NewRegistry("TestReadOnlyRegistry")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1", "hello", 201)
+
+	xNoErr(t, reg.SetReadOnly(true))
+	ro, err := reg.IsReadOnly()
+	xNoErr(t, err)
+	xCheck(t, ro, "Registry should be read-only")
+
+	msg := "Write operations to a read-only registry are not allowed\n"
+	xStatus(t, reg, "GET", "/dirs/d1/files/f1", "", 200)
+	xHTTP(t, reg, "PUT", "/", "{}", 405, msg)
+	xHTTP(t, reg, "PUT", "/model", "{}", 405, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d2", "{}", 405, msg)
+	xHTTP(t, reg, "PATCH", "/dirs/d1", "{}", 405, msg)
+	xHTTP(t, reg, "POST", "/dirs/d1/files", "{}", 405, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", "world", 405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1", "", 405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs", "", 405, msg)
+	xHTTP(t, reg, "PUT", "/subscriptions/s1", `{"sink":"http://x"}`, 405, msg)
+
+	// Internal APIs can still change things
+	d1, err := reg.FindGroup("dirs", "d1", false)
+	xNoErr(t, err)
+	_, err = d1.AddResource("files", "f2", "v1")
+	xNoErr(t, err)
+
+	xNoErr(t, reg.SetReadOnly(false))
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f2", "", 204, "")
+
+	// Server-wide read-only mode
+	server := httptest.NewServer(&registry.Server{ReadOnly: true})
+	defer server.Close()
+
+	for _, method := range []string{"GET", "PUT", "POST", "PATCH", "DELETE"} {
+		req, err := http.NewRequest(method, server.URL+"/dirs/d1",
+			strings.NewReader(""))
+		xNoErr(t, err)
+		res, err := http.DefaultClient.Do(req)
+		xNoErr(t, err)
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if method == "GET" {
+			xCheckEqual(t, "", res.StatusCode, 200)
+		} else {
+			xCheckEqual(t, method+":\n", res.StatusCode, 405)
+			xCheckEqual(t, method+":\n", string(body), msg)
+		}
+	}
+}
+
+func TestReadOnlyLockedGroup(t *testing.T) {
+	reg := NewRegistry("TestReadOnlyLockedGroup")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/v1", "hello", 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/v2", "world", 201)
+	xStatus(t, reg, "PUT", "/dirs/d2", "{}", 201)
+
+	xHTTP(t, reg, "PATCH", "/dirs/d1", `{"locked":true}`, 200, `{
+  "id": "d1",
+  "epoch": 2,
+  "self": "http://localhost:8181/dirs/d1",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:02Z",
+
+  "filescount": 1,
+  "filesurl": "http://localhost:8181/dirs/d1/files"
+}
+`)
+
+	d1, err := reg.FindGroup("dirs", "d1", false)
+	xNoErr(t, err)
+	locked, err := d1.IsLocked()
+	xNoErr(t, err)
+	xCheck(t, locked, "d1 should be locked")
+
+	msg := "Group \"/dirs/d1\" is locked\n"
+	xStatus(t, reg, "GET", "/dirs/d1/files/f1", "", 200)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1", "new", 423, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f2", "new", 423, msg)
+	xHTTP(t, reg, "POST", "/dirs/d1/files", `{"f3":{}}`, 423, msg)
+	xHTTP(t, reg, "POST", "/dirs/d1/files/f1", "new", 423, msg)
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1$meta", "{}", 423, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d1/files/f1/versions/v3", "new", 423, msg)
+	xHTTP(t, reg, "POST", "/dirs/d1/files/f1?setdefaultversionid=v1", "",
+		423, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1/versions/v1", "", 423, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1", "", 423,
+		"Error deleting Resource \"f1\": "+msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files", "", 423,
+		"Error deleting \"f1\": "+msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1", "", 423,
+		"Error deleting Group \"d1\": "+msg)
+	xHTTP(t, reg, "DELETE", "/dirs", `[{"id":"d1"}]`, 423,
+		"Error deleting \"d1\": "+msg)
+
+	// Nested updates via the Group, or the Registry, are blocked too. A PUT
+	// w/o "locked" doesn't unlock it.
+	xHTTP(t, reg, "PUT", "/dirs/d1?nested", `{"files":{"f3":{}}}`, 423, msg)
+	xHTTP(t, reg, "PUT", "/?nested", `{"dirs":{"d1":{"files":{"f3":{}}}}}`, 423,
+		msg)
+
+	// But the Group's own attributes, and other Groups, are still ok
+	xStatus(t, reg, "PATCH", "/dirs/d1", `{"name":"frozen"}`, 200)
+	xStatus(t, reg, "PUT", "/dirs/d1", `{"name":"frozen"}`, 200)
+	locked, err = d1.IsLocked()
+	xCheck(t, err == nil && locked, "d1 should be locked")
+	xStatus(t, reg, "PUT", "/dirs/d2/files/f1", "hello", 201)
+
+	// Internal APIs honor the lock too
+	_, err = d1.AddResource("files", "f3", "v1")
+	xCheckErr(t, err, "Group \"/dirs/d1\" is locked")
+
+	xHTTP(t, reg, "PATCH", "/dirs/d1", `{"locked":"yes"}`, 400,
+		"Attribute \"locked\" must be a boolean\n")
+
+	xStatus(t, reg, "PATCH", "/dirs/d1", `{"locked":false}`, 200)
+	locked, err = d1.IsLocked()
+	xCheck(t, err == nil && !locked, "d1 shouldn't be locked")
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1", "new", 200)
+
+	xNoErr(t, d1.SetLocked(true))
+	xHTTP(t, reg, "DELETE", "/dirs/d1", "", 423,
+		"Error deleting Group \"d1\": "+msg)
+	xNoErr(t, d1.SetLocked(false))
+	xHTTP(t, reg, "DELETE", "/dirs/d1", "", 204, "")
+}
+
+func TestReadOnlyResourceModel(t *testing.T) {
+	reg := NewRegistry("TestReadOnlyResourceModel")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModelFull(&registry.ResourceModel{
+		Plural:           "files",
+		Singular:         "file",
+		SetVersionId:     registry.PtrBool(true),
+		SetStickyDefault: registry.PtrBool(true),
+		HasDocument:      registry.PtrBool(true),
+		ReadOnly:         true,
+	})
+	xNoErr(t, err)
+
+	xStatus(t, reg, "PUT", "/dirs/d1", "{}", 201)
+	d1, err := reg.FindGroup("dirs", "d1", false)
+	xNoErr(t, err)
+	f1, err := d1.AddResource("files", "f1", "v1")
+	xNoErr(t, err)
+	_, err = f1.AddVersion("v2")
+	xNoErr(t, err)
+
+	msg := "Write operations to read-only resources are not allowed\n"
+	xHTTP(t, reg, "PATCH", "/dirs/d1/files/f1$meta", "{}", 405, msg)
+	xHTTP(t, reg, "POST", "/dirs/d1/files/f1?setdefaultversionid=v1", "",
+		405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1/versions/v1", "", 405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files/f1", "", 405, msg)
+	xHTTP(t, reg, "DELETE", "/dirs/d1/files", "", 405, msg)
+
+	// Nested updates are caught too
+	xHTTP(t, reg, "PUT", "/dirs/d1?nested", `{"files":{"f2":{}}}`, 400, msg)
+	xHTTP(t, reg, "PUT", "/dirs/d1?nested", `{"files":{"f1":{"name":"x"}}}`, 400,
+		msg)
+
+	xStatus(t, reg, "GET", "/dirs/d1/files", "", 200)
+	xHTTP(t, reg, "DELETE", "/dirs/d1", "", 204, "")
+}
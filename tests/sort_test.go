@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+func TestSortBasic(t *testing.T) {
+	reg := NewRegistry("TestSortBasic")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddAttr("rank", registry.INTEGER)
+	xNoErr(t, err)
+	rm, err := gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	_, err = rm.AddAttr("when", registry.TIMESTAMP)
+	xNoErr(t, err)
+
+	// Note: as strings the ranks would sort as d1(10), d3(100), d2(9)
+	d, _ := reg.AddGroup("dirs", "d1")
+	xNoErr(t, d.SetSave("rank", 10))
+	xNoErr(t, d.SetSave("name", "beta"))
+	f, _ := d.AddResource("files", "f1", "v1")
+	xNoErr(t, f.SetSave("when", "2024-06-01T12:00:00+02:00")) // 10:00Z
+	f, _ = d.AddResource("files", "f2", "v1")
+	xNoErr(t, f.SetSave("when", "2024-06-01T11:00:00Z"))
+	f, _ = d.AddResource("files", "f3", "v1")
+	f.AddVersion("v2")
+
+	d, _ = reg.AddGroup("dirs", "d2")
+	xNoErr(t, d.SetSave("rank", 9))
+	xNoErr(t, d.SetSave("name", "Alpha"))
+
+	d, _ = reg.AddGroup("dirs", "d3")
+	xNoErr(t, d.SetSave("rank", 100))
+	xNoErr(t, d.SetSave("name", "gamma"))
+
+	d, _ = reg.AddGroup("dirs", "d4")
+
+	tests := []struct {
+		Name string
+		URL  string
+		Exp  string
+	}{
+		{"int asc", "dirs?oneline&sort=rank",
+			`{"d2":{},"d1":{},"d3":{},"d4":{}}`},
+		{"int asc explicit", "dirs?oneline&sort=rank=asc",
+			`{"d2":{},"d1":{},"d3":{},"d4":{}}`},
+		{"int desc", "dirs?oneline&sort=rank=desc",
+			`{"d3":{},"d1":{},"d2":{},"d4":{}}`},
+		{"string any case", "dirs?oneline&sort=name",
+			`{"d2":{},"d1":{},"d3":{},"d4":{}}`},
+		{"string desc", "dirs?oneline&sort=name=DESC",
+			`{"d3":{},"d1":{},"d2":{},"d4":{}}`},
+		{"ts asc", "dirs/d1/files?oneline&sort=when",
+			`{"f1":{},"f2":{},"f3":{}}`},
+		{"ts desc", "dirs/d1/files?oneline&sort=when=desc",
+			`{"f2":{},"f1":{},"f3":{}}`},
+		{"versions desc", "dirs/d1/files/f3/versions?oneline&sort=id=desc",
+			`{"v2":{},"v1":{}}`},
+		{"nested", "?oneline&inline&sort=id=desc",
+			`{"dirs":{"d4":{"files":{}},"d3":{"files":{}},"d2":{"files":{}},` +
+				`"d1":{"files":{"f3":{"versions":{"v2":{},"v1":{}}},` +
+				`"f2":{"versions":{"v1":{}}},` +
+				`"f1":{"versions":{"v1":{}}}}}}}`},
+		{"nested mixed", "dirs?oneline&inline&sort=when=desc",
+			`{"d1":{"files":{"f2":{"versions":{"v1":{}}},` +
+				`"f1":{"versions":{"v1":{}}},` +
+				`"f3":{"versions":{"v1":{},"v2":{}}}}},` +
+				`"d2":{"files":{}},"d3":{"files":{}},"d4":{"files":{}}}`},
+		{"no attr", "dirs?oneline&sort=",
+			"Sort \"\" is missing an attribute name\n"},
+		{"bad order", "dirs?oneline&sort=rank=up",
+			"Sort \"rank=up\" has an invalid order, must be one of: asc, desc\n"},
+		{"not scalar", "dirs?oneline&sort=labels",
+			"Sort \"labels\" must use a scalar attribute\n"},
+	}
+
+	for _, test := range tests {
+		t.Logf("Test name: %s", test.Name)
+		xCheckGet(t, reg, test.URL, test.Exp)
+	}
+}
@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+// Collects the events sent to the sink as "SUBID:TYPE:SUBJECT" strings, the
+// subscription ID being the last part of the sink's URL
+type EventSink struct {
+	mutex  sync.Mutex
+	events []string
+	server *httptest.Server
+}
+
+func NewEventSink() *EventSink {
+	sink := &EventSink{}
+	sink.server = httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			buf, _ := io.ReadAll(r.Body)
+			event := registry.Event{}
+			json.Unmarshal(buf, &event)
+
+			sink.mutex.Lock()
+			defer sink.mutex.Unlock()
+			sink.events = append(sink.events, r.URL.Path[1:]+":"+
+				event.Type[len("io.xregistry."):]+":"+event.Subject)
+		}))
+	return sink
+}
+
+// Wait for the expected events (in any order) and make sure no others show up
+func xCheckEvents(t *testing.T, sink *EventSink, exp ...string) {
+	t.Helper()
+
+	got := []string{}
+	for end := time.Now().Add(5 * time.Second); time.Now().Before(end); {
+		sink.mutex.Lock()
+		l := len(sink.events)
+		sink.mutex.Unlock()
+		if l >= len(exp) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	sink.mutex.Lock()
+	got, sink.events = sink.events, nil
+	sink.mutex.Unlock()
+
+	sort.Strings(got)
+	sort.Strings(exp)
+	xCheckEqual(t, "Events:\n", strings.Join(got, "\n"), strings.Join(exp, "\n"))
+}
+
+func TestSubscriptionsBasic(t *testing.T) {
+	reg := NewRegistry("TestSubscriptionsBasic")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+
+	sink := NewEventSink()
+	defer sink.server.Close()
+	url := sink.server.URL
+
+	xHTTP(t, reg, "GET", "/subscriptions", "", 200, "{}\n")
+
+	// Everything
+	xHTTP(t, reg, "PUT", "/subscriptions/s1", `{"sink":"`+url+`/s1"}`, 201,
+		`{
+  "id": "s1",
+  "sink": "`+url+`/s1"
+}
+`)
+	// Just new things in /dirs/d1/files
+	xHTTP(t, reg, "PUT", "/subscriptions/s2", `{
+  "sink": "`+url+`/s2",
+  "path": "dirs/d1/files/",
+  "types": ["io.xregistry.created"]
+}`, 201, `{
+  "id": "s2",
+  "sink": "`+url+`/s2",
+  "path": "/dirs/d1/files",
+  "types": [
+    "io.xregistry.created"
+  ]
+}
+`)
+	// Dirs (or their files) with an "env" label of "prod"
+	xHTTP(t, reg, "POST", "/subscriptions", `{
+  "id": "s3",
+  "sink": "`+url+`/s3",
+  "path": "/dirs",
+  "filters": ["labels.env=prod", "name=x*,labels.env"]
+}`, 201, `{
+  "id": "s3",
+  "sink": "`+url+`/s3",
+  "path": "/dirs",
+  "filters": [
+    "labels.env=prod",
+    "name=x*,labels.env"
+  ]
+}
+`)
+
+	xStatus(t, reg, "PUT", "/dirs/d1", `{}`, 201)
+	xCheckEvents(t, sink, "s1:created:dirs/d1")
+
+	xStatus(t, reg, "PUT", "/dirs/d2", `{"labels":{"env":"prod"}}`, 201)
+	xCheckEvents(t, sink, "s1:created:dirs/d2", "s3:created:dirs/d2")
+
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1", `hello`, 201)
+	xCheckEvents(t, sink,
+		"s1:created:dirs/d1/files/f1",
+		"s1:created:dirs/d1/files/f1/versions/1",
+		"s2:created:dirs/d1/files/f1",
+		"s2:created:dirs/d1/files/f1/versions/1")
+
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1", `world`, 200)
+	xCheckEvents(t, sink, "s1:updated:dirs/d1/files/f1/versions/1")
+
+	// Filters check the parents too
+	xStatus(t, reg, "PUT", "/dirs/d2/files/f2", `hello`, 201)
+	xCheckEvents(t, sink,
+		"s1:created:dirs/d2/files/f2",
+		"s1:created:dirs/d2/files/f2/versions/1",
+		"s3:created:dirs/d2/files/f2",
+		"s3:created:dirs/d2/files/f2/versions/1")
+
+	xStatus(t, reg, "PATCH", "/dirs/d1", `{"name":"xyz"}`, 200)
+	xCheckEvents(t, sink, "s1:updated:dirs/d1")
+
+	xStatus(t, reg, "PATCH", "/dirs/d1", `{"labels":{"env":"dev"}}`, 200)
+	xCheckEvents(t, sink, "s1:updated:dirs/d1", "s3:updated:dirs/d1")
+
+	// Deleted entities use their last known values
+	xStatus(t, reg, "DELETE", "/dirs/d2", ``, 204)
+	xCheckEvents(t, sink, "s1:deleted:dirs/d2", "s3:deleted:dirs/d2")
+
+	// Subscriptions are stored in the DB, so make sure we can reload them
+	registry.ClearSubscriptionsCache(reg.DbSID)
+	xHTTP(t, reg, "DELETE", "/subscriptions/s1", ``, 204, "")
+	xStatus(t, reg, "DELETE", "/dirs/d1", ``, 204)
+	xCheckEvents(t, sink, "s3:deleted:dirs/d1")
+
+	xHTTP(t, reg, "GET", "/subscriptions", "", 200, `{
+  "s2": {
+    "id": "s2",
+    "sink": "`+url+`/s2",
+    "path": "/dirs/d1/files",
+    "types": [
+      "io.xregistry.created"
+    ]
+  },
+  "s3": {
+    "id": "s3",
+    "sink": "`+url+`/s3",
+    "path": "/dirs",
+    "filters": [
+      "labels.env=prod",
+      "name=x*,labels.env"
+    ]
+  }
+}
+`)
+	xHTTP(t, reg, "GET", "/subscriptions/s3", "", 200, `{
+  "id": "s3",
+  "sink": "`+url+`/s3",
+  "path": "/dirs",
+  "filters": [
+    "labels.env=prod",
+    "name=x*,labels.env"
+  ]
+}
+`)
+
+	// Errors
+	xHTTP(t, reg, "GET", "/subscriptions/s1", "", 404,
+		"Subscription \"s1\" not found\n")
+	xHTTP(t, reg, "DELETE", "/subscriptions/s1", "", 404,
+		"Subscription \"s1\" not found\n")
+	xHTTP(t, reg, "DELETE", "/subscriptions", "", 405,
+		"DELETE not allowed on /subscriptions\n")
+	xHTTP(t, reg, "PATCH", "/subscriptions/s2", `{}`, 405,
+		"PATCH not allowed on \"/subscriptions/s2\"\n")
+	xHTTP(t, reg, "POST", "/subscriptions", `{"id":"s2","sink":"`+url+`"}`,
+		409, "Subscription \"s2\" already exists\n")
+	xHTTP(t, reg, "PUT", "/subscriptions/s4", `{"id":"s5","sink":"`+url+`"}`,
+		400, "The \"id\" attribute must be set to \"s4\", not \"s5\"\n")
+	xHTTP(t, reg, "PUT", "/subscriptions/s4", `{}`, 400,
+		"Subscription must have a \"sink\" value\n")
+	xHTTP(t, reg, "PUT", "/subscriptions/s4", `{"sink":"/foo"}`, 400,
+		"Invalid \"sink\" value (/foo), must be an absolute http(s) URL\n")
+	xHTTP(t, reg, "PUT", "/subscriptions/s4",
+		`{"sink":"`+url+`","types":["created"]}`, 400,
+		"Invalid \"types\" value (created), must be one of: "+
+			"io.xregistry.created, io.xregistry.updated, "+
+			"io.xregistry.deleted, io.xregistry.defaultversionchanged\n")
+	xHTTP(t, reg, "PUT", "/subscriptions/s4",
+		`{"sink":"`+url+`","path":"/foos"}`, 400,
+		"Invalid \"path\" value (/foos): Unknown Group type: foos\n")
+	xHTTP(t, reg, "PUT", "/subscriptions/s4",
+		`{"sink":"`+url+`","path":"/model"}`, 400,
+		"Invalid \"path\" value (/model): must be the path to an entity "+
+			"or collection in the registry\n")
+	xHTTP(t, reg, "PUT", "/subscriptions/s4",
+		`{"sink":"`+url+`","path":"/dirs","filters":["epoch<abc"]}`, 400,
+		"Invalid \"filters\" value (epoch<abc): Filter \"epoch<abc\" must "+
+			"use a numeric value\n")
+	xStatus(t, reg, "PUT", "/subscriptions/s4", `{"sink":"`+url+`","foo":"bar"}`, 400)
+	xHTTP(t, reg, "GET", "/subscriptions/s4/foo", "", 404, "Not found\n")
+}
@@ -32,6 +32,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -47,6 +48,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "filebase64": "Zm9v",
 
   "versionscount": 1,
@@ -64,6 +66,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "file": "foo",
 
   "versionscount": 1,
@@ -82,6 +85,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "file": "foo",
 
   "versionscount": 1,
@@ -99,6 +103,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "file": "foo",
 
   "versionscount": 1,
@@ -116,6 +121,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "filebase64": "Zm9v",
 
   "versionscount": 1,
@@ -135,6 +141,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:01Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae",
   "file": "foo",
 
   "versionscount": 1,
@@ -153,6 +160,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:7a38bf81f383f69433ad6e900d35b3e2385593f76a7b7ab5d4355b8ba41ee24b",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -168,6 +176,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:7a38bf81f383f69433ad6e900d35b3e2385593f76a7b7ab5d4355b8ba41ee24b",
   "file": "{\"foo\":\"bar\"}",
 
   "versionscount": 1,
@@ -185,6 +194,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:7a38bf81f383f69433ad6e900d35b3e2385593f76a7b7ab5d4355b8ba41ee24b",
   "file": {
     "foo": "bar"
   },
@@ -204,6 +214,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "bad/bad",
+  "contentdigest": "sha256:7a38bf81f383f69433ad6e900d35b3e2385593f76a7b7ab5d4355b8ba41ee24b",
   "filebase64": "eyJmb28iOiJiYXIifQ==",
 
   "versionscount": 1,
@@ -221,6 +232,7 @@ func TestTypeMap(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:738f748710e0adc2e62f2e5f9b5cec4ed12abfd7142c0bd4ff81966e5a17a278",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -235,6 +247,7 @@ func TestTypeMap(t *testing.T) {
   "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:738f748710e0adc2e62f2e5f9b5cec4ed12abfd7142c0bd4ff81966e5a17a278",
   "filebase64": "Zm9vImJhcg==",
 
   "versionscount": 1,
@@ -255,6 +268,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:738f748710e0adc2e62f2e5f9b5cec4ed12abfd7142c0bd4ff81966e5a17a278",
 
   "versionscount": 1,
   "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
@@ -270,6 +284,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:738f748710e0adc2e62f2e5f9b5cec4ed12abfd7142c0bd4ff81966e5a17a278",
   "filebase64": "Zm9vImJhcg==",
 
   "versionscount": 1,
@@ -287,6 +302,7 @@ func TestTypeMap(t *testing.T) {
   "createdat": "2024-01-01T12:00:01Z",
   "modifiedat": "2024-01-01T12:00:02Z",
   "contenttype": "application/json",
+  "contentdigest": "sha256:738f748710e0adc2e62f2e5f9b5cec4ed12abfd7142c0bd4ff81966e5a17a278",
   "file": "foo\"bar",
 
   "versionscount": 1,
@@ -120,6 +120,14 @@ func Fail(t *testing.T, str string, args ...any) {
 	t.Fatalf("%s\n\n", text)
 }
 
+// Just check the status code
+func xStatus(t *testing.T, reg *registry.Registry, method, url, body string,
+	code int) {
+	t.Helper()
+	xCheckETag(t, reg, &ETagTest{method + " " + url, method, url, nil,
+		body, code, "", "*"})
+}
+
 func xCheckErr(t *testing.T, err error, errStr string) {
 	t.Helper()
 	if err == nil {
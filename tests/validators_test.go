@@ -0,0 +1,57 @@
+package tests
+
+import (
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+func TestContentValidation(t *testing.T) {
+	reg := NewRegistry("TestContentValidation")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	rm, err := gm.AddResourceModel("schemas", "schema", 0, true, true, true)
+	xNoErr(t, err)
+	_, err = rm.AddAttr("format", registry.STRING)
+	xNoErr(t, err)
+
+	// Picked based on the content type
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s1$meta",
+		`{"contenttype":"application/schema+json","schema":{"type":"object"}}`,
+		201)
+	xCheckHTTP(t, reg, &HTTPTest{
+		URL:        "dirs/d1/schemas/s1",
+		Method:     "PUT",
+		ReqHeaders: []string{"Content-Type: application/schema+json"},
+		ReqBody:    "{\n  \"type\": 5\n}",
+		Code:       400,
+		ResBody: `Invalid "application/schema+json" document: Error at ` +
+			`"type": must be one of: array, boolean, integer, null, number, ` +
+			`object, string, or an array of them` + "\n",
+	})
+
+	// Or the "format" attribute
+	xHTTP(t, reg, "PUT", "/dirs/d1/schemas/s2$meta",
+		`{"format":"Avro/1.11","schema":{"type":"record","fields":[]}}`,
+		400, `Invalid "avro" document: Error at "name": must be a `+
+			`non-empty string`+"\n")
+	xHTTP(t, reg, "PUT", "/dirs/d1/schemas/s2$meta",
+		`{"format":"Protobuf","schemabase64":"`+
+			`c3ludGF4ID0gInByb3RvMyI7Cm1lc3NhZ2UgTSB7`+`"}`,
+		400, `Invalid "protobuf" document: Syntax error at line 2, `+
+			`column 11: "{" is never closed`+"\n")
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s2$meta",
+		`{"format":"Protobuf","schema":"syntax = \"proto3\";"}`, 201)
+
+	// Failed updates don't change anything
+	xHTTP(t, reg, "PUT", "/dirs/d1/schemas/s2/versions/2$meta",
+		`{"format":"OpenAPI/3.0","schema":{"openapi":"3.0.0"}}`, 400,
+		`Invalid "openapi" document: Error at "info": must be an object`+"\n")
+	xStatus(t, reg, "GET", "/dirs/d1/schemas/s2/versions/2", "", 404)
+
+	// Unknown formats aren't checked
+	xStatus(t, reg, "PUT", "/dirs/d1/schemas/s3$meta",
+		`{"format":"XSD","schema":"<xs:schema"}`, 201)
+}
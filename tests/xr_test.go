@@ -1,8 +1,11 @@
 package tests
 
 import (
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -18,8 +21,13 @@ func TestXRBasic(t *testing.T) {
 	// Just look for the first 3 lines
 	xCheckEqual(t, "", lines, "xRegistry CLI\n\nUsage")
 
+	// Unless we're told to use a real copy of the spec, get its model files
+	// from the local import catalog so we don't need the network
+	env := append(os.Environ(), "XR_IMPORT_CATALOG=catalog",
+		"XR_OFFLINE=true")
 	if tmp := os.Getenv("XR_SPEC"); tmp != "" {
 		RepoBase = tmp
+		env = os.Environ()
 	}
 
 	// Make sure we can validate the various spec owned model files
@@ -32,6 +40,7 @@ func TestXRBasic(t *testing.T) {
 
 	for _, file := range files {
 		cmd = exec.Command("../xr", "model", "verify", file)
+		cmd.Env = env
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			t.Fatalf("File: %s\nOut: %s\nErr: %s", file, string(out), err)
@@ -39,3 +48,281 @@ func TestXRBasic(t *testing.T) {
 		xCheckEqual(t, "", string(out), "")
 	}
 }
+
+// Run "xr" against the test server, returning stdout, stderr and exit code
+func xXR(t *testing.T, stdin string, args ...string) (string, string, int) {
+	t.Helper()
+
+	cmd := exec.Command("../xr", append([]string{"-s",
+		"http://localhost:8181"}, args...)...)
+	cmd.Stdin = strings.NewReader(stdin)
+	stdout, stderr := &strings.Builder{}, &strings.Builder{}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+
+	code := 0
+	if err := cmd.Run(); err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		xCheck(t, ok, "Error running xr %v: %s", args, err)
+		code = exitErr.ExitCode()
+	}
+	return stdout.String(), stderr.String(), code
+}
+
+func TestXRCRUD(t *testing.T) {
+	reg := NewRegistry("TestXRCRUD")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("notes", "note", 0, true, true, false)
+	xNoErr(t, err)
+	xNoErr(t, reg.Commit())
+
+	file := t.TempDir() + "/f1.txt"
+	xNoErr(t, os.WriteFile(file, []byte("hello"), 0644))
+
+	for _, test := range []struct {
+		stdin  string
+		args   []string
+		stdout string // just the start of it
+		stderr string
+		code   int
+	}{
+		// Groups
+		{"", []string{"group", "create", "dirs/d1", "name=n1",
+			"labels.env=prod"}, "{\n  \"id\": \"d1\",", "", 0},
+		{"", []string{"group", "create", "dirs/d1"}, "",
+			"Group \"dirs/d1\" already exists\n", 2},
+		{"", []string{"group", "update", "dirs/d2"}, "",
+			"Group \"dirs/d2\" not found\n", 3},
+		{`{"description":"desc"}`, []string{"group", "update", "/dirs/d1/",
+			"-d", "-", "labels.env=dev"}, "{\n  \"id\": \"d1\",", "", 0},
+		{"", []string{"group", "patch", "dirs/d1", "name=n2", "labels-"},
+			"{\n  \"id\": \"d1\",", "", 0},
+		{"", []string{"group", "patch", "dirs/d1", "epoch:=abc"}, "",
+			"Invalid JSON value on \"epoch:=abc\": invalid character 'a' " +
+				"looking for beginning of value\n", 1},
+		{"", []string{"group", "patch", "dirs/d1", "epoch=abc"}, "",
+			"Attribute \"epoch\" must be a uinteger\n", 2},
+		{"", []string{"group", "get", "dirs"}, "",
+			"Invalid group PATH \"dirs\", must be of the form: GROUPS/gID\n", 1},
+		{"", []string{"group", "get", "dirs/d9"}, "", "Not found\n", 3},
+		{"", []string{"resource", "get", "foos/f1/files/f1"}, "",
+			"Unknown Group type: foos\n", 3},
+
+		// Resources and Versions
+		{"", []string{"resource", "create", "dirs/d1/files/f1", "-f", file,
+			"name=f1", "labels.a=b"}, "hello", "", 0},
+		{"", []string{"resource", "get", "dirs/d1/files/f1", "-c"}, "hello",
+			"", 0},
+		{"", []string{"resource", "get", "dirs/d1/files/f1"},
+			"{\n  \"id\": \"f1\",", "", 0},
+		{"", []string{"version", "get", "dirs/d1/files/f1/versions/1"},
+			"{\n  \"id\": \"1\",\n  \"name\": \"f1\",", "", 0},
+		{"world", []string{"version", "create", "dirs/d1/files/f1/versions/v2",
+			"-f", "-"}, "world", "", 0},
+		{"", []string{"version", "patch", "dirs/d1/files/f1/versions/v2",
+			"description=d"}, "{\n  \"id\": \"v2\",", "", 0},
+		{"", []string{"resource", "create", "dirs/d1/notes/n1", "name=n1"},
+			"{\n  \"id\": \"n1\",", "", 0},
+		{"", []string{"resource", "create", "dirs/d1/notes/n2", "-f", file},
+			"", "Resource type \"notes\" doesn't have documents\n", 1},
+		{"", []string{"version", "get", "dirs/d1/files/f1/vers/v2"}, "",
+			"Invalid version PATH \"dirs/d1/files/f1/vers/v2\", must be of " +
+				"the form: GROUPS/gID/RESOURCES/rID/versions/vID\n", 1},
+		{"", []string{"version", "delete", "dirs/d1/files/f1/versions/1"},
+			"", "", 0},
+		{"", []string{"version", "delete", "dirs/d1/files/f1/versions/1"},
+			"", "Version \"1\" not found\n", 3},
+	} {
+		name := strings.Join(test.args, " ")
+		stdout, stderr, code := xXR(t, test.stdin, test.args...)
+		xCheck(t, strings.HasPrefix(stdout, test.stdout),
+			"%s: expected stdout to start with %q, got:\n%s", name,
+			test.stdout, stdout)
+		xCheckEqual(t, name+"\nStderr:\n", stderr, test.stderr)
+		xCheckEqual(t, name+"\nExit code:\n", code, test.code)
+	}
+
+	xHTTP(t, reg, "GET", "/dirs/d1", "", 200, `{
+  "id": "d1",
+  "name": "n2",
+  "epoch": 3,
+  "self": "http://localhost:8181/dirs/d1",
+  "description": "desc",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:02Z",
+
+  "filescount": 1,
+  "filesurl": "http://localhost:8181/dirs/d1/files",
+  "notescount": 1,
+  "notesurl": "http://localhost:8181/dirs/d1/notes"
+}
+`)
+	xHTTP(t, reg, "GET", "/dirs/d1/files/f1$meta", "", 200, `{
+  "id": "f1",
+  "epoch": 2,
+  "self": "http://localhost:8181/dirs/d1/files/f1$meta",
+  "defaultversionid": "v2",
+  "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/v2$meta",
+  "description": "d",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:02Z",
+  "contentdigest": "sha256:486ea46224d1bb4fb680f34f7c9ad96a8f24ec88be73ea8e5a6c65260e9cb8a7",
+
+  "versionscount": 1,
+  "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
+}
+`)
+
+	_, stderr, code := xXR(t, "", "registry", "set", "name=reg", "labels.x=y")
+	xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+	xNoErr(t, reg.Refresh())
+	xCheckEqual(t, "", reg.Get("name"), "reg")
+	xCheckEqual(t, "", reg.Get("labels.x"), "y")
+	xNoErr(t, reg.Commit())
+
+	for _, args := range [][]string{
+		{"resource", "delete", "dirs/d1/files/f1"},
+		{"group", "delete", "dirs/d1"},
+	} {
+		_, stderr, code := xXR(t, "", args...)
+		xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+	}
+	xHTTP(t, reg, "GET", "/dirs", "", 200, "{}\n")
+}
+
+func TestXRExportImport(t *testing.T) {
+	reg := NewRegistry("TestXRExportImport")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("notes", "note", 0, true, true, false)
+	xNoErr(t, err)
+
+	xStatus(t, reg, "PATCH", "/", `{"name":"src"}`, 200)
+	xStatus(t, reg, "PUT", "/dirs/d1", `{"labels":{"env":"prod"}}`, 201)
+
+	// Newest (non-sticky) is "1", not "10" or "2"
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/10", `ten`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/2", `two`, 201)
+	xStatus(t, reg, "PUT", "/dirs/d1/files/f1/versions/1$meta",
+		`{"name":"one","contenttype":"application/octet-stream",
+		  "filebase64":"AAEC/w=="}`, 201)
+
+	// Sticky default, and versions created in the same request
+	xStatus(t, reg, "POST", "/dirs/d1/files/f2/versions?setdefaultversionid=2",
+		`{"1":{"file":"a"},"2":{"file":"b"},"3":{"file":"c"}}`, 200)
+
+	xStatus(t, reg, "PUT", "/dirs/d2/notes/n1", `{"name":"note"}`, 201)
+
+	bundle := t.TempDir() + "/bundle.json"
+	_, stderr, code := xXR(t, "", "registry", "export", bundle)
+	xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+	src, err := os.ReadFile(bundle)
+	xNoErr(t, err)
+
+	// Now load it into a new Registry and make sure we get the same thing
+	reg2 := NewRegistry("TestXRExportImport2")
+	defer PassDeleteReg(t, reg2)
+
+	_, stderr, code = xXR(t, string(src), "registry", "import")
+	xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+
+	xHTTP(t, reg2, "GET", "/dirs/d1/files/f1$meta", "", 200, `{
+  "id": "f1",
+  "name": "one",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1/files/f1$meta",
+  "defaultversionid": "1",
+  "defaultversionurl": "http://localhost:8181/dirs/d1/files/f1/versions/1$meta",
+  "createdat": "2024-01-01T12:00:03Z",
+  "modifiedat": "2024-01-01T12:00:03Z",
+  "contenttype": "application/octet-stream",
+  "contentdigest": "sha256:3d1f57c984978ef98a18378c8166c1cb8ede02c03eeb6aee7e2f121dfeee3e56",
+
+  "versionscount": 3,
+  "versionsurl": "http://localhost:8181/dirs/d1/files/f1/versions"
+}
+`)
+	xHTTP(t, reg2, "GET", "/dirs/d1/files/f2$meta", "", 200, `{
+  "id": "f2",
+  "epoch": 1,
+  "self": "http://localhost:8181/dirs/d1/files/f2$meta",
+  "stickydefaultversion": true,
+  "defaultversionid": "2",
+  "defaultversionurl": "http://localhost:8181/dirs/d1/files/f2/versions/2$meta",
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:01Z",
+  "contenttype": "application/json",
+  "contentdigest": "sha256:3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",
+
+  "versionscount": 3,
+  "versionsurl": "http://localhost:8181/dirs/d1/files/f2/versions"
+}
+`)
+	res, err := http.Get("http://localhost:8181/dirs/d1/files/f1/versions/1")
+	xNoErr(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	xCheckEqual(t, "", string(body), "\x00\x01\x02\xff")
+
+	_, stderr, code = xXR(t, "", "registry", "export", bundle)
+	xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+	dst, err := os.ReadFile(bundle)
+	xNoErr(t, err)
+	xCheckEqual(t, "", string(dst), string(src))
+
+	_, stderr, code = xXR(t, "{", "registry", "import")
+	xCheckEqual(t, "", stderr+strconv.Itoa(code),
+		"Error parsing the bundle: unexpected EOF\n1")
+}
+
+func TestXROutputYAML(t *testing.T) {
+	reg := NewRegistry("TestXROutputYAML")
+	defer PassDeleteReg(t, reg)
+
+	gm, err := reg.Model.AddGroupModel("dirs", "dir")
+	xNoErr(t, err)
+	_, err = gm.AddResourceModel("files", "file", 0, true, true, true)
+	xNoErr(t, err)
+	xNoErr(t, reg.Commit())
+
+	stdout, stderr, code := xXR(t, "", "-o", "yaml", "group", "create",
+		"dirs/d1", "name=n1", "labels.env=prod")
+	xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+	xCheckEqual(t, "", MaskTimestamps(stdout), `id: d1
+name: n1
+epoch: 1
+self: http://localhost:8181/dirs/d1
+labels:
+  env: prod
+createdat: "2024-01-01T12:00:01Z"
+modifiedat: "2024-01-01T12:00:01Z"
+filescount: 0
+filesurl: http://localhost:8181/dirs/d1/files
+`)
+
+	stdout, stderr, code = xXR(t, "", "--output=yaml", "registry", "get",
+		"dirs", "--inline", "files")
+	xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+	xCheck(t, strings.HasPrefix(stdout, "d1:\n  id: d1\n"),
+		"Bad output:\n%s", stdout)
+
+	// Documents are returned as is
+	_, stderr, code = xXR(t, "hello", "resource", "create",
+		"dirs/d1/files/f1", "-f", "-")
+	xCheckEqual(t, "", stderr+strconv.Itoa(code), "0")
+	stdout, stderr, code = xXR(t, "", "-o", "yaml", "resource", "get",
+		"dirs/d1/files/f1", "--content")
+	xCheckEqual(t, "", stdout+stderr+strconv.Itoa(code), "hello0")
+
+	_, stderr, code = xXR(t, "", "-o", "xml", "registry", "get")
+	xCheckEqual(t, "", stderr+strconv.Itoa(code),
+		"Invalid --output value \"xml\", must be json or yaml\n1")
+}
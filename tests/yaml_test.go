@@ -0,0 +1,190 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/duglin/xreg-github/registry"
+)
+
+func xYAML(t *testing.T, reg *registry.Registry, method string, url string,
+	headers map[string]string, body string, code int, resCT string,
+	resBody string) {
+
+	t.Helper()
+	xNoErr(t, reg.Commit())
+
+	req, err := http.NewRequest(method, "http://localhost:8181"+url,
+		strings.NewReader(body))
+	xNoErr(t, err)
+	for k, v := range headers {
+		req.Header.Add(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	xNoErr(t, err)
+	buf, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+
+	xCheck(t, res.StatusCode == code, "%s %s: expected %d, got %d\n%s",
+		method, url, code, res.StatusCode, string(buf))
+	xCheckEqual(t, "Content-Type", res.Header.Get("Content-Type"), resCT)
+	if resBody != "*" {
+		xCheckEqual(t, "", MaskTimestamps(string(buf)), resBody)
+	}
+}
+
+func TestHTTPYAML(t *testing.T) {
+	reg := NewRegistry("TestHTTPYAML")
+	defer PassDeleteReg(t, reg)
+
+	yamlIn := map[string]string{"Content-Type": "application/yaml"}
+	yamlOut := map[string]string{"Accept": "application/yaml"}
+	yamlBoth := map[string]string{
+		"Content-Type": "application/yaml",
+		"Accept":       "application/json;q=0.5, application/yaml",
+	}
+
+	// The model, in and out
+	xYAML(t, reg, "PUT", "/model", yamlIn, `
+# A YAML model
+groups:
+  dirs:
+    plural: dirs
+    singular: dir
+    attributes:
+      tags: { name: tags, type: array, item: { type: string } }
+    resources:
+      files:
+        plural: files
+        singular: file
+`, 200, "application/json", "*")
+
+	xYAML(t, reg, "GET", "/model", yamlOut, "", 200, "application/yaml", "*")
+
+	// Entities
+	xYAML(t, reg, "PUT", "/dirs/d1", yamlBoth, `
+name: "my dir"
+description: >-
+  A folded
+  description
+labels:
+  env: prod
+tags:
+  - a
+  - "123"
+`, 201, "application/yaml", `id: d1
+name: my dir
+epoch: 1
+self: http://localhost:8181/dirs/d1
+description: A folded description
+labels:
+  env: prod
+createdat: "2024-01-01T12:00:01Z"
+modifiedat: "2024-01-01T12:00:01Z"
+tags:
+  - a
+  - "123"
+filescount: 0
+filesurl: http://localhost:8181/dirs/d1/files
+`)
+
+	xYAML(t, reg, "PATCH", "/dirs/d1", yamlIn, "labels: { env: dev }\n",
+		200, "application/json", "*")
+
+	xYAML(t, reg, "GET", "/dirs/d1", nil, "", 200, "application/json",
+		`{
+  "id": "d1",
+  "name": "my dir",
+  "epoch": 2,
+  "self": "http://localhost:8181/dirs/d1",
+  "description": "A folded description",
+  "labels": {
+    "env": "dev"
+  },
+  "createdat": "2024-01-01T12:00:01Z",
+  "modifiedat": "2024-01-01T12:00:02Z",
+  "tags": [
+    "a",
+    "123"
+  ],
+
+  "filescount": 0,
+  "filesurl": "http://localhost:8181/dirs/d1/files"
+}
+`)
+
+	// A YAML document is saved, and returned, as is
+	doc := "# my schema\ntype: object\n"
+	xYAML(t, reg, "PUT", "/dirs/d1/files/f1", yamlBoth, doc, 201,
+		"application/yaml", doc)
+	xYAML(t, reg, "GET", "/dirs/d1/files/f1", yamlOut, "", 200,
+		"application/yaml", doc)
+
+	// But its metadata is converted
+	xYAML(t, reg, "PATCH", "/dirs/d1/files/f1$meta", yamlBoth,
+		"name: f1 name\n", 200, "application/yaml", "*")
+	xYAML(t, reg, "GET", "/dirs/d1/files/f1$meta?inline=file", yamlOut, "",
+		200, "application/yaml", `id: f1
+name: f1 name
+epoch: 2
+self: http://localhost:8181/dirs/d1/files/f1$meta
+defaultversionid: "1"
+defaultversionurl: http://localhost:8181/dirs/d1/files/f1/versions/1$meta
+createdat: "2024-01-01T12:00:01Z"
+modifiedat: "2024-01-01T12:00:02Z"
+contenttype: application/yaml
+contentdigest: sha256:`+registry.ContentDigest([]byte(doc))[7:]+`
+filebase64: IyBteSBzY2hlbWEKdHlwZTogb2JqZWN0Cg==
+versionscount: 1
+versionsurl: http://localhost:8181/dirs/d1/files/f1/versions
+`)
+
+	// Collections too
+	xYAML(t, reg, "GET", "/dirs", yamlOut, "", 200, "application/yaml", "*")
+
+	// Errors aren't converted
+	xYAML(t, reg, "PUT", "/dirs/d2", yamlBoth, "name: [oops\n", 400,
+		"text/plain; charset=utf-8",
+		"YAML error at line 1: did not find expected ',' or ']'\n")
+	xYAML(t, reg, "GET", "/dirs/d9", yamlOut, "", 404,
+		"text/plain; charset=utf-8", "Not found\n")
+
+	// Aliases can't be used to blow up the size of a request
+	bomb := "a0: &a0 [x, x, x, x, x, x, x, x, x, x]\n"
+	for i := 1; i <= 6; i++ {
+		bomb += fmt.Sprintf("a%d: &a%d [*a%d, *a%d, *a%d, *a%d, *a%d, *a%d, "+
+			"*a%d, *a%d, *a%d, *a%d]\n", i, i, i-1, i-1, i-1, i-1, i-1,
+			i-1, i-1, i-1, i-1, i-1)
+	}
+	xYAML(t, reg, "PUT", "/dirs/d2", yamlIn, bomb, 400,
+		"text/plain; charset=utf-8",
+		"YAML error at line 5: too many nodes (more than 100000) once the "+
+			"aliases are expanded\n")
+
+	// The JSON and YAML representations have their own ETags, and caches
+	// need to know that the response depends on the "Accept" header
+	etags := map[string]bool{}
+	for _, accept := range []string{"", "application/yaml"} {
+		req, err := http.NewRequest("GET", "http://localhost:8181/dirs/d1",
+			nil)
+		xNoErr(t, err)
+		req.Header.Add("Accept", accept)
+		res, err := http.DefaultClient.Do(req)
+		xNoErr(t, err)
+		res.Body.Close()
+		xCheckEqual(t, "Vary", res.Header.Get("Vary"), "Accept")
+
+		etag := res.Header.Get("ETag")
+		xCheck(t, etag != "" && !etags[etag], "Bad ETag: %q", etag)
+		etags[etag] = true
+
+		req.Header.Add("If-None-Match", etag)
+		res, err = http.DefaultClient.Do(req)
+		xNoErr(t, err)
+		res.Body.Close()
+		xCheckEqual(t, "", res.StatusCode, 304)
+	}
+}